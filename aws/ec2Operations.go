@@ -2,6 +2,7 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	"github.com/jrottersman/lats/state"
 )
 
@@ -18,6 +20,7 @@ type Ec2Client interface {
 	AuthorizeSecurityGroupEgress(ctx context.Context, params *ec2.AuthorizeSecurityGroupEgressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupEgressOutput, error)
 	DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error)
 	AuthorizeSecurityGroupIngress(ctx context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error)
+	RevokeSecurityGroupEgress(ctx context.Context, params *ec2.RevokeSecurityGroupEgressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupEgressOutput, error)
 	DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error)
 	DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error)
 	DescribeInternetGateways(ctx context.Context, params *ec2.DescribeInternetGatewaysInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInternetGatewaysOutput, error)
@@ -87,10 +90,10 @@ func (c *EC2Instances) CreateSG(i CreateSGInput) (*ec2.CreateSecurityGroupOutput
 		}
 
 		groups, err := c.Client.DescribeSecurityGroups(ctx, &describe)
-		if err != nil {
+		if err != nil && !isGroupNotFound(err) {
 			return nil, err
 		}
-		if len(groups.SecurityGroups) > 0 {
+		if groups != nil && len(groups.SecurityGroups) > 0 {
 			slog.Info("Security group alread exists skipping creation")
 			return nil, nil
 		}
@@ -109,6 +112,75 @@ func (c *EC2Instances) CreateSG(i CreateSGInput) (*ec2.CreateSecurityGroupOutput
 	return output, nil
 }
 
+// isGroupNotFound checks if describe failed because the group doesn't exist which is expected when restoring into a new region
+func isGroupNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode() == "InvalidGroup.NotFound"
+	}
+	return false
+}
+
+// SGIngressRules authorizes ingress rules we stored when the stack was created on a security group
+func (c *EC2Instances) SGIngressRules(groupID string, rules []state.SGRuleStorage) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	params := ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       &groupID,
+		IpPermissions: state.SgRuleStoragesToIpPermissions(rules),
+	}
+
+	output, err := c.Client.AuthorizeSecurityGroupIngress(ctx, &params)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// SGEgressRules replaces the allow all egress rule a new security group gets with the egress rules we stored when the stack was created
+func (c *EC2Instances) SGEgressRules(groupID string, rules []state.SGRuleStorage) (*ec2.AuthorizeSecurityGroupEgressOutput, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	_, err := c.Client.RevokeSecurityGroupEgress(ctx, &ec2.RevokeSecurityGroupEgressInput{
+		GroupId: &groupID,
+		IpPermissions: []types.IpPermission{{
+			IpProtocol: aws.String("-1"),
+			IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+		}},
+	})
+	if err != nil && !isPermissionNotFound(err) {
+		return nil, err
+	}
+
+	params := ec2.AuthorizeSecurityGroupEgressInput{
+		GroupId:       &groupID,
+		IpPermissions: state.SgRuleStoragesToIpPermissions(rules),
+	}
+
+	output, err := c.Client.AuthorizeSecurityGroupEgress(ctx, &params)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// isPermissionNotFound checks if revoking failed because the group doesn't have the rule
+func isPermissionNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode() == "InvalidPermission.NotFound"
+	}
+	return false
+}
+
 // SGIngress updates a security group with ingress ips
 func (c *EC2Instances) SGIngress(sgname string, s []PassedIPs) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
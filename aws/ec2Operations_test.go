@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -371,3 +372,19 @@ func TestGetSubnet(t *testing.T) {
 
 	assert.Equal(t, "subnet-0123456789abcdef0", *output.Subnets[0].SubnetId)
 }
+
+func TestEC2Instances_SGIngressRules(t *testing.T) {
+	c := &EC2Instances{Client: mock.EC2Client{}}
+	got, err := c.SGIngressRules("foo", nil)
+	if err != nil || got != nil {
+		t.Errorf("EC2Instances.SGIngressRules() with no rules = %v, %v", got, err)
+	}
+	rules := []state.SGRuleStorage{{FromPort: aws.Int32(22), ToPort: aws.Int32(22), IPProtocol: aws.String("tcp")}}
+	got, err = c.SGIngressRules("foo", rules)
+	if err != nil {
+		t.Errorf("EC2Instances.SGIngressRules() error = %v", err)
+	}
+	if got == nil || !*got.Return {
+		t.Errorf("EC2Instances.SGIngressRules() = %v, want a successful return", got)
+	}
+}
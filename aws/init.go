@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 // Init creates an RDS Client
@@ -37,6 +38,14 @@ func InitEc2(region string) EC2Instances {
 	}
 }
 
+// InitSts creates an STS client
+func InitSts(region string) StsOperations {
+	cfg := createConfig(region)
+	return StsOperations{
+		Client: sts.NewFromConfig(cfg),
+	}
+}
+
 func getRDSClient(cfg aws.Config) *rds.Client {
 	return rds.NewFromConfig(cfg)
 }
@@ -49,8 +58,15 @@ func getEC2Client(cfg aws.Config) *ec2.Client {
 	return ec2.NewFromConfig(cfg)
 }
 
+// Profile is the shared config profile clients are created with, the default credential chain is used when it's empty
+var Profile string
+
 func createConfig(region string) aws.Config {
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(Profile))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		panic("configuration error, " + err.Error())
 	}
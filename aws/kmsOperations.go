@@ -5,13 +5,18 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jrottersman/lats/state"
 )
 
 // KmsClient type for mocks
 type KmsClient interface {
 	CreateKey(ctx context.Context, params *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error)
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+	DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
 }
 
 // KmsOperations struct with the KmsClient
@@ -19,6 +24,8 @@ type KmsOperations struct {
 	Client KmsClient
 }
 
+var _ state.DataKeys = KmsOperations{}
+
 // KmsConfig descripes our KmsConfig and they way it works
 type KmsConfig struct {
 	Description *string
@@ -42,6 +49,37 @@ func (k KmsOperations) CreateKMSKey(cfg *KmsConfig) (*types.KeyMetadata, error)
 	return output.KeyMetadata, nil
 }
 
+// GenerateDataKey creates a 256 bit data key under keyID, it returns the plaintext key and the key encrypted by KMS
+func (k KmsOperations) GenerateDataKey(keyID string) ([]byte, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	output, err := k.Client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		slog.Warn("Error generating data key", "key", keyID, "error", err)
+		return nil, nil, err
+	}
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+// Decrypt decrypts a data key that was encrypted under keyID
+func (k KmsOperations) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	input := &kms.DecryptInput{CiphertextBlob: ciphertext}
+	if keyID != "" {
+		input.KeyId = aws.String(keyID)
+	}
+	output, err := k.Client.Decrypt(ctx, input)
+	if err != nil {
+		slog.Warn("Error decrypting data key", "key", keyID, "error", err)
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
+
 func handleKmsConfig(k KmsConfig) *kms.CreateKeyInput {
 	input := kms.CreateKeyInput{}
 	if k.Description != nil {
@@ -55,3 +93,15 @@ func handleKmsConfig(k KmsConfig) *kms.CreateKeyInput {
 	}
 	return &input
 }
+
+// MultiRegion reports whether keyID, which can be an alias, is a Multi-Region key that can be replicated to other regions
+func (k KmsOperations) MultiRegion(keyID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	output, err := k.Client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		slog.Warn("Error describing key", "key", keyID, "error", err)
+		return false, err
+	}
+	return aws.ToBool(output.KeyMetadata.MultiRegion), nil
+}
@@ -1,15 +1,19 @@
 package aws
 
 import (
+	"bytes"
 	"context"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	mock "github.com/jrottersman/lats/mocks"
 )
 
-type mockKMSClient struct{}
+type mockKMSClient struct {
+	*mock.KmsClient
+}
 
 func (m mockKMSClient) CreateKey(ctx context.Context, params *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error) {
 	kid := "foobar"
@@ -22,7 +26,7 @@ func (m mockKMSClient) CreateKey(ctx context.Context, params *kms.CreateKeyInput
 }
 
 func TestCreateKMSKey(t *testing.T) {
-	c := mockKMSClient{}
+	c := mockKMSClient{mock.NewKmsClient()}
 	kmsOp := KmsOperations{
 		Client: c,
 	}
@@ -56,3 +60,47 @@ func TestHandleKmsConfig(t *testing.T) {
 		t.Errorf("policy should be %s got %s", policy, *keyInput.Policy)
 	}
 }
+
+func TestDataKeys(t *testing.T) {
+	kmsOp := KmsOperations{Client: mock.NewKmsClient("alias/lats")}
+	key, encKey, err := kmsOp.GenerateDataKey("alias/lats")
+	if err != nil {
+		t.Fatalf("GenerateDataKey() error = %v", err)
+	}
+	if len(key) != 32 {
+		t.Errorf("got a %d byte key expected 32", len(key))
+	}
+	got, err := kmsOp.Decrypt("alias/lats", encKey)
+	if err != nil || !bytes.Equal(got, key) {
+		t.Errorf("Decrypt() = %x, %v want %x", got, err, key)
+	}
+	_, err = kmsOp.Decrypt("alias/other", encKey)
+	if err == nil {
+		t.Errorf("expected an error decrypting with the wrong key")
+	}
+	_, _, err = kmsOp.GenerateDataKey("alias/missing")
+	if err == nil {
+		t.Errorf("expected an error generating a data key with a key that doesn't exist")
+	}
+}
+
+func TestMultiRegion(t *testing.T) {
+	kmsOp := KmsOperations{Client: mock.NewKmsClient("alias/lats", "mrk-1234")}
+	tests := []struct {
+		key     string
+		want    bool
+		wantErr bool
+	}{
+		{"alias/lats", false, false},
+		{"mrk-1234", true, false},
+		{"alias/missing", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := kmsOp.MultiRegion(tt.key)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("MultiRegion() = %v, %v want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Types of things lats can report progress on
+const (
+	SnapshotProgress        = "DBSnapshot"
+	ClusterSnapshotProgress = "DBClusterSnapshot"
+	InstanceProgress        = "DBInstance"
+	ClusterProgress         = "DBCluster"
+)
+
+// ErrProgressNotFound is returned when there's nothing to report progress on
+var ErrProgressNotFound = errors.New("not found")
+
+// ErrWaitTimeout is returned when something still isn't available or failed when the wait is over
+var ErrWaitTimeout = errors.New("timed out waiting")
+
+// failedStatuses are the statuses snapshots, instances and clusters don't come back from on their own
+var failedStatuses = []string{
+	"failed",
+	"deleting",
+	"deleted",
+	"incompatible-restore",
+	"incompatible-parameters",
+	"incompatible-network",
+	"incompatible-option-group",
+	"incompatible-credentials",
+	"inaccessible-encryption-credentials",
+	"restore-error",
+	"storage-full",
+}
+
+// Progress is how far along a snapshot, snapshot copy or restored database is
+type Progress struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id"`
+	Region  string    `json:"region,omitempty"` // Region is set by callers, DbInstances doesn't know its region
+	Status  string    `json:"status"`
+	Percent *int32    `json:"percent,omitempty"` // Percent is only reported for snapshots
+	Started time.Time `json:"started,omitzero"`
+}
+
+// Available is true when it's ready to use
+func (p Progress) Available() bool {
+	return p.Status == "available"
+}
+
+// Failed is true when it's never going to be available
+func (p Progress) Failed() bool {
+	return slices.Contains(failedStatuses, p.Status)
+}
+
+// Done is true when there's no point waiting any longer
+func (p Progress) Done() bool {
+	return p.Available() || p.Failed()
+}
+
+// ETA extrapolates from how long it took to get to Percent, it's zero when there's nothing to go on
+func (p Progress) ETA(now time.Time) time.Duration {
+	if p.Done() || p.Percent == nil || *p.Percent <= 0 || *p.Percent >= 100 || p.Started.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(p.Started)
+	if elapsed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * float64(100-*p.Percent) / float64(*p.Percent)).Round(time.Second)
+}
+
+// GetProgress describes the snapshot or database of type progressType called id, it's ErrProgressNotFound when there isn't one
+func (instances *DbInstances) GetProgress(progressType string, id string) (Progress, error) {
+	p := Progress{Type: progressType, ID: id}
+	switch progressType {
+	case SnapshotProgress:
+		snap, err := instances.GetSnapshot(id)
+		if err != nil {
+			return p, err
+		}
+		if snap == nil {
+			return p, fmt.Errorf("snapshot %s: %w", id, ErrProgressNotFound)
+		}
+		p.Status, p.Percent, p.Started = toString(snap.Status), snap.PercentProgress, toTime(snap.SnapshotCreateTime)
+	case ClusterSnapshotProgress:
+		snap, err := instances.GetClusterSnapshot(id)
+		if err != nil {
+			return p, err
+		}
+		if snap == nil {
+			return p, fmt.Errorf("cluster snapshot %s: %w", id, ErrProgressNotFound)
+		}
+		p.Status, p.Percent, p.Started = toString(snap.Status), snap.PercentProgress, toTime(snap.SnapshotCreateTime)
+	case InstanceProgress:
+		db, err := instances.GetInstance(id)
+		if err != nil {
+			return p, err
+		}
+		if db == nil {
+			return p, fmt.Errorf("instance %s: %w", id, ErrProgressNotFound)
+		}
+		p.Status, p.Started = toString(db.DBInstanceStatus), toTime(db.InstanceCreateTime)
+	case ClusterProgress:
+		c, err := instances.GetCluster(id)
+		if err != nil {
+			return p, err
+		}
+		if c == nil {
+			return p, fmt.Errorf("cluster %s: %w", id, ErrProgressNotFound)
+		}
+		p.Status, p.Started = toString(c.Status), toTime(c.ClusterCreateTime)
+	default:
+		return p, fmt.Errorf("can't report progress on a %s", progressType)
+	}
+	return p, nil
+}
+
+// WaitForProgress checks on the snapshot or database every interval until it's available or failed.
+// A timeout of zero waits forever, when it runs out the last progress is returned with ErrWaitTimeout. report is called with every check and can be nil
+func (instances *DbInstances) WaitForProgress(progressType string, id string, interval time.Duration, timeout time.Duration, report func(Progress)) (Progress, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		p, err := instances.GetProgress(progressType, id)
+		if err != nil {
+			return p, err
+		}
+		if report != nil {
+			report(p)
+		}
+		if p.Done() {
+			return p, nil
+		}
+		sleep := interval
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return p, fmt.Errorf("%s %s is still %s: %w", progressType, id, p.Status, ErrWaitTimeout)
+			}
+			sleep = min(sleep, left)
+		}
+		time.Sleep(sleep)
+	}
+}
+
+func toString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func toTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
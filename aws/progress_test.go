@@ -0,0 +1,134 @@
+package aws
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	mock "github.com/jrottersman/lats/mocks"
+)
+
+func TestProgressETA(t *testing.T) {
+	now := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	started := now.Add(-30 * time.Minute)
+	tests := []struct {
+		name string
+		p    Progress
+		want time.Duration
+	}{
+		{"quarter done", Progress{Status: "creating", Percent: aws.Int32(25), Started: started}, 90 * time.Minute},
+		{"half done", Progress{Status: "copying", Percent: aws.Int32(50), Started: started}, 30 * time.Minute},
+		{"not started", Progress{Status: "creating", Percent: aws.Int32(0), Started: started}, 0},
+		{"no percent", Progress{Status: "creating", Started: started}, 0},
+		{"no start", Progress{Status: "creating", Percent: aws.Int32(50)}, 0},
+		{"available", Progress{Status: "available", Percent: aws.Int32(50), Started: started}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.ETA(now); got != tt.want {
+				t.Errorf("ETA() = %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgressDone(t *testing.T) {
+	tests := []struct {
+		status    string
+		available bool
+		failed    bool
+	}{
+		{"available", true, false},
+		{"creating", false, false},
+		{"backing-up", false, false},
+		{"failed", false, true},
+		{"incompatible-restore", false, true},
+		{"deleted", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			p := Progress{Status: tt.status}
+			if p.Available() != tt.available || p.Failed() != tt.failed || p.Done() != (tt.available || tt.failed) {
+				t.Errorf("%s got available %v failed %v done %v", tt.status, p.Available(), p.Failed(), p.Done())
+			}
+		})
+	}
+}
+
+func TestGetProgress(t *testing.T) {
+	started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := mock.ProgressRDSClient{Snapshot: "snap", ClusterSnapshot: "csnap", Instance: "db", Cluster: "aurora", Statuses: []string{"creating"}, Percent: 40, Started: started}
+	tests := []struct {
+		name         string
+		progressType string
+		id           string
+		wantPercent  bool
+		wantErr      error
+	}{
+		{"snapshot", SnapshotProgress, "snap", true, nil},
+		{"cluster snapshot", ClusterSnapshotProgress, "csnap", true, nil},
+		{"instance", InstanceProgress, "db", false, nil},
+		{"cluster", ClusterProgress, "aurora", false, nil},
+		{"missing snapshot", SnapshotProgress, "nope", false, ErrProgressNotFound},
+		{"missing cluster", ClusterProgress, "nope", false, ErrProgressNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbi := DbInstances{RdsClient: client}
+			p, err := dbi.GetProgress(tt.progressType, tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetProgress() error = %v want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Type != tt.progressType || p.ID != tt.id || p.Status != "creating" || (p.Percent != nil) != tt.wantPercent {
+				t.Errorf("GetProgress() = %+v", p)
+			}
+			if tt.wantPercent && (*p.Percent != 40 || !p.Started.Equal(started)) {
+				t.Errorf("GetProgress() percent %d started %v", *p.Percent, p.Started)
+			}
+		})
+	}
+	dbi := DbInstances{RdsClient: client}
+	if _, err := dbi.GetProgress("Stack", "snap"); err == nil {
+		t.Errorf("expected an error for a type with no progress")
+	}
+}
+
+func TestWaitForProgress(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []string
+		timeout    time.Duration
+		wantStatus string
+		wantErr    error
+		wantChecks int
+	}{
+		{"available", []string{"creating", "creating", "available"}, 0, "available", nil, 3},
+		{"failed", []string{"creating", "failed"}, 0, "failed", nil, 2},
+		{"timeout", []string{"creating"}, 5 * time.Millisecond, "creating", ErrWaitTimeout, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			dbi := DbInstances{RdsClient: mock.ProgressRDSClient{Snapshot: "snap", Statuses: tt.statuses, Calls: &calls}}
+			checks := 0
+			p, err := dbi.WaitForProgress(SnapshotProgress, "snap", time.Millisecond, tt.timeout, func(Progress) { checks++ })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WaitForProgress() error = %v want %v", err, tt.wantErr)
+			}
+			if p.Status != tt.wantStatus {
+				t.Errorf("WaitForProgress() status = %s want %s", p.Status, tt.wantStatus)
+			}
+			if tt.wantChecks != 0 && checks != tt.wantChecks {
+				t.Errorf("WaitForProgress() checked %d times want %d", checks, tt.wantChecks)
+			}
+		})
+	}
+	dbi := DbInstances{RdsClient: mock.ProgressRDSClient{}}
+	if _, err := dbi.WaitForProgress(SnapshotProgress, "snap", time.Millisecond, 0, nil); !errors.Is(err, ErrProgressNotFound) {
+		t.Errorf("WaitForProgress() error = %v want %v", err, ErrProgressNotFound)
+	}
+}
@@ -5,15 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	"github.com/aws/aws-sdk-go-v2/service/rds/types"
-	"github.com/jrottersman/lats/pgstate"
 	"github.com/jrottersman/lats/stack"
-	"github.com/jrottersman/lats/state"
 )
 
 // MaxConcurrentJobs max number of operations to hit AWS with at the same time
@@ -44,6 +41,8 @@ type Client interface {
 	CopyDBClusterSnapshot(ctx context.Context, params *rds.CopyDBClusterSnapshotInput, optFns ...func(*rds.Options)) (*rds.CopyDBClusterSnapshotOutput, error)
 	RestoreDBClusterFromSnapshot(ctx context.Context, params *rds.RestoreDBClusterFromSnapshotInput, optFns ...func(*rds.Options)) (*rds.RestoreDBClusterFromSnapshotOutput, error)
 	RestoreDBInstanceFromDBSnapshot(ctx context.Context, params *rds.RestoreDBInstanceFromDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error)
+	DeleteDBSnapshot(ctx context.Context, params *rds.DeleteDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.DeleteDBSnapshotOutput, error)
+	DeleteDBClusterSnapshot(ctx context.Context, params *rds.DeleteDBClusterSnapshotInput, optFns ...func(*rds.Options)) (*rds.DeleteDBClusterSnapshotOutput, error)
 }
 
 // DbInstances holds our RDS client that allows for operations in AWS
@@ -94,6 +93,66 @@ func (instances *DbInstances) GetCluster(clusterName string) (*types.DBCluster,
 	return &output.DBClusters[0], err
 }
 
+// GetSnapshot describes an instance snapshot, manual, automated and shared snapshots all work. It's nil when there's no snapshot called id
+func (instances *DbInstances) GetSnapshot(id string) (*types.DBSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	output, err := instances.RdsClient.DescribeDBSnapshots(ctx, &rds.DescribeDBSnapshotsInput{
+		DBSnapshotIdentifier: aws.String(id),
+	})
+	var notFoundError *types.DBSnapshotNotFoundFault
+	if errors.As(err, &notFoundError) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range output.DBSnapshots {
+		if aws.ToString(v.DBSnapshotIdentifier) == id || aws.ToString(v.DBSnapshotArn) == id {
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetClusterSnapshot describes a cluster snapshot, it's nil when there's no snapshot called id
+func (instances *DbInstances) GetClusterSnapshot(id string) (*types.DBClusterSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	output, err := instances.RdsClient.DescribeDBClusterSnapshots(ctx, &rds.DescribeDBClusterSnapshotsInput{
+		DBClusterSnapshotIdentifier: aws.String(id),
+	})
+	var notFoundError *types.DBClusterSnapshotNotFoundFault
+	if errors.As(err, &notFoundError) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range output.DBClusterSnapshots {
+		if aws.ToString(v.DBClusterSnapshotIdentifier) == id || aws.ToString(v.DBClusterSnapshotArn) == id {
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteSnapshot deletes an instance or cluster snapshot, deleting a copy that's still copying is how AWS cancels it
+func (instances *DbInstances) DeleteSnapshot(id string, cluster bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if cluster {
+		_, err := instances.RdsClient.DeleteDBClusterSnapshot(ctx, &rds.DeleteDBClusterSnapshotInput{
+			DBClusterSnapshotIdentifier: aws.String(id),
+		})
+		return err
+	}
+	_, err := instances.RdsClient.DeleteDBSnapshot(ctx, &rds.DeleteDBSnapshotInput{
+		DBSnapshotIdentifier: aws.String(id),
+	})
+	return err
+}
+
 // GetInstancesFromCluster get's the instaces associated with a database cluster
 func (instances *DbInstances) GetInstancesFromCluster(c *types.DBCluster) ([]types.DBInstance, error) {
 	if c.DBClusterMembers == nil {
@@ -147,183 +206,33 @@ type CreateClusterFromStackInput struct {
 	S             *stack.Stack
 	ClusterName   *string
 	DBSubnetGroup *string
-	ec2Client     *EC2Instances
+	Ec2Client     *EC2Instances
 	VpcID         *string
 	Ingress       []PassedIPs
 	Egress        []PassedIPs
+	Created       func(progressType string, id string) // Created is called with each cluster and instance AWS has started creating, it can be nil
 }
 
-// CreateClusterFromStack creates an RDS cluster from a stack
+// CreateClusterFromStack starts creating an RDS cluster from a stack, WaitForProgress waits for it to be available
 func (instances *DbInstances) CreateClusterFromStack(c CreateClusterFromStackInput) error {
-	first := c.S.Objects[1]
-	var pgName *string
-	var pgExists bool
-	if len(first) < 1 {
-		slog.Info("skipping the parameter set")
-	} else {
-		for _, p := range first {
-			pb := p.ReadObject()
-			switch pb.(type) {
-			case *state.SecurityGroupOutput:
-				sgs, ok := pb.(*state.SecurityGroupOutput)
-				if !ok {
-					slog.Error("error casting security group")
-					return fmt.Errorf("type error security group")
-				}
-				for _, v := range sgs.SecurityGroups {
-					input := CreateSGInput{
-						description: v.Description,
-						groupName:   v.GroupName,
-						vpcID:       c.VpcID,
-						groupID:     v.GroupId,
-					}
-					_, err := c.ec2Client.CreateSG(input)
-					if err != nil {
-						slog.Error("creating SG", "error", err)
-						return fmt.Errorf("creating security group error")
-					}
-					if len(c.Ingress) > 0 {
-						c.ec2Client.SGIngress(*v.GroupName, c.Ingress)
-					}
-					if len(c.Egress) > 0 {
-						c.ec2Client.SGEgress(*v.GroupName, c.Egress)
-					}
-				}
-			case *pgstate.ParameterGroup:
-				pg, ok := pb.(*pgstate.ParameterGroup)
-				if !ok {
-					slog.Error("error casting to parameter group")
-					return fmt.Errorf("type Error parameter group")
-				}
-				pgName = pg.ClusterParameterGroup.DBClusterParameterGroupName
-				_, err := instances.GetParameterGroup(*pgName)
-				if err != nil {
-					pgExists = true
-					slog.Info("parameter group exists hopefully we should do better error handling", "error", err)
-					continue
-				} else {
-					slog.Info("creating parameter group", "name", *pgName)
-					_, err = instances.CreateClusterParameterGroup(&pg.ClusterParameterGroup)
-					if err != nil {
-						return err
-					}
-					batchSize := 20
-					params := pg.Params
-					batches := make([][]types.Parameter, 0, (len(params)+batchSize-1)/batchSize)
-					for batchSize < len(params) {
-						params, batches = params[batchSize:], append(batches, params[0:batchSize:batchSize])
-					}
-					batches = append(batches, params)
-					for _, b := range batches {
-						err = instances.ModifyClusterParameterGroup(*pg.ClusterParameterGroup.DBClusterParameterGroupName, b)
-						if err != nil {
-							return err
-						}
-					}
-				}
-			case *types.OptionGroup:
-				og, ok := pb.(*types.OptionGroup)
-				if !ok {
-					slog.Error("getting option group")
-				}
-				slog.Info("restoring option group")
-				_, err := instances.RestoreOptionGroup(*og.EngineName, *og.MajorEngineVersion, *og.OptionGroupName, *og.OptionGroupDescription)
-				if err != nil {
-					return fmt.Errorf("error creating option group %s", err)
-				}
-				optConfigs := optionsToConfiguration(og.Options)
-				err = instances.ModifyOptionGroup(*og.OptionGroupName, optConfigs)
-				if err != nil {
-					slog.Warn("error modifying option group", "error", err)
-				}
-			}
-		}
-		//Wait five minutes for parameter sets per aws docs
-		if !pgExists {
-			for i := 0; i < 10; i++ {
-				slog.Info("waiting for five minutes for Parameter group per AWS documentation", "seconds", 30*i)
-				time.Sleep(30 * time.Second)
-			}
-		}
-	}
-
-	// get the one which is the cluster and create it
-	var engineVersion *string
-	second := c.S.Objects[2]
-	if len(second) != 1 {
+	if len(c.S.ObjectsOfType(stack.Cluster)) != 1 {
 		slog.Error("Multiple clusters and there should only be one")
 		return fmt.Errorf("multiple clusters and there should only be one")
 	}
-	for _, v := range second {
-		b := v.ReadObject()
-		dbi, ok := b.(*rds.RestoreDBClusterFromSnapshotInput)
-		if !ok {
-			slog.Error("Can't read cluster object")
-		}
-		if pgName != nil {
-			dbi.DBClusterParameterGroupName = pgName
-		}
-		dbi.DBSubnetGroupName = c.DBSubnetGroup
-		slog.Info("subnet group is called ", "subnet", *dbi.DBSubnetGroupName)
-		if c.ClusterName != nil {
-			slog.Info("creating cluster", "ClusterName", *c.ClusterName)
-			dbi.DBClusterIdentifier = c.ClusterName
-		}
-		cl, err := instances.RestoreSnapshotCluster(*dbi) // we might need to do something with the output in which case this changes
-		engineVersion = cl.DBCluster.EngineVersion
-		if err != nil {
-			return err
-		}
-	}
-
-	// get three which is the instances create them in parallel
-	third := c.S.Objects[3]
-	slog.Info("Starting restore cluster instances")
-	var wg sync.WaitGroup
-	for _, i := range third {
-		slog.Info("inside the for loop for restore instances")
-		wg.Add(1)
-		go func(inst stack.Object, wg *sync.WaitGroup) {
-			defer wg.Done()
-			slog.Info("Creating Instance")
-			o := inst.ReadObject()
-			if o == nil {
-				slog.Error("object from instance is nil")
-				return
-			}
-			ins, ok := o.(*rds.CreateDBInstanceInput)
-			if !ok {
-				slog.Error("failed to cast to createDBInstanceInput")
-				return
-			}
-			ins.DBSubnetGroupName = c.DBSubnetGroup
-			ins.DBClusterIdentifier = c.ClusterName
-			ins.EngineVersion = engineVersion
-			_, err := instances.RestoreInstanceForCluster(*ins)
-			if err != nil {
-				slog.Error("error creating instance", "error", err)
-			}
-		}(i, &wg)
-	}
-	wg.Wait()
-	counter := 0
-	for {
-		status, err := instances.getClusterStatus(*c.ClusterName)
-		if err != nil {
-			return err
-		}
-		if *status == "availaible" {
-			slog.Info("Status is ", "status", *status)
-			break
-		}
-		counter++
-		if counter == 20 {
-			slog.Error("cluster not avaible after 10 minutes")
-			break
-		}
-		time.Sleep(30 * time.Second)
+	slog.Info("Starting restore cluster")
+	err := instances.restoreStack(*c.S, restoreInput{
+		name:          c.ClusterName,
+		dbSubnetGroup: c.DBSubnetGroup,
+		ec2Client:     c.Ec2Client,
+		vpcID:         c.VpcID,
+		ingress:       c.Ingress,
+		egress:        c.Egress,
+		created:       c.Created,
+	})
+	if err != nil {
+		return err
 	}
-	slog.Info("Restored cluster instances")
+	slog.Info("Started restoring the cluster and its instances")
 	return nil
 }
 
@@ -332,146 +241,31 @@ type CreateInstanceFromStackInput struct {
 	Stack         *stack.Stack
 	DBName        *string
 	DBSubnetGroup *string
-	ec2Client     *EC2Instances
+	Ec2Client     *EC2Instances
 	VpcID         *string
 	Ingress       []PassedIPs
 	Egress        []PassedIPs
+	Created       func(progressType string, id string) // Created is called with each cluster and instance AWS has started creating, it can be nil
 }
 
-// CreateInstanceFromStack creates an RDS instance from a stack object
+// CreateInstanceFromStack starts creating an RDS instance from a stack object, WaitForProgress waits for it to be available
 func (instances *DbInstances) CreateInstanceFromStack(c CreateInstanceFromStackInput) error {
-	pgs := c.Stack.Objects[1]
-	var pgName *string
-	var pgExists bool
-	if len(pgs) == 0 {
-		slog.Info("No parameter groups using the default parameter group")
-	} else {
-		for _, p := range pgs {
-			pb := p.ReadObject()
-			switch pb.(type) {
-			case *state.SecurityGroupOutput:
-				sgs, ok := pb.(*state.SecurityGroupOutput)
-				if !ok {
-					slog.Error("error casting security group")
-					return fmt.Errorf("type error security group")
-				}
-				for _, v := range sgs.SecurityGroups {
-					input := CreateSGInput{
-						description: v.Description,
-						groupName:   v.GroupName,
-						vpcID:       c.VpcID,
-						groupID:     v.GroupId,
-					}
-					_, err := c.ec2Client.CreateSG(input)
-					if err != nil {
-						slog.Error("error creating security group", "error", err)
-						return fmt.Errorf("error creating security group")
-					}
-					if len(c.Ingress) > 0 {
-						slog.Info("updating ingress rules")
-						c.ec2Client.SGIngress(*v.GroupName, c.Ingress)
-					}
-					if len(c.Egress) > 0 {
-						slog.Info("updating egress rules")
-						c.ec2Client.SGEgress(*v.GroupName, c.Egress)
-					}
-				}
-			case *pgstate.ParameterGroup:
-				pg, ok := pb.(*pgstate.ParameterGroup)
-				if !ok {
-					slog.Error("Could not decode parameter group")
-				}
-				pgName = pg.ParameterGroup.DBParameterGroupName
-				_, err := instances.GetParameterGroup(*pgName)
-				if err != nil {
-					slog.Info("hopefully pg exists", "error", err)
-					pgExists = true
-					continue
-				} else {
-					_, err = instances.CreateParameterGroup(&pg.ParameterGroup)
-					if err != nil {
-						return err
-					}
-					batchSize := 20
-					params := pg.Params
-					batches := make([][]types.Parameter, 0, (len(params)+batchSize-1)/batchSize)
-					for batchSize < len(params) {
-						params, batches = params[batchSize:], append(batches, params[0:batchSize:batchSize])
-					}
-					batches = append(batches, params)
-					for _, b := range batches {
-						err = instances.ModifyParameterGroup(*pg.ParameterGroup.DBParameterGroupName, b)
-						if err != nil {
-							return err
-						}
-					}
-				}
-			case *types.OptionGroup:
-				og, ok := pb.(*types.OptionGroup)
-				if !ok {
-					slog.Error("Could not decode option group")
-				}
-				_, err := instances.RestoreOptionGroup(*og.EngineName, *og.MajorEngineVersion, *og.OptionGroupName, *og.OptionGroupDescription)
-				if err != nil {
-					slog.Warn("failed to restore option group", "error", err)
-				}
-				optConfigs := optionsToConfiguration(og.Options)
-				err = instances.ModifyOptionGroup(*og.OptionGroupName, optConfigs)
-				if err != nil {
-					slog.Warn("error modifying option group", "Error", err)
-				}
-			}
-		}
-		if !pgExists {
-			// Sleep for 5 minutes per AWS documentation to wait for a parameter group to be ready
-			for i := 0; i < 10; i++ {
-				slog.Info("waiting for five minutes for Parameter group per AWS documentation", "seconds", 30*i)
-				time.Sleep(30 * time.Second)
-			}
-		}
-	}
-
-	instance := c.Stack.Objects[2]
 	slog.Info("starting to restore the instance")
-	if len(instance) != 1 {
+	if len(c.Stack.ObjectsOfType(stack.LoneInstance)) != 1 {
 		slog.Error("No instances")
 		return fmt.Errorf("there should only be a single instance")
 	}
-	for _, v := range instance {
-		b := v.ReadObject()
-		ins := b.(*rds.RestoreDBInstanceFromDBSnapshotInput)
-		if pgName != nil {
-			ins.DBParameterGroupName = pgName
-		}
-		if c.DBName != nil {
-			ins.DBInstanceIdentifier = c.DBName
-		}
-		if c.DBSubnetGroup != nil {
-			ins.DBSubnetGroupName = c.DBSubnetGroup
-		}
-		_, err := instances.RestoreSnapshotInstance(*ins)
-		if err != nil {
-			slog.Error("failed to restore the instance", "error", err)
-			return err
-		}
-		slog.Info("Database creation in progress")
-	}
-	counter := 0
-	for {
-		status, err := instances.GetInstance(*c.DBName)
-		if err != nil {
-			return err
-		}
-		if *status.DBInstanceStatus == "availaible" {
-			slog.Info("Status is ", "status", *status.DBInstanceStatus)
-			break
-		}
-		counter++
-		if counter == 20 {
-			slog.Error("cluster not avaible after 10 minutes")
-			break
-		}
-		time.Sleep(30 * time.Second)
+	err := instances.restoreStack(*c.Stack, restoreInput{
+		name:          c.DBName,
+		dbSubnetGroup: c.DBSubnetGroup,
+		ec2Client:     c.Ec2Client,
+		vpcID:         c.VpcID,
+		ingress:       c.Ingress,
+		egress:        c.Egress,
+		created:       c.Created,
+	})
+	if err != nil {
+		return err
 	}
 	return nil
 }
@@ -593,7 +387,7 @@ func (instances *DbInstances) RestoreOptionGroup(EngineName string, MajorEngineV
 	}
 	out, err := instances.RdsClient.CreateOptionGroup(ctx, &input)
 	if err != nil {
-		return nil, fmt.Errorf("restore option group had an error %s", err)
+		return nil, fmt.Errorf("restore option group had an error %w", err)
 	}
 	return out, nil
 }
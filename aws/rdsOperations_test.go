@@ -28,6 +28,37 @@ func TestGetCluster(t *testing.T) {
 		t.Errorf("got %s expected %s", *resp.DBClusterIdentifier, expected)
 	}
 }
+func TestGetSnapshot(t *testing.T) {
+	dbi := DbInstances{RdsClient: mock.MockRDSClient{}}
+	tests := []struct {
+		name    string
+		id      string
+		cluster bool
+		found   bool
+	}{
+		{"instance", "foo", false, true},
+		{"instance missing", "bar", false, false},
+		{"cluster", "foo", true, true},
+		{"cluster missing", "bar", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found bool
+			var err error
+			if tt.cluster {
+				snap, cerr := dbi.GetClusterSnapshot(tt.id)
+				found, err = snap != nil, cerr
+			} else {
+				snap, ierr := dbi.GetSnapshot(tt.id)
+				found, err = snap != nil, ierr
+			}
+			if err != nil || found != tt.found {
+				t.Errorf("got found %v error %v expected %v", found, err, tt.found)
+			}
+		})
+	}
+}
+
 func TestGetInstance(t *testing.T) {
 	expected := "foo"
 	c := mock.MockRDSClient{}
@@ -90,6 +121,17 @@ func TestCreateClusterSnapshot(t *testing.T) {
 	}
 }
 
+func TestDeleteSnapshot(t *testing.T) {
+	dbi := DbInstances{
+		RdsClient: mock.MockRDSClient{},
+	}
+	for _, cluster := range []bool{false, true} {
+		if err := dbi.DeleteSnapshot("foo", cluster); err != nil {
+			t.Errorf("DeleteSnapshot(cluster %v) error = %s", cluster, err)
+		}
+	}
+}
+
 func TestDescribeParameterGroup(t *testing.T) {
 	c := mock.MockRDSClient{}
 	dbi := DbInstances{
@@ -499,14 +541,12 @@ func TestDbInstances_CreateInstanceFromStack(t *testing.T) {
 	field := fields{RdsClient: mock.MockRDSClient{}}
 	// Create long args
 	objs := []stack.Object{}
-	obj1 := stack.Object{}
-	obj2 := stack.Object{}
+	obj1 := stack.NewObject("foo", "", stack.LoneInstance)
+	obj2 := stack.NewObject("bar", "", stack.LoneInstance)
 	objs = append(objs, obj1)
 	objs = append(objs, obj2)
-	objects := make(map[int][]stack.Object)
-	objects[2] = objs
 	longStack := stack.Stack{
-		Objects: objects,
+		Objects: objs,
 	}
 	c := CreateInstanceFromStackInput{
 		Stack:  &longStack,
@@ -516,7 +556,6 @@ func TestDbInstances_CreateInstanceFromStack(t *testing.T) {
 
 	//Create a valid object and instance
 	filename := "/tmp/foo"
-	order := 2
 	objType := stack.LoneInstance
 
 	defer os.Remove(filename)
@@ -528,13 +567,11 @@ func TestDbInstances_CreateInstanceFromStack(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to write output, %s", err)
 	}
-	gObj := stack.NewObject(filename, order, objType)
+	gObj := stack.NewObject("instance", filename, objType)
 	objs2 := []stack.Object{}
 	objs2 = append(objs2, gObj)
-	object := make(map[int][]stack.Object)
-	object[2] = objs2
 	goodstack := stack.Stack{
-		Objects: object,
+		Objects: objs2,
 	}
 	c2 := CreateInstanceFromStackInput{
 		Stack:  &goodstack,
@@ -610,14 +647,12 @@ func TestDbInstances_CreateClusterFromStack(t *testing.T) {
 	field := fields{RdsClient: mock.MockRDSClient{}}
 	// Create long args
 	objs := []stack.Object{}
-	obj1 := stack.Object{}
-	obj2 := stack.Object{}
+	obj1 := stack.NewObject("foo", "", stack.Cluster)
+	obj2 := stack.NewObject("bar", "", stack.Cluster)
 	objs = append(objs, obj1)
 	objs = append(objs, obj2)
-	objects := make(map[int][]stack.Object)
-	objects[2] = objs
 	longStack := stack.Stack{
-		Objects: objects,
+		Objects: objs,
 	}
 	c := CreateClusterFromStackInput{
 		S:           &longStack,
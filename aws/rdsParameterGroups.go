@@ -2,7 +2,9 @@ package aws
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/jrottersman/lats/pgstate"
 	"github.com/jrottersman/lats/state"
 )
@@ -34,11 +36,14 @@ func GetParameterGroups(r state.RDSRestorationStore, i DbInstances) ([]pgstate.P
 func GetClusterParameterGroup(r state.RDSRestorationStore, i DbInstances) ([]pgstate.ParameterGroup, error) {
 	pg := r.GetClusterParameterGroups()
 	groups := []pgstate.ParameterGroup{}
+	if pg == nil {
+		return groups, nil
+	}
 	group, err := i.GetClusterParameterGroup(*pg)
 	if err != nil {
 		return nil, fmt.Errorf("error getting cluster parameter group %s", err)
 	}
-	params, err := i.GetParametersForGroup(*pg)
+	params, err := i.GetParametersForClusterParameterGroup(*pg)
 	if err != nil {
 		return nil, fmt.Errorf("error getting parameters %s for group %s", err, *pg)
 	}
@@ -49,3 +54,16 @@ func GetClusterParameterGroup(r state.RDSRestorationStore, i DbInstances) ([]pgs
 	groups = append(groups, fpg)
 	return groups, nil
 }
+
+//GetCustomOptionGroup take in restoration store return the option group for an instance or nil if it's using the default one
+func GetCustomOptionGroup(r state.RDSRestorationStore, i DbInstances) (*types.OptionGroup, error) {
+	name := r.GetOptionGroupName()
+	if name == nil || strings.HasPrefix(*name, "default:") {
+		return nil, nil
+	}
+	og, err := i.GetOptionGroup(*name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting option group %s: %s", *name, err)
+	}
+	return og, nil
+}
@@ -78,3 +78,20 @@ func TestGetClusterParameterGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCustomOptionGroup(t *testing.T) {
+	i := DbInstances{mock.MockRDSClient{}}
+	def := state.RDSRestorationStore{Instance: &types.DBInstance{OptionGroupMemberships: []types.OptionGroupMembership{{OptionGroupName: aws.String("default:mysql-8-0")}}}}
+	got, err := GetCustomOptionGroup(def, i)
+	if err != nil || got != nil {
+		t.Errorf("GetCustomOptionGroup() for default group = %v, %v", got, err)
+	}
+	custom := state.RDSRestorationStore{Instance: &types.DBInstance{OptionGroupMemberships: []types.OptionGroupMembership{{OptionGroupName: aws.String("foo")}}}}
+	got, err = GetCustomOptionGroup(custom, i)
+	if err != nil {
+		t.Errorf("GetCustomOptionGroup() error = %v", err)
+	}
+	if got == nil {
+		t.Errorf("GetCustomOptionGroup() expected an option group")
+	}
+}
@@ -0,0 +1,184 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/jrottersman/lats/state"
+)
+
+// S3Client type for mocks
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// S3Backend keeps lats state in an S3 bucket, conditional writes on the ETag catch two lats writing the state file at once.
+// It works with S3 compatible servers like MinIO that support If-Match and If-None-Match on PutObject
+type S3Backend struct {
+	Client S3Client
+	Bucket string
+	Prefix string
+}
+
+var _ state.StateBackend = S3Backend{}
+
+// S3BackendConfig is how to reach the bucket
+type S3BackendConfig struct {
+	Region       string
+	Endpoint     string // Endpoint is only needed for S3 compatible servers
+	UsePathStyle bool
+	Bucket       string
+	Prefix       string
+}
+
+// InitS3Backend creates an S3 client for the state backend
+func InitS3Backend(c S3BackendConfig) S3Backend {
+	cfg := createConfig(c.Region)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if c.Endpoint != "" {
+			o.BaseEndpoint = aws.String(c.Endpoint)
+		}
+		o.UsePathStyle = c.UsePathStyle
+	})
+	return S3Backend{
+		Client: client,
+		Bucket: c.Bucket,
+		Prefix: c.Prefix,
+	}
+}
+
+func (b S3Backend) String() string {
+	return fmt.Sprintf("s3://%s", path.Join(b.Bucket, b.Prefix))
+}
+
+// key turns a lats path like .state/foo.json into an object key under the prefix
+func (b S3Backend) key(k string) string {
+	k = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(k)), "/")
+	if k == "." {
+		k = ""
+	}
+	return strings.TrimPrefix(path.Join(b.Prefix, k), "/")
+}
+
+// Get reads an object, the generation is its ETag
+func (b S3Backend) Get(ctx context.Context, key string) ([]byte, string, error) {
+	out, err := b.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.key(key)),
+	})
+	if err != nil {
+		return nil, "", s3Error(key, err)
+	}
+	defer out.Body.Close()
+	dat, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return dat, aws.ToString(out.ETag), nil
+}
+
+// Put writes an object
+func (b S3Backend) Put(ctx context.Context, key string, data []byte) error {
+	_, err := b.put(ctx, key, data, nil, nil)
+	return err
+}
+
+// PutIf writes an object only if its ETag is still generation, an empty generation only writes it if it doesn't exist
+func (b S3Backend) PutIf(ctx context.Context, key string, data []byte, generation string) (string, error) {
+	if generation == "" {
+		return b.put(ctx, key, data, nil, aws.String("*"))
+	}
+	return b.put(ctx, key, data, aws.String(generation), nil)
+}
+
+func (b S3Backend) put(ctx context.Context, key string, data []byte, ifMatch *string, ifNoneMatch *string) (string, error) {
+	out, err := b.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(b.Bucket),
+		Key:         aws.String(b.key(key)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+		IfMatch:     ifMatch,
+		IfNoneMatch: ifNoneMatch,
+	})
+	if err != nil {
+		return "", s3Error(key, err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// ModTime is the LastModified of an object
+func (b S3Backend) ModTime(ctx context.Context, key string) (time.Time, error) {
+	out, err := b.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.key(key)),
+	})
+	if err != nil {
+		return time.Time{}, s3Error(key, err)
+	}
+	return aws.ToTime(out.LastModified), nil
+}
+
+// Delete removes an object
+func (b S3Backend) Delete(ctx context.Context, key string) error {
+	_, err := b.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.key(key)),
+	})
+	if err != nil {
+		return s3Error(key, err)
+	}
+	return nil
+}
+
+// List returns the keys directly under dir
+func (b S3Backend) List(ctx context.Context, dir string) ([]string, error) {
+	prefix := b.key(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	keys := []string{}
+	p := s3.NewListObjectsV2Paginator(b.Client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(b.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(dir, err)
+		}
+		for _, o := range out.Contents {
+			name := strings.TrimPrefix(aws.ToString(o.Key), prefix)
+			keys = append(keys, filepath.Join(dir, name))
+		}
+	}
+	return keys, nil
+}
+
+// s3Error maps S3 errors to the state backend errors
+func s3Error(key string, err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return fmt.Errorf("%s: %w", key, errors.Join(state.ErrNotFound, err))
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return fmt.Errorf("%s: %w", key, errors.Join(state.ErrConflict, err))
+		}
+	}
+	return fmt.Errorf("%s: %w", key, err)
+}
@@ -0,0 +1,172 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/state"
+)
+
+// testBackend checks the behaviour lats relies on from a state backend
+func testBackend(t *testing.T, b state.StateBackend) {
+	ctx := context.Background()
+	_, _, err := b.Get(ctx, ".confState.json")
+	if !errors.Is(err, state.ErrNotFound) {
+		t.Fatalf("Get() of a missing key error = %v, want ErrNotFound", err)
+	}
+
+	gen, err := b.PutIf(ctx, ".confState.json", []byte("one"), "")
+	if err != nil {
+		t.Fatalf("PutIf() creating error = %v", err)
+	}
+	_, err = b.PutIf(ctx, ".confState.json", []byte("two"), "")
+	if !errors.Is(err, state.ErrConflict) {
+		t.Errorf("PutIf() creating a key that exists error = %v, want ErrConflict", err)
+	}
+	dat, got, err := b.Get(ctx, ".confState.json")
+	if err != nil || string(dat) != "one" || got != gen {
+		t.Errorf("Get() = %s, %s, %v want one, %s", dat, got, err, gen)
+	}
+
+	newGen, err := b.PutIf(ctx, ".confState.json", []byte("two"), gen)
+	if err != nil {
+		t.Fatalf("PutIf() error = %v", err)
+	}
+	_, err = b.PutIf(ctx, ".confState.json", []byte("three"), gen)
+	if !errors.Is(err, state.ErrConflict) {
+		t.Errorf("PutIf() with a stale generation error = %v, want ErrConflict", err)
+	}
+	dat, got, err = b.Get(ctx, ".confState.json")
+	if err != nil || string(dat) != "two" || got != newGen {
+		t.Errorf("Get() = %s, %s, %v want two, %s", dat, got, err, newGen)
+	}
+
+	for _, k := range []string{".state/a.json", ".state/b.json", ".state/nested/c.json"} {
+		err = b.Put(ctx, k, []byte(k))
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	keys, err := b.List(ctx, ".state")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	sort.Strings(keys)
+	if want := []string{".state/a.json", ".state/b.json"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+
+	if mt, ok := b.(state.ModTimer); ok {
+		modified, err := mt.ModTime(ctx, ".state/a.json")
+		if err != nil || time.Since(modified) > time.Minute {
+			t.Errorf("ModTime() = %v, %v want about now", modified, err)
+		}
+		_, err = mt.ModTime(ctx, ".state/missing.json")
+		if !errors.Is(err, state.ErrNotFound) {
+			t.Errorf("ModTime() of a missing key error = %v, want ErrNotFound", err)
+		}
+	}
+
+	err = b.Delete(ctx, ".state/a.json")
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, _, err = b.Get(ctx, ".state/a.json")
+	if !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3Backend(t *testing.T) {
+	c := mock.NewS3Client()
+	testBackend(t, S3Backend{Client: c, Bucket: "foo", Prefix: "lats/prod"})
+	if _, ok := c.Objects["lats/prod/.state/b.json"]; !ok {
+		t.Errorf("expected keys to be under the prefix got %v", c.Objects)
+	}
+}
+
+func TestS3Backend_key(t *testing.T) {
+	tests := []struct {
+		prefix string
+		key    string
+		want   string
+	}{
+		{"", ".confState.json", ".confState.json"},
+		{"lats", ".state/foo.json", "lats/.state/foo.json"},
+		{"lats/", "/tmp/foo.json", "lats/tmp/foo.json"},
+		{"lats", ".", "lats"},
+		{"", ".", ""},
+	}
+	for _, tt := range tests {
+		b := S3Backend{Prefix: tt.prefix}
+		if got := b.key(tt.key); got != tt.want {
+			t.Errorf("key(%s) with prefix %s = %s, want %s", tt.key, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// TestS3Backend_Server runs against a real S3 compatible server, start MinIO and set LATS_TEST_S3_ENDPOINT to run it
+//
+//	minio server /tmp/minio
+//	LATS_TEST_S3_ENDPOINT=http://127.0.0.1:9000 AWS_ACCESS_KEY_ID=minioadmin AWS_SECRET_ACCESS_KEY=minioadmin go test ./aws -run S3Backend_Server
+func TestS3Backend_Server(t *testing.T) {
+	endpoint := os.Getenv("LATS_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("LATS_TEST_S3_ENDPOINT isn't set")
+	}
+	bucket := os.Getenv("LATS_TEST_S3_BUCKET")
+	if bucket == "" {
+		bucket = "lats-test"
+	}
+	b := InitS3Backend(S3BackendConfig{
+		Region:       "us-east-1",
+		Endpoint:     endpoint,
+		UsePathStyle: true,
+		Bucket:       bucket,
+		Prefix:       fmt.Sprintf("test-%d", time.Now().UnixNano()),
+	})
+	client := b.Client.(*s3.Client)
+	_, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		t.Logf("CreateBucket() error = %v, assuming it exists", err)
+	}
+	testBackend(t, b)
+}
+
+func TestS3Backend_SyncState(t *testing.T) {
+	old := state.Backend
+	defer func() { state.Backend = old }()
+	state.Backend = S3Backend{Client: mock.NewS3Client(), Bucket: "foo"}
+	filename := t.TempDir() + "/.confState.json"
+
+	err := state.InitState(filename)
+	if err != nil {
+		t.Fatalf("InitState() error = %v", err)
+	}
+	first, _ := state.ReadState(filename)
+	second, _ := state.ReadState(filename)
+	first.UpdateState("a", ".state/a.json", "stack")
+	second.UpdateState("b", ".state/b.json", "stack")
+	if err := first.SyncState(filename); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	if err := second.SyncState(filename); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	sm, err := state.ReadState(filename)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if len(sm.StateLocations) != 2 {
+		t.Errorf("expected both stacks in the bucket got %v", sm.StateLocations)
+	}
+}
@@ -0,0 +1,482 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/pgstate"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+// parameterGroupWaitInterval is how long we sleep between checks while a new parameter group settles, AWS says to wait five minutes total
+var parameterGroupWaitInterval = 30 * time.Second
+
+// restoreInput is what we need to restore every object in a stack
+type restoreInput struct {
+	name          *string
+	dbSubnetGroup *string
+	ec2Client     *EC2Instances
+	vpcID         *string
+	ingress       []PassedIPs
+	egress        []PassedIPs
+	created       func(progressType string, id string) // created is called with each cluster and instance AWS has started creating, it can be nil
+}
+
+// stackRestore restores the objects of a stack, stack.Execute calls restoreObject once per object in dependency order.
+// Objects run in parallel so everything an object produces for the objects that depend on it is kept behind mu.
+type stackRestore struct {
+	instances *DbInstances
+	in        restoreInput
+
+	mu                 sync.Mutex
+	parameterGroupName *string
+	optionGroupName    *string
+	securityGroupIDs   []string
+	groupIDs           map[string]string // groupIDs maps the id of a security group we recreated to it's new id
+	engineVersion      *string
+}
+
+func newStackRestore(instances *DbInstances, in restoreInput) *stackRestore {
+	return &stackRestore{
+		instances: instances,
+		in:        in,
+		groupIDs:  make(map[string]string),
+	}
+}
+
+// restoreStack restores every object in the stack running independent objects in parallel
+func (instances *DbInstances) restoreStack(s stack.Stack, in restoreInput) error {
+	r := newStackRestore(instances, in)
+	return stack.Execute(context.Background(), s, MaxConcurrentJobs, r.restoreObject)
+}
+
+// restoreObject is the stack.Handler that dispatches on the object type
+func (r *stackRestore) restoreObject(ctx context.Context, o stack.Object) error {
+	slog.Info("restoring object", "id", o.ID, "type", o.ObjType)
+	switch o.ObjType {
+	case stack.DBParameterGroup:
+		return r.restoreParameterGroups(o, false)
+	case stack.DBClusterParameterGroup:
+		return r.restoreParameterGroups(o, true)
+	case stack.OptionGroup:
+		return r.restoreOptionGroup(o)
+	case stack.SecurityGroup:
+		return r.restoreSecurityGroups(o)
+	case stack.SecurityGroupRules:
+		return r.restoreSecurityGroupRules(o)
+	case stack.LoneInstance:
+		return r.restoreLoneInstance(o)
+	case stack.Cluster:
+		return r.restoreCluster(o)
+	case stack.Instance:
+		return r.restoreClusterInstance(o)
+	}
+	return fmt.Errorf("no restore handler for object type %s", o.ObjType)
+}
+
+func (r *stackRestore) restoreParameterGroups(o stack.Object, cluster bool) error {
+	pgs, err := stack.Read[[]pgstate.ParameterGroup](o)
+	if err != nil {
+		return err
+	}
+	created := false
+	for _, pg := range pgs {
+		var name *string
+		var c bool
+		if cluster {
+			name, c, err = r.instances.restoreClusterParameterGroup(pg)
+		} else {
+			name, c, err = r.instances.restoreParameterGroup(pg)
+		}
+		if err != nil {
+			return err
+		}
+		created = created || c
+		if name != nil {
+			r.mu.Lock()
+			r.parameterGroupName = name
+			r.mu.Unlock()
+		}
+	}
+	//Wait five minutes for parameter sets per aws docs
+	if created {
+		for i := 0; i < 10; i++ {
+			slog.Info("waiting for five minutes for Parameter group per AWS documentation", "seconds", 30*i)
+			time.Sleep(parameterGroupWaitInterval)
+		}
+	}
+	return nil
+}
+
+func (r *stackRestore) restoreOptionGroup(o stack.Object) error {
+	og, err := stack.Read[*types.OptionGroup](o)
+	if err != nil {
+		return err
+	}
+	name, err := r.instances.restoreOptionGroup(og)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name != nil {
+		r.optionGroupName = name
+	}
+	return nil
+}
+
+func (r *stackRestore) restoreSecurityGroups(o stack.Object) error {
+	sgs, err := stack.Read[*state.SecurityGroupOutput](o)
+	if err != nil {
+		return err
+	}
+	if len(sgs.SecurityGroups) == 0 {
+		return nil
+	}
+	if r.in.ec2Client == nil {
+		return fmt.Errorf("an ec2 client is required to restore security groups")
+	}
+	for _, v := range sgs.SecurityGroups {
+		id, created, err := restoreSecurityGroup(r.in, v.Description, v.GroupName, v.GroupId)
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.securityGroupIDs = append(r.securityGroupIDs, id)
+		if created && v.GroupId != nil {
+			r.groupIDs[*v.GroupId] = id
+		}
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+func (r *stackRestore) restoreSecurityGroupRules(o stack.Object) error {
+	rules, err := stack.Read[[]state.SGRuleStorage](o)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	groupIDs := make(map[string]string, len(r.groupIDs))
+	for k, v := range r.groupIDs {
+		groupIDs[k] = v
+	}
+	restored := len(r.securityGroupIDs) > 0
+	r.mu.Unlock()
+	if !restored {
+		return fmt.Errorf("security group rules %s have no restored security group, the rules have to depend on the security groups", o.ID)
+	}
+	// groups that already existed keep the rules they have
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	if r.in.ec2Client == nil {
+		return fmt.Errorf("an ec2 client is required to restore security group rules")
+	}
+	return applySecurityGroupRules(r.in.ec2Client, groupIDs, rules)
+}
+
+func (r *stackRestore) restoreLoneInstance(o stack.Object) error {
+	ins, err := stack.Read[*rds.RestoreDBInstanceFromDBSnapshotInput](o)
+	if err != nil {
+		slog.Error("failed to read the instance", "error", err)
+		return err
+	}
+	r.mu.Lock()
+	if r.parameterGroupName != nil {
+		ins.DBParameterGroupName = r.parameterGroupName
+	}
+	if r.optionGroupName != nil {
+		ins.OptionGroupName = r.optionGroupName
+	}
+	if len(r.securityGroupIDs) > 0 {
+		ins.VpcSecurityGroupIds = r.securityGroupIDs
+	}
+	r.mu.Unlock()
+	if r.in.name != nil {
+		ins.DBInstanceIdentifier = r.in.name
+	}
+	if r.in.dbSubnetGroup != nil {
+		ins.DBSubnetGroupName = r.in.dbSubnetGroup
+	}
+	_, err = r.instances.RestoreSnapshotInstance(*ins)
+	if err != nil {
+		slog.Error("failed to restore the instance", "error", err)
+		return err
+	}
+	r.created(InstanceProgress, ins.DBInstanceIdentifier)
+	slog.Info("Database creation in progress")
+	return nil
+}
+
+func (r *stackRestore) restoreCluster(o stack.Object) error {
+	dbi, err := stack.Read[*rds.RestoreDBClusterFromSnapshotInput](o)
+	if err != nil {
+		slog.Error("Can't read cluster object", "error", err)
+		return err
+	}
+	r.mu.Lock()
+	if r.parameterGroupName != nil {
+		dbi.DBClusterParameterGroupName = r.parameterGroupName
+	}
+	if len(r.securityGroupIDs) > 0 {
+		dbi.VpcSecurityGroupIds = r.securityGroupIDs
+	}
+	r.mu.Unlock()
+	dbi.DBSubnetGroupName = r.in.dbSubnetGroup
+	if r.in.name != nil {
+		slog.Info("creating cluster", "ClusterName", *r.in.name)
+		dbi.DBClusterIdentifier = r.in.name
+	}
+	cl, err := r.instances.RestoreSnapshotCluster(*dbi) // we might need to do something with the output in which case this changes
+	if err != nil {
+		return err
+	}
+	r.created(ClusterProgress, dbi.DBClusterIdentifier)
+	r.mu.Lock()
+	r.engineVersion = cl.DBCluster.EngineVersion
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *stackRestore) restoreClusterInstance(o stack.Object) error {
+	ins, err := stack.Read[*rds.CreateDBInstanceInput](o)
+	if err != nil {
+		slog.Error("failed to read createDBInstanceInput", "error", err)
+		return err
+	}
+	ins.DBSubnetGroupName = r.in.dbSubnetGroup
+	ins.DBClusterIdentifier = r.in.name
+	r.mu.Lock()
+	ins.EngineVersion = r.engineVersion
+	r.mu.Unlock()
+	_, err = r.instances.RestoreInstanceForCluster(*ins)
+	if err != nil {
+		slog.Error("error creating instance", "error", err)
+		return err
+	}
+	r.created(InstanceProgress, ins.DBInstanceIdentifier)
+	return nil
+}
+
+// created tells the caller AWS has started creating the cluster or instance with id
+func (r *stackRestore) created(progressType string, id *string) {
+	if r.in.created != nil && id != nil {
+		r.in.created(progressType, *id)
+	}
+}
+
+// restoreParameterGroup creates the parameter group if it doesn't exist, it returns the name to use and if we created it
+func (instances *DbInstances) restoreParameterGroup(pg pgstate.ParameterGroup) (*string, bool, error) {
+	name := pg.ParameterGroup.DBParameterGroupName
+	if name == nil || strings.HasPrefix(*name, "default.") {
+		slog.Info("using the default parameter group")
+		return nil, false, nil
+	}
+	existing, err := instances.GetParameterGroup(*name)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		slog.Info("parameter group already exists", "name", *name)
+		return name, false, nil
+	}
+	slog.Info("creating parameter group", "name", *name)
+	_, err = instances.CreateParameterGroup(&pg.ParameterGroup)
+	if err != nil {
+		return nil, false, err
+	}
+	params := pg.UserParameters()
+	if len(params) == 0 {
+		return name, true, nil
+	}
+	return name, true, instances.ModifyParameterGroup(*name, params)
+}
+
+// restoreClusterParameterGroup is restoreParameterGroup for cluster parameter groups
+func (instances *DbInstances) restoreClusterParameterGroup(pg pgstate.ParameterGroup) (*string, bool, error) {
+	name := pg.ClusterParameterGroup.DBClusterParameterGroupName
+	if name == nil || strings.HasPrefix(*name, "default.") {
+		slog.Info("using the default cluster parameter group")
+		return nil, false, nil
+	}
+	existing, err := instances.GetClusterParameterGroup(*name)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		slog.Info("cluster parameter group already exists", "name", *name)
+		return name, false, nil
+	}
+	slog.Info("creating cluster parameter group", "name", *name)
+	_, err = instances.CreateClusterParameterGroup(&pg.ClusterParameterGroup)
+	if err != nil {
+		return nil, false, err
+	}
+	params := pg.UserParameters()
+	if len(params) == 0 {
+		return name, true, nil
+	}
+	return name, true, instances.ModifyClusterParameterGroup(*name, params)
+}
+
+// restoreOptionGroup creates the option group if it isn't a default one and returns the name to use
+func (instances *DbInstances) restoreOptionGroup(og *types.OptionGroup) (*string, error) {
+	if og.OptionGroupName == nil || strings.HasPrefix(*og.OptionGroupName, "default:") {
+		slog.Info("using the default option group")
+		return nil, nil
+	}
+	if og.EngineName == nil || og.MajorEngineVersion == nil {
+		return nil, fmt.Errorf("option group %s is missing its engine", *og.OptionGroupName)
+	}
+	description := *og.OptionGroupName
+	if og.OptionGroupDescription != nil {
+		description = *og.OptionGroupDescription
+	}
+	slog.Info("restoring option group", "name", *og.OptionGroupName)
+	_, err := instances.RestoreOptionGroup(*og.EngineName, *og.MajorEngineVersion, *og.OptionGroupName, description)
+	if err != nil {
+		var exists *types.OptionGroupAlreadyExistsFault
+		if errors.As(err, &exists) {
+			slog.Info("option group already exists", "name", *og.OptionGroupName)
+			return og.OptionGroupName, nil
+		}
+		return nil, fmt.Errorf("error creating option group %s", err)
+	}
+	if len(og.Options) == 0 {
+		return og.OptionGroupName, nil
+	}
+	optConfigs := optionsToConfiguration(og.Options)
+	err = instances.ModifyOptionGroup(*og.OptionGroupName, optConfigs)
+	if err != nil {
+		slog.Warn("error modifying option group", "error", err)
+	}
+	return og.OptionGroupName, nil
+}
+
+// restoreSecurityGroup creates the security group and returns it's id and if we created it, an existing group is reused as is
+func restoreSecurityGroup(in restoreInput, description *string, groupName *string, groupID *string) (string, bool, error) {
+	input := CreateSGInput{
+		description: description,
+		groupName:   groupName,
+		vpcID:       in.vpcID,
+		groupID:     groupID,
+	}
+	out, err := in.ec2Client.CreateSG(input)
+	if err != nil {
+		slog.Error("creating SG", "error", err)
+		return "", false, fmt.Errorf("creating security group error %s", err)
+	}
+	if out == nil {
+		return *groupID, false, nil
+	}
+	if out.GroupId == nil {
+		return "", false, fmt.Errorf("creating security group %s returned no group id", aws.ToString(groupName))
+	}
+	id := *out.GroupId
+	if len(in.ingress) > 0 {
+		slog.Info("updating ingress rules")
+		_, err := in.ec2Client.SGIngress(id, in.ingress)
+		if err != nil {
+			slog.Warn("error updating ingress rules", "error", err)
+		}
+	}
+	if len(in.egress) > 0 {
+		slog.Info("updating egress rules")
+		_, err := in.ec2Client.SGEgress(id, in.egress)
+		if err != nil {
+			slog.Warn("error updating egress rules", "error", err)
+		}
+	}
+	return id, true, nil
+}
+
+// applySecurityGroupRules authorizes the stored rules on the groups we created, groupIDs maps the original id to the new one.
+// Groups with stored egress rules have the default allow all egress rule swapped for them
+func applySecurityGroupRules(c *EC2Instances, groupIDs map[string]string, rules []state.SGRuleStorage) error {
+	ingress := make(map[string][]state.SGRuleStorage)
+	egress := make(map[string][]state.SGRuleStorage)
+	for _, rule := range rules {
+		if rule.GroupID == nil {
+			continue
+		}
+		id, ok := groupIDs[*rule.GroupID]
+		if !ok {
+			continue
+		}
+		rule = rule.RemapGroups(groupIDs)
+		if rule.Egress {
+			egress[id] = append(egress[id], rule)
+		} else {
+			ingress[id] = append(ingress[id], rule)
+		}
+	}
+	for id, groupRules := range ingress {
+		slog.Info("applying stored security group rules", "group", id, "rules", len(groupRules))
+		_, err := c.SGIngressRules(id, groupRules)
+		if err != nil {
+			return fmt.Errorf("error applying rules to security group %s: %s", id, err)
+		}
+	}
+	for id, groupRules := range egress {
+		slog.Info("applying stored security group egress rules", "group", id, "rules", len(groupRules))
+		_, err := c.SGEgressRules(id, groupRules)
+		if err != nil {
+			return fmt.Errorf("error applying egress rules to security group %s: %s", id, err)
+		}
+	}
+	return nil
+}
+
+// RestoreChange is a field of a stack object that restore sets to something other than what the stack recorded
+type RestoreChange struct {
+	Field  string `json:"field"`
+	Action string `json:"action"` // Action is overridden or nulled
+	With   string `json:"with"`   // With is what restore puts in the field and when
+}
+
+// Restore change actions
+const (
+	Overridden = "overridden"
+	Nulled     = "nulled"
+)
+
+// RestoreChanges are the fields restoreObject changes for an object of type objType, keep it in step with the restore handlers
+func RestoreChanges(objType string) []RestoreChange {
+	switch objType {
+	case stack.LoneInstance:
+		return []RestoreChange{
+			{"DBInstanceIdentifier", Overridden, "the database name restore is given, when it's given"},
+			{"DBParameterGroupName", Overridden, "the parameter group restored from the stack, unless it's a default one"},
+			{"OptionGroupName", Overridden, "the option group restored from the stack, unless it's a default one"},
+			{"VpcSecurityGroupIds", Overridden, "the ids of the security groups recreated from the stack, when it has any"},
+			{"DBSubnetGroupName", Overridden, "the subnet group restore is given or creates, when there is one"},
+		}
+	case stack.Cluster:
+		return []RestoreChange{
+			{"DBClusterIdentifier", Overridden, "the database name restore is given, when it's given"},
+			{"DBClusterParameterGroupName", Overridden, "the cluster parameter group restored from the stack, unless it's a default one"},
+			{"VpcSecurityGroupIds", Overridden, "the ids of the security groups recreated from the stack, when it has any"},
+			{"DBSubnetGroupName", Nulled, "the subnet group restore is given or creates, it's nulled when there isn't one"},
+		}
+	case stack.Instance:
+		return []RestoreChange{
+			{"DBClusterIdentifier", Nulled, "the database name restore is given, it's nulled when there isn't one"},
+			{"DBSubnetGroupName", Nulled, "the subnet group restore is given or creates, it's nulled when there isn't one"},
+			{"EngineVersion", Overridden, "the engine version of the restored cluster"},
+		}
+	}
+	return nil
+}
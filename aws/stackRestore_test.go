@@ -0,0 +1,237 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/pgstate"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func Test_stackRestore_restoreObject(t *testing.T) {
+	parameterGroupWaitInterval = 0
+	pgFile := "/tmp/deps-pg.gob"
+	ogFile := "/tmp/deps-og.gob"
+	sgFile := "/tmp/deps-sg.gob"
+	rulesFile := "/tmp/deps-rules.gob"
+	defer os.Remove(pgFile)
+	defer os.Remove(ogFile)
+	defer os.Remove(sgFile)
+	defer os.Remove(rulesFile)
+
+	pgs := []pgstate.ParameterGroup{{ParameterGroup: types.DBParameterGroup{DBParameterGroupName: aws.String("foo")}}}
+	state.WriteOutput(pgFile, pgstate.EncodeParameterGroups(pgs))
+	og := types.OptionGroup{OptionGroupName: aws.String("default:mysql-8-0")}
+	state.WriteOutput(ogFile, state.EncodeOptionGroup(&og))
+	sgs := state.SecurityGroupOutput{SecurityGroups: []ec2types.SecurityGroup{{GroupId: aws.String("foobar"), GroupName: aws.String("bar"), Description: aws.String("baz")}}}
+	state.WriteOutput(sgFile, state.EncodeSecurityGroups(sgs))
+	state.WriteOutput(rulesFile, state.EncodeSGRulesStorage(state.SecurityGroupNeeds(sgs)))
+
+	s := stack.NewStack("deps", stack.LoneInstance, []stack.Object{
+		stack.NewObject("pg", pgFile, stack.DBParameterGroup),
+		stack.NewObject("og", ogFile, stack.OptionGroup),
+		stack.NewObject("sg", sgFile, stack.SecurityGroup),
+		stack.NewObject("rules", rulesFile, stack.SecurityGroupRules, "sg"),
+	})
+	ec2 := EC2Instances{Client: mock.EC2Client{}}
+
+	type result struct {
+		parameterGroupName *string
+		optionGroupName    *string
+		securityGroupIDs   []string
+	}
+	tests := []struct {
+		name    string
+		input   restoreInput
+		want    *result
+		wantErr bool
+	}{
+		{
+			name:  "restores",
+			input: restoreInput{ec2Client: &ec2},
+			want: &result{
+				parameterGroupName: aws.String("foo"),
+				securityGroupIDs:   []string{"foobar"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "noEc2Client",
+			input:   restoreInput{},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newStackRestore(&DbInstances{RdsClient: mock.MockRDSClient{}}, tt.input)
+			err := stack.Execute(context.Background(), s, MaxConcurrentJobs, r.restoreObject)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("stackRestore.restoreObject() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want == nil {
+				return
+			}
+			got := &result{r.parameterGroupName, r.optionGroupName, r.securityGroupIDs}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stackRestore.restoreObject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_stackRestore_unknownType(t *testing.T) {
+	r := newStackRestore(&DbInstances{RdsClient: mock.MockRDSClient{}}, restoreInput{})
+	err := r.restoreObject(context.Background(), stack.NewObject("foo", "/tmp/nope", "NotAType"))
+	if err == nil {
+		t.Errorf("expected an error for an unknown object type")
+	}
+}
+
+func Test_applySecurityGroupRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []state.SGRuleStorage
+		want  []string
+	}{
+		{
+			name: "ingress",
+			rules: []state.SGRuleStorage{
+				{GroupID: aws.String("old"), FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IPProtocol: aws.String("tcp")},
+				{GroupID: aws.String("unmapped")},
+				{},
+			},
+			want: []string{"AuthorizeSecurityGroupIngress new"},
+		},
+		{
+			name: "egress replaces the default",
+			rules: []state.SGRuleStorage{
+				{GroupID: aws.String("old"), FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IPProtocol: aws.String("tcp")},
+				{GroupID: aws.String("old"), FromPort: aws.Int32(443), ToPort: aws.Int32(443), IPProtocol: aws.String("tcp"), Egress: true},
+				{GroupID: aws.String("unmapped"), Egress: true},
+			},
+			want: []string{"AuthorizeSecurityGroupIngress new", "RevokeSecurityGroupEgress new", "AuthorizeSecurityGroupEgress new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := []string{}
+			c := &EC2Instances{Client: mock.EC2Client{Calls: &calls}}
+			err := applySecurityGroupRules(c, map[string]string{"old": "new"}, tt.rules)
+			if err != nil {
+				t.Errorf("applySecurityGroupRules() error = %v", err)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("applySecurityGroupRules() called %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func Test_restoreTieredStack(t *testing.T) {
+	parameterGroupWaitInterval = 0
+	dir := t.TempDir()
+	pgFile, sgFile, rulesFile, instanceFile := dir+"/pg", dir+"/sg", dir+"/rules", dir+"/instance"
+	pgs := []pgstate.ParameterGroup{{ParameterGroup: types.DBParameterGroup{DBParameterGroupName: aws.String("foo")}}}
+	state.WriteOutput(pgFile, pgstate.EncodeParameterGroups(pgs))
+	sgs := state.SecurityGroupOutput{SecurityGroups: []ec2types.SecurityGroup{{
+		GroupId: aws.String("sg-old"), GroupName: aws.String("bar"), Description: aws.String("baz"),
+		IpPermissions: []ec2types.IpPermission{{FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IpProtocol: aws.String("tcp"), IpRanges: []ec2types.IpRange{{CidrIp: aws.String("10.0.0.0/16")}}}},
+	}}}
+	state.WriteOutput(sgFile, state.EncodeSecurityGroups(sgs))
+	state.WriteOutput(rulesFile, state.EncodeSGRulesStorage(state.SecurityGroupNeeds(sgs)))
+	state.WriteOutput(instanceFile, state.EncodeRestoreDBInstanceFromDBSnapshotInput(&rds.RestoreDBInstanceFromDBSnapshotInput{DBInstanceIdentifier: aws.String("db"), DBSnapshotIdentifier: aws.String("nightly")}))
+
+	// the layout stacks had before they were graphs, rdsstate put the groups and their rules in the same tier
+	type tieredObject struct {
+		FileName string
+		Order    int
+		ObjType  string
+	}
+	type tieredStack struct {
+		Name                  string
+		RestorationObjectName string
+		Objects               map[int][]tieredObject
+	}
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(tieredStack{Name: "nightly", RestorationObjectName: stack.LoneInstance, Objects: map[int][]tieredObject{
+		1: {
+			{FileName: pgFile, Order: 1, ObjType: stack.DBParameterGroup},
+			{FileName: sgFile, Order: 1, ObjType: stack.SecurityGroup},
+			{FileName: rulesFile, Order: 1, ObjType: stack.SecurityGroupRules},
+		},
+		2: {{FileName: instanceFile, Order: 2, ObjType: stack.LoneInstance}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated, _, err := stack.StackMigrations.Migrate(b.Bytes())
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	s, err := stack.DecodeStack(migrated)
+	if err != nil {
+		t.Fatalf("DecodeStack() error = %v", err)
+	}
+
+	calls := []string{}
+	created := []string{}
+	ec2 := EC2Instances{Client: mock.EC2Client{Calls: &calls, NewGroups: true}}
+	r := newStackRestore(&DbInstances{RdsClient: mock.MockRDSClient{}}, restoreInput{ec2Client: &ec2, name: aws.String("restored"), created: func(progressType string, id string) {
+		created = append(created, progressType+" "+id)
+	}})
+	if err := stack.Execute(context.Background(), *s, MaxConcurrentJobs, r.restoreObject); err != nil {
+		t.Fatalf("restoring the migrated stack error = %v", err)
+	}
+	if want := []string{"AuthorizeSecurityGroupIngress foobar"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("restoring the migrated stack called %v, want %v", calls, want)
+	}
+	if want := []string{InstanceProgress + " restored"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("restoring the migrated stack created %v, want %v", created, want)
+	}
+
+	// rules that run before their group is restored are an error instead of being dropped
+	r = newStackRestore(&DbInstances{RdsClient: mock.MockRDSClient{}}, restoreInput{ec2Client: &ec2})
+	if err := r.restoreObject(context.Background(), stack.NewObject("rules", rulesFile, stack.SecurityGroupRules)); err == nil {
+		t.Error("restoring rules without their group should error")
+	}
+}
+
+func Test_applySecurityGroupRules_groupSource(t *testing.T) {
+	rules := []state.SGRuleStorage{
+		{GroupID: aws.String("sg-db"), FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IPProtocol: aws.String("tcp"), GroupPairs: []ec2types.UserIdGroupPair{{GroupId: aws.String("sg-app"), UserId: aws.String("123456789012")}}},
+		{GroupID: aws.String("sg-db"), FromPort: aws.Int32(6432), ToPort: aws.Int32(6432), IPProtocol: aws.String("tcp"), GroupPairs: []ec2types.UserIdGroupPair{{GroupId: aws.String("sg-shared"), UserId: aws.String("123456789012")}}},
+	}
+	perms := []ec2types.IpPermission{}
+	c := &EC2Instances{Client: mock.EC2Client{Permissions: &perms}}
+	err := applySecurityGroupRules(c, map[string]string{"sg-db": "sg-db-new", "sg-app": "sg-app-new"}, rules)
+	if err != nil {
+		t.Fatalf("applySecurityGroupRules() error = %v", err)
+	}
+	want := []ec2types.IpPermission{
+		{FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IpProtocol: aws.String("tcp"), UserIdGroupPairs: []ec2types.UserIdGroupPair{{GroupId: aws.String("sg-app-new")}}},
+		{FromPort: aws.Int32(6432), ToPort: aws.Int32(6432), IpProtocol: aws.String("tcp"), UserIdGroupPairs: []ec2types.UserIdGroupPair{{GroupId: aws.String("sg-shared"), UserId: aws.String("123456789012")}}},
+	}
+	if !reflect.DeepEqual(perms, want) {
+		t.Errorf("applySecurityGroupRules() authorized %+v, want %+v", perms, want)
+	}
+}
+
+func Test_restoreSecurityGroup_noGroupID(t *testing.T) {
+	ec2 := EC2Instances{Client: mock.EC2Client{NewGroups: true, NoGroupID: true}}
+	_, _, err := restoreSecurityGroup(restoreInput{ec2Client: &ec2}, aws.String("baz"), aws.String("bar"), aws.String("sg-old"))
+	if err == nil {
+		t.Error("restoreSecurityGroup() should error when the new group has no id")
+	}
+}
@@ -0,0 +1,44 @@
+package aws
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// StsClient type for mocks
+type StsClient interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// StsOperations struct with the StsClient
+type StsOperations struct {
+	Client StsClient
+}
+
+// Identity is who lats is running as
+type Identity struct {
+	AccountID string
+	ARN       string
+}
+
+// CallerIdentity asks STS who lats is running as
+func (s StsOperations) CallerIdentity() (Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	output, err := s.Client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		slog.Warn("Error getting caller identity", "error", err)
+		return Identity{}, err
+	}
+	id := Identity{}
+	if output.Account != nil {
+		id.AccountID = *output.Account
+	}
+	if output.Arn != nil {
+		id.ARN = *output.Arn
+	}
+	return id, nil
+}
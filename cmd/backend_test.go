@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestNewBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       Config
+		want    string
+		wantErr bool
+	}{
+		{name: "default", c: Config{}, want: "local files"},
+		{name: "local", c: Config{Backend: &BackendConfig{Type: "local"}}, want: "local files"},
+		{name: "s3", c: Config{MainRegion: "us-east-1", Backend: &BackendConfig{Type: "s3", Bucket: "foo", Prefix: "lats"}}, want: "s3://foo/lats"},
+		{name: "s3NoBucket", c: Config{Backend: &BackendConfig{Type: "s3"}}, wantErr: true},
+		{name: "unknown", c: Config{Backend: &BackendConfig{Type: "gcs"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newBackend(tt.c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("newBackend() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBackend_Sqlite(t *testing.T) {
+	path := t.TempDir() + "/lats.db"
+	b, err := newBackend(Config{Backend: &BackendConfig{Type: "sqlite", Path: path}})
+	if err != nil {
+		t.Fatalf("newBackend() error = %v", err)
+	}
+	if _, ok := b.(state.Querier); !ok {
+		t.Errorf("expected the sqlite backend to answer queries")
+	}
+	if b.String() != "sqlite "+path {
+		t.Errorf("newBackend() = %s", b)
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	defer func() { state.Backend = state.LocalBackend{} }()
+	err := applyConfig(Config{MainRegion: "us-east-1", Backend: &BackendConfig{Type: "s3", Bucket: "foo"}})
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if _, ok := state.Backend.(aws.S3Backend); !ok {
+		t.Errorf("expected the s3 backend got %s", state.Backend)
+	}
+}
+
+func TestApplyConfig_Encryption(t *testing.T) {
+	defer func() { state.Encrypter = nil }()
+	err := applyConfig(Config{MainRegion: "us-east-1", Encryption: &EncryptionConfig{KmsKeyID: "mrk-1234"}})
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if !state.Encrypting() || state.Encrypter.KeyID != "mrk-1234" {
+		t.Errorf("expected encryption with mrk-1234 got %v", state.Encrypter)
+	}
+	err = applyConfig(Config{MainRegion: "us-east-1"})
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if state.Encrypter != nil {
+		t.Errorf("expected encryption to be off")
+	}
+}
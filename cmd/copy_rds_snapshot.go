@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
@@ -28,7 +31,9 @@ var (
 		Short:   "Copies a snapshot for a given DB",
 		Long:    "Copies a snapshot for an RDS or Aurora database into a new region",
 		Run: func(cmd *cobra.Command, args []string) {
-			copySnapshot()
+			res := NewResult(cmd)
+			err := copySnapshot(res)
+			finishCommand(res, err)
 		},
 	}
 )
@@ -38,18 +43,14 @@ func init() {
 	CopyRDSSnapshotCmd.Flags().StringVarP(&copySnapshotName, "new-snapshot", "c", "", "Name of the snapshot copy we are creating")
 	CopyRDSSnapshotCmd.Flags().StringVarP(&originalSnapshotName, "snapshot", "s", "", "Snapshot we want to copy")
 	CopyRDSSnapshotCmd.Flags().StringVarP(&configFile, "config-file", "f", "", "Config file for the snapshot that we want to parse")
+	CopyRDSSnapshotCmd.Flags().DurationVar(&snapshotWaitTimeout, "wait-timeout", 2*time.Hour, "how long to wait for the copy, lats ops wait carries on after")
+	CopyRDSSnapshotCmd.Flags().BoolVar(&noWait, "no-wait", false, "record the operation and return without waiting for the copy")
 }
 
-func copySnapshot() {
-	config, err := readConfig(".latsConfig.json")
-	if err != nil {
-		slog.Error("Error reading config", "error", err)
-	}
+// copySnapshot copies the snapshot of a stack to the backup region and records the copy and its stack in res
+func copySnapshot(res *Result) error {
+	config, sm := GetState()
 	stateFileName := config.StateFileName
-	sm, err := state.ReadState(stateFileName)
-	if err != nil {
-		slog.Error("Error reading state", "error", err)
-	}
 
 	if configFile != "" {
 		viper.SetConfigFile(configFile)
@@ -71,7 +72,12 @@ func copySnapshot() {
 	// Create KMS key
 	if kmsKey == "" {
 		slog.Info("creating KMS key")
-		kmsKey = createKMSKey(config)
+		key, err := createKMSKey(config)
+		if err != nil {
+			return err
+		}
+		kmsKey = *key.KeyId
+		res.Add(Resource{Type: "KMSKey", ID: kmsKey, ARN: derefString(key.Arn), Region: config.BackupRegion})
 	}
 
 	// Get RDS Client
@@ -82,157 +88,165 @@ func copySnapshot() {
 	origStack, err := FindStack(sm, originalSnapshotName)
 	if err != nil {
 		slog.Error("Error finding stack", "error", err)
+		return err
 	}
+	waitStart := time.Now()
 
+	var copied state.OperationResource
 	if origStack.RestorationObjectName == stack.Cluster {
 		slog.Info("copying cluster snapshot")
 		arn, err := dbi2.GetSnapshotARN(originalSnapshotName, true)
 		if err != nil {
 			slog.Error("Couldn't find snapshot ", "snapshot", originalSnapshotName)
+			return err
 		}
-		_, err = dbi.CopyClusterSnaphot(*arn, copySnapshotName, config.MainRegion, kmsKey)
+		snap, err := dbi.CopyClusterSnaphot(*arn, copySnapshotName, config.MainRegion, kmsKey)
 		if err != nil {
 			slog.Error("Couldn't copy snapshot ", "error", err)
+			return err
 		}
 
-		counter := 0
-		for {
-			status, err := dbi.GetClusterSnapshotStatus(copySnapshotName)
-			if err != nil {
-				slog.Error("error getting status", "error", err)
-			}
-			if *status == "available" {
-				break
-			}
-			if counter == 10 {
-				break
-			}
-			slog.Info("snapshot creation in progess", "Status", *status)
-			counter++
-			time.Sleep(30 * time.Second)
-		}
+		copied = state.OperationResource{Type: aws.ClusterSnapshotProgress, ID: copySnapshotName, ARN: derefString(snap.DBClusterSnapshotArn), Region: config.BackupRegion, Status: derefString(snap.Status)}
 	}
 	if origStack.RestorationObjectName == stack.LoneInstance {
 		slog.Info("copying instance snapshot")
 		iarn, err := dbi2.GetSnapshotARN(originalSnapshotName, false)
 		if err != nil {
 			slog.Error("Couldn't find snapshot ", "snapshot", originalSnapshotName)
+			return err
 		}
-		_, err = dbi.CopySnapshot(*iarn, copySnapshotName, config.MainRegion, kmsKey)
+		snap, err := dbi.CopySnapshot(*iarn, copySnapshotName, config.MainRegion, kmsKey)
 		if err != nil {
 			slog.Error("Couldn't copy snapshot ", "error", err)
+			return err
 		}
 
-		counter := 0
-		for {
-			status, err := dbi.GetInstanceSnapshotStatus(copySnapshotName)
-			if err != nil {
-				slog.Error("error getting status", "error", err)
-			}
-			if *status == "available" {
-				break
-			}
-			if counter == 10 {
-				break
-			}
-			slog.Info("snapshot creation in progess", "Status", *status)
-			counter++
-			time.Sleep(30 * time.Second)
-		}
+		copied = state.OperationResource{Type: aws.SnapshotProgress, ID: copySnapshotName, ARN: derefString(snap.DBSnapshotArn), Region: config.BackupRegion, Status: derefString(snap.Status)}
+	}
+	if copied.ID == "" {
+		return fmt.Errorf("stack %s restores a %s, only instance and cluster snapshots can be copied", origStack.Name, origStack.RestorationObjectName)
+	}
+	t, err := startOperation(&sm, stateFileName, state.Operation{
+		Kind:      state.OpCopySnapshot,
+		Params:    map[string]string{"snapshot": originalSnapshotName, "new-snapshot": copySnapshotName, "kms-key": kmsKey},
+		Stack:     copySnapshotName,
+		Resources: []state.OperationResource{copied},
+	})
+	if err != nil {
+		return err
 	}
 	stack := NewStack(*origStack, copySnapshotName)
+	stack.Metadata = copyMetadata(origStack.Metadata, origStack.Name, copySnapshotName, config.BackupRegion, kmsKey)
+	stack.Metadata = stampMetadata(stack.Metadata, aws.InitSts(config.BackupRegion))
 
 	fn := fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
 	err = stack.Write(fn)
 	if err != nil {
 		slog.Error("Couldn't write stack", "error", err)
+		return err
 	}
 
 	sm.UpdateState(stack.Name, fn, "stack")
-	sm.SyncState(stateFileName)
+	err = sm.SyncState(stateFileName)
+	if err != nil {
+		slog.Error("error saving state", "error", err)
+		return err
+	}
+	res.AddStack(stack.Name, fn)
+	err = finishOperation(t, res, snapshotWaitTimeout)
+	res.Add(Resource{Type: copied.Type, ID: copied.ID, ARN: copied.ARN, Region: copied.Region, Status: t.resourceStatus(copied.ID), DurationSeconds: time.Since(waitStart).Seconds()})
+	return err
 }
 
-func createKMSKey(config Config) string {
-	var kmsStruct *types.KeyMetadata
+func createKMSKey(config Config) (*types.KeyMetadata, error) {
 	c := aws.InitKms(config.BackupRegion)
 	kmsStruct, err := c.CreateKMSKey(nil)
 	if err != nil {
 		slog.Error("failed creating KMS key", "error", err)
+		return nil, err
 	}
-	return *kmsStruct.KeyId
-
+	return kmsStruct, nil
 }
 
-// FindStack get's a stack for creating our new stack when we copy the snapshot
+// FindStack reads the newest stack called snapshot, it's looked up in the backend's stack index or the state index so only that stack is read.
+// A stack that isn't in the state is a state.NotFoundError
 func FindStack(sm state.StateManager, snapshot string) (*stack.Stack, error) {
-	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
-	if len(sm.StateLocations) == 0 {
-		slog.Error("There are no state locations create a snapshot with Lats before attempting to copy it")
+	if f, ok := state.Backend.(state.StackFinder); ok {
+		return findIndexedStack(f, sm, snapshot)
 	}
-	slog.Info("state locations", "locations", sm.StateLocations)
-	for _, v := range sm.StateLocations {
-		slog.Info("Looping through objects this one is ", "name", v.Object)
-		if v.ObjectType != "stack" {
-			continue
-		}
-		stack, err := stack.ReadStack(v.FileLocation)
-		if err != nil {
-			slog.Error("error reading stack", "error", err)
-			return nil, err
-		}
-		if stack == nil {
-			slog.Error("Read stack returned a nil value")
-			return nil, nil
-		}
-		slog.Info("stack name is", "name", stack.Name, "snapshot", snapshot)
-		if stack.Name == snapshot {
-			return stack, nil
+	kv, err := sm.FindStack(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return stack.ReadStack(kv.FileLocation)
+}
+
+// findIndexedStack looks the stack up by the name in its document in the backend, the newest one this state file points at is read
+func findIndexedStack(f state.StackFinder, sm state.StateManager, snapshot string) (*stack.Stack, error) {
+	keys, err := f.FindStack(context.Background(), snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("looking up stack %s: %w", snapshot, err)
+	}
+	found := ""
+	for _, kv := range sm.StateLocations {
+		if kv.ObjectType == state.StackType && slices.Contains(keys, filepath.Clean(kv.FileLocation)) {
+			found = kv.FileLocation
 		}
 	}
-	slog.Error("Returning a nil stack")
-	return nil, nil
+	if found == "" {
+		return nil, &state.NotFoundError{ObjectType: state.StackType, Name: snapshot}
+	}
+	return stack.ReadStack(found)
 }
 
-// NewStack generates the new stack that we are going to use
+// NewStack generates the new stack that we are going to use, objects keep their IDs so the dependencies still line up
 func NewStack(oldStack stack.Stack, name string) *stack.Stack {
-	objs := make(map[int][]stack.Object)
-	for k, v := range oldStack.Objects {
-		objs[k] = []stack.Object{}
-		for _, i := range v {
-			obj := i.ReadObject()
-			switch i.ObjType {
-			case stack.LoneInstance:
-				slog.Info("Generating lone instance object")
-				s := getLoneInstanceObject(obj, name, k)
-				objs[k] = append(objs[k], s)
-			case stack.Cluster:
-				s := getClusterObject(obj, name, k)
-				objs[k] = append(objs[k], s)
-			case stack.Instance:
-				s := getInstanceObject(obj, name, k)
-				objs[k] = append(objs[k], s)
-			case stack.DBClusterParameterGroup:
-				objs[k] = append(objs[k], i)
-			case stack.DBParameterGroup:
-				objs[k] = append(objs[k], i)
-			case stack.SecurityGroup:
-				objs[k] = append(objs[k], i)
-			case stack.SecurityGroupRules:
-				objs[k] = append(objs[k], i)
+	objs := []stack.Object{}
+	for _, i := range oldStack.Objects {
+		switch i.ObjType {
+		case stack.LoneInstance:
+			slog.Info("Generating lone instance object")
+			s, err := getLoneInstanceObject(i, name)
+			if err != nil {
+				slog.Error("Error generating lone instance object", "error", err)
+				continue
 			}
-
+			objs = append(objs, s)
+		case stack.Cluster:
+			s, err := getClusterObject(i, name)
+			if err != nil {
+				slog.Error("Error generating cluster object", "error", err)
+				continue
+			}
+			objs = append(objs, s)
+		case stack.Instance:
+			s, err := getInstanceObject(i, name)
+			if err != nil {
+				slog.Error("Error generating instance object", "error", err)
+				continue
+			}
+			objs = append(objs, s)
+		case stack.DBClusterParameterGroup:
+			objs = append(objs, i)
+		case stack.DBParameterGroup:
+			objs = append(objs, i)
+		case stack.OptionGroup:
+			objs = append(objs, i)
+		case stack.SecurityGroup:
+			objs = append(objs, i)
+		case stack.SecurityGroupRules:
+			objs = append(objs, i)
 		}
 	}
-	return &stack.Stack{
-		Name:                  name,
-		RestorationObjectName: oldStack.RestorationObjectName,
-		Objects:               objs,
-	}
+	s := stack.NewStack(name, oldStack.RestorationObjectName, objs)
+	return &s
 }
 
-func getLoneInstanceObject(obj interface{}, name string, order int) stack.Object {
-	obj2 := obj.(*rds.RestoreDBInstanceFromDBSnapshotInput)
+func getLoneInstanceObject(obj stack.Object, name string) (stack.Object, error) {
+	obj2, err := stack.Read[*rds.RestoreDBInstanceFromDBSnapshotInput](obj)
+	if err != nil {
+		return stack.Object{}, err
+	}
 	insID := fmt.Sprintf("%s-instance", name)
 	obj2.DBInstanceIdentifier = &insID
 	obj2.DBSnapshotIdentifier = &copySnapshotName
@@ -241,23 +255,22 @@ func getLoneInstanceObject(obj interface{}, name string, order int) stack.Object
 	obj2.DBSubnetGroupName = nil
 	obj2.VpcSecurityGroupIds = nil
 	obj2.OptionGroupName = nil
-	b := state.EncodeRestoreDBInstanceFromDBSnapshotInput(obj2)
 	fn := fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
-	_, err := state.WriteOutput(fn, b)
+	s := stack.NewObject(obj.ID, fn, stack.LoneInstance, obj.DependsOn...)
+	err = stack.Write(s, obj2)
 	if err != nil {
 		slog.Error("Error writing ouptut", "error", err)
-	}
-	s := stack.Object{
-		FileName: fn,
-		Order:    order,
-		ObjType:  stack.LoneInstance,
+		return stack.Object{}, err
 	}
 	slog.Info("created stack object", "stack", s)
-	return s
+	return s, nil
 }
 
-func getClusterObject(obj interface{}, name string, order int) stack.Object {
-	obj2 := obj.(*rds.RestoreDBClusterFromSnapshotInput)
+func getClusterObject(obj stack.Object, name string) (stack.Object, error) {
+	obj2, err := stack.Read[*rds.RestoreDBClusterFromSnapshotInput](obj)
+	if err != nil {
+		return stack.Object{}, err
+	}
 	clsID := name
 	obj2.DBClusterIdentifier = &clsID
 	obj2.SnapshotIdentifier = &copySnapshotName
@@ -266,21 +279,21 @@ func getClusterObject(obj interface{}, name string, order int) stack.Object {
 	obj2.DBSubnetGroupName = nil
 	obj2.KmsKeyId = nil
 	obj2.VpcSecurityGroupIds = nil
-	b := state.EncodeRestoreDBClusterFromSnapshotInput(obj2)
 	fn := fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
-	_, err := state.WriteOutput(fn, b)
+	s := stack.NewObject(obj.ID, fn, stack.Cluster, obj.DependsOn...)
+	err = stack.Write(s, obj2)
 	if err != nil {
 		slog.Error("Error writing output", "Error", err)
+		return stack.Object{}, err
 	}
-	return stack.Object{
-		FileName: fn,
-		Order:    order,
-		ObjType:  stack.Cluster,
-	}
+	return s, nil
 }
 
-func getInstanceObject(obj interface{}, ending string, order int) stack.Object {
-	obj2 := obj.(rds.CreateDBInstanceInput)
+func getInstanceObject(obj stack.Object, ending string) (stack.Object, error) {
+	obj2, err := stack.Read[*rds.CreateDBInstanceInput](obj)
+	if err != nil {
+		return stack.Object{}, err
+	}
 	insID := fmt.Sprintf("%s-%s", *obj2.DBInstanceIdentifier, ending)
 	clusterID := fmt.Sprintf("%s-%s", *obj2.DBClusterIdentifier, ending)
 	obj2.DBInstanceIdentifier = &insID
@@ -288,15 +301,12 @@ func getInstanceObject(obj interface{}, ending string, order int) stack.Object {
 	obj2.AvailabilityZone = nil
 	obj2.DBParameterGroupName = nil
 	obj2.DBSubnetGroupName = nil
-	b := state.EncodeCreateDBInstanceInput(&obj2)
 	fn := fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
-	_, err := state.WriteOutput(fn, b)
+	s := stack.NewObject(obj.ID, fn, stack.Instance, obj.DependsOn...)
+	err = stack.Write(s, obj2)
 	if err != nil {
 		slog.Error("Error writing output", "Error", err)
+		return stack.Object{}, err
 	}
-	return stack.Object{
-		FileName: fn,
-		Order:    order,
-		ObjType:  stack.Instance,
-	}
+	return s, nil
 }
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
+	"github.com/jrottersman/lats/sqlitestate"
 	"github.com/jrottersman/lats/stack"
 	"github.com/jrottersman/lats/state"
 )
@@ -18,10 +21,14 @@ func TestFindStack(t *testing.T) {
 	obj := "boo"
 	ot := "bar"
 	sm.UpdateState(obj, filename, ot)
-	resp, _ := FindStack(sm, "baz")
+	resp, nferr := FindStack(sm, "baz")
 	if resp != nil {
 		t.Errorf("Expected nil got %v", resp)
 	}
+	var nf *state.NotFoundError
+	if !errors.As(nferr, &nf) || !errors.Is(nferr, state.ErrNotFound) {
+		t.Errorf("expected a NotFoundError got %v", nferr)
+	}
 	stk := stack.Stack{
 		Name:                  "foo",
 		RestorationObjectName: "stack",
@@ -36,4 +43,46 @@ func TestFindStack(t *testing.T) {
 	if exp.Name != stk.Name {
 		t.Errorf("got %s expected %s", exp.Name, stk.Name)
 	}
+	if kv := sm.StateLocations[1]; kv.Stack.Name != "foo" || kv.Stack.RestorationType != "stack" {
+		t.Errorf("expected the stack info to be in the state index got %+v", kv.Stack)
+	}
+}
+
+func TestFindStack_SQLite(t *testing.T) {
+	b, err := sqlitestate.Open(filepath.Join(t.TempDir(), "lats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	old := state.Backend
+	state.Backend = b
+	defer func() { state.Backend = old }()
+
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	for _, fn := range []string{".state/old.json", ".state/new.json"} {
+		stk := stack.Stack{Name: "nightly", RestorationObjectName: fn}
+		if err := stk.Write(fn); err != nil {
+			t.Fatal(err)
+		}
+		sm.UpdateState("nightly", fn, state.StackType)
+	}
+	// a stack written to the backend that this state file doesn't point at
+	other := stack.Stack{Name: "nightly", RestorationObjectName: "other"}
+	if err := other.Write(".state/other.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FindStack(sm, "nightly")
+	if err != nil {
+		t.Fatalf("FindStack() error = %v", err)
+	}
+	if got.RestorationObjectName != ".state/new.json" {
+		t.Errorf("FindStack() read %s want the newest stack", got.RestorationObjectName)
+	}
+	if _, err := FindStack(sm, "weekly"); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("FindStack() error = %v want %v", err, state.ErrNotFound)
+	}
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -26,7 +27,9 @@ var (
 		Short:   "Creates a snapshot for a given DB",
 		Long:    "Creates a snapshot for an RDS or Aurora database",
 		Run: func(cmd *cobra.Command, args []string) {
-			CreateSnapshot()
+			res := NewResult(cmd)
+			err := CreateSnapshot(res)
+			finishCommand(res, err)
 		},
 	}
 )
@@ -34,44 +37,62 @@ var (
 func init() {
 	CreateRDSSnapshotCmd.Flags().StringVarP(&dbName, "database-name", "d", "", "Database name we want to create the snapshot for")
 	CreateRDSSnapshotCmd.Flags().StringVarP(&snapshotName, "snapshot-name", "s", "", "Snapshot name that we want to create our snapshot with")
+	CreateRDSSnapshotCmd.Flags().DurationVar(&snapshotWaitTimeout, "wait-timeout", 2*time.Hour, "how long to wait for the snapshot, lats ops wait carries on after")
+	CreateRDSSnapshotCmd.Flags().BoolVar(&noWait, "no-wait", false, "record the operation and return without waiting for the snapshot")
 }
 
-// CreateSnapshot generates a snapshot in AWS
-func CreateSnapshot() {
+// CreateSnapshot generates a snapshot in AWS and records the snapshot and stack in res
+func CreateSnapshot(res *Result) error {
 	//Get Config and state
 	config, sm := GetState()
 	dbi := aws.Init(config.MainRegion)
 	ec2 := aws.InitEc2(config.MainRegion)
+	sts := aws.InitSts(config.MainRegion)
 	cluster, err := dbi.GetCluster(dbName)
 	if err != nil {
 		slog.Info("not a cluster with step 1 get cluster ", "error", err)
 	}
 	if cluster == nil {
 		c := CreateInstanceSnapshotInput{
-			dbi: dbi,
-			ec2: ec2,
-			sm:  sm,
-			sfn: config.StateFileName,
+			dbi:    dbi,
+			ec2:    ec2,
+			sts:    sts,
+			sm:     sm,
+			sfn:    config.StateFileName,
+			res:    res,
+			region: config.MainRegion,
 		}
-		createSnapshotForInstance(c)
-	} else {
-		c := CreateClusterSnapshotInput{
-			dbi:     dbi,
-			ec2:     ec2,
-			sm:      sm,
-			cluster: cluster,
-			sfn:     config.StateFileName,
-		}
-		createSnapshotForCluster(c)
+		return createSnapshotForInstance(c)
+	}
+	c := CreateClusterSnapshotInput{
+		dbi:     dbi,
+		ec2:     ec2,
+		sts:     sts,
+		sm:      sm,
+		cluster: cluster,
+		sfn:     config.StateFileName,
+		res:     res,
+		region:  config.MainRegion,
 	}
+	return createSnapshotForCluster(c)
 }
 
-func createSnapshotForCluster(c CreateClusterSnapshotInput) {
+func createSnapshotForCluster(c CreateClusterSnapshotInput) error {
 	slog.Info("creating snapshot for cluster")
 	snapshot, err := c.dbi.CreateClusterSnapshot(dbName, snapshotName)
 	if err != nil {
 		slog.Error("error creating snapshot", "error", err)
-		os.Exit(1)
+		return err
+	}
+	waitStart := time.Now()
+	t, err := startOperation(&c.sm, c.sfn, state.Operation{
+		Kind:      state.OpCreateSnapshot,
+		Params:    map[string]string{"database": dbName, "snapshot": snapshotName},
+		Stack:     snapshotName,
+		Resources: []state.OperationResource{{Type: aws.ClusterSnapshotProgress, ID: snapshotName, ARN: derefString(snapshot.DBClusterSnapshotArn), Region: c.region, Status: derefString(snapshot.Status)}},
+	})
+	if err != nil {
+		return err
 	}
 	// create a stack
 	store := state.RDSRestorationStore{
@@ -92,53 +113,57 @@ func createSnapshotForCluster(c CreateClusterSnapshotInput) {
 		}
 		sgOutput = state.SecurityGroupOutput{SecurityGroups: groups}
 	}
+	pgs, err := aws.GetClusterParameterGroup(store, c.dbi)
+	if err != nil {
+		slog.Warn("error getting cluster parameter groups", "error", err)
+	}
 	input := rdsstate.ClusterStackInput{
-		R:              store,
-		StackName:      snapshotName,
-		Client:         c.dbi,
-		SecurityGroups: &sgOutput,
-		Folder:         ".state",
+		R:               store,
+		StackName:       snapshotName,
+		Client:          c.dbi,
+		ParameterGroups: pgs,
+		SecurityGroups:  &sgOutput,
+		Folder:          ".state",
 	}
 	slog.Info("generating the stack")
 	stack, err := rdsstate.GenerateRDSClusterStack(input)
 	if err != nil {
 		slog.Error("error generating stack ", "error", err)
-		os.Exit(1)
-	}
-	counter := 0
-	for {
-		status, err := c.dbi.GetClusterSnapshotStatus(snapshotName)
-		if err != nil {
-			slog.Error("error getting status", "error", err)
-		}
-		if *status == "available" {
-			break
-		}
-		if counter == 10 {
-			break
-		}
-		slog.Info("snapshot creation in progess", "Status", *status)
-		counter++
-		time.Sleep(30 * time.Second)
+		return err
 	}
+	stack.Metadata = stampMetadata(stack.Metadata, c.sts)
 	stackFn := fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
 	slog.Info("Writing the stack")
 	err = stack.Write(stackFn)
 	if err != nil {
 		slog.Error("error writing stack ", "error", err)
-		os.Exit(1)
+		return err
 	}
 	c.sm.UpdateState(snapshotName, stackFn, "stack")
-	c.sm.SyncState(c.sfn)
-	slog.Info("Snapshot created")
+	err = c.sm.SyncState(c.sfn)
+	if err != nil {
+		slog.Error("error saving state", "error", err)
+		return err
+	}
+	c.res.AddStack(snapshotName, stackFn)
+	err = finishOperation(t, c.res, snapshotWaitTimeout)
+	c.res.Add(Resource{Type: "DBClusterSnapshot", ID: snapshotName, ARN: derefString(snapshot.DBClusterSnapshotArn), Region: c.region, Status: t.resourceStatus(snapshotName), DurationSeconds: time.Since(waitStart).Seconds()})
+	if err != nil {
+		return err
+	}
+	slog.Info("Snapshot created", "status", t.resourceStatus(snapshotName))
+	return nil
 }
 
-func createSnapshotForInstance(c CreateInstanceSnapshotInput) {
+func createSnapshotForInstance(c CreateInstanceSnapshotInput) error {
 	slog.Info("starting create snapshot for instance")
 	db, err := c.dbi.GetInstance(dbName)
 	if err != nil {
 		slog.Warn("didn't get instance", "problem", err)
 	}
+	if db == nil {
+		return fmt.Errorf("there's no instance or cluster called %s", dbName)
+	}
 	sgs := db.VpcSecurityGroups
 	var sgOutput state.SecurityGroupOutput
 	if len(sgs) != 0 {
@@ -157,6 +182,17 @@ func createSnapshotForInstance(c CreateInstanceSnapshotInput) {
 	snapshot, err := c.dbi.CreateSnapshot(dbName, snapshotName)
 	if err != nil {
 		slog.Error("error creating snapshot: ", "error", err)
+		return err
+	}
+	waitStart := time.Now()
+	t, err := startOperation(&c.sm, c.sfn, state.Operation{
+		Kind:      state.OpCreateSnapshot,
+		Params:    map[string]string{"database": dbName, "snapshot": snapshotName},
+		Stack:     snapshotName,
+		Resources: []state.OperationResource{{Type: aws.SnapshotProgress, ID: snapshotName, ARN: derefString(snapshot.DBSnapshotArn), Region: c.region, Status: derefString(snapshot.Status)}},
+	})
+	if err != nil {
+		return err
 	}
 
 	store := state.RDSRestorationStore{
@@ -169,40 +205,41 @@ func createSnapshotForInstance(c CreateInstanceSnapshotInput) {
 		slog.Warn("error getting parameter groups", "error", err)
 	}
 
+	og, err := aws.GetCustomOptionGroup(store, c.dbi)
+	if err != nil {
+		slog.Warn("error getting option group", "error", err)
+	}
+
 	stackInput := rdsstate.InstanceStackInputs{
 		R:               store,
 		StackName:       snapshotName,
 		ParameterGroups: pgs,
+		OptionGroup:     og,
 		SecurityGroups:  &sgOutput,
 	}
 	slog.Debug("generating stack")
 	stack, err := rdsstate.GenerateRDSInstanceStack(stackInput)
 	if err != nil {
 		slog.Warn("error generating stack", "error", err)
+		return err
 	}
+	stack.Metadata = stampMetadata(stack.Metadata, c.sts)
 	stackFn := fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
 	err = stack.Write(stackFn)
 	if err != nil {
 		slog.Warn("error writing stack", "error", err)
-	}
-	counter := 0
-	for {
-		status, err := c.dbi.GetInstanceSnapshotStatus(snapshotName)
-		if err != nil {
-			slog.Error("error getting status", "error", err)
-		}
-		if *status == "available" {
-			break
-		}
-		if counter == 10 {
-			break
-		}
-		slog.Info("snapshot creation in progess", "Status", *status)
-		counter++
-		time.Sleep(30 * time.Second)
+		return err
 	}
 	c.sm.UpdateState(snapshotName, stackFn, "stack")
-	c.sm.SyncState(c.sfn)
+	err = c.sm.SyncState(c.sfn)
+	if err != nil {
+		slog.Error("error saving state", "error", err)
+		return err
+	}
+	c.res.AddStack(snapshotName, stackFn)
+	err = finishOperation(t, c.res, snapshotWaitTimeout)
+	c.res.Add(Resource{Type: "DBSnapshot", ID: snapshotName, ARN: derefString(snapshot.DBSnapshotArn), Region: c.region, Status: t.resourceStatus(snapshotName), DurationSeconds: time.Since(waitStart).Seconds()})
+	return err
 }
 
 // GetState reads in our statefile and config for future processing
@@ -212,9 +249,24 @@ func GetState() (Config, state.StateManager) {
 	if err != nil {
 		slog.Warn("Error reading config", "error", err)
 	}
+	config, err = config.ForWorkspace(workspaceName)
+	if err != nil {
+		slog.Error("Error selecting the workspace", "error", err)
+		os.Exit(1)
+	}
+	err = applyConfig(config)
+	if err != nil {
+		slog.Error("Error setting up the state backend", "error", err)
+		os.Exit(1)
+	}
 	slog.Debug("Getting state")
 	stateFileName := config.StateFileName
 	sm, err := state.ReadState(stateFileName)
+	var verr *state.VersionError
+	if errors.As(err, &verr) {
+		slog.Error("Refusing to use state from a newer lats", "error", err)
+		os.Exit(1)
+	}
 	if err != nil {
 		slog.Warn("Error reading state", "error", err)
 	}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	describeFormat string
+
+	// DescribeCmd prints everything in a stack
+	DescribeCmd = &cobra.Command{
+		Use:   "describe stack",
+		Short: "Prints a stack's restore inputs and the objects they depend on",
+		Long: "Describe decodes every object in a stack. The restore inputs come first with the fields restore will override or null, " +
+			"then the parameter groups, option group and security groups they depend on in the order they're restored",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sm := GetState()
+			format := describeFormat
+			if format == "" {
+				format = outputFormat
+			}
+			err := DescribeStack(sm, args[0], format, os.Stdout)
+			if err != nil {
+				slog.Error("error describing stack", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	DescribeCmd.Flags().StringVar(&describeFormat, "format", "", "yaml or json, defaults to --output and text is yaml")
+}
+
+// StackDescription is a stack with its objects decoded
+type StackDescription struct {
+	Name            string              `json:"name"`
+	RestorationType string              `json:"restorationType"`
+	File            string              `json:"file"`
+	Metadata        state.StackMetadata `json:"metadata,omitzero"`
+	Restore         []ObjectDescription `json:"restore"`      // Restore are the objects that restore the database
+	Dependencies    []ObjectDescription `json:"dependencies"` // Dependencies are the other objects in the order they're restored
+}
+
+// ObjectDescription is a decoded stack object, fields that are null aren't in Data
+type ObjectDescription struct {
+	ID             string              `json:"id"`
+	Type           string              `json:"type"`
+	File           string              `json:"file"`
+	DependsOn      []string            `json:"dependsOn,omitempty"`
+	RestoreChanges []aws.RestoreChange `json:"restoreChanges,omitempty"`
+	Data           interface{}         `json:"data,omitempty"`
+	Error          string              `json:"error,omitempty"` // Error is why the object couldn't be decoded
+}
+
+// DescribeStack writes the newest stack called name with its objects decoded as YAML or JSON, text is YAML
+func DescribeStack(sm state.StateManager, name string, format string, out io.Writer) error {
+	if format == OutputText {
+		format = OutputYAML
+	}
+	kv, err := sm.FindStack(name)
+	if err != nil {
+		return err
+	}
+	d, err := describeStack(kv)
+	if err != nil {
+		return err
+	}
+	return writeStructured(d, format, out)
+}
+
+func describeStack(kv state.StateKV) (StackDescription, error) {
+	s, err := stack.ReadStack(kv.FileLocation)
+	if err != nil {
+		return StackDescription{}, err
+	}
+	levels, err := s.Levels()
+	if err != nil {
+		return StackDescription{}, err
+	}
+	d := StackDescription{
+		Name:            s.Name,
+		RestorationType: s.RestorationObjectName,
+		File:            kv.FileLocation,
+		Metadata:        s.Metadata,
+		Restore:         []ObjectDescription{},
+		Dependencies:    []ObjectDescription{},
+	}
+	for _, level := range levels {
+		for _, o := range level {
+			od := describeObject(o)
+			if len(od.RestoreChanges) > 0 {
+				d.Restore = append(d.Restore, od)
+			} else {
+				d.Dependencies = append(d.Dependencies, od)
+			}
+		}
+	}
+	return d, nil
+}
+
+// describeObject decodes an object, one that can't be decoded has the error instead so the rest of the stack is still shown
+func describeObject(o stack.Object) ObjectDescription {
+	od := ObjectDescription{ID: o.ID, Type: o.ObjType, File: o.FileName, DependsOn: o.DependsOn, RestoreChanges: aws.RestoreChanges(o.ObjType)}
+	v, err := stack.Decode(o)
+	if err != nil {
+		od.Error = err.Error()
+		return od
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		od.Error = err.Error()
+		return od
+	}
+	od.Data, err = decodeOrdered(b, true)
+	if err != nil {
+		od.Error = err.Error()
+	}
+	return od
+}
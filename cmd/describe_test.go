@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/pgstate"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestDescribeStack(t *testing.T) {
+	t.Chdir(t.TempDir())
+	pgObj := stack.NewObject("parameter-group", ".state/pg.json", stack.DBParameterGroup)
+	err := stack.Write(pgObj, []pgstate.ParameterGroup{{ParameterGroup: types.DBParameterGroup{DBParameterGroupName: aws.String("orders-pg")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	insObj := stack.NewObject("instance", ".state/instance.json", stack.LoneInstance, "parameter-group")
+	err = stack.Write(insObj, &rds.RestoreDBInstanceFromDBSnapshotInput{DBInstanceIdentifier: aws.String("orders"), DBSnapshotIdentifier: aws.String("nightly"), AllocatedStorage: aws.Int32(20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stack.NewStack("nightly", stack.LoneInstance, []stack.Object{insObj, pgObj})
+	s.Metadata = state.StackMetadata{Engine: "postgres"}
+	if err := s.Write(".state/nightly.json"); err != nil {
+		t.Fatal(err)
+	}
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("nightly", ".state/nightly.json", state.StackType)
+
+	var out bytes.Buffer
+	if err := DescribeStack(sm, "nightly", "json", &out); err != nil {
+		t.Fatalf("DescribeStack() error = %v", err)
+	}
+	var d StackDescription
+	if err := json.Unmarshal(out.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Restore) != 1 || d.Restore[0].ID != "instance" || len(d.Dependencies) != 1 || d.Dependencies[0].ID != "parameter-group" {
+		t.Fatalf("got restore %v dependencies %v", d.Restore, d.Dependencies)
+	}
+	if len(d.Restore[0].RestoreChanges) == 0 || d.Metadata.Engine != "postgres" {
+		t.Errorf("expected restore changes and metadata got %+v", d)
+	}
+	data := d.Restore[0].Data.(map[string]interface{})
+	if data["DBSnapshotIdentifier"] != "nightly" || data["AllocatedStorage"] != float64(20) {
+		t.Errorf("got data %v", data)
+	}
+	if _, ok := data["DBParameterGroupName"]; ok {
+		t.Errorf("expected null fields to be dropped got %v", data)
+	}
+
+	out.Reset()
+	if err := DescribeStack(sm, "nightly", "yaml", &out); err != nil {
+		t.Fatalf("DescribeStack() error = %v", err)
+	}
+	for _, want := range []string{"name: nightly\nrestorationType: SingleRDSInstance\n", "    DBSnapshotIdentifier: nightly\n", "      - field: DBParameterGroupName\n        action: overridden\n", "AllocatedStorage: 20\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in\n%s", want, out.String())
+		}
+	}
+	if err := DescribeStack(sm, "weekly", "yaml", &out); err == nil {
+		t.Error("expected a stack that isn't in state to fail")
+	}
+}
+
+func TestWriteStructured(t *testing.T) {
+	v := struct {
+		Name  string   `json:"name"`
+		Flag  string   `json:"flag"`
+		Count int      `json:"count"`
+		Ratio float64  `json:"ratio"`
+		On    bool     `json:"on"`
+		Tags  []string `json:"tags"`
+		None  *string  `json:"none"`
+		Empty struct{} `json:"empty"`
+	}{"nightly", "true", 3, 0.5, true, []string{"a"}, nil, struct{}{}}
+	var out bytes.Buffer
+	if err := writeStructured(v, "yaml", &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "name: nightly\nflag: \"true\"\ncount: 3\nratio: 0.5\non: true\ntags:\n  - a\nnone: null\nempty: {}\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nexpected\n%s", out.String(), want)
+	}
+	if err := writeStructured(v, "toml", &out); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/rdsstate"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	importStackName string
+
+	// ImportCmd groups the commands that bring things lats didn't create into state
+	ImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Adopt existing AWS resources into lats state",
+	}
+
+	importSnapshotCmd = &cobra.Command{
+		Use:   "snapshot id",
+		Short: "Adopts an existing RDS or Aurora snapshot",
+		Long: "Import snapshot describes a manual, automated or shared snapshot in the main region and builds a stack for it so it can be copied and restored like one lats created. " +
+			"The parameter groups, option group and security groups come from the instance or cluster the snapshot was taken from, when that's gone the stack only has the snapshot",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			dbi := aws.Init(config.MainRegion)
+			ec2 := aws.InitEc2(config.MainRegion)
+			sts := aws.InitSts(config.MainRegion)
+			err := ImportSnapshot(dbi, ec2, sts, &sm, config.StateFileName, args[0], importStackName, os.Stdout)
+			if err != nil {
+				slog.Error("error importing snapshot", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	importSnapshotCmd.Flags().StringVar(&importStackName, "name", "", "name of the stack, defaults to the snapshot id")
+	ImportCmd.AddCommand(importSnapshotCmd)
+}
+
+// ImportSnapshot builds a stack called name for the snapshot id and adds it to the state, instance snapshots are looked for before cluster snapshots
+func ImportSnapshot(dbi aws.DbInstances, ec2 aws.EC2Instances, sts aws.StsOperations, sm *state.StateManager, stateFileName string, id string, name string, out io.Writer) error {
+	if name == "" {
+		name = id
+	}
+	if exists, err := stackExists(sm, name); err != nil || exists {
+		if err == nil {
+			err = fmt.Errorf("there's already a stack called %s, pass --name", name)
+		}
+		return err
+	}
+	var s *stack.Stack
+	snap, err := dbi.GetSnapshot(id)
+	if err != nil {
+		return err
+	}
+	if snap != nil {
+		s, err = importInstanceSnapshot(dbi, ec2, snap, name, out)
+	} else {
+		csnap, cerr := dbi.GetClusterSnapshot(id)
+		if cerr != nil {
+			return cerr
+		}
+		if csnap == nil {
+			return fmt.Errorf("there's no instance or cluster snapshot called %s", id)
+		}
+		s, err = importClusterSnapshot(dbi, ec2, csnap, name, out)
+	}
+	if err != nil {
+		return err
+	}
+	s.Metadata = stampMetadata(s.Metadata, sts)
+	fn := fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
+	err = s.Write(fn)
+	if err != nil {
+		return err
+	}
+	sm.UpdateState(name, fn, state.StackType)
+	err = sm.SyncState(stateFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "imported %s as stack %s\n", id, name)
+	return nil
+}
+
+func importInstanceSnapshot(dbi aws.DbInstances, ec2 aws.EC2Instances, snap *types.DBSnapshot, name string, out io.Writer) (*stack.Stack, error) {
+	store := state.RDSRestorationStore{Snapshot: snap}
+	input := rdsstate.InstanceStackInputs{R: store, StackName: name}
+	var db *types.DBInstance
+	var err error
+	if snap.DBInstanceIdentifier != nil {
+		db, err = dbi.GetInstance(*snap.DBInstanceIdentifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if db == nil {
+		fmt.Fprintln(out, "the instance the snapshot was taken from is gone so the stack only has the snapshot, pass the parameter group, option group and security groups when restoring")
+		return rdsstate.GenerateRDSInstanceStack(input)
+	}
+	input.R.Instance = db
+	input.SecurityGroups, err = securityGroupOutput(ec2, db.VpcSecurityGroups)
+	if err != nil {
+		return nil, err
+	}
+	input.ParameterGroups, err = aws.GetParameterGroups(input.R, dbi)
+	if err != nil {
+		return nil, err
+	}
+	input.OptionGroup, err = aws.GetCustomOptionGroup(input.R, dbi)
+	if err != nil {
+		return nil, err
+	}
+	return rdsstate.GenerateRDSInstanceStack(input)
+}
+
+func importClusterSnapshot(dbi aws.DbInstances, ec2 aws.EC2Instances, snap *types.DBClusterSnapshot, name string, out io.Writer) (*stack.Stack, error) {
+	store := state.RDSRestorationStore{ClusterSnapshot: snap}
+	input := rdsstate.ClusterStackInput{R: store, StackName: name, Client: dbi, Folder: ".state"}
+	var cluster *types.DBCluster
+	var err error
+	if snap.DBClusterIdentifier != nil {
+		cluster, err = dbi.GetCluster(*snap.DBClusterIdentifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cluster == nil {
+		fmt.Fprintln(out, "the cluster the snapshot was taken from is gone so the stack only has the snapshot, it restores a cluster without instances")
+		return rdsstate.GenerateRDSClusterStack(input)
+	}
+	input.R.Cluster = cluster
+	input.SecurityGroups, err = securityGroupOutput(ec2, cluster.VpcSecurityGroups)
+	if err != nil {
+		return nil, err
+	}
+	input.ParameterGroups, err = aws.GetClusterParameterGroup(input.R, dbi)
+	if err != nil {
+		return nil, err
+	}
+	return rdsstate.GenerateRDSClusterStack(input)
+}
+
+// securityGroupOutput describes the security groups a database is in, it's nil when it isn't in any
+func securityGroupOutput(ec2 aws.EC2Instances, sgs []types.VpcSecurityGroupMembership) (*state.SecurityGroupOutput, error) {
+	if len(sgs) == 0 {
+		return nil, nil
+	}
+	out, err := getSGs(ec2, sgs)
+	if err != nil {
+		return nil, err
+	}
+	var groups []ec2types.SecurityGroup
+	for _, v := range out {
+		groups = append(groups, v.SecurityGroups...)
+	}
+	return &state.SecurityGroupOutput{SecurityGroups: groups}, nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	latsaws "github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+// importRDSClient has one snapshot and says the database it was taken from is gone when gone is set
+type importRDSClient struct {
+	mock.MockRDSClient
+	snapshot        *types.DBSnapshot
+	clusterSnapshot *types.DBClusterSnapshot
+	gone            bool
+}
+
+func (c importRDSClient) DescribeDBSnapshots(ctx context.Context, params *rds.DescribeDBSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error) {
+	if c.snapshot == nil {
+		return nil, &types.DBSnapshotNotFoundFault{}
+	}
+	return &rds.DescribeDBSnapshotsOutput{DBSnapshots: []types.DBSnapshot{*c.snapshot}}, nil
+}
+
+func (c importRDSClient) DescribeDBClusterSnapshots(ctx context.Context, params *rds.DescribeDBClusterSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotsOutput, error) {
+	if c.clusterSnapshot == nil {
+		return nil, &types.DBClusterSnapshotNotFoundFault{}
+	}
+	return &rds.DescribeDBClusterSnapshotsOutput{DBClusterSnapshots: []types.DBClusterSnapshot{*c.clusterSnapshot}}, nil
+}
+
+func (c importRDSClient) DescribeDBInstances(ctx context.Context, input *rds.DescribeDBInstancesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	if c.gone {
+		return nil, &types.DBInstanceNotFoundFault{}
+	}
+	return &rds.DescribeDBInstancesOutput{DBInstances: []types.DBInstance{{
+		DBInstanceIdentifier:   input.DBInstanceIdentifier,
+		DBInstanceClass:        aws.String("db.t3.micro"),
+		DBParameterGroups:      []types.DBParameterGroupStatus{{DBParameterGroupName: aws.String("pg")}},
+		OptionGroupMemberships: []types.OptionGroupMembership{{OptionGroupName: aws.String("og")}},
+		VpcSecurityGroups:      []types.VpcSecurityGroupMembership{{VpcSecurityGroupId: aws.String("sg-1")}},
+	}}}, nil
+}
+
+func (c importRDSClient) DescribeDBClusters(ctx context.Context, params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	if c.gone {
+		return nil, &types.DBClusterNotFoundFault{}
+	}
+	return c.MockRDSClient.DescribeDBClusters(ctx, params, optFns...)
+}
+
+func TestImportSnapshot(t *testing.T) {
+	instanceSnap := &types.DBSnapshot{DBSnapshotIdentifier: aws.String("rds:db-2024-01-01"), DBInstanceIdentifier: aws.String("db")}
+	clusterSnap := &types.DBClusterSnapshot{DBClusterSnapshotIdentifier: aws.String("aurora-manual"), DBClusterIdentifier: aws.String("aurora"), Engine: aws.String("aurora-postgresql")}
+	tests := []struct {
+		name        string
+		client      importRDSClient
+		id          string
+		restores    string
+		wantObjects []string
+		wantErr     bool
+	}{
+		{"instance", importRDSClient{snapshot: instanceSnap}, "rds:db-2024-01-01", stack.LoneInstance, []string{"parameter-group", "option-group", "security-groups", "security-group-rules", "instance"}, false},
+		{"instance gone", importRDSClient{snapshot: instanceSnap, gone: true}, "rds:db-2024-01-01", stack.LoneInstance, []string{"parameter-group", "instance"}, false},
+		{"cluster", importRDSClient{clusterSnapshot: clusterSnap}, "aurora-manual", stack.Cluster, []string{"parameter-group", "cluster", "instance-foo"}, false},
+		{"cluster gone", importRDSClient{clusterSnapshot: clusterSnap, gone: true}, "aurora-manual", stack.Cluster, []string{"parameter-group", "cluster"}, false},
+		{"missing", importRDSClient{}, "nope", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			sm := state.StateManager{Mu: &sync.Mutex{}}
+			dbi := latsaws.DbInstances{RdsClient: tt.client}
+			ec2 := latsaws.EC2Instances{Client: mock.EC2Client{}}
+			sts := latsaws.StsOperations{Client: mock.StsClient{Account: "123456789012", ARN: "arn:aws:iam::123456789012:user/dr"}}
+			err := ImportSnapshot(dbi, ec2, sts, &sm, ".confState.json", tt.id, "", io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportSnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			s, err := FindStack(sm, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.RestorationObjectName != tt.restores || len(s.Objects) != len(tt.wantObjects) {
+				t.Fatalf("got a %s stack with %v expected %s %v", s.RestorationObjectName, s.Objects, tt.restores, tt.wantObjects)
+			}
+			for i, o := range s.Objects {
+				if o.ID != tt.wantObjects[i] {
+					t.Errorf("object %d is %s expected %s", i, o.ID, tt.wantObjects[i])
+				}
+			}
+			if err := s.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			md := s.Metadata
+			if md.Snapshot != tt.id || md.CreatedBy != "arn:aws:iam::123456789012:user/dr" || md.AccountID != "123456789012" || md.Created.IsZero() || md.LatsVersion == "" {
+				t.Errorf("got metadata %+v", md)
+			}
+			kv, _ := sm.FindStack(tt.id)
+			if kv.Stack.Metadata != md {
+				t.Errorf("state index has %+v expected %+v", kv.Stack.Metadata, md)
+			}
+			// importing it again needs another name
+			if err := ImportSnapshot(dbi, ec2, sts, &sm, ".confState.json", tt.id, "", io.Discard); err == nil {
+				t.Errorf("expected importing %s twice to fail", tt.id)
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
+	"github.com/jrottersman/lats/aws"
 	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/sqlitestate"
 	"github.com/jrottersman/lats/state"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,9 +17,149 @@ import (
 
 // Config tells us our regions and where the state file is
 type Config struct {
-	MainRegion    string `json:"mainRegion"`
-	BackupRegion  string `json:"backupRegion"`
-	StateFileName string `json:"stateFileName"`
+	MainRegion    string            `json:"mainRegion"`
+	BackupRegion  string            `json:"backupRegion"`
+	StateFileName string            `json:"stateFileName"`
+	StateBackups  *int              `json:"stateBackups,omitempty"` // StateBackups is how many old state files to keep, defaults to state.MaxBackups
+	Backend       *BackendConfig    `json:"backend,omitempty"`      // Backend is where state is kept, the working directory when it's not set
+	Replica       *ReplicaConfig    `json:"replica,omitempty"`      // Replica is the bucket in the backup region state is copied to
+	Encryption    *EncryptionConfig `json:"encryption,omitempty"`   // Encryption turns on encrypting stack objects with a KMS key
+	Profile       string            `json:"profile,omitempty"`      // Profile is the AWS shared config profile, the default credential chain is used when it's not set
+
+	Workspace  string                     `json:"workspace,omitempty"`  // Workspace is the selected workspace, the settings above are the default workspace
+	Workspaces map[string]WorkspaceConfig `json:"workspaces,omitempty"` // Workspaces are other estates with their own regions, credentials and state
+}
+
+// EncryptionConfig is the KMS key stack objects are encrypted with
+type EncryptionConfig struct {
+	KmsKeyID string `json:"kmsKeyId,omitempty"` // KmsKeyID encrypts new objects, leave it empty to only decrypt the ones already encrypted
+	Region   string `json:"region,omitempty"`   // Region of the key, defaults to the main region. Multi-Region keys can be decrypted in the backup region
+}
+
+// ReplicaConfig is the S3 bucket in the backup region lats copies state to after every sync
+type ReplicaConfig struct {
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix,omitempty"`
+	Endpoint     string `json:"endpoint,omitempty"`
+	UsePathStyle bool   `json:"usePathStyle,omitempty"`
+}
+
+// backend is the replica's backend in region
+func (r ReplicaConfig) backend(region string) aws.S3Backend {
+	return aws.InitS3Backend(aws.S3BackendConfig{
+		Region:       region,
+		Endpoint:     r.Endpoint,
+		UsePathStyle: r.UsePathStyle,
+		Bucket:       r.Bucket,
+		Prefix:       r.Prefix,
+	})
+}
+
+// BackendConfig says where lats keeps state
+type BackendConfig struct {
+	Type         string `json:"type"`                   // Type is local, s3 or sqlite
+	Bucket       string `json:"bucket,omitempty"`       // Bucket is the S3 bucket state is kept in
+	Prefix       string `json:"prefix,omitempty"`       // Prefix is put in front of every key in the bucket
+	Region       string `json:"region,omitempty"`       // Region of the bucket, defaults to the main region
+	Endpoint     string `json:"endpoint,omitempty"`     // Endpoint is for S3 compatible servers like MinIO
+	UsePathStyle bool   `json:"usePathStyle,omitempty"` // UsePathStyle is needed by most S3 compatible servers
+	Path         string `json:"path,omitempty"`         // Path is the sqlite database, defaults to .lats.db. For local state it's the directory state is kept in
+}
+
+// applyConfig sets the package level settings that come from the config
+func applyConfig(c Config) error {
+	aws.Profile = c.Profile
+	if c.StateBackups != nil {
+		state.MaxBackups = *c.StateBackups
+	}
+	backend, err := newBackend(c)
+	if err != nil {
+		return err
+	}
+	state.Backend = backend
+	state.Replica = nil
+	if c.Replica != nil {
+		if c.Replica.Bucket == "" {
+			return fmt.Errorf("the replica needs a bucket")
+		}
+		if c.BackupRegion == "" {
+			return fmt.Errorf("the replica needs a backup region")
+		}
+		state.Replica = &state.Replication{
+			Backend: c.Replica.backend(c.BackupRegion),
+			Files:   []string{".latsConfig.json"},
+		}
+	}
+	state.Encrypter = nil
+	if c.Encryption != nil {
+		region := c.Encryption.Region
+		if region == "" {
+			region = c.MainRegion
+		}
+		state.Encrypter = &state.Encryption{Keys: aws.InitKms(region), KeyID: c.Encryption.KmsKeyID}
+		if state.Replica != nil && c.Encryption.KmsKeyID != "" && region == c.MainRegion && !maybeMultiRegion(c.Encryption.KmsKeyID) {
+			slog.Warn(singleRegionKeyWarning, "key", c.Encryption.KmsKeyID, "region", region)
+		}
+	}
+	return nil
+}
+
+const singleRegionKeyWarning = "stack objects are encrypted with a key that's only in the main region, the replica can't be decrypted if the main region is lost. Use a Multi-Region key or a key in the backup region"
+
+// maybeMultiRegion is false when keyID is an ID or ARN that isn't a Multi-Region key, their IDs start with mrk-. Aliases could be either
+func maybeMultiRegion(keyID string) bool {
+	return strings.Contains(keyID, "mrk-") || strings.Contains(keyID, "alias/")
+}
+
+// singleRegionKey asks KMS whether the replica's stack objects are encrypted with a key only the main region has
+func singleRegionKey(c Config, keys func(region string) aws.KmsOperations) (bool, error) {
+	if c.Replica == nil || c.Encryption == nil || c.Encryption.KmsKeyID == "" {
+		return false, nil
+	}
+	region := c.Encryption.Region
+	if region == "" {
+		region = c.MainRegion
+	}
+	if region != c.MainRegion {
+		return false, nil
+	}
+	mr, err := keys(region).MultiRegion(c.Encryption.KmsKeyID)
+	if err != nil {
+		return false, err
+	}
+	return !mr, nil
+}
+
+func newBackend(c Config) (state.StateBackend, error) {
+	if c.Backend == nil {
+		return state.LocalBackend{}, nil
+	}
+	switch c.Backend.Type {
+	case "", "local":
+		return state.LocalBackend{Dir: c.Backend.Path}, nil
+	case "s3":
+		if c.Backend.Bucket == "" {
+			return nil, fmt.Errorf("the s3 backend needs a bucket")
+		}
+		region := c.Backend.Region
+		if region == "" {
+			region = c.MainRegion
+		}
+		return aws.InitS3Backend(aws.S3BackendConfig{
+			Region:       region,
+			Endpoint:     c.Backend.Endpoint,
+			UsePathStyle: c.Backend.UsePathStyle,
+			Bucket:       c.Backend.Bucket,
+			Prefix:       c.Backend.Prefix,
+		}), nil
+	case "sqlite":
+		path := c.Backend.Path
+		if path == "" {
+			path = ".lats.db"
+		}
+		return sqlitestate.Open(path)
+	}
+	return nil, fmt.Errorf("unknown backend type %s, use local, s3 or sqlite", c.Backend.Type)
 }
 
 var (
@@ -29,34 +173,67 @@ var (
 		Short:   "Initalizes lats and configures it for creating backups",
 		Long:    "Initalize (lats init) will setup lats with the correct regions and let you choose where you want to store state",
 		Run: func(cmd *cobra.Command, args []string) {
-			slog.Info("Initalizing lats")
-			viper.SetConfigName(".latsConfig")
-			viper.SetConfigType("json")
-			viper.AddConfigPath(".")
-
-			if err := viper.ReadInConfig(); err != nil {
-				if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-					genConfigFile()
-				} else {
-					slog.Error("Error parsing config file ", "error", err)
-				}
-			}
-
-			// Config file found and successfully parsed
-			state.InitState(".confState.json")
-			os.Mkdir(".state", os.ModePerm)
-
+			res := NewResult(cmd)
+			err := initLats(res)
+			finishCommand(res, err)
 		},
 	}
 )
 
-func genConfigFile() {
+// initLats writes the config when there isn't one and creates the state file and .state directory, what it made is recorded in res
+func initLats(res *Result) error {
+	slog.Info("Initalizing lats")
+	viper.SetConfigName(".latsConfig")
+	viper.SetConfigType("json")
+	viper.AddConfigPath(".")
+
+	configStatus := "exists"
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			err = genConfigFile()
+			if err != nil {
+				return err
+			}
+			configStatus = "created"
+		} else {
+			slog.Error("Error parsing config file ", "error", err)
+		}
+	}
+	res.Add(Resource{Type: "File", ID: ".latsConfig.json", Status: configStatus})
+
+	// Config file found and successfully parsed
+	config, err := loadConfig()
+	if err == nil {
+		err = applyConfig(config)
+	}
+	if err != nil {
+		slog.Error("Error reading config", "error", err)
+		return err
+	}
+	err = state.InitState(config.StateFileName)
+	if err != nil {
+		return err
+	}
+	res.Add(Resource{Type: "File", ID: config.StateFileName, Status: "ready"})
+	os.Mkdir(".state", os.ModePerm)
+	res.Add(Resource{Type: "Directory", ID: ".state", Status: "ready"})
+	return nil
+}
+
+func genConfigFile() error {
 	slog.Info("Generating config file")
 	c := genConfig(getMainRegion, getBackupRegion)
-	writeConfig(c, ".latsConfig.json")
-	state.InitState(".confState.json")
+	err := writeConfig(c, ".latsConfig.json")
+	if err != nil {
+		return err
+	}
+	err = state.InitState(".confState.json")
+	if err != nil {
+		return err
+	}
 	slog.Info("creating .state directory")
 	os.Mkdir(".state", os.ModePerm)
+	return nil
 }
 func getMainRegion() string {
 	if mainRegion != "" {
@@ -108,7 +285,7 @@ func writeConfig(c Config, filename string) error {
 		slog.Warn("Error writing config: ", "error", err)
 		return err
 	}
-	err = os.WriteFile(filename, conf, 0644)
+	err = helpers.WriteFileAtomic(filename, conf, 0644)
 	if err != nil {
 		slog.Warn("Error writing config", "error", err)
 		return err
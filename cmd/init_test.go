@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -30,12 +31,12 @@ func TestGenConfig(t *testing.T) {
 	br := mockGetRegion
 	mr := mockGetRegion
 	expected := Config{
-		"foo",
-		"foo",
-		".confState.json",
+		MainRegion:    "foo",
+		BackupRegion:  "foo",
+		StateFileName: ".confState.json",
 	}
 	actual := genConfig(mr, br)
-	if actual != expected {
+	if !reflect.DeepEqual(actual, expected) {
 		t.Errorf("expected %v got %v", expected, actual)
 	}
 }
@@ -43,9 +44,9 @@ func TestGenConfig(t *testing.T) {
 func TestWriteConfig(t *testing.T) {
 	filename := "/tmp/config.json"
 	conf := Config{
-		"foo",
-		"bar",
-		"tmp/baz.json",
+		MainRegion:    "foo",
+		BackupRegion:  "bar",
+		StateFileName: "tmp/baz.json",
 	}
 	writeConfig(conf, filename)
 	dat, err := os.ReadFile(filename)
@@ -61,9 +62,9 @@ func TestWriteConfig(t *testing.T) {
 func TestReadConfig(t *testing.T) {
 	filename := "/tmp/config.json"
 	mconf := Config{
-		"foo",
-		"bar",
-		"tmp/baz.json",
+		MainRegion:    "foo",
+		BackupRegion:  "bar",
+		StateFileName: "tmp/baz.json",
 	}
 	writeConfig(mconf, filename)
 	conf, err := readConfig(filename)
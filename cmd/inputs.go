@@ -6,19 +6,25 @@ import (
 	"github.com/jrottersman/lats/state"
 )
 
-//CreateClusterSnapshotInput input for create snapshot for cluster
+// CreateClusterSnapshotInput input for create snapshot for cluster
 type CreateClusterSnapshotInput struct {
 	dbi     aws.DbInstances
 	ec2     aws.EC2Instances
+	sts     aws.StsOperations
 	sm      state.StateManager
 	cluster *types.DBCluster
 	sfn     string
+	res     *Result
+	region  string
 }
 
-//CreateInstanceSnapshotInput input for create snapshot for instance
+// CreateInstanceSnapshotInput input for create snapshot for instance
 type CreateInstanceSnapshotInput struct {
-	dbi aws.DbInstances
-	ec2 aws.EC2Instances
-	sm  state.StateManager
-	sfn string
+	dbi    aws.DbInstances
+	ec2    aws.EC2Instances
+	sts    aws.StsOperations
+	sm     state.StateManager
+	sfn    string
+	res    *Result
+	region string
 }
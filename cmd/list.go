@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+// Copy statuses of stacks in lats list
+const (
+	CopyStatusCopy      = "copy"       // the stack's snapshot is a copy in another region
+	CopyStatusCopied    = "copied"     // there's a copy of the stack
+	CopyStatusNotCopied = "not-copied" // nothing in state is a copy of the stack
+)
+
+var (
+	// Variables used for flags
+	listEngine     string
+	listRegion     string
+	listDatabase   string
+	listOlderThan  string
+	listNewerThan  string
+	listCopyStatus string
+	listFormat     string
+	listLive       bool
+
+	// ListCmd lists the stacks lats manages
+	ListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the stacks lats manages and their snapshots",
+		Long: "List shows every stack in the state with its type, source database, the region its snapshot is in, the snapshot's status, size, age and whether it's been copied. " +
+			"Status is what lats state refresh last saw unless --live describes the snapshots now",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			f, err := listFilter(listEngine, listRegion, listDatabase, listOlderThan, listNewerThan, listCopyStatus)
+			if err != nil {
+				slog.Error("error parsing filters", "error", err)
+				os.Exit(1)
+			}
+			var regions []RegionClient
+			if listLive {
+				regions = configRegions(config)
+			}
+			entries := Catalog(sm, regions, time.Now())
+			format := listFormat
+			if format == "" {
+				format = outputFormat
+			}
+			err = WriteCatalog(f.Apply(entries), format, os.Stdout)
+			if err != nil {
+				slog.Error("error listing stacks", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	ListCmd.Flags().StringVar(&listEngine, "engine", "", "database engine like postgres or aurora-mysql")
+	ListCmd.Flags().StringVar(&listRegion, "region", "", "region the snapshot is in")
+	ListCmd.Flags().StringVar(&listDatabase, "db", "", "source database identifier, * and ? are wildcards")
+	ListCmd.Flags().StringVar(&listOlderThan, "older-than", "", "only snapshots older than this like 36h or 7d")
+	ListCmd.Flags().StringVar(&listNewerThan, "newer-than", "", "only snapshots newer than this like 36h or 7d")
+	ListCmd.Flags().StringVar(&listCopyStatus, "copy-status", "", "copy, copied or not-copied")
+	ListCmd.Flags().StringVar(&listFormat, "format", "", "table, json, yaml or csv, defaults to --output")
+	ListCmd.Flags().BoolVar(&listLive, "live", false, "describe the snapshots in AWS instead of using what refresh recorded")
+}
+
+// CatalogEntry is a stack in lats list
+type CatalogEntry struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"` // Type is LoneInstance or Cluster
+	Database   string        `json:"database,omitempty"`
+	Engine     string        `json:"engine,omitempty"`
+	Region     string        `json:"region,omitempty"`
+	Snapshot   string        `json:"snapshot,omitempty"`
+	Status     string        `json:"status,omitempty"`
+	SizeGB     int32         `json:"sizeGb,omitempty"`
+	Created    time.Time     `json:"created,omitzero"` // Created is when the snapshot was taken
+	Age        time.Duration `json:"-"`
+	CopyStatus string        `json:"copyStatus,omitempty"`
+}
+
+// CatalogFilter narrows lats list, empty fields match everything
+type CatalogFilter struct {
+	Engine     string
+	Region     string
+	Database   string        // Database is a glob matched against the source database
+	OlderThan  time.Duration // OlderThan and NewerThan don't match stacks with no creation time
+	NewerThan  time.Duration
+	CopyStatus string
+}
+
+func listFilter(engine, region, db, olderThan, newerThan, copyStatus string) (CatalogFilter, error) {
+	f := CatalogFilter{Engine: engine, Region: region, Database: db, CopyStatus: copyStatus}
+	switch copyStatus {
+	case "", CopyStatusCopy, CopyStatusCopied, CopyStatusNotCopied:
+	default:
+		return f, fmt.Errorf("--copy-status is copy, copied or not-copied not %q", copyStatus)
+	}
+	var err error
+	if olderThan != "" {
+		f.OlderThan, err = parseAge(olderThan)
+		if err != nil {
+			return f, fmt.Errorf("--older-than: %w", err)
+		}
+	}
+	if newerThan != "" {
+		f.NewerThan, err = parseAge(newerThan)
+		if err != nil {
+			return f, fmt.Errorf("--newer-than: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// parseAge parses a duration that can also be in days like 7d
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("%q isn't a number of days", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Match checks an entry against the filter
+func (f CatalogFilter) Match(e CatalogEntry) bool {
+	if f.Engine != "" && !strings.EqualFold(e.Engine, f.Engine) {
+		return false
+	}
+	if f.Region != "" && e.Region != f.Region {
+		return false
+	}
+	if f.Database != "" {
+		if ok, _ := path.Match(f.Database, e.Database); !ok {
+			return false
+		}
+	}
+	if f.OlderThan != 0 && (e.Created.IsZero() || e.Age <= f.OlderThan) {
+		return false
+	}
+	if f.NewerThan != 0 && (e.Created.IsZero() || e.Age >= f.NewerThan) {
+		return false
+	}
+	if f.CopyStatus != "" && e.CopyStatus != f.CopyStatus {
+		return false
+	}
+	return true
+}
+
+// Apply returns the entries that match
+func (f CatalogFilter) Apply(entries []CatalogEntry) []CatalogEntry {
+	matched := []CatalogEntry{}
+	for _, e := range entries {
+		if f.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// Catalog builds the entries for the newest stack of each name from the state index, when regions are given the snapshots are described in them.
+// A snapshot that can't be described keeps what refresh recorded
+func Catalog(sm state.StateManager, regions []RegionClient, now time.Time) []CatalogEntry {
+	newest := map[string]state.StateKV{}
+	names := []string{}
+	copied := map[string]bool{}
+	for _, kv := range sm.StateLocations {
+		if kv.ObjectType != state.StackType {
+			continue
+		}
+		name := kv.Object
+		if kv.Stack.Name != "" {
+			name = kv.Stack.Name
+		}
+		if _, ok := newest[name]; !ok {
+			names = append(names, name)
+		}
+		newest[name] = kv
+		if from := kv.Stack.Metadata.CopyOf; from != "" {
+			copied[from] = true
+		}
+	}
+	entries := []CatalogEntry{}
+	for _, name := range names {
+		kv := newest[name]
+		md := kv.Stack.Metadata
+		e := CatalogEntry{
+			Name:     name,
+			Type:     stackType(kv.Stack.RestorationType),
+			Database: md.Database,
+			Engine:   md.Engine,
+			Region:   md.Region,
+			Snapshot: md.Snapshot,
+			Status:   kv.Snapshot.Status,
+			SizeGB:   md.StorageGB,
+			Created:  md.SnapshotCreated,
+		}
+		if e.Region == "" {
+			e.Region = kv.Snapshot.Region
+		}
+		if e.SizeGB == 0 {
+			e.SizeGB = kv.Snapshot.SizeGB
+		}
+		if e.Created.IsZero() {
+			e.Created = kv.Snapshot.Created
+		}
+		if len(regions) > 0 {
+			liveSnapshot(&e, kv, regions)
+		}
+		if !e.Created.IsZero() {
+			e.Age = now.Sub(e.Created)
+		}
+		e.CopyStatus = copyStatus(md, copied[name])
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// liveSnapshot describes the entry's snapshot, stacks from older lats have the snapshot read from their objects
+func liveSnapshot(e *CatalogEntry, kv state.StateKV, regions []RegionClient) {
+	id := e.Snapshot
+	cluster := kv.Stack.RestorationType == stack.Cluster
+	if id == "" {
+		s, err := stack.ReadStack(kv.FileLocation)
+		if err != nil {
+			slog.Warn("can't read stack to find its snapshot", "stack", e.Name, "error", err)
+			return
+		}
+		id, cluster = stackSnapshot(s)
+		if id == "" {
+			return
+		}
+		e.Snapshot = id
+	}
+	info, err := describeSnapshot(id, cluster, orderRegions(regions, e.Region))
+	if err != nil {
+		slog.Warn("can't describe snapshot", "stack", e.Name, "error", err)
+		return
+	}
+	e.Status = info.Status
+	if info.Status == state.SnapshotMissing {
+		return
+	}
+	e.Region = info.Region
+	if info.SizeGB != 0 {
+		e.SizeGB = info.SizeGB
+	}
+	if !info.Created.IsZero() {
+		e.Created = info.Created
+	}
+}
+
+// stackType is the name lats list uses for a restoration type
+func stackType(restorationType string) string {
+	switch restorationType {
+	case stack.LoneInstance:
+		return "LoneInstance"
+	case stack.Cluster:
+		return "Cluster"
+	}
+	return restorationType
+}
+
+// copyStatus works out if a stack is a copy or has been copied, stacks from older lats without metadata have none
+func copyStatus(md state.StackMetadata, hasCopy bool) string {
+	if md.CopyOf != "" || (md.SourceRegion != "" && md.Region != "" && md.SourceRegion != md.Region) {
+		return CopyStatusCopy
+	}
+	if hasCopy {
+		return CopyStatusCopied
+	}
+	if md == (state.StackMetadata{}) {
+		return ""
+	}
+	return CopyStatusNotCopied
+}
+
+// formatAge rounds an age to days or hours
+func formatAge(e CatalogEntry) string {
+	if e.Created.IsZero() {
+		return "-"
+	}
+	if e.Age >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(e.Age.Hours()/24))
+	}
+	return fmt.Sprintf("%dh", int(e.Age.Hours()))
+}
+
+// WriteCatalog writes the entries as a table, JSON, YAML or CSV
+func WriteCatalog(entries []CatalogEntry, format string, out io.Writer) error {
+	switch format {
+	case "", "table", OutputText:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTYPE\tDATABASE\tENGINE\tREGION\tSTATUS\tSIZE\tAGE\tCOPY")
+		for _, e := range entries {
+			size := "-"
+			if e.SizeGB != 0 {
+				size = fmt.Sprintf("%d GiB", e.SizeGB)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.Type, orDash(e.Database), orDash(e.Engine), orDash(e.Region), orDash(e.Status), size, formatAge(e), orDash(e.CopyStatus))
+		}
+		return w.Flush()
+	case OutputJSON, OutputYAML:
+		return writeStructured(entries, format, out)
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"name", "type", "database", "engine", "region", "snapshot", "status", "sizeGb", "created", "copyStatus"})
+		for _, e := range entries {
+			created := ""
+			if !e.Created.IsZero() {
+				created = e.Created.UTC().Format(time.RFC3339)
+			}
+			w.Write([]string{e.Name, e.Type, e.Database, e.Engine, e.Region, e.Snapshot, e.Status, strconv.Itoa(int(e.SizeGB)), created, e.CopyStatus})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return fmt.Errorf("unknown format %q, use table, json, yaml or csv", format)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	latsaws "github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func catalogState() state.StateManager {
+	day := 24 * time.Hour
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	stackKV := func(name string, rt string, md state.StackMetadata) state.StateKV {
+		return state.StateKV{Object: name, FileLocation: ".state/" + name + ".json", ObjectType: state.StackType, Stack: state.StackInfo{Name: name, RestorationType: rt, Metadata: md}}
+	}
+	nightly := stackKV("nightly", stack.LoneInstance, state.StackMetadata{Database: "orders", Engine: "postgres", Region: "us-east-1", SourceRegion: "us-east-1", Snapshot: "nightly", StorageGB: 20, SnapshotCreated: now.Add(-2 * day)})
+	nightly.Snapshot = state.SnapshotInfo{ID: "nightly", Region: "us-east-1", Status: "available"}
+	return state.StateManager{Mu: &sync.Mutex{}, StateLocations: []state.StateKV{
+		{Object: "db-snap", FileLocation: ".state/snap.json", ObjectType: "RDSSnapshot"},
+		stackKV("nightly", stack.LoneInstance, state.StackMetadata{Database: "orders", Engine: "postgres", Region: "us-east-1", Snapshot: "old"}),
+		nightly,
+		stackKV("nightly-copy", stack.LoneInstance, state.StackMetadata{Database: "orders", Engine: "postgres", Region: "us-west-2", SourceRegion: "us-east-1", Snapshot: "nightly-copy", CopyOf: "nightly", StorageGB: 20, SnapshotCreated: now.Add(-2 * day)}),
+		stackKV("aurora", stack.Cluster, state.StackMetadata{Database: "billing", Engine: "aurora-postgresql", Region: "us-east-1", SourceRegion: "us-east-1", Snapshot: "aurora", SnapshotCreated: now.Add(-10 * day)}),
+		stackKV("legacy", stack.LoneInstance, state.StackMetadata{}),
+	}}
+}
+
+func TestCatalog(t *testing.T) {
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	entries := Catalog(catalogState(), nil, now)
+	tests := []struct {
+		name   string
+		filter CatalogFilter
+		want   []string
+	}{
+		{"everything", CatalogFilter{}, []string{"nightly", "nightly-copy", "aurora", "legacy"}},
+		{"engine", CatalogFilter{Engine: "Postgres"}, []string{"nightly", "nightly-copy"}},
+		{"region", CatalogFilter{Region: "us-west-2"}, []string{"nightly-copy"}},
+		{"database", CatalogFilter{Database: "bill*"}, []string{"aurora"}},
+		{"older than", CatalogFilter{OlderThan: 7 * 24 * time.Hour}, []string{"aurora"}},
+		{"newer than", CatalogFilter{NewerThan: 7 * 24 * time.Hour}, []string{"nightly", "nightly-copy"}},
+		{"copied", CatalogFilter{CopyStatus: CopyStatusCopied}, []string{"nightly"}},
+		{"copy", CatalogFilter{CopyStatus: CopyStatusCopy}, []string{"nightly-copy"}},
+		{"not copied", CatalogFilter{CopyStatus: CopyStatusNotCopied}, []string{"aurora"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, e := range tt.filter.Apply(entries) {
+				got = append(got, e.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v expected %v", got, tt.want)
+			}
+		})
+	}
+	if entries[0].Snapshot != "nightly" || entries[0].Status != "available" || entries[0].Type != "LoneInstance" || entries[2].Type != "Cluster" {
+		t.Errorf("expected the newest nightly with what refresh saw got %+v", entries[0])
+	}
+}
+
+func TestCatalog_Live(t *testing.T) {
+	t.Chdir(t.TempDir())
+	created := time.Date(2024, 6, 9, 0, 0, 0, 0, time.UTC)
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	writeSnapshotStack(t, &sm, "legacy", "legacy-snap")
+	backup := importRDSClient{snapshot: &types.DBSnapshot{DBSnapshotIdentifier: aws.String("legacy-snap"), Status: aws.String("available"), AllocatedStorage: aws.Int32(5), SnapshotCreateTime: &created}}
+	regions := []RegionClient{
+		{Region: "us-east-1", DB: latsaws.DbInstances{RdsClient: importRDSClient{}}},
+		{Region: "us-west-2", DB: latsaws.DbInstances{RdsClient: backup}},
+	}
+	entries := Catalog(sm, regions, created.Add(36*time.Hour))
+	e := entries[0]
+	if e.Snapshot != "legacy-snap" || e.Region != "us-west-2" || e.Status != "available" || e.SizeGB != 5 || formatAge(e) != "1d" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestWriteCatalog(t *testing.T) {
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	entries := Catalog(catalogState(), nil, now)[:1]
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{"table", "NAME     TYPE          DATABASE  ENGINE    REGION     STATUS     SIZE    AGE  COPY\nnightly  LoneInstance  orders    postgres  us-east-1  available  20 GiB  2d   copied\n", false},
+		{"csv", "name,type,database,engine,region,snapshot,status,sizeGb,created,copyStatus\nnightly,LoneInstance,orders,postgres,us-east-1,nightly,available,20,2024-06-08T00:00:00Z,copied\n", false},
+		{"xml", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			err := WriteCatalog(entries, tt.format, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteCatalog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got\n%q\nexpected\n%q", out.String(), tt.want)
+			}
+		})
+	}
+	var out bytes.Buffer
+	WriteCatalog(entries, "json", &out)
+	var got []CatalogEntry
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil || got[0].Name != "nightly" || got[0].CopyStatus != CopyStatusCopied {
+		t.Errorf("got %v %s", err, out.String())
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"7d", 7 * 24 * time.Hour, false},
+		{"36h", 36 * time.Hour, false},
+		{"xd", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAge(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
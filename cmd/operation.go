@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/state"
+)
+
+// noWait is --no-wait on create, copy and restore
+var noWait bool
+
+// regionDB returns an RDS client for a region, it's aws.Init outside of tests
+type regionDB func(region string) aws.DbInstances
+
+// resourcePending is the status of a resource the operation hasn't started creating yet
+const resourcePending = "pending"
+
+// tracker keeps an operation's record in the state up to date
+type tracker struct {
+	sm   *state.StateManager
+	sfn  string
+	file string
+	op   state.Operation
+
+	mu sync.Mutex // mu keeps created, which restore calls from every object it restores at once, from saving over itself
+}
+
+// startOperation records an operation that's been started in AWS so it can be waited on by another lats if we don't wait or die
+func startOperation(sm *state.StateManager, sfn string, op state.Operation) (*tracker, error) {
+	now := time.Now().UTC()
+	for k, v := range op.Params {
+		if v == "" {
+			delete(op.Params, k)
+		}
+	}
+	op.ID = helpers.OperationID()
+	op.Status = state.OpRunning
+	op.Created, op.Updated = now, now
+	t := &tracker{sm: sm, sfn: sfn, file: fmt.Sprintf(".state/%s", *helpers.RandomStateFileName()), op: op}
+	err := state.WriteOperation(t.file, op)
+	if err != nil {
+		return nil, fmt.Errorf("error recording the operation: %w", err)
+	}
+	sm.UpdateState(op.ID, t.file, state.OperationType)
+	err = sm.SyncState(sfn)
+	if err != nil {
+		return nil, fmt.Errorf("error recording the operation: %w", err)
+	}
+	slog.Info("recorded operation", "id", op.ID, "kind", op.Kind)
+	return t, nil
+}
+
+// loadOperation reads the record of the operation with id
+func loadOperation(sm *state.StateManager, sfn string, id string) (*tracker, error) {
+	kv, err := sm.FindOperation(id)
+	if err != nil {
+		return nil, err
+	}
+	op, err := state.ReadOperation(kv.FileLocation)
+	if err != nil {
+		return nil, err
+	}
+	return &tracker{sm: sm, sfn: sfn, file: kv.FileLocation, op: op}, nil
+}
+
+// save writes the operation and updates its entry in the state file
+func (t *tracker) save() error {
+	t.op.Updated = time.Now().UTC()
+	if t.op.Done() && t.op.Finished.IsZero() {
+		t.op.Finished = t.op.Updated
+	}
+	err := state.WriteOperation(t.file, t.op)
+	if err != nil {
+		return err
+	}
+	t.sm.Rehash(t.file)
+	return t.sm.SyncState(t.sfn)
+}
+
+// wait checks each of the operation's resources every interval until they're all available or one failed, a timeout of zero waits forever.
+// The record is saved when it's done or we stop waiting, running out of time returns aws.ErrWaitTimeout and leaves it running
+func (t *tracker) wait(clients regionDB, interval time.Duration, timeout time.Duration) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	var waitErr error
+	for i, r := range t.op.Resources {
+		if r.Status == "available" {
+			continue
+		}
+		left := time.Duration(0)
+		if !deadline.IsZero() {
+			// always look at least once so the status is up to date
+			left = max(time.Until(deadline), time.Nanosecond)
+		}
+		dbi := clients(r.Region)
+		p, err := dbi.WaitForProgress(r.Type, r.ID, interval, left, logProgress)
+		if errors.Is(err, aws.ErrProgressNotFound) && r.Status == resourcePending {
+			// the restore hasn't got to it yet or died before it did, it's left running for cancel to end
+			waitErr = fmt.Errorf("%s %s hasn't been created yet: %w", r.Type, r.ID, aws.ErrWaitTimeout)
+			break
+		}
+		if errors.Is(err, aws.ErrProgressNotFound) {
+			p.Status, err = "deleted", nil
+		}
+		if p.Status != "" {
+			t.op.Resources[i].Status = p.Status
+		}
+		if err != nil {
+			waitErr = err
+			break
+		}
+		if p.Failed() {
+			t.op.Status = state.OpFailed
+			t.op.Error = fmt.Sprintf("%s %s is %s", r.Type, r.ID, p.Status)
+			break
+		}
+	}
+	if waitErr == nil && t.op.Status == state.OpRunning {
+		t.op.Status = state.OpSucceeded
+	}
+	err := t.save()
+	if err != nil {
+		return errors.Join(waitErr, fmt.Errorf("error saving operation %s: %w", t.op.ID, err))
+	}
+	return waitErr
+}
+
+// finishOperation waits for an operation create, copy or restore started unless --no-wait was passed.
+// Running out of time isn't an error, the operation is left running for lats ops wait to pick up
+func finishOperation(t *tracker, res *Result, timeout time.Duration) error {
+	res.Operation = t.op.ID
+	if noWait {
+		slog.Info("not waiting, lats ops wait waits for it", "operation", t.op.ID)
+		return nil
+	}
+	err := t.wait(aws.Init, pollInterval, timeout)
+	if errors.Is(err, aws.ErrWaitTimeout) {
+		slog.Warn("still not done, run lats ops wait to keep waiting", "operation", t.op.ID, "waited", timeout)
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	if t.op.Status == state.OpFailed {
+		return errors.New(t.op.Error)
+	}
+	return nil
+}
+
+// created marks the resource with id as being created, it's the aws.CreateClusterFromStackInput and aws.CreateInstanceFromStackInput Created callback.
+// Resources restore didn't know about up front are added
+func (t *tracker) created(progressType string, id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := slices.IndexFunc(t.op.Resources, func(r state.OperationResource) bool { return r.Type == progressType && r.ID == id })
+	if i < 0 {
+		region := ""
+		if len(t.op.Resources) > 0 {
+			region = t.op.Resources[0].Region
+		}
+		t.op.Resources = append(t.op.Resources, state.OperationResource{Type: progressType, ID: id, Region: region})
+		i = len(t.op.Resources) - 1
+	}
+	t.op.Resources[i].Status = "creating"
+	err := t.save()
+	if err != nil {
+		slog.Warn("error recording the operation", "operation", t.op.ID, "error", err)
+	}
+}
+
+// fail records err as why the operation failed and returns it
+func (t *tracker) fail(err error) error {
+	t.op.Status = state.OpFailed
+	t.op.Error = err.Error()
+	saveErr := t.save()
+	if saveErr != nil {
+		return errors.Join(err, fmt.Errorf("error saving operation %s: %w", t.op.ID, saveErr))
+	}
+	return err
+}
+
+// resourceStatus is the last status the operation saw of the resource with id
+func (t *tracker) resourceStatus(id string) string {
+	for _, r := range t.op.Resources {
+		if r.ID == id {
+			return r.Status
+		}
+	}
+	return ""
+}
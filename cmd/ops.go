@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	opsStatus string
+	opsDelete bool
+
+	// OpsCmd groups the commands for operations create, copy and restore recorded
+	OpsCmd = &cobra.Command{
+		Use:   "ops",
+		Short: "Lists and waits on the snapshots, copies and restores lats started",
+		Long: "Create, copy and restore record an operation in the state with what they started in AWS before they wait for it. " +
+			"With --no-wait they return straight away and these commands pick it up, so does a lats that died while waiting",
+	}
+
+	opsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists operations oldest first",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sm := GetState()
+			err := ListOperations(&sm, opsStatus, outputFormat, os.Stdout)
+			if err != nil {
+				slog.Error("error listing operations", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	opsShowCmd = &cobra.Command{
+		Use:   "show id",
+		Short: "Prints an operation with its parameters and resources",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sm := GetState()
+			err := ShowOperation(&sm, args[0], outputFormat, os.Stdout)
+			if err != nil {
+				slog.Error("error showing operation", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	opsWaitCmd = &cobra.Command{
+		Use:   "wait id",
+		Short: "Waits for an operation to succeed or fail",
+		Long: "Wait checks the operation's resources until they're all available or one failed and records what it saw. " +
+			"It exits like lats wait, 0 when it succeeded, 1 when lats couldn't check, 2 when it failed or was cancelled, 3 when --timeout runs out and 4 when there's no operation with that id",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			os.Exit(WaitOperation(&sm, config.StateFileName, args[0], aws.Init, waitInterval, waitTimeout, outputFormat, os.Stdout))
+		},
+	}
+
+	opsCancelCmd = &cobra.Command{
+		Use:   "cancel id",
+		Short: "Stops tracking an operation",
+		Long: "Cancel marks a running operation cancelled so nothing waits on it. " +
+			"--delete also deletes its snapshots that aren't available yet, deleting a copy is how AWS cancels it. Databases being restored are never deleted",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			err := CancelOperation(&sm, config.StateFileName, args[0], aws.Init, opsDelete)
+			if err != nil {
+				slog.Error("error cancelling operation", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	opsListCmd.Flags().StringVar(&opsStatus, "status", "", "only operations that are running, succeeded, failed or cancelled")
+	opsWaitCmd.Flags().DurationVar(&waitTimeout, "timeout", 2*time.Hour, "how long to wait, 0 waits forever")
+	opsWaitCmd.Flags().DurationVar(&waitInterval, "interval", 30*time.Second, "how long to sleep between checks")
+	opsCancelCmd.Flags().BoolVar(&opsDelete, "delete", false, "delete the operation's snapshots that aren't available yet")
+	OpsCmd.AddCommand(opsListCmd)
+	OpsCmd.AddCommand(opsShowCmd)
+	OpsCmd.AddCommand(opsWaitCmd)
+	OpsCmd.AddCommand(opsCancelCmd)
+}
+
+// ListOperations writes the operations in the state file as a table, JSON or YAML, status narrows them when it isn't empty
+func ListOperations(sm *state.StateManager, status string, format string, out io.Writer) error {
+	ops := []state.OperationInfo{}
+	for _, kv := range sm.Operations() {
+		if status == "" || kv.Operation.Status == status {
+			ops = append(ops, kv.Operation)
+		}
+	}
+	if format == OutputJSON || format == OutputYAML {
+		return writeStructured(ops, format, out)
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tSTATUS\tSTACK\tCREATED\tUPDATED")
+	for _, o := range ops {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", o.ID, o.Kind, o.Status, orDash(o.Stack), formatTime(o.Created), formatTime(o.Updated))
+	}
+	return w.Flush()
+}
+
+// ShowOperation writes an operation as YAML or JSON, text is YAML
+func ShowOperation(sm *state.StateManager, id string, format string, out io.Writer) error {
+	t, err := loadOperation(sm, "", id)
+	if err != nil {
+		return err
+	}
+	if format == OutputText {
+		format = OutputYAML
+	}
+	return writeStructured(t.op, format, out)
+}
+
+// WaitOperation waits for the operation with id and records what it saw, it returns the exit code for lats ops wait
+func WaitOperation(sm *state.StateManager, stateFileName string, id string, clients regionDB, interval time.Duration, timeout time.Duration, format string, out io.Writer) int {
+	t, err := loadOperation(sm, stateFileName, id)
+	if errors.Is(err, state.ErrNotFound) {
+		slog.Error("nothing to wait for", "error", err)
+		return ExitNotFound
+	}
+	if err != nil {
+		slog.Error("error reading the operation", "error", err)
+		return ExitError
+	}
+	code := ExitAvailable
+	if !t.op.Done() {
+		err = t.wait(clients, interval, timeout)
+		switch {
+		case errors.Is(err, aws.ErrWaitTimeout):
+			slog.Error("gave up waiting", "operation", id, "timeout", timeout)
+			code = ExitTimeout
+		case err != nil:
+			slog.Error("error waiting", "operation", id, "error", err)
+			code = ExitError
+		}
+	}
+	if t.op.Status == state.OpFailed || t.op.Status == state.OpCancelled {
+		slog.Error("operation didn't succeed", "operation", id, "status", t.op.Status, "error", t.op.Error)
+		code = ExitFailed
+	}
+	if format == OutputText {
+		fmt.Fprintf(out, "%s %s %s\n", t.op.ID, t.op.Kind, t.op.Status)
+		for _, r := range t.op.Resources {
+			fmt.Fprintf(out, "  %s\t%s\t%s\t%s\n", r.Type, r.ID, r.Region, orDash(r.Status))
+		}
+		return code
+	}
+	err = writeStructured(t.op, format, out)
+	if err != nil {
+		slog.Error("error writing the operation", "error", err)
+	}
+	return code
+}
+
+// CancelOperation marks a running operation cancelled, with deleteResources its snapshots that aren't available yet are deleted
+func CancelOperation(sm *state.StateManager, stateFileName string, id string, clients regionDB, deleteResources bool) error {
+	t, err := loadOperation(sm, stateFileName, id)
+	if err != nil {
+		return err
+	}
+	if t.op.Done() {
+		return fmt.Errorf("operation %s already %s", id, t.op.Status)
+	}
+	var errs []error
+	if deleteResources {
+		for i, r := range t.op.Resources {
+			if r.Status == "available" {
+				continue
+			}
+			if r.Type != aws.SnapshotProgress && r.Type != aws.ClusterSnapshotProgress {
+				slog.Warn("not deleting a database, delete it yourself if you don't want it", "type", r.Type, "id", r.ID, "region", r.Region)
+				continue
+			}
+			dbi := clients(r.Region)
+			// what's recorded is stale after --no-wait, a snapshot that finished since is kept
+			p, err := dbi.GetProgress(r.Type, r.ID)
+			if errors.Is(err, aws.ErrProgressNotFound) {
+				t.op.Resources[i].Status = "deleted"
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("checking %s %s: %w", r.Type, r.ID, err))
+				continue
+			}
+			t.op.Resources[i].Status = p.Status
+			if p.Available() {
+				slog.Info("not deleting, it's available", "type", r.Type, "id", r.ID, "region", r.Region)
+				continue
+			}
+			err = dbi.DeleteSnapshot(r.ID, r.Type == aws.ClusterSnapshotProgress)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("deleting %s %s: %w", r.Type, r.ID, err))
+				continue
+			}
+			t.op.Resources[i].Status = "deleting"
+			slog.Info("deleted", "type", r.Type, "id", r.ID, "region", r.Region)
+		}
+		if t.op.Stack != "" && t.op.Kind != state.OpRestore {
+			slog.Warn("the operation's stack is still in the state, lats state rm removes it", "stack", t.op.Stack)
+		}
+	}
+	if len(errs) > 0 {
+		// leave it running so cancel can be tried again
+		return errors.Join(append(errs, t.save())...)
+	}
+	t.op.Status = state.OpCancelled
+	return t.save()
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	latsaws "github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/state"
+)
+
+func opsClients(c mock.ProgressRDSClient) regionDB {
+	return func(region string) latsaws.DbInstances {
+		return latsaws.DbInstances{RdsClient: c}
+	}
+}
+
+func startTestOperation(t *testing.T, sm *state.StateManager, kind string, resources ...state.OperationResource) *tracker {
+	t.Helper()
+	tr, err := startOperation(sm, "state.json", state.Operation{Kind: kind, Params: map[string]string{"snapshot": "nightly", "kms-key": ""}, Stack: "nightly", Resources: resources})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestWaitOperation(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.Mkdir(".state", 0755)
+	tests := []struct {
+		name    string
+		client  mock.ProgressRDSClient
+		timeout time.Duration
+		want    int
+		status  string
+	}{
+		{"available", mock.ProgressRDSClient{Snapshot: "nightly", Statuses: []string{"creating", "available"}}, 0, ExitAvailable, state.OpSucceeded},
+		{"failed", mock.ProgressRDSClient{Snapshot: "nightly", Statuses: []string{"creating", "failed"}}, 0, ExitFailed, state.OpFailed},
+		{"deleted", mock.ProgressRDSClient{}, 0, ExitFailed, state.OpFailed},
+		{"timeout", mock.ProgressRDSClient{Snapshot: "nightly", Statuses: []string{"creating"}}, 5 * time.Millisecond, ExitTimeout, state.OpRunning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := state.StateManager{Mu: &sync.Mutex{}}
+			calls := 0
+			tt.client.Calls = &calls
+			tr := startTestOperation(t, &sm, state.OpCreateSnapshot, state.OperationResource{Type: latsaws.SnapshotProgress, ID: "nightly", Region: "us-east-1", Status: "creating"})
+			var out bytes.Buffer
+			got := WaitOperation(&sm, "state.json", tr.op.ID, opsClients(tt.client), time.Millisecond, tt.timeout, OutputJSON, &out)
+			if got != tt.want {
+				t.Errorf("WaitOperation() = %d want %d", got, tt.want)
+			}
+			var op state.Operation
+			if err := json.Unmarshal(out.Bytes(), &op); err != nil {
+				t.Fatal(err)
+			}
+			if op.Status != tt.status {
+				t.Errorf("WaitOperation() status = %s want %s", op.Status, tt.status)
+			}
+			// what it saw is recorded for the next lats
+			saved, err := loadOperation(&sm, "state.json", tr.op.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.op.Status != tt.status || saved.op.Done() == saved.op.Finished.IsZero() {
+				t.Errorf("saved operation = %+v", saved.op)
+			}
+			if _, ok := saved.op.Params["kms-key"]; ok {
+				t.Errorf("empty params should be dropped, got %v", saved.op.Params)
+			}
+		})
+	}
+
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	if got := WaitOperation(&sm, "state.json", "op-nope", opsClients(mock.ProgressRDSClient{}), time.Millisecond, 0, OutputText, &bytes.Buffer{}); got != ExitNotFound {
+		t.Errorf("WaitOperation() = %d want %d", got, ExitNotFound)
+	}
+}
+
+func TestListAndShowOperations(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.Mkdir(".state", 0755)
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	running := startTestOperation(t, &sm, state.OpCopySnapshot, state.OperationResource{Type: latsaws.SnapshotProgress, ID: "nightly-copy", Region: "us-west-2"})
+	done := startTestOperation(t, &sm, state.OpCreateSnapshot, state.OperationResource{Type: latsaws.SnapshotProgress, ID: "nightly", Region: "us-east-1"})
+	done.op.Status = state.OpSucceeded
+	if err := done.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		want   []string
+	}{
+		{"all", "", []string{running.op.ID, done.op.ID}},
+		{"running", state.OpRunning, []string{running.op.ID}},
+		{"cancelled", state.OpCancelled, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := ListOperations(&sm, tt.status, OutputJSON, &out); err != nil {
+				t.Fatal(err)
+			}
+			var got []state.OperationInfo
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ListOperations() = %+v want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].ID != tt.want[i] {
+					t.Errorf("ListOperations()[%d] = %s want %s", i, got[i].ID, tt.want[i])
+				}
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := ListOperations(&sm, "", OutputText, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"KIND", running.op.ID, state.OpCopySnapshot, state.OpSucceeded} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("operations table is missing %q\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := ShowOperation(&sm, running.op.ID, OutputText, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{running.op.ID, "nightly-copy", "us-west-2"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("operation is missing %q\n%s", want, out.String())
+		}
+	}
+	if err := ShowOperation(&sm, "op-nope", OutputText, &out); err == nil {
+		t.Error("ShowOperation() of a missing operation should error")
+	}
+}
+
+func TestCancelOperation(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.Mkdir(".state", 0755)
+	tests := []struct {
+		name      string
+		kind      string
+		resource  state.OperationResource
+		client    mock.ProgressRDSClient
+		delete    bool
+		wantState string
+	}{
+		{"cancel", state.OpCopySnapshot, state.OperationResource{Type: latsaws.SnapshotProgress, ID: "nightly-copy", Status: "copying"}, mock.ProgressRDSClient{}, false, "copying"},
+		{"delete copy", state.OpCopySnapshot, state.OperationResource{Type: latsaws.SnapshotProgress, ID: "nightly-copy", Status: "copying"}, mock.ProgressRDSClient{Snapshot: "nightly-copy", Statuses: []string{"copying"}}, true, "deleting"},
+		{"delete cluster snapshot", state.OpCreateSnapshot, state.OperationResource{Type: latsaws.ClusterSnapshotProgress, ID: "nightly", Status: "creating"}, mock.ProgressRDSClient{ClusterSnapshot: "nightly", Statuses: []string{"creating"}}, true, "deleting"},
+		{"finished since", state.OpCreateSnapshot, state.OperationResource{Type: latsaws.SnapshotProgress, ID: "nightly", Status: "creating"}, mock.ProgressRDSClient{Snapshot: "nightly", Statuses: []string{"available"}}, true, "available"},
+		{"gone", state.OpCopySnapshot, state.OperationResource{Type: latsaws.SnapshotProgress, ID: "nightly-copy", Status: "copying"}, mock.ProgressRDSClient{}, true, "deleted"},
+		{"restore keeps the database", state.OpRestore, state.OperationResource{Type: latsaws.InstanceProgress, ID: "restored", Status: "creating"}, mock.ProgressRDSClient{}, true, "creating"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := state.StateManager{Mu: &sync.Mutex{}}
+			tr := startTestOperation(t, &sm, tt.kind, tt.resource)
+			err := CancelOperation(&sm, "state.json", tr.op.ID, opsClients(tt.client), tt.delete)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, err := loadOperation(&sm, "state.json", tr.op.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.op.Status != state.OpCancelled || saved.op.Resources[0].Status != tt.wantState {
+				t.Errorf("CancelOperation() left %+v", saved.op)
+			}
+			if err := CancelOperation(&sm, "state.json", tr.op.ID, opsClients(tt.client), false); err == nil {
+				t.Error("cancelling a cancelled operation should error")
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"log/slog"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/rds"
 	"github.com/jrottersman/lats/aws"
 	"github.com/jrottersman/lats/stack"
 	"github.com/jrottersman/lats/state"
@@ -24,6 +26,7 @@ var (
 	ruleTypes           []string
 	protocols           []string
 	restConfigFile      string
+	restoreWaitTimeout  time.Duration
 
 	//RestoreRDSSnapshotCmd restores an RDS snapshot
 	RestoreRDSSnapshotCmd = &cobra.Command{
@@ -32,8 +35,10 @@ var (
 		Short:   "Restores an RDS snapshot",
 		Long:    "Restores an RDS snapshot",
 		Run: func(cmd *cobra.Command, args []string) {
-			_, sm := GetState()
-			RestoreSnapshot(sm, restoreSnapshotName)
+			config, sm := GetState()
+			res := NewResult(cmd)
+			err := RestoreSnapshot(sm, config.StateFileName, restoreSnapshotName, res)
+			finishCommand(res, err)
 		},
 	}
 )
@@ -50,10 +55,64 @@ func init() {
 	RestoreRDSSnapshotCmd.Flags().StringArrayVar(&ruleTypes, "rule-types", []string{}, "Rule types that we want to update our security group with")
 	RestoreRDSSnapshotCmd.Flags().StringArrayVar(&protocols, "protocols", []string{}, "Protocols that we want to update our security group with")
 	RestoreRDSSnapshotCmd.Flags().StringVarP(&restConfigFile, "config-file", "f", "", "Config file for the snapshot that we want to parse")
+	RestoreRDSSnapshotCmd.Flags().DurationVar(&restoreWaitTimeout, "wait-timeout", 2*time.Hour, "how long to wait for the database, lats ops wait carries on after")
+	RestoreRDSSnapshotCmd.Flags().BoolVar(&noWait, "no-wait", false, "record the operation and return without waiting for the database")
 }
 
-// RestoreSnapshot is the function that restores a snapshot
-func RestoreSnapshot(stateKV state.StateManager, restoreSnapshotName string) error {
+// restoreResources are what a restore of s as dbName creates, the cluster or instance and each of the cluster's instances.
+// Cluster instances keep the identifiers they had in the stack, they're all pending until the restore starts creating them
+func restoreResources(s *stack.Stack, dbName string, region string) ([]state.OperationResource, error) {
+	if dbName == "" {
+		return nil, fmt.Errorf("a name for the restored database is required, pass --database-name")
+	}
+	switch s.RestorationObjectName {
+	case stack.LoneInstance:
+		return []state.OperationResource{{Type: aws.InstanceProgress, ID: dbName, Region: region, Status: resourcePending}}, nil
+	case stack.Cluster:
+		resources := []state.OperationResource{{Type: aws.ClusterProgress, ID: dbName, Region: region, Status: resourcePending}}
+		for _, o := range s.ObjectsOfType(stack.Instance) {
+			ins, err := stack.Read[*rds.CreateDBInstanceInput](o)
+			if err != nil {
+				return nil, fmt.Errorf("reading cluster instance %s: %w", o.ID, err)
+			}
+			if ins == nil || ins.DBInstanceIdentifier == nil || *ins.DBInstanceIdentifier == "" {
+				return nil, fmt.Errorf("cluster instance %s in stack %s has no identifier", o.ID, s.Name)
+			}
+			resources = append(resources, state.OperationResource{Type: aws.InstanceProgress, ID: *ins.DBInstanceIdentifier, Region: region, Status: resourcePending})
+		}
+		return resources, nil
+	}
+	return nil, fmt.Errorf("error invalid type of stack to restore a snapshot")
+}
+
+// startRestore records the restore as running before anything in the stack is restored, so --no-wait returns its id straight away
+// and a restore that dies part way is still in lats ops. The restore marks each resource as it creates it
+func startRestore(sm *state.StateManager, stateFileName string, resources []state.OperationResource, stackName string) (*tracker, error) {
+	return startOperation(sm, stateFileName, state.Operation{
+		Kind:      state.OpRestore,
+		Params:    map[string]string{"snapshot": restoreSnapshotName, "database": restoreDbName, "region": region, "subnet-group": dbSubnetGroupName, "vpc-id": vpcID},
+		Stack:     stackName,
+		Resources: resources,
+	})
+}
+
+// finishRestore waits for the database and any cluster instances to be available and adds them to res, restore returned err
+func finishRestore(t *tracker, err error, res *Result) error {
+	if err != nil {
+		res.Operation = t.op.ID
+		return t.fail(err)
+	}
+	waitStart := time.Now()
+	err = finishOperation(t, res, restoreWaitTimeout)
+	for _, r := range t.op.Resources {
+		res.Add(Resource{Type: r.Type, ID: r.ID, Region: r.Region, Status: r.Status, DurationSeconds: time.Since(waitStart).Seconds()})
+	}
+	return err
+}
+
+// RestoreSnapshot is the function that restores a snapshot, the subnet group it creates and the database are recorded in res.
+// The restore is recorded as an operation and waited for unless --no-wait was passed
+func RestoreSnapshot(stateKV state.StateManager, stateFileName string, restoreSnapshotName string, res *Result) error {
 	slog.Info("Starting restore snapshot procedure")
 	slog.Info("Creating AWS session in region", "region", region)
 	dbi := aws.Init(region)
@@ -121,8 +180,13 @@ func RestoreSnapshot(stateKV state.StateManager, restoreSnapshotName string) err
 	SnapshotStack, err := FindStack(stateKV, restoreSnapshotName)
 	if err != nil {
 		slog.Error("Error finding stack", "error", err)
+		return err
 	}
 	slog.Info("Stack is", "stack", SnapshotStack)
+	resources, err := restoreResources(SnapshotStack, restoreDbName, region)
+	if err != nil {
+		return err
+	}
 
 	if SnapshotStack.RestorationObjectName == stack.Cluster && len(subnets) > 2 {
 		slog.Error("subnet creation will fail for a cluster less then two azs", "subnets", subnets)
@@ -147,33 +211,44 @@ func RestoreSnapshot(stateKV state.StateManager, restoreSnapshotName string) err
 		sg, err := dbi.CreateDBSubnetGroup(name, desc, subnets)
 		if err != nil {
 			slog.Error("problem creating subnet group", "error", err)
+			return err
 		}
 		dbSubnetGroupName = *sg.DBSubnetGroup.DBSubnetGroupName
+		res.Add(Resource{Type: "DBSubnetGroup", ID: dbSubnetGroupName, ARN: derefString(sg.DBSubnetGroup.DBSubnetGroupArn), Region: region})
 	}
+	res.Stacks = append(res.Stacks, SnapshotStack.Name)
 
-	slog.Info("starting restore", "type", SnapshotStack.RestorationObjectName)
+	t, err := startRestore(&stateKV, stateFileName, resources, SnapshotStack.Name)
+	if err != nil {
+		return err
+	}
+	slog.Info("starting restore", "type", SnapshotStack.RestorationObjectName, "operation", t.op.ID)
 	if SnapshotStack.RestorationObjectName == stack.Cluster {
 		slog.Info("Restoring a cluster with inputs", "restoreDbName", "dbSubnetGroupName", "vpcID", restoreDbName, dbSubnetGroupName, vpcID)
 		c := aws.CreateClusterFromStackInput{
 			S:             SnapshotStack,
 			ClusterName:   &restoreDbName,
 			DBSubnetGroup: &dbSubnetGroupName,
+			Ec2Client:     &ec2,
 			VpcID:         &vpcID,
 			Ingress:       ingressRules,
 			Egress:        egressRules,
+			Created:       t.created,
 		}
-		return dbi.CreateClusterFromStack(c)
+		return finishRestore(t, dbi.CreateClusterFromStack(c), res)
 	} else if SnapshotStack.RestorationObjectName == stack.LoneInstance {
 		slog.Info("Restoring an Instance with inputs", "restoreDbName", "dbSubnetGroupName", "vpcID", restoreDbName, dbSubnetGroupName, vpcID)
 		c := aws.CreateInstanceFromStackInput{
 			Stack:         SnapshotStack,
 			DBName:        &restoreDbName,
 			DBSubnetGroup: &dbSubnetGroupName,
+			Ec2Client:     &ec2,
 			VpcID:         &vpcID,
 			Ingress:       ingressRules,
 			Egress:        egressRules,
+			Created:       t.created,
 		}
-		return dbi.CreateInstanceFromStack(c)
+		return finishRestore(t, dbi.CreateInstanceFromStack(c), res)
 	}
 
 	slog.Error("Invalid type of stack for restoring an object", "StackType", SnapshotStack.RestorationObjectName)
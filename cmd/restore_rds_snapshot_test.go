@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	latsaws "github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestRestoreResources(t *testing.T) {
+	t.Chdir(t.TempDir())
+	clusterInstance := func(id string, identifier *string) stack.Object {
+		o := stack.NewObject(id, ".state/"+id+".json", stack.Instance, "cluster")
+		if err := stack.Write(o, &rds.CreateDBInstanceInput{DBInstanceIdentifier: identifier}); err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+	cluster := stack.NewStack("nightly", stack.Cluster, []stack.Object{
+		stack.NewObject("cluster", ".state/cluster.json", stack.Cluster),
+		clusterInstance("writer", aws.String("aurora-1")),
+		clusterInstance("reader", aws.String("aurora-2")),
+	})
+	broken := stack.NewStack("broken", stack.Cluster, []stack.Object{clusterInstance("nameless", nil)})
+	lone := stack.NewStack("lone", stack.LoneInstance, nil)
+	tests := []struct {
+		name    string
+		stack   stack.Stack
+		dbName  string
+		want    []state.OperationResource
+		wantErr bool
+	}{
+		{"cluster and its instances", cluster, "restored", []state.OperationResource{
+			{Type: latsaws.ClusterProgress, ID: "restored", Region: "us-west-2", Status: "pending"},
+			{Type: latsaws.InstanceProgress, ID: "aurora-1", Region: "us-west-2", Status: "pending"},
+			{Type: latsaws.InstanceProgress, ID: "aurora-2", Region: "us-west-2", Status: "pending"},
+		}, false},
+		{"instance", lone, "restored", []state.OperationResource{{Type: latsaws.InstanceProgress, ID: "restored", Region: "us-west-2", Status: "pending"}}, false},
+		{"no name", lone, "", nil, true},
+		{"instance without identifier", broken, "restored", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := restoreResources(&tt.stack, tt.dbName, "us-west-2")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("restoreResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("restoreResources() = %+v want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreOperation(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.Mkdir(".state", 0755)
+	resources := []state.OperationResource{
+		{Type: latsaws.ClusterProgress, ID: "restored", Region: "us-west-2", Status: resourcePending},
+		{Type: latsaws.InstanceProgress, ID: "aurora-1", Region: "us-west-2", Status: resourcePending},
+	}
+	start := func(t *testing.T, sm *state.StateManager) *tracker {
+		tr, err := startRestore(sm, "state.json", slices.Clone(resources), "nightly")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr
+	}
+
+	t.Run("recorded before anything is created", func(t *testing.T) {
+		sm := state.StateManager{Mu: &sync.Mutex{}}
+		tr := start(t, &sm)
+		saved, err := loadOperation(&sm, "state.json", tr.op.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.op.Status != state.OpRunning || !reflect.DeepEqual(saved.op.Resources, resources) {
+			t.Errorf("startRestore() recorded %+v", saved.op)
+		}
+		// another lats waiting on it doesn't take a database that isn't there yet as deleted
+		err = saved.wait(opsClients(mock.ProgressRDSClient{}), time.Millisecond, time.Millisecond)
+		if !errors.Is(err, latsaws.ErrWaitTimeout) || saved.op.Status != state.OpRunning {
+			t.Errorf("wait() = %v left %+v", err, saved.op)
+		}
+	})
+
+	t.Run("created as the restore goes", func(t *testing.T) {
+		sm := state.StateManager{Mu: &sync.Mutex{}}
+		tr := start(t, &sm)
+		var wg sync.WaitGroup
+		for _, r := range []state.OperationResource{resources[0], resources[1], {Type: latsaws.InstanceProgress, ID: "aurora-2"}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tr.created(r.Type, r.ID)
+			}()
+		}
+		wg.Wait()
+		saved, err := loadOperation(&sm, "state.json", tr.op.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved.op.Resources) != 3 {
+			t.Fatalf("created() recorded %+v", saved.op.Resources)
+		}
+		for _, r := range saved.op.Resources {
+			if r.Status != "creating" || r.Region != "us-west-2" {
+				t.Errorf("created() recorded %+v", r)
+			}
+		}
+	})
+
+	t.Run("restore fails", func(t *testing.T) {
+		sm := state.StateManager{Mu: &sync.Mutex{}}
+		tr := start(t, &sm)
+		res := &Result{}
+		err := finishRestore(tr, errors.New("no capacity"), res)
+		if err == nil || res.Operation != tr.op.ID {
+			t.Errorf("finishRestore() = %v operation %q", err, res.Operation)
+		}
+		saved, err := loadOperation(&sm, "state.json", tr.op.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.op.Status != state.OpFailed || saved.op.Error != "no capacity" {
+			t.Errorf("finishRestore() recorded %+v", saved.op)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats for --output
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+// Result statuses
+const (
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+// Result is the document a command prints when it's done, logs go to stderr so stdout only has this
+type Result struct {
+	Command         string     `json:"command"`
+	Status          string     `json:"status"`
+	Started         time.Time  `json:"started"`
+	Finished        time.Time  `json:"finished"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	Stacks          []string   `json:"stacks,omitempty"`
+	Operation       string     `json:"operation,omitempty"` // Operation is the id of the operation the command recorded
+	Resources       []Resource `json:"resources"`
+	Errors          []string   `json:"errors,omitempty"`
+}
+
+// Resource is something a command created or used in AWS or on disk
+type Resource struct {
+	Type            string  `json:"type"` // Type like DBSnapshot, DBClusterSnapshot, KMSKey, DBSubnetGroup, DBInstance, DBCluster, Stack or File
+	ID              string  `json:"id"`
+	ARN             string  `json:"arn,omitempty"`
+	Region          string  `json:"region,omitempty"`
+	Status          string  `json:"status,omitempty"`
+	File            string  `json:"file,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"` // DurationSeconds is how long we waited for it to be ready
+}
+
+// NewResult starts the result of cmd
+func NewResult(cmd *cobra.Command) *Result {
+	return &Result{Command: cmd.Name(), Started: time.Now().UTC(), Resources: []Resource{}}
+}
+
+// Add records a resource
+func (r *Result) Add(res Resource) {
+	r.Resources = append(r.Resources, res)
+}
+
+// AddStack records a stack and the file it was written to
+func (r *Result) AddStack(name string, file string) {
+	r.Stacks = append(r.Stacks, name)
+	r.Add(Resource{Type: "Stack", ID: name, File: file})
+}
+
+// Finish sets the status and timings, err is nil when the command worked
+func (r *Result) Finish(err error) {
+	r.Finished = time.Now().UTC()
+	r.DurationSeconds = r.Finished.Sub(r.Started).Seconds()
+	r.Status = Succeeded
+	if err != nil {
+		r.Status = Failed
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// Write writes the result as text, JSON or YAML
+func (r *Result) Write(format string, out io.Writer) error {
+	if format == OutputJSON || format == OutputYAML {
+		return writeStructured(r, format, out)
+	}
+	took := time.Duration(r.DurationSeconds * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(out, "%s %s in %s\n", r.Command, r.Status, took)
+	if r.Operation != "" {
+		fmt.Fprintf(out, "  operation %s\n", r.Operation)
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, res := range r.Resources {
+		id := res.ID
+		if res.ARN != "" {
+			id = res.ARN
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", res.Type, id, orDash(res.Region), orDash(res.Status), orDash(res.File))
+	}
+	w.Flush()
+	for _, e := range r.Errors {
+		fmt.Fprintf(out, "error: %s\n", e)
+	}
+	return nil
+}
+
+// finishCommand prints the result in the --output format and exits non-zero when err isn't nil
+func finishCommand(r *Result, err error) {
+	r.Finish(err)
+	if werr := r.Write(outputFormat, os.Stdout); werr != nil {
+		slog.Error("error writing the result", "error", werr)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// checkOutput checks --output is a format we know
+func checkOutput(format string) error {
+	switch format {
+	case OutputText, OutputJSON, OutputYAML:
+		return nil
+	}
+	return fmt.Errorf("--output is text, json or yaml not %q", format)
+}
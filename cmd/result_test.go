@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestResult_Write(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		format string
+		want   []string
+	}{
+		{"text", nil, OutputText, []string{"CreateRDSSnapshot succeeded in 0s\n", "  DBSnapshot  arn:aws:rds:us-east-1:123456789012:snapshot:nightly  us-east-1  available  -\n", "  Stack       nightly"}},
+		{"text failed", errors.New("no credentials"), OutputText, []string{"CreateRDSSnapshot failed in 0s\n", "error: no credentials\n"}},
+		{"yaml", nil, OutputYAML, []string{"command: CreateRDSSnapshot\nstatus: succeeded\n", "stacks:\n  - nightly\n", "  - type: DBSnapshot\n    id: nightly\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := NewResult(&cobra.Command{Use: "CreateRDSSnapshot"})
+			res.Add(Resource{Type: "DBSnapshot", ID: "nightly", ARN: "arn:aws:rds:us-east-1:123456789012:snapshot:nightly", Region: "us-east-1", Status: "available"})
+			res.AddStack("nightly", ".state/nightly.json")
+			res.Finish(tt.err)
+			var out bytes.Buffer
+			if err := res.Write(tt.format, &out); err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("expected %q in\n%s", w, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestResult_JSON(t *testing.T) {
+	res := NewResult(&cobra.Command{Use: "restoreRDSSnapshot"})
+	res.Finish(errors.New("subnet group missing"))
+	var out bytes.Buffer
+	if err := res.Write(OutputJSON, &out); err != nil {
+		t.Fatal(err)
+	}
+	var got Result
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != Failed || len(got.Errors) != 1 || got.Finished.Before(got.Started) || got.Resources == nil {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	for _, f := range []string{OutputText, OutputJSON, OutputYAML} {
+		if err := checkOutput(f); err != nil {
+			t.Errorf("checkOutput(%s) error = %v", f, err)
+		}
+	}
+	if err := checkOutput("csv"); err == nil {
+		t.Error("expected csv to be rejected")
+	}
+}
+
+func TestInitLats(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := writeConfig(newConfig("us-east-1", "us-west-2"), ".latsConfig.json"); err != nil {
+		t.Fatal(err)
+	}
+	res := NewResult(initCmd)
+	if err := initLats(res); err != nil {
+		t.Fatalf("initLats() error = %v", err)
+	}
+	got := []string{}
+	for _, r := range res.Resources {
+		got = append(got, r.ID+"="+r.Status)
+	}
+	want := ".latsConfig.json=exists,.confState.json=ready,.state=ready"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %v expected %s", got, want)
+	}
+}
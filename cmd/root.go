@@ -4,15 +4,46 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"runtime/debug"
+	"time"
 
+	"github.com/jrottersman/lats/state"
 	"github.com/spf13/cobra"
 )
 
+var (
+	lockTimeout   time.Duration
+	workspaceName string
+	outputFormat  string
+)
+
+// Version is the version of lats, releases set it with -ldflags "-X github.com/jrottersman/lats/cmd.Version=v1.2.3"
+var Version string
+
+// latsVersion is Version or the module version go install recorded, local builds are (devel)
+func latsVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "lats",
 	Short: "Lats simplifies disaster recovery in AWS",
 	Long: `Lats simplifies disaster recovery in AWS"
                 Complete documentation is available at https://latscli.io/documentation/`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := checkOutput(outputFormat); err != nil {
+			slog.Error("error parsing flags", "error", err)
+			os.Exit(1)
+		}
+		state.LockTimeout = lockTimeout
+		state.LockOperation = cmd.CommandPath()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Hi From Lats")
 	},
@@ -27,8 +58,21 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.Version = latsVersion()
+	rootCmd.PersistentFlags().StringVar(&workspaceName, "workspace", "", "workspace to use, defaults to the one picked with lats workspace select")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", OutputText, "format of the result commands print to stdout, text, json or yaml. Logs go to stderr")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", state.LockTimeout, "how long to wait for another lats to release the state lock")
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(CreateRDSSnapshotCmd)
 	rootCmd.AddCommand(CopyRDSSnapshotCmd)
 	rootCmd.AddCommand(RestoreRDSSnapshotCmd)
+	rootCmd.AddCommand(StateCmd)
+	rootCmd.AddCommand(StackCmd)
+	rootCmd.AddCommand(WorkspaceCmd)
+	rootCmd.AddCommand(ImportCmd)
+	rootCmd.AddCommand(ListCmd)
+	rootCmd.AddCommand(DescribeCmd)
+	rootCmd.AddCommand(StatusCmd)
+	rootCmd.AddCommand(WaitCmd)
+	rootCmd.AddCommand(OpsCmd)
 }
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// StackCmd groups the commands that work on whole stacks
+var StackCmd = &cobra.Command{
+	Use:   "stack",
+	Short: "Move stacks between states",
+	Long:  "Stack commands work on a stack and every object it points at together",
+}
+
+func init() {
+	StackCmd.AddCommand(stackExportCmd)
+	StackCmd.AddCommand(stackImportCmd)
+}
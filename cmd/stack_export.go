@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	exportFile    string
+	exportDecrypt bool
+
+	stackExportCmd = &cobra.Command{
+		Use:   "export stack [stack...]",
+		Short: "Bundles stacks and their objects into a tar.gz",
+		Long: "Export writes the stacks and every object they point at with a manifest of checksums to a tar.gz bundle that lats stack import can add to another state. " +
+			"Encrypted objects stay encrypted unless --decrypt is passed, whoever imports them needs access to the KMS key",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sm := GetState()
+			fn := exportFile
+			if fn == "" {
+				fn = args[0] + ".tar.gz"
+			}
+			n, err := ExportStacksToFile(sm, args, exportDecrypt, fn)
+			if err != nil {
+				slog.Error("error exporting stacks", "error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("exported %d stacks to %s\n", n, fn)
+		},
+	}
+)
+
+func init() {
+	stackExportCmd.Flags().StringVarP(&exportFile, "file", "f", "", "bundle to write, defaults to the first stack's name with .tar.gz")
+	stackExportCmd.Flags().BoolVar(&exportDecrypt, "decrypt", false, "decrypt encrypted objects so the bundle can be imported without the KMS key")
+}
+
+// ExportStacksToFile writes the bundle to fn, it's only there once the whole bundle is written
+func ExportStacksToFile(sm state.StateManager, names []string, decrypt bool, fn string) (int, error) {
+	var b bytes.Buffer
+	n, err := ExportStacks(sm, names, decrypt, &b)
+	if err != nil {
+		return 0, err
+	}
+	return n, helpers.WriteFileAtomic(fn, b.Bytes(), 0600)
+}
+
+// ExportStacks writes a bundle of the stacks called names to w, encrypted objects are decrypted with decrypt.
+// It returns how many stacks it bundled
+func ExportStacks(sm state.StateManager, names []string, decrypt bool, w io.Writer) (int, error) {
+	b := stack.NewBundle()
+	encrypted := false
+	for _, name := range names {
+		s, err := FindStack(sm, name)
+		if err != nil {
+			return 0, err
+		}
+		objects := map[string][]byte{}
+		for _, o := range s.Objects {
+			dat, err := state.ReadObject(o.FileName)
+			if err != nil {
+				return 0, fmt.Errorf("stack %s object %s: %w", name, o.ID, err)
+			}
+			if state.IsEncrypted(dat) {
+				if decrypt {
+					dat, err = state.Open(dat)
+					if err != nil {
+						return 0, fmt.Errorf("stack %s object %s: %w", name, o.ID, err)
+					}
+				} else {
+					encrypted = true
+				}
+			}
+			objects[o.ID] = dat
+		}
+		err = b.Add(*s, objects)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if encrypted {
+		slog.Warn("the bundle has encrypted objects, importing it needs the KMS key they were encrypted with, export with --decrypt if that's a problem")
+	}
+	return len(names), b.Write(w)
+}
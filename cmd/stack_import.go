@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+// What import does with a stack whose name is already in the state
+const (
+	ConflictFail    = "fail"
+	ConflictSkip    = "skip"
+	ConflictRename  = "rename"
+	ConflictReplace = "replace"
+)
+
+var (
+	// Variables used for flags
+	onConflict string
+
+	stackImportCmd = &cobra.Command{
+		Use:   "import bundle",
+		Short: "Adds the stacks in a bundle to the state",
+		Long: "Import checks a bundle from lats stack export against its manifest and adds its stacks to the state with new object files. " +
+			"--on-conflict says what to do with a stack whose name is taken: fail (the default) imports nothing, skip leaves the existing stack, rename imports it as <name>-imported and replace points the name at the imported stack",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			f, err := os.Open(args[0])
+			if err != nil {
+				slog.Error("error opening bundle", "error", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			err = ImportStacks(&sm, config.StateFileName, f, onConflict, os.Stdout)
+			if err != nil {
+				slog.Error("error importing stacks", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stackImportCmd.Flags().StringVar(&onConflict, "on-conflict", ConflictFail, "what to do with stacks whose name is taken: fail, skip, rename or replace")
+}
+
+// ImportStacks adds the stacks in the bundle r to the state, onConflict says what to do with a stack whose name is taken.
+// Nothing is written unless the whole bundle checks out and no stack conflicts with fail
+func ImportStacks(sm *state.StateManager, stateFileName string, r io.Reader, onConflict string, out io.Writer) error {
+	switch onConflict {
+	case ConflictFail, ConflictSkip, ConflictRename, ConflictReplace:
+	default:
+		return fmt.Errorf("unknown --on-conflict %q, use fail, skip, rename or replace", onConflict)
+	}
+	b, err := stack.ReadBundle(r)
+	if err != nil {
+		return err
+	}
+
+	type planned struct {
+		bs      stack.BundleStack
+		name    string
+		replace bool
+	}
+	var plan []planned
+	var conflicts []string
+	taken := map[string]bool{} // taken are names used by stacks earlier in the bundle
+	for _, bs := range b.Manifest.Stacks {
+		if _, err := b.Stack(bs); err != nil {
+			return err
+		}
+		p := planned{bs: bs, name: bs.Name}
+		exists, err := stackExists(sm, bs.Name)
+		if err != nil {
+			return err
+		}
+		if exists || taken[bs.Name] {
+			switch onConflict {
+			case ConflictFail:
+				conflicts = append(conflicts, bs.Name)
+				continue
+			case ConflictSkip:
+				fmt.Fprintf(out, "skipped %s, it's already in the state\n", bs.Name)
+				continue
+			case ConflictRename:
+				p.name, err = freeStackName(sm, bs.Name, taken)
+				if err != nil {
+					return err
+				}
+			case ConflictReplace:
+				p.replace = exists
+			}
+		}
+		taken[p.name] = true
+		plan = append(plan, p)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("stacks already in the state: %s, pass --on-conflict to skip, rename or replace them", strings.Join(conflicts, ", "))
+	}
+
+	for _, p := range plan {
+		_, fn, err := b.Unpack(p.bs, p.name, ".state")
+		if err != nil {
+			return err
+		}
+		if p.replace {
+			sm.Remove(state.StackType, p.name)
+		}
+		sm.UpdateState(p.name, fn, state.StackType)
+		if p.name != p.bs.Name {
+			fmt.Fprintf(out, "imported %s as %s\n", p.bs.Name, p.name)
+		} else {
+			fmt.Fprintf(out, "imported %s\n", p.name)
+		}
+	}
+	if len(plan) == 0 {
+		return nil
+	}
+	return sm.SyncState(stateFileName)
+}
+
+func stackExists(sm *state.StateManager, name string) (bool, error) {
+	_, err := sm.FindStack(name)
+	if errors.Is(err, state.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// freeStackName finds a name for an imported stack that isn't in the state or the bundle
+func freeStackName(sm *state.StateManager, name string, taken map[string]bool) (string, error) {
+	for i := 1; ; i++ {
+		n := name + "-imported"
+		if i > 1 {
+			n = fmt.Sprintf("%s-%d", n, i)
+		}
+		exists, err := stackExists(sm, n)
+		if err != nil {
+			return "", err
+		}
+		if !exists && !taken[n] {
+			return n, nil
+		}
+	}
+}
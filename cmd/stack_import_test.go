@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func exportNightly(t *testing.T) []byte {
+	t.Helper()
+	writeVerifyState(t)
+	sm, err := state.ReadState(".confState.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	n, err := ExportStacks(sm, []string{"nightly"}, false, &b)
+	if err != nil || n != 1 {
+		t.Fatalf("ExportStacks() got %d %v", n, err)
+	}
+	return b.Bytes()
+}
+
+func TestImportStacks(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   bool
+		onConflict string
+		want       []string // want are the stacks in the state after the import
+		wantErr    bool
+	}{
+		{"new", false, ConflictFail, []string{"nightly"}, false},
+		{"fail", true, ConflictFail, []string{"nightly"}, true},
+		{"skip", true, ConflictSkip, []string{"nightly"}, false},
+		{"rename", true, ConflictRename, []string{"nightly", "nightly-imported"}, false},
+		{"replace", true, ConflictReplace, []string{"nightly"}, false},
+		{"bad mode", false, "merge", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := exportNightly(t)
+			t.Chdir(t.TempDir())
+			sm := state.StateManager{Mu: &sync.Mutex{}}
+			if tt.existing {
+				stack.NewStack("nightly", stack.LoneInstance, nil).Write(".state/existing.json")
+				sm.UpdateState("nightly", ".state/existing.json", state.StackType)
+				sm.SyncState(".confState.json")
+			}
+			err := ImportStacks(&sm, ".confState.json", bytes.NewReader(bundle), tt.onConflict, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportStacks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, _ := state.ReadState(".confState.json")
+			var names []string
+			for _, kv := range got.StateLocations {
+				names = append(names, kv.Object)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got stacks %v expected %v", names, tt.want)
+			}
+			if len(tt.want) == 0 {
+				return
+			}
+			s, err := FindStack(got, tt.want[len(tt.want)-1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the existing stack has no objects, an imported one has the instance
+			imported := tt.onConflict != ConflictFail && tt.onConflict != ConflictSkip || !tt.existing
+			if imported != (len(s.Objects) == 1) {
+				t.Errorf("got %d objects imported %v", len(s.Objects), imported)
+			}
+			if imported {
+				ins, err := stack.Read[*rds.RestoreDBInstanceFromDBSnapshotInput](s.Objects[0])
+				if err != nil || *ins.DBInstanceIdentifier != "db" {
+					t.Errorf("got %v %v expected db", ins, err)
+				}
+				var out bytes.Buffer
+				if err := VerifyState(".confState.json", &out); err != nil {
+					t.Errorf("imported state doesn't verify: %s", out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/state"
+)
+
+// stampMetadata records when a stack was made, who made it and with which lats.
+// Who is left out when STS can't tell us, that's not worth failing a backup over
+func stampMetadata(md state.StackMetadata, sts aws.StsOperations) state.StackMetadata {
+	md.Created = time.Now().UTC()
+	md.LatsVersion = latsVersion()
+	id, err := sts.CallerIdentity()
+	if err != nil {
+		slog.Warn("can't tell who is running lats, the stack won't record it", "error", err)
+		return md
+	}
+	md.CreatedBy = id.ARN
+	if md.AccountID == "" {
+		md.AccountID = id.AccountID
+	}
+	return md
+}
+
+// copyMetadata is the metadata of a copy of the stack from whose snapshot was copied to region as snapshot
+func copyMetadata(md state.StackMetadata, from string, snapshot string, region string, kmsKey string) state.StackMetadata {
+	if md.SourceRegion == "" {
+		md.SourceRegion = md.Region
+	}
+	md.Snapshot = snapshot
+	md.CopyOf = from
+	md.Region = region
+	if kmsKey != "" {
+		md.KmsKeyID = kmsKey
+	}
+	return md
+}
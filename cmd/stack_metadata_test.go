@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	latsaws "github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestStampMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      mock.StsClient
+		account     string
+		wantAccount string
+		wantBy      string
+	}{
+		{"from sts", mock.StsClient{Account: "123456789012", ARN: "arn:aws:iam::123456789012:user/dr"}, "", "123456789012", "arn:aws:iam::123456789012:user/dr"},
+		{"snapshot account wins", mock.StsClient{Account: "123456789012", ARN: "arn:aws:iam::123456789012:user/dr"}, "210987654321", "210987654321", "arn:aws:iam::123456789012:user/dr"},
+		{"no credentials", mock.StsClient{}, "210987654321", "210987654321", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stampMetadata(state.StackMetadata{AccountID: tt.account}, latsaws.StsOperations{Client: tt.client})
+			if got.AccountID != tt.wantAccount || got.CreatedBy != tt.wantBy || got.Created.IsZero() || got.LatsVersion == "" {
+				t.Errorf("stampMetadata() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestCopyMetadata(t *testing.T) {
+	orig := state.StackMetadata{SourceRegion: "us-east-1", Region: "us-east-1", Snapshot: "nightly", Engine: "postgres", KmsKeyID: "main-key"}
+	got := copyMetadata(orig, "nightly", "nightly-copy", "us-west-2", "backup-key")
+	want := state.StackMetadata{SourceRegion: "us-east-1", Region: "us-west-2", Snapshot: "nightly-copy", CopyOf: "nightly", Engine: "postgres", KmsKeyID: "backup-key"}
+	if got != want {
+		t.Errorf("copyMetadata() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// StateCmd groups the commands that work on the state file and the .state directory
+var StateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect and manage lats state",
+	Long:  "State commands work on the state file and the objects lats keeps in the .state directory",
+}
+
+func init() {
+	StateCmd.AddCommand(stateConvertCmd)
+	StateCmd.AddCommand(stateMigrateCmd)
+	StateCmd.AddCommand(stateRestoreBackupCmd)
+	StateCmd.AddCommand(stateForceUnlockCmd)
+	StateCmd.AddCommand(stateQueryCmd)
+	StateCmd.AddCommand(stateReplicateCmd)
+	StateCmd.AddCommand(stateRecoverCmd)
+	StateCmd.AddCommand(stateGCCmd)
+	StateCmd.AddCommand(stateVerifyCmd)
+	StateCmd.AddCommand(stateListCmd)
+	StateCmd.AddCommand(stateShowCmd)
+	StateCmd.AddCommand(stateRmCmd)
+	StateCmd.AddCommand(stateMvCmd)
+	StateCmd.AddCommand(stateRefreshCmd)
+}
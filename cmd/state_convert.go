@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	convertStateDir string
+
+	stateConvertCmd = &cobra.Command{
+		Use:   "convert",
+		Short: "Rewrites gob state files as JSON",
+		Long:  "Convert rewrites every stack and object the state file points at from gob to the versioned JSON format, files that are already JSON are left alone. When encryption is on objects that are still plaintext are encrypted",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			n, err := ConvertState(&sm, convertStateDir)
+			fmt.Printf("converted %d files\n", n)
+			if err != nil {
+				slog.Error("error converting state", "error", err)
+			}
+			if n > 0 {
+				serr := sm.SyncState(config.StateFileName)
+				if serr != nil {
+					slog.Error("error saving the new checksums", "error", serr)
+					err = serr
+				}
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stateConvertCmd.Flags().StringVar(&convertStateDir, "state-dir", ".state", "directory lats keeps it's state objects in")
+}
+
+// ConvertState rewrites every stack and object the state file points at as JSON, it returns how many files it rewrote.
+// The checksums in sm are updated for the files it rewrote, sync it afterwards
+func ConvertState(sm *state.StateManager, dir string) (int, error) {
+	converted := 0
+	var rewritten []string
+	var errs []error
+	for _, kv := range sm.StateLocations {
+		if kv.ObjectType == "stack" {
+			n, err := stack.ConvertStack(kv.FileLocation)
+			converted += n
+			if n > 0 {
+				rewritten = append(rewritten, kv.FileLocation)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("stack %s: %w", kv.Object, err))
+			}
+			continue
+		}
+		err := state.ConvertObject(kv.FileLocation, kv.ObjectType)
+		if errors.Is(err, state.ErrAlreadyConverted) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", kv.ObjectType, kv.Object, err))
+			continue
+		}
+		converted++
+		rewritten = append(rewritten, kv.FileLocation)
+	}
+	sm.Rehash(rewritten...)
+	warnUnconverted(dir)
+	return converted, errors.Join(errs...)
+}
+
+// warnUnconverted logs the files in dir that are still gob, these aren't referenced by the state file so we can't tell what they are
+func warnUnconverted(dir string) {
+	keys, err := state.Backend.List(context.Background(), dir)
+	if err != nil {
+		slog.Warn("can't read the state directory", "dir", dir, "error", err)
+		return
+	}
+	for _, fn := range keys {
+		dat, err := state.ReadObject(fn)
+		if err != nil {
+			slog.Warn("can't read state file", "file", fn, "error", err)
+			continue
+		}
+		if !state.IsDocument(dat) {
+			slog.Warn("file isn't referenced by the state file and is still gob", "file", fn)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestConvertState(t *testing.T) {
+	dir := t.TempDir()
+	objFile := dir + "/instance.gob"
+	stackFile := dir + "/stack.gob"
+
+	codec := stack.GobCodec[*rds.RestoreDBInstanceFromDBSnapshotInput]()
+	b, _ := codec.Encode(&rds.RestoreDBInstanceFromDBSnapshotInput{DBInstanceIdentifier: aws.String("foo")})
+	helpers.WriteOutput(objFile, b)
+	s := stack.NewStack("foo", stack.LoneInstance, []stack.Object{stack.NewObject("instance", objFile, stack.LoneInstance)})
+	var sb bytes.Buffer
+	gob.NewEncoder(&sb).Encode(s)
+	helpers.WriteOutput(stackFile, sb)
+
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("foo", stackFile, "stack")
+
+	n, err := ConvertState(&sm, dir)
+	if err != nil {
+		t.Fatalf("ConvertState() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("converted %d files expected 2", n)
+	}
+	for _, fn := range []string{objFile, stackFile} {
+		dat, _ := os.ReadFile(fn)
+		if !state.IsDocument(dat) {
+			t.Errorf("expected %s to be JSON", fn)
+		}
+	}
+	got, err := stack.ReadStack(stackFile)
+	if err != nil {
+		t.Fatalf("ReadStack() error = %v", err)
+	}
+	// the stack is written with the checksum of the converted object
+	objDat, _ := os.ReadFile(objFile)
+	s.Objects[0].Checksum = state.Checksum(objDat)
+	s.Objects[0].Size = int64(len(objDat))
+	if !reflect.DeepEqual(*got, s) {
+		t.Errorf("got %v expected %v", *got, s)
+	}
+	stackDat, _ := os.ReadFile(stackFile)
+	if sm.StateLocations[0].Checksum != state.Checksum(stackDat) {
+		t.Errorf("expected the state to have the checksum of the converted stack")
+	}
+	ins, err := stack.Read[*rds.RestoreDBInstanceFromDBSnapshotInput](got.Objects[0])
+	if err != nil || *ins.DBInstanceIdentifier != "foo" {
+		t.Errorf("got %v %v expected foo", ins, err)
+	}
+
+	n, err = ConvertState(&sm, dir)
+	if err != nil || n != 0 {
+		t.Errorf("second convert got %d %v expected 0 nil", n, err)
+	}
+}
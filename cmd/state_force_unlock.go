@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stateForceUnlockCmd = &cobra.Command{
+		Use:   "force-unlock [lock-id]",
+		Short: "Removes a stale state lock",
+		Long:  "Force-unlock shows who holds the state lock, pass the lock id to remove it. Only do this when the lats holding it has died, removing a live lock lets two runs overwrite each other",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, err := loadConfig()
+			if err != nil {
+				slog.Error("Error reading config", "error", err)
+				os.Exit(1)
+			}
+			err = applyConfig(config)
+			if err != nil {
+				slog.Error("Error setting up the state backend", "error", err)
+				os.Exit(1)
+			}
+			id := ""
+			if len(args) == 1 {
+				id = args[0]
+			}
+			err = ForceUnlock(config.StateFileName, id, os.Stdout)
+			if err != nil {
+				slog.Error("error unlocking state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+// ForceUnlock prints who holds the lock, when id is set it removes the lock
+func ForceUnlock(stateFileName string, id string, out io.Writer) error {
+	held, err := state.ReadLock(stateFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(out, "state isn't locked")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		fmt.Fprintf(out, "state is locked by %s\n", held)
+		return nil
+	}
+	err = state.ForceUnlock(stateFileName, id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "removed lock %s\n", id)
+	return nil
+}
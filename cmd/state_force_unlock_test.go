@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func TestForceUnlock(t *testing.T) {
+	stateFile := t.TempDir() + "/.confState.json"
+	var out bytes.Buffer
+	err := ForceUnlock(stateFile, "", &out)
+	if err != nil || !strings.Contains(out.String(), "isn't locked") {
+		t.Errorf("ForceUnlock() = %q, %v expected the state not to be locked", out.String(), err)
+	}
+
+	lock, err := state.AcquireLock(stateFile, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	out.Reset()
+	err = ForceUnlock(stateFile, "", &out)
+	if err != nil || !strings.Contains(out.String(), lock.Info.ID) {
+		t.Errorf("ForceUnlock() = %q, %v expected the lock id", out.String(), err)
+	}
+	err = ForceUnlock(stateFile, lock.Info.ID, &out)
+	if err != nil {
+		t.Fatalf("ForceUnlock() error = %v", err)
+	}
+	if _, err := state.AcquireLock(stateFile, 0); err != nil {
+		t.Errorf("expected the state to be unlocked got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	gcStateDir string
+	gcMinAge   time.Duration
+	gcDryRun   bool
+
+	stateGCCmd = &cobra.Command{
+		Use:   "gc",
+		Short: "Deletes state objects nothing points at",
+		Long: "GC deletes the files in the state directory that aren't referenced by the state file, its backups or the stacks they point at. " +
+			"These are left behind by failed runs and objects that were removed from state. Files newer than --min-age are kept so gc can't delete what a running lats just wrote, " +
+			"use --dry-run to see what would be deleted",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := GetState()
+			_, err := GCState(config.StateFileName, gcStateDir, gcMinAge, gcDryRun, os.Stdout)
+			if err != nil {
+				slog.Error("error collecting state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stateGCCmd.Flags().StringVar(&gcStateDir, "state-dir", ".state", "directory lats keeps it's state objects in")
+	stateGCCmd.Flags().DurationVar(&gcMinAge, "min-age", 24*time.Hour, "only delete files last written longer ago than this")
+	stateGCCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "list what would be deleted without deleting it")
+}
+
+// GCState deletes the unreferenced files in dir older than minAge, with dryRun it only lists them. It returns the files it deleted or would delete
+func GCState(stateFileName string, dir string, minAge time.Duration, dryRun bool, out io.Writer) ([]string, error) {
+	var collected []string
+	err := state.WithLock(stateFileName, func() error {
+		refs, err := referencedFiles(stateFileName)
+		if err != nil {
+			return fmt.Errorf("can't tell what's referenced so nothing was deleted: %w", err)
+		}
+		ctx := context.Background()
+		keys, err := state.Backend.List(ctx, dir)
+		if err != nil {
+			return err
+		}
+		sort.Strings(keys)
+		mt, _ := state.Backend.(state.ModTimer)
+		var errs []error
+		kept := 0
+		for _, k := range keys {
+			if refs[filepath.Clean(k)] {
+				continue
+			}
+			if minAge > 0 {
+				if mt == nil {
+					return fmt.Errorf("the %s backend can't tell how old files are, pass --min-age 0 to delete them anyway", state.Backend)
+				}
+				modified, err := mt.ModTime(ctx, k)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if time.Since(modified) < minAge {
+					kept++
+					continue
+				}
+			}
+			if dryRun {
+				fmt.Fprintf(out, "would delete %s\n", k)
+				collected = append(collected, k)
+				continue
+			}
+			err := state.Backend.Delete(ctx, k)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Fprintf(out, "deleted %s\n", k)
+			collected = append(collected, k)
+		}
+		if kept > 0 {
+			fmt.Fprintf(out, "kept %d unreferenced files newer than %s\n", kept, minAge)
+		}
+		return errors.Join(errs...)
+	})
+	return collected, err
+}
+
+// referencedFiles returns every file the state file and its backups point at, stacks are read for the files of their objects
+func referencedFiles(stateFileName string) (map[string]bool, error) {
+	refs := map[string]bool{}
+	dat, err := state.ReadObject(stateFileName)
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := state.DecodeStateFile(dat)
+	if err != nil {
+		return nil, err
+	}
+	err = markReferenced(refs, kvs, false)
+	if err != nil {
+		return nil, err
+	}
+	// backups are kept so restore-backup still has the objects it points at
+	backups, err := state.ListBackups(stateFileName)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range backups {
+		dat, err := state.ReadObject(b.Path)
+		if err != nil {
+			return nil, err
+		}
+		kvs, err := state.DecodeStateFile(dat)
+		if err != nil {
+			return nil, fmt.Errorf("backup %s: %w", b.Path, err)
+		}
+		err = markReferenced(refs, kvs, true)
+		if err != nil {
+			return nil, fmt.Errorf("backup %s: %w", b.Path, err)
+		}
+	}
+	return refs, nil
+}
+
+// markReferenced adds the files of kvs to refs, stacks that are already gone are only an error when they're in the state file
+func markReferenced(refs map[string]bool, kvs []state.StateKV, backup bool) error {
+	for _, kv := range kvs {
+		fn := filepath.Clean(kv.FileLocation)
+		if refs[fn] {
+			continue
+		}
+		refs[fn] = true
+		if kv.ObjectType != "stack" {
+			continue
+		}
+		dat, err := state.ReadObject(fn)
+		if backup && errors.Is(err, state.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("stack %s: %w", kv.Object, err)
+		}
+		s, err := stack.DecodeStack(dat)
+		if err != nil {
+			return fmt.Errorf("stack %s: %w", kv.Object, err)
+		}
+		for _, o := range s.Objects {
+			refs[filepath.Clean(o.FileName)] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestGCState(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.Mkdir(".state", 0755)
+	old := time.Now().Add(-48 * time.Hour)
+	write := func(fn string) {
+		os.WriteFile(fn, []byte("{}"), 0644)
+		os.Chtimes(fn, old, old)
+	}
+	write(".state/instance.json")
+	write(".state/snapshot.json")
+	write(".state/removed.json")
+	write(".state/orphan.json")
+	s := stack.NewStack("foo", stack.LoneInstance, []stack.Object{stack.NewObject("instance", ".state/instance.json", stack.LoneInstance)})
+	s.Write(".state/stack.json")
+
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("removed", ".state/removed.json", state.SnapshotType)
+	sm.SyncState(".confState.json")
+	// removed is only in the backup now so it's kept
+	sm, _ = state.ReadState(".confState.json")
+	sm.StateLocations = nil
+	sm.UpdateState("foo", ".state/stack.json", "stack")
+	sm.UpdateState("snap", ".state/snapshot.json", state.SnapshotType)
+	sm.SyncState(".confState.json")
+	// written by a run that's still going
+	os.WriteFile(".state/new.json", []byte("{}"), 0644)
+
+	tests := []struct {
+		name   string
+		minAge time.Duration
+		dryRun bool
+		want   []string
+		left   []string
+	}{
+		{"dry run", 24 * time.Hour, true, []string{".state/orphan.json"}, []string{".state/new.json", ".state/orphan.json"}},
+		{"delete", 24 * time.Hour, false, []string{".state/orphan.json"}, []string{".state/new.json"}},
+		{"no age", 0, false, []string{".state/new.json"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := GCState(".confState.json", ".state", tt.minAge, tt.dryRun, &out)
+			if err != nil {
+				t.Fatalf("GCState() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GCState() = %v want %v", got, tt.want)
+			}
+			for _, fn := range []string{".state/instance.json", ".state/snapshot.json", ".state/stack.json", ".state/removed.json"} {
+				if _, err := os.Stat(fn); err != nil {
+					t.Errorf("referenced file %s was deleted", fn)
+				}
+			}
+			for _, fn := range tt.left {
+				if _, err := os.Stat(fn); err != nil {
+					t.Errorf("expected %s to be left", fn)
+				}
+			}
+		})
+	}
+}
+
+func TestGCState_UnreadableStack(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.Mkdir(".state", 0755)
+	os.WriteFile(".state/orphan.json", []byte("{}"), 0644)
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("foo", ".state/missing.json", "stack")
+	sm.SyncState(".confState.json")
+
+	var out bytes.Buffer
+	_, err := GCState(".confState.json", ".state", 0, false, &out)
+	if err == nil {
+		t.Errorf("expected an error when a stack can't be read")
+	}
+	if _, err := os.Stat(".state/orphan.json"); err != nil {
+		t.Errorf("nothing should be deleted when a stack can't be read")
+	}
+}
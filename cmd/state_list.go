@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	listType string
+	showType string
+
+	stateListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists what's in the state file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sm := GetState()
+			err := ListState(sm, listType, os.Stdout)
+			if err != nil {
+				slog.Error("error listing state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	stateShowCmd = &cobra.Command{
+		Use:   "show name",
+		Short: "Prints an entry in the state file and what its file holds",
+		Long:  "Show prints the newest entry in the state file called name and decodes its file, stacks are printed with their objects",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sm := GetState()
+			err := ShowState(sm, showType, args[0], os.Stdout)
+			if err != nil {
+				slog.Error("error showing state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stateListCmd.Flags().StringVar(&listType, "type", "", "only list entries of this type like stack or RDSSnapshot")
+	stateShowCmd.Flags().StringVar(&showType, "type", state.StackType, "type of the entry")
+}
+
+// ListState writes the entries in the state file as a table, objType limits it to one type
+func ListState(sm state.StateManager, objType string, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tRESTORES\tOBJECTS\tFILE")
+	for _, kv := range sm.StateLocations {
+		if objType != "" && kv.ObjectType != objType {
+			continue
+		}
+		restores, objects := "-", "-"
+		if kv.Stack.RestorationType != "" {
+			restores = kv.Stack.RestorationType
+			objects = fmt.Sprint(kv.Stack.Objects)
+		}
+		name := kv.Object
+		if kv.Stack.Name != "" {
+			name = kv.Stack.Name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", kv.ObjectType, name, restores, objects, kv.FileLocation)
+	}
+	return w.Flush()
+}
+
+// ShowState writes the newest entry of type objType called name and its decoded file as JSON
+func ShowState(sm state.StateManager, objType string, name string, out io.Writer) error {
+	kvs, err := sm.Lookup(objType, name)
+	if err != nil {
+		return err
+	}
+	kv := kvs[len(kvs)-1]
+	dat, err := state.ReadObject(kv.FileLocation)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if objType == state.StackType {
+		v, err = stack.DecodeStack(dat)
+	} else {
+		v, err = state.DecodeObject(dat, objType)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", objType, name, err)
+	}
+	b, err := json.MarshalIndent(struct {
+		Entry state.StateKV `json:"entry"`
+		Data  interface{}   `json:"data"`
+	}{kv, v}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(b))
+	if len(kvs) > 1 {
+		fmt.Fprintf(out, "%d older entries are called %s\n", len(kvs)-1, name)
+	}
+	return nil
+}
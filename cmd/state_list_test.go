@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func TestListState(t *testing.T) {
+	writeVerifyState(t)
+	sm, _ := state.ReadState(".confState.json")
+	tests := []struct {
+		name    string
+		objType string
+		want    []string
+		notWant []string
+	}{
+		{"all", "", []string{"nightly  SingleRDSInstance  1", "RDSSnapshot  snap"}, nil},
+		{"stacks", state.StackType, []string{"nightly"}, []string{"snap"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := ListState(sm, tt.objType, &out); err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("expected %q in %q", w, out.String())
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(out.String(), w) {
+					t.Errorf("didn't expect %q in %q", w, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestShowState(t *testing.T) {
+	writeVerifyState(t)
+	sm, _ := state.ReadState(".confState.json")
+	tests := []struct {
+		name    string
+		objType string
+		obj     string
+		want    string
+		wantErr error
+	}{
+		{"stack", state.StackType, "nightly", `"fileName": ".state/instance.json"`, nil},
+		{"snapshot", state.SnapshotType, "snap", `"DBSnapshotIdentifier": "snap"`, nil},
+		{"missing", state.StackType, "weekly", "", state.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := ShowState(sm, tt.objType, tt.obj, &out)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ShowState() error = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("expected %q in %q", tt.want, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	migrateDryRun bool
+
+	stateMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrades the state file and stacks to the layout this lats writes",
+		Long:  "Migrate upgrades the state file and every stack it points at one version at a time, use --dry-run to see the migrations without writing anything",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, err := loadConfig()
+			if err != nil {
+				slog.Error("Error reading config", "error", err)
+				os.Exit(1)
+			}
+			err = applyConfig(config)
+			if err != nil {
+				slog.Error("Error setting up the state backend", "error", err)
+				os.Exit(1)
+			}
+			err = MigrateState(config.StateFileName, migrateDryRun, os.Stdout)
+			if err != nil {
+				slog.Error("error migrating state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stateMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "print the migrations without running them")
+}
+
+// MigrateState upgrades the state file and the stacks it points at, with dryRun it only prints the plan
+func MigrateState(stateFileName string, dryRun bool, out io.Writer) error {
+	b, err := state.ReadObject(stateFileName)
+	if err != nil {
+		return err
+	}
+	steps, err := printMigrationPlan(out, state.StateMigrations, stateFileName, b)
+	if err != nil {
+		return err
+	}
+	sm, err := state.ReadState(stateFileName)
+	if err != nil {
+		return err
+	}
+	if !dryRun && len(steps) > 0 {
+		err = sm.SyncState(stateFileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	var migrated []string
+	for _, kv := range sm.StateLocations {
+		if kv.ObjectType != "stack" {
+			continue
+		}
+		ok, err := migrateStack(kv, dryRun, out)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stack %s: %w", kv.Object, err))
+		}
+		if ok {
+			migrated = append(migrated, kv.FileLocation)
+		}
+	}
+	if dryRun {
+		fmt.Fprintln(out, "dry run, nothing was written")
+	}
+	if len(migrated) > 0 {
+		// the stacks changed so the state file needs their new checksums
+		sm.Rehash(migrated...)
+		err = sm.SyncState(stateFileName)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// migrateStack migrates a stack file and returns if it was rewritten
+func migrateStack(kv state.StateKV, dryRun bool, out io.Writer) (bool, error) {
+	b, err := state.ReadObject(kv.FileLocation)
+	if err != nil {
+		return false, err
+	}
+	name := fmt.Sprintf("stack %s (%s)", kv.Object, kv.FileLocation)
+	steps, err := printMigrationPlan(out, stack.StackMigrations, name, b)
+	if err != nil || dryRun || len(steps) == 0 {
+		return false, err
+	}
+	m, _, err := stack.StackMigrations.Migrate(b)
+	if err != nil {
+		return false, err
+	}
+	_, err = state.WriteOutput(kv.FileLocation, *bytes.NewBuffer(m))
+	return err == nil, err
+}
+
+// printMigrationPlan writes the migrations a file needs and returns them
+func printMigrationPlan(out io.Writer, m state.Migrations, name string, b []byte) ([]state.Migration, error) {
+	from, err := m.Version(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	steps, err := m.Plan(from)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(steps) == 0 {
+		fmt.Fprintf(out, "%s: up to date at version %d\n", name, from)
+		return steps, nil
+	}
+	fmt.Fprintf(out, "%s: version %d -> %d\n", name, from, m.Current)
+	for _, s := range steps {
+		fmt.Fprintf(out, "  %d -> %d: %s\n", s.From, s.From+1, s.Description)
+	}
+	return steps, nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestMigrateState(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := dir + "/.confState.json"
+	stackFile := dir + "/stack.gob"
+
+	type legacyObject struct {
+		FileName string
+		Order    int
+		ObjType  string
+	}
+	type legacyStack struct {
+		Name                  string
+		RestorationObjectName string
+		Objects               map[int][]legacyObject
+	}
+	var sb bytes.Buffer
+	gob.NewEncoder(&sb).Encode(legacyStack{Name: "foo", Objects: map[int][]legacyObject{2: {{FileName: "foo", Order: 2, ObjType: stack.LoneInstance}}}})
+	os.WriteFile(stackFile, sb.Bytes(), 0644)
+	kvs, _ := json.Marshal([]state.StateKV{{Object: "foo", FileLocation: stackFile, ObjectType: "stack"}})
+	os.WriteFile(stateFile, kvs, 0644)
+
+	var out bytes.Buffer
+	err := MigrateState(stateFile, true, &out)
+	if err != nil {
+		t.Fatalf("MigrateState() dry run error = %v", err)
+	}
+	for _, want := range []string{"version 1 -> 2", "stack foo", "dry run"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("dry run output %q doesn't contain %q", out.String(), want)
+		}
+	}
+	if dat, _ := os.ReadFile(stateFile); !bytes.Equal(dat, kvs) {
+		t.Errorf("dry run rewrote the state file")
+	}
+	if dat, _ := os.ReadFile(stackFile); !bytes.Equal(dat, sb.Bytes()) {
+		t.Errorf("dry run rewrote the stack")
+	}
+
+	out.Reset()
+	err = MigrateState(stateFile, false, &out)
+	if err != nil {
+		t.Fatalf("MigrateState() error = %v", err)
+	}
+	dat, _ := os.ReadFile(stateFile)
+	if v, _ := state.StateFileVersion(dat); v != state.StateVersion {
+		t.Errorf("state file is version %d expected %d", v, state.StateVersion)
+	}
+	dat, _ = os.ReadFile(stackFile)
+	if v, _ := stack.FileVersion(dat); v != stack.StackVersion || !state.IsDocument(dat) {
+		t.Errorf("stack is version %d expected a %d document", v, stack.StackVersion)
+	}
+
+	out.Reset()
+	MigrateState(stateFile, false, &out)
+	if strings.Count(out.String(), "up to date") != 2 {
+		t.Errorf("expected everything up to date got %q", out.String())
+	}
+}
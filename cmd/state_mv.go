@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	mvType string
+
+	stateMvCmd = &cobra.Command{
+		Use:   "mv old new",
+		Short: "Renames an entry in the state file",
+		Long:  "Mv renames every entry in the state file of --type called old. Stacks are written to a new file with the new name so backups of the state file still point at the old one",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			err := MoveState(&sm, config.StateFileName, mvType, args[0], args[1], os.Stdout)
+			if err != nil {
+				slog.Error("error renaming in state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stateMvCmd.Flags().StringVar(&mvType, "type", state.StackType, "type of the entry")
+}
+
+// MoveState renames the entries of type objType called old to new, stacks get a new file with Name set to new
+func MoveState(sm *state.StateManager, stateFileName string, objType string, old string, new string, out io.Writer) error {
+	if old == new {
+		return fmt.Errorf("%s is already called %s", old, new)
+	}
+	kvs, err := sm.Lookup(objType, old)
+	if err != nil {
+		return err
+	}
+	if _, err := sm.Lookup(objType, new); err == nil {
+		return fmt.Errorf("there's already a %s called %s, lats state rm it first", objType, new)
+	}
+	files := make([]string, len(kvs))
+	for i, kv := range kvs {
+		files[i] = kv.FileLocation
+		if objType != state.StackType {
+			continue
+		}
+		s, err := stack.ReadStack(kv.FileLocation)
+		if err != nil {
+			return fmt.Errorf("stack %s: %w", old, err)
+		}
+		s.Name = new
+		files[i] = fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
+		err = s.Write(files[i])
+		if err != nil {
+			return err
+		}
+	}
+	sm.Remove(objType, old)
+	for _, fn := range files {
+		sm.UpdateState(new, fn, objType)
+	}
+	err = sm.SyncState(stateFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "renamed %d %s entries from %s to %s\n", len(kvs), objType, old, new)
+	return nil
+}
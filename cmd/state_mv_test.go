@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func TestMoveState(t *testing.T) {
+	tests := []struct {
+		name    string
+		objType string
+		old     string
+		new     string
+		wantErr bool
+	}{
+		{"stack", state.StackType, "nightly", "weekly", false},
+		{"snapshot", state.SnapshotType, "snap", "snap-2", false},
+		{"missing", state.StackType, "weekly", "monthly", true},
+		{"taken", state.StackType, "nightly", "nightly", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeVerifyState(t)
+			sm, _ := state.ReadState(".confState.json")
+			err := MoveState(&sm, ".confState.json", tt.objType, tt.old, tt.new, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MoveState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, _ := state.ReadState(".confState.json")
+			if _, err := got.Lookup(tt.objType, tt.old); !errors.Is(err, state.ErrNotFound) {
+				t.Errorf("expected %s to be gone got %v", tt.old, err)
+			}
+			kvs, err := got.Lookup(tt.objType, tt.new)
+			if err != nil || kvs[0].Object != tt.new {
+				t.Fatalf("got %v %v expected %s", kvs, err, tt.new)
+			}
+			if tt.objType == state.StackType {
+				s, err := FindStack(got, tt.new)
+				if err != nil || s.Name != tt.new || kvs[0].Stack.Name != tt.new {
+					t.Errorf("expected the stack and its entry to be called %s got %v %v", tt.new, s, err)
+				}
+			}
+			var out bytes.Buffer
+			if err := VerifyState(".confState.json", &out); err != nil {
+				t.Errorf("state doesn't verify after mv: %s", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	queryType    string
+	queryName    string
+	queryEngine  string
+	querySince   string
+	queryUntil   string
+	queryHistory bool
+
+	stateQueryCmd = &cobra.Command{
+		Use:   "query",
+		Short: "Lists the objects in the state file that match the filters",
+		Long:  "Query lists the objects in the state file filtered by type, name, engine and when they were created. --history lists every change to the state instead, it needs the sqlite backend",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := GetState()
+			f, err := queryFilter(queryType, queryName, queryEngine, querySince, queryUntil)
+			if err != nil {
+				slog.Error("error parsing filters", "error", err)
+				os.Exit(1)
+			}
+			if queryHistory {
+				err = QueryHistory(f, os.Stdout)
+			} else {
+				err = QueryState(config.StateFileName, f, os.Stdout)
+			}
+			if err != nil {
+				slog.Error("error querying state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stateQueryCmd.Flags().StringVar(&queryType, "type", "", "object type like stack or RDSSnapshot")
+	stateQueryCmd.Flags().StringVar(&queryName, "name", "", "object name, * and ? are wildcards")
+	stateQueryCmd.Flags().StringVar(&queryEngine, "engine", "", "database engine like postgres or aurora-mysql")
+	stateQueryCmd.Flags().StringVar(&querySince, "since", "", "only objects created at or after this time, RFC3339 or YYYY-MM-DD")
+	stateQueryCmd.Flags().StringVar(&queryUntil, "until", "", "only objects created before this time, RFC3339 or YYYY-MM-DD")
+	stateQueryCmd.Flags().BoolVar(&queryHistory, "history", false, "list changes to the state instead of objects")
+}
+
+func queryFilter(objType, name, engine, since, until string) (state.Filter, error) {
+	f := state.Filter{Type: objType, Name: name, Engine: engine}
+	var err error
+	if since != "" {
+		f.Since, err = parseTime(since)
+		if err != nil {
+			return f, fmt.Errorf("--since: %w", err)
+		}
+	}
+	if until != "" {
+		f.Until, err = parseTime(until)
+		if err != nil {
+			return f, fmt.Errorf("--until: %w", err)
+		}
+	}
+	return f, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// QueryState writes the objects in the state file matching f as a table
+func QueryState(stateFileName string, f state.Filter, out io.Writer) error {
+	records, err := state.Query(stateFileName, f)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tENGINE\tCREATED\tFILE")
+	for _, r := range records {
+		engine := r.Engine
+		if engine == "" {
+			engine = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Object, r.ObjectType, engine, formatTime(r.Created), r.FileLocation)
+	}
+	return w.Flush()
+}
+
+// QueryHistory writes the changes matching f, the name filter matches the key of the change
+func QueryHistory(f state.Filter, out io.Writer) error {
+	h, ok := state.Backend.(state.Historian)
+	if !ok {
+		return fmt.Errorf("the %s backend doesn't keep history, use the sqlite backend", state.Backend)
+	}
+	changes, err := h.History(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tOP\tKEY\tGENERATION\tSIZE")
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", formatTime(c.At), c.Op, c.Key, c.Generation, c.Size)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func TestQueryFilter(t *testing.T) {
+	f, err := queryFilter("stack", "foo*", "postgres", "2024-05-01", "2024-06-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("queryFilter() error = %v", err)
+	}
+	if f.Since.Day() != 1 || f.Until != time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("queryFilter() = %v", f)
+	}
+	if _, err := queryFilter("", "", "", "yesterday", ""); err == nil {
+		t.Errorf("expected an error for a bad time")
+	}
+}
+
+func TestQueryState(t *testing.T) {
+	stateFile := t.TempDir() + "/.confState.json"
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("foo", "/tmp/missing-foo", "stack")
+	sm.UpdateState("bar", "/tmp/missing-bar", state.SnapshotType)
+	sm.SyncState(stateFile)
+
+	var out bytes.Buffer
+	err := QueryState(stateFile, state.Filter{Type: "stack"}, &out)
+	if err != nil {
+		t.Fatalf("QueryState() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "foo") || strings.Contains(out.String(), "bar") {
+		t.Errorf("QueryState() = %q, want only foo", out.String())
+	}
+	if err := QueryHistory(state.Filter{}, &out); err == nil {
+		t.Errorf("expected an error asking the local backend for history")
+	}
+}
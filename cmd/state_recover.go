@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	recoverRegion    string
+	recoverBucket    string
+	recoverPrefix    string
+	recoverEndpoint  string
+	recoverPathStyle bool
+	recoverForce     bool
+
+	stateRecoverCmd = &cobra.Command{
+		Use:   "recover",
+		Short: "Rebuilds local state from the copy in the backup region",
+		Long:  "Recover copies the state file, the stacks and objects it points at and the config from the replica in the backup region into the working directory, use it on a new machine when the one that ran lats or the main region is gone",
+		Run: func(cmd *cobra.Command, args []string) {
+			rc := ReplicaConfig{Bucket: recoverBucket, Prefix: recoverPrefix, Endpoint: recoverEndpoint, UsePathStyle: recoverPathStyle}
+			config, err := loadConfig()
+			if err == nil && config.Replica != nil && rc.Bucket == "" {
+				rc = *config.Replica
+			}
+			if rc.Bucket == "" {
+				slog.Error("pass --bucket, there's no replica in .latsConfig.json")
+				os.Exit(1)
+			}
+			err = RecoverState(rc.backend(recoverRegion), recoverLocal(config, err), recoverForce, os.Stdout)
+			if err != nil {
+				slog.Error("error recovering state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	stateReplicateCmd = &cobra.Command{
+		Use:   "replicate",
+		Short: "Copies state to the backup region",
+		Long:  "Replicate copies the state file and everything it points at to the replica in the backup region, lats does this after every change to state so you only need it when that failed",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := GetState()
+			single, err := singleRegionKey(config, aws.InitKms)
+			if err != nil {
+				slog.Warn("can't tell if the encryption key is Multi-Region", "error", err)
+			}
+			if single {
+				slog.Warn(singleRegionKeyWarning, "key", config.Encryption.KmsKeyID)
+			}
+			err = state.ReplicateState(config.StateFileName)
+			if err != nil {
+				slog.Error("error replicating state", "error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("replicated %s to %s\n", config.StateFileName, state.Replica.Backend)
+		},
+	}
+)
+
+func init() {
+	stateRecoverCmd.Flags().StringVar(&recoverRegion, "from-region", "", "region the replica is in, usually the backup region")
+	stateRecoverCmd.Flags().StringVar(&recoverBucket, "bucket", "", "replica bucket, defaults to the replica in .latsConfig.json")
+	stateRecoverCmd.Flags().StringVar(&recoverPrefix, "prefix", "", "prefix of the replica in the bucket")
+	stateRecoverCmd.Flags().StringVar(&recoverEndpoint, "endpoint", "", "endpoint for S3 compatible servers")
+	stateRecoverCmd.Flags().BoolVar(&recoverPathStyle, "path-style", false, "use path style requests, most S3 compatible servers need it")
+	stateRecoverCmd.Flags().BoolVar(&recoverForce, "force", false, "overwrite local state and config")
+	stateRecoverCmd.MarkFlagRequired("from-region")
+}
+
+// recoverLocal is where the workspace keeps state on disk, on a new machine there's no config so it comes from --workspace
+func recoverLocal(config Config, configErr error) state.LocalBackend {
+	if configErr != nil {
+		return state.LocalBackend{Dir: workspaceDir(workspaceName)}
+	}
+	if config.Backend != nil && (config.Backend.Type == "" || config.Backend.Type == "local") {
+		return state.LocalBackend{Dir: config.Backend.Path}
+	}
+	return state.LocalBackend{}
+}
+
+// RecoverState copies the replica's state into local, the config goes in the working directory. Existing state is only overwritten with force
+func RecoverState(replica state.StateBackend, local state.LocalBackend, force bool, out io.Writer) error {
+	m, err := state.ReadManifest(replica)
+	if err != nil {
+		return err
+	}
+	state.Backend = local
+	if _, err := state.ReadObject(m.StateFile); err == nil && !force {
+		return fmt.Errorf("%s already exists, pass --force to overwrite it", m.StateFile)
+	}
+	fmt.Fprintf(out, "recovering state replicated at %s from %s\n", m.Replicated.Local().Format("2006-01-02 15:04:05"), replica)
+	n, err := state.Recover(replica, m)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "recovered %d objects\n", n)
+
+	ctx := context.Background()
+	var errs []error
+	for fn := range m.Files {
+		if _, err := os.Stat(fn); err == nil && !force {
+			fmt.Fprintf(out, "kept the existing %s\n", fn)
+			continue
+		}
+		dat, _, err := replica.Get(ctx, fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = helpers.WriteFileAtomic(fn, dat, 0644)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(out, "recovered %s\n", fn)
+	}
+	if config, err := loadConfig(); err == nil && config.Backend != nil && config.Backend.Type != "" && config.Backend.Type != "local" {
+		fmt.Fprintf(out, "the config keeps state in the %s backend, state was recovered to %s\n", config.Backend.Type, local)
+	}
+	return errors.Join(errs...)
+}
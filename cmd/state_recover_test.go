@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestRecoverState(t *testing.T) {
+	t.Chdir(t.TempDir())
+	replica := aws.S3Backend{Client: mock.NewS3Client(), Bucket: "backup"}
+	state.Replica = &state.Replication{Backend: replica, Files: []string{".latsConfig.json"}}
+	defer func() { state.Replica = nil }()
+
+	writeConfig(newConfig("us-east-1", "us-west-2"), ".latsConfig.json")
+	state.WriteOutput(".state/foo.json", *bytes.NewBufferString("{}"))
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("foo", ".state/foo.json", state.SnapshotType)
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := RecoverState(replica, state.LocalBackend{}, false, &out); err == nil {
+		t.Errorf("expected an error recovering over existing state")
+	}
+
+	t.Chdir(t.TempDir())
+	out.Reset()
+	err := RecoverState(replica, state.LocalBackend{}, false, &out)
+	if err != nil {
+		t.Fatalf("RecoverState() error = %v", err)
+	}
+	for _, fn := range []string{".confState.json", ".state/foo.json", ".latsConfig.json"} {
+		if _, err := os.Stat(fn); err != nil {
+			t.Errorf("%s wasn't recovered: %v", fn, err)
+		}
+	}
+	if !strings.Contains(out.String(), "recovered 2 objects") {
+		t.Errorf("RecoverState() output = %q", out.String())
+	}
+	config, err := readConfig(".latsConfig.json")
+	if err != nil || config.BackupRegion != "us-west-2" {
+		t.Errorf("recovered config = %v, %v", config, err)
+	}
+}
+
+func TestApplyConfig_Replica(t *testing.T) {
+	defer func() { state.Replica = nil }()
+	err := applyConfig(Config{MainRegion: "us-east-1", Replica: &ReplicaConfig{Bucket: "backup"}})
+	if err == nil {
+		t.Errorf("expected an error for a replica without a backup region")
+	}
+	err = applyConfig(Config{MainRegion: "us-east-1", BackupRegion: "us-west-2", Replica: &ReplicaConfig{Bucket: "backup"}})
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if state.Replica == nil || state.Replica.Backend.String() != "s3://backup" {
+		t.Errorf("expected a replica in the backup bucket got %v", state.Replica)
+	}
+}
+
+func TestSingleRegionKey(t *testing.T) {
+	keys := func(region string) aws.KmsOperations {
+		return aws.KmsOperations{Client: mock.NewKmsClient("alias/lats", "mrk-1234", "1234")}
+	}
+	replica := &ReplicaConfig{Bucket: "backup"}
+	tests := []struct {
+		name    string
+		config  Config
+		want    bool
+		wantErr bool
+	}{
+		{"no replica", Config{MainRegion: "us-east-1", Encryption: &EncryptionConfig{KmsKeyID: "1234"}}, false, false},
+		{"not encrypted", Config{MainRegion: "us-east-1", Replica: replica}, false, false},
+		{"single region key", Config{MainRegion: "us-east-1", Replica: replica, Encryption: &EncryptionConfig{KmsKeyID: "1234"}}, true, false},
+		{"single region alias", Config{MainRegion: "us-east-1", Replica: replica, Encryption: &EncryptionConfig{KmsKeyID: "alias/lats"}}, true, false},
+		{"multi-region key", Config{MainRegion: "us-east-1", Replica: replica, Encryption: &EncryptionConfig{KmsKeyID: "mrk-1234"}}, false, false},
+		{"key in the backup region", Config{MainRegion: "us-east-1", Replica: replica, Encryption: &EncryptionConfig{KmsKeyID: "1234", Region: "us-west-2"}}, false, false},
+		{"missing key", Config{MainRegion: "us-east-1", Replica: replica, Encryption: &EncryptionConfig{KmsKeyID: "alias/missing"}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := singleRegionKey(tt.config, keys)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("singleRegionKey() = %v, %v want %v", got, err, tt.want)
+			}
+		})
+	}
+	if maybeMultiRegion("arn:aws:kms:us-east-1:123456789012:key/1234") || !maybeMultiRegion("arn:aws:kms:us-east-1:123456789012:key/mrk-1234") {
+		t.Error("maybeMultiRegion() should only be false for keys that can't be Multi-Region")
+	}
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stateRefreshCmd = &cobra.Command{
+		Use:   "refresh",
+		Short: "Checks the snapshot of every stack still exists in AWS",
+		Long: "Refresh describes the snapshot of every stack in the main and backup regions and records its region, status, size and creation time in the state file. " +
+			"Stacks whose snapshot can't be found in either region are flagged and refresh exits non-zero",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			missing, err := RefreshState(&sm, config.StateFileName, configRegions(config), os.Stdout)
+			if err != nil {
+				slog.Error("error refreshing state", "error", err)
+				os.Exit(1)
+			}
+			if len(missing) > 0 {
+				slog.Error("stacks whose snapshot is gone", "stacks", strings.Join(missing, ", "))
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+// RegionClient is an RDS client for a region
+type RegionClient struct {
+	Region string
+	DB     aws.DbInstances
+}
+
+// RefreshState describes the snapshot of every stack in regions, the region it was last seen in goes first, and records what it found.
+// It returns the stacks whose snapshot wasn't in any region
+func RefreshState(sm *state.StateManager, stateFileName string, regions []RegionClient, out io.Writer) ([]string, error) {
+	var missing []string
+	var errs []error
+	now := time.Now()
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STACK\tSNAPSHOT\tREGION\tSTATUS\tSIZE\tCREATED")
+	for _, kv := range append([]state.StateKV{}, sm.StateLocations...) {
+		if kv.ObjectType != state.StackType {
+			continue
+		}
+		s, err := stack.ReadStack(kv.FileLocation)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stack %s: %w", kv.Object, err))
+			continue
+		}
+		id, cluster := stackSnapshot(s)
+		if id == "" {
+			fmt.Fprintf(w, "%s\t-\t-\tno snapshot recorded\t-\t-\n", s.Name)
+			continue
+		}
+		info, err := describeSnapshot(id, cluster, orderRegions(regions, kv.Snapshot.Region))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stack %s: %w", s.Name, err))
+			continue
+		}
+		info.Refreshed = now
+		sm.SetSnapshot(kv.FileLocation, info)
+		if info.Status == state.SnapshotMissing {
+			missing = append(missing, s.Name)
+			fmt.Fprintf(w, "%s\t%s\t-\t%s\t-\t-\n", s.Name, id, info.Status)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d GiB\t%s\n", s.Name, id, info.Region, info.Status, info.SizeGB, formatTime(info.Created))
+	}
+	w.Flush()
+	if len(missing) > 0 {
+		fmt.Fprintf(out, "%d stacks have no snapshot in any region: %s\n", len(missing), strings.Join(missing, ", "))
+	}
+	err := sm.SyncState(stateFileName)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return missing, errors.Join(errs...)
+}
+
+// stackSnapshot is the snapshot a stack restores from and if it's a cluster snapshot
+func stackSnapshot(s *stack.Stack) (string, bool) {
+	for _, o := range s.Objects {
+		switch o.ObjType {
+		case stack.LoneInstance:
+			in, err := stack.Read[*rds.RestoreDBInstanceFromDBSnapshotInput](o)
+			if err == nil && in.DBSnapshotIdentifier != nil {
+				return *in.DBSnapshotIdentifier, false
+			}
+		case stack.Cluster:
+			in, err := stack.Read[*rds.RestoreDBClusterFromSnapshotInput](o)
+			if err == nil && in.SnapshotIdentifier != nil {
+				return *in.SnapshotIdentifier, true
+			}
+		}
+	}
+	return "", false
+}
+
+// orderRegions puts region first so a snapshot is looked for where it was last seen
+func orderRegions(regions []RegionClient, region string) []RegionClient {
+	ordered := []RegionClient{}
+	for _, r := range regions {
+		if r.Region == region {
+			ordered = append(ordered, r)
+		}
+	}
+	for _, r := range regions {
+		if r.Region != region {
+			ordered = append(ordered, r)
+		}
+	}
+	return ordered
+}
+
+// describeSnapshot finds the snapshot in the first region that has it, it's SnapshotMissing when none do
+func describeSnapshot(id string, cluster bool, regions []RegionClient) (state.SnapshotInfo, error) {
+	for _, r := range regions {
+		if cluster {
+			snap, err := r.DB.GetClusterSnapshot(id)
+			if err != nil {
+				return state.SnapshotInfo{}, fmt.Errorf("describing %s in %s: %w", id, r.Region, err)
+			}
+			if snap != nil {
+				return state.SnapshotInfo{ID: id, Region: r.Region, Status: derefString(snap.Status), SizeGB: derefInt32(snap.AllocatedStorage), Created: derefTime(snap.SnapshotCreateTime)}, nil
+			}
+			continue
+		}
+		snap, err := r.DB.GetSnapshot(id)
+		if err != nil {
+			return state.SnapshotInfo{}, fmt.Errorf("describing %s in %s: %w", id, r.Region, err)
+		}
+		if snap != nil {
+			return state.SnapshotInfo{ID: id, Region: r.Region, Status: derefString(snap.Status), SizeGB: derefInt32(snap.AllocatedStorage), Created: derefTime(snap.SnapshotCreateTime)}, nil
+		}
+	}
+	return state.SnapshotInfo{ID: id, Status: state.SnapshotMissing}, nil
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefInt32(i *int32) int32 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func derefTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
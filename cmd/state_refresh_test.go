@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	latsaws "github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+// writeSnapshotStack writes a stack restoring snapshot and adds it to sm
+func writeSnapshotStack(t *testing.T, sm *state.StateManager, name string, snapshot string) {
+	t.Helper()
+	obj := stack.NewObject("instance", ".state/"+name+"-instance.json", stack.LoneInstance)
+	err := stack.Write(obj, &rds.RestoreDBInstanceFromDBSnapshotInput{DBSnapshotIdentifier: aws.String(snapshot)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stack.NewStack(name, stack.LoneInstance, []stack.Object{obj}).Write(".state/" + name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.UpdateState(name, ".state/"+name+".json", state.StackType)
+}
+
+func TestRefreshState(t *testing.T) {
+	t.Chdir(t.TempDir())
+	created := time.Date(2024, 6, 1, 5, 10, 0, 0, time.UTC)
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	writeSnapshotStack(t, &sm, "nightly", "nightly")
+	writeSnapshotStack(t, &sm, "nightly-copy", "nightly-copy")
+	writeSnapshotStack(t, &sm, "expired", "rds:db-2023-01-01")
+	sm.SyncState(".confState.json")
+
+	main := importRDSClient{snapshot: &types.DBSnapshot{DBSnapshotIdentifier: aws.String("nightly"), Status: aws.String("available"), AllocatedStorage: aws.Int32(20), SnapshotCreateTime: &created}}
+	backup := importRDSClient{snapshot: &types.DBSnapshot{DBSnapshotIdentifier: aws.String("nightly-copy"), Status: aws.String("copying")}}
+	regions := []RegionClient{
+		{Region: "us-east-1", DB: latsaws.DbInstances{RdsClient: main}},
+		{Region: "us-west-2", DB: latsaws.DbInstances{RdsClient: backup}},
+	}
+	var out bytes.Buffer
+	missing, err := RefreshState(&sm, ".confState.json", regions, &out)
+	if err != nil {
+		t.Fatalf("RefreshState() error = %v", err)
+	}
+	if strings.Join(missing, ",") != "expired" {
+		t.Errorf("got missing %v expected expired", missing)
+	}
+	if !strings.Contains(out.String(), "1 stacks have no snapshot in any region: expired") {
+		t.Errorf("expected expired to be flagged got %q", out.String())
+	}
+
+	got, _ := state.ReadState(".confState.json")
+	tests := []struct {
+		stack  string
+		region string
+		status string
+		size   int32
+		create time.Time
+	}{
+		{"nightly", "us-east-1", "available", 20, created},
+		{"nightly-copy", "us-west-2", "copying", 0, time.Time{}},
+		{"expired", "", state.SnapshotMissing, 0, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stack, func(t *testing.T) {
+			kv, err := got.FindStack(tt.stack)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info := kv.Snapshot
+			if info.Region != tt.region || info.Status != tt.status || info.SizeGB != tt.size || !info.Created.Equal(tt.create) || info.Refreshed.IsZero() {
+				t.Errorf("got %+v expected %s %s %d %v", info, tt.region, tt.status, tt.size, tt.create)
+			}
+		})
+	}
+}
+
+func TestOrderRegions(t *testing.T) {
+	regions := []RegionClient{{Region: "us-east-1"}, {Region: "us-west-2"}}
+	got := orderRegions(regions, "us-west-2")
+	if got[0].Region != "us-west-2" || got[1].Region != "us-east-1" {
+		t.Errorf("expected the region it was last seen in first got %v", got)
+	}
+	got = orderRegions(regions, "")
+	if got[0].Region != "us-east-1" || len(got) != 2 {
+		t.Errorf("expected the order to be kept got %v", got)
+	}
+}
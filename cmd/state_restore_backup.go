@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stateRestoreBackupCmd = &cobra.Command{
+		Use:   "restore-backup [backup]",
+		Short: "Restores the state file from a backup",
+		Long:  "Restore-backup lists the backups of the state file, pass the name of a backup or latest to restore it. The current state file is backed up before it's replaced",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, err := loadConfig()
+			if err != nil {
+				slog.Error("Error reading config", "error", err)
+				os.Exit(1)
+			}
+			err = applyConfig(config)
+			if err != nil {
+				slog.Error("Error setting up the state backend", "error", err)
+				os.Exit(1)
+			}
+			if len(args) == 0 {
+				err = PrintBackups(config.StateFileName, os.Stdout)
+			} else {
+				err = RestoreStateBackup(config.StateFileName, args[0], os.Stdout)
+			}
+			if err != nil {
+				slog.Error("error restoring backup", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+// PrintBackups writes the backups of the state file newest first
+func PrintBackups(stateFileName string, out io.Writer) error {
+	backups, err := state.ListBackups(stateFileName)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Fprintf(out, "no backups of %s in %s\n", stateFileName, state.BackupDir(stateFileName))
+		return nil
+	}
+	for _, b := range backups {
+		fmt.Fprintf(out, "%s\t%s\n", filepath.Base(b.Path), b.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// RestoreStateBackup restores the named backup, latest restores the newest one
+func RestoreStateBackup(stateFileName string, name string, out io.Writer) error {
+	backups, err := state.ListBackups(stateFileName)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no backups of %s", stateFileName)
+	}
+	var backup *state.Backup
+	for i, b := range backups {
+		if (name == "latest" && i == 0) || filepath.Base(b.Path) == filepath.Base(name) {
+			backup = &backups[i]
+			break
+		}
+	}
+	if backup == nil {
+		return fmt.Errorf("no backup called %s, run lats state restore-backup to list them", name)
+	}
+	err = state.RestoreBackup(stateFileName, backup.Path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "restored %s from %s\n", stateFileName, filepath.Base(backup.Path))
+	return nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func TestRestoreStateBackup(t *testing.T) {
+	stateFile := t.TempDir() + "/.confState.json"
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("a", "/tmp/a", state.SnapshotType)
+	sm.SyncState(stateFile)
+	sm.UpdateState("b", "/tmp/b", state.SnapshotType)
+	sm.SyncState(stateFile)
+
+	var out bytes.Buffer
+	err := PrintBackups(stateFile, &out)
+	if err != nil {
+		t.Fatalf("PrintBackups() error = %v", err)
+	}
+	if !strings.Contains(out.String(), ".confState.json.") {
+		t.Errorf("expected a backup to be listed got %q", out.String())
+	}
+
+	err = RestoreStateBackup(stateFile, "missing", &out)
+	if err == nil {
+		t.Errorf("expected an error restoring a backup that doesn't exist")
+	}
+	err = RestoreStateBackup(stateFile, "latest", &out)
+	if err != nil {
+		t.Fatalf("RestoreStateBackup() error = %v", err)
+	}
+	restored, err := state.ReadState(stateFile)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if len(restored.StateLocations) != 1 {
+		t.Errorf("expected 1 object after restoring got %d", len(restored.StateLocations))
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Variables used for flags
+	rmType    string
+	rmCascade bool
+
+	stateRmCmd = &cobra.Command{
+		Use:   "rm name",
+		Short: "Removes an entry from the state file",
+		Long: "Rm removes every entry in the state file of --type called name. Their files are left for lats state gc unless --cascade is passed, " +
+			"then the files and a stack's object files are deleted once nothing left in the state file points at them. Backups of the state file from before the rm can't restore files --cascade deleted",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			err := RemoveState(&sm, config.StateFileName, rmType, args[0], rmCascade, os.Stdout)
+			if err != nil {
+				slog.Error("error removing from state", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	stateRmCmd.Flags().StringVar(&rmType, "type", state.StackType, "type of the entry")
+	stateRmCmd.Flags().BoolVar(&rmCascade, "cascade", false, "delete the files of the entry and a stack's objects too")
+}
+
+// RemoveState drops the entries of type objType called name from the state file, with cascade their files go too
+func RemoveState(sm *state.StateManager, stateFileName string, objType string, name string, cascade bool, out io.Writer) error {
+	kvs, err := sm.Lookup(objType, name)
+	if err != nil {
+		return err
+	}
+	// the files have to be read before the entries are gone
+	var files []string
+	if cascade {
+		for _, kv := range kvs {
+			fs, err := entryFiles(kv)
+			if err != nil {
+				return fmt.Errorf("can't tell what to delete so nothing was removed: %w", err)
+			}
+			files = append(files, fs...)
+		}
+	}
+	removed := sm.Remove(objType, name)
+	err = sm.SyncState(stateFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "removed %d %s entries called %s\n", len(removed), objType, name)
+	if !cascade {
+		return nil
+	}
+	refs := map[string]bool{}
+	err = markReferenced(refs, sm.StateLocations, false)
+	if err != nil {
+		return fmt.Errorf("removed from the state but can't tell what's still referenced so no files were deleted: %w", err)
+	}
+	ctx := context.Background()
+	var errs []error
+	for _, fn := range files {
+		if refs[fn] {
+			fmt.Fprintf(out, "kept %s, the state still points at it\n", fn)
+			continue
+		}
+		err := state.Backend.Delete(ctx, fn)
+		if err != nil && !errors.Is(err, state.ErrNotFound) {
+			errs = append(errs, err)
+			continue
+		}
+		refs[fn] = true // stacks can share objects
+		fmt.Fprintf(out, "deleted %s\n", fn)
+	}
+	return errors.Join(errs...)
+}
+
+// entryFiles is the file of an entry and the files of a stack's objects, the stack's own file goes last
+func entryFiles(kv state.StateKV) ([]string, error) {
+	fn := filepath.Clean(kv.FileLocation)
+	if kv.ObjectType != state.StackType {
+		return []string{fn}, nil
+	}
+	s, err := stack.ReadStack(fn)
+	if errors.Is(err, state.ErrNotFound) {
+		return []string{fn}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stack %s: %w", kv.Object, err)
+	}
+	var files []string
+	for _, o := range s.Objects {
+		files = append(files, filepath.Clean(o.FileName))
+	}
+	return append(files, fn), nil
+}
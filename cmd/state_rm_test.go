@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestRemoveState(t *testing.T) {
+	tests := []struct {
+		name    string
+		objType string
+		obj     string
+		cascade bool
+		deleted []string
+		kept    []string
+		wantErr bool
+	}{
+		{"stack", state.StackType, "nightly", false, nil, []string{".state/stack.json", ".state/instance.json"}, false},
+		{"cascade", state.StackType, "nightly", true, []string{".state/stack.json", ".state/instance.json"}, []string{".state/snap.json"}, false},
+		{"snapshot", state.SnapshotType, "snap", true, []string{".state/snap.json"}, []string{".state/stack.json"}, false},
+		{"missing", state.StackType, "weekly", true, nil, []string{".state/stack.json", ".state/snap.json"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeVerifyState(t)
+			sm, _ := state.ReadState(".confState.json")
+			err := RemoveState(&sm, ".confState.json", tt.objType, tt.obj, tt.cascade, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RemoveState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, _ := state.ReadState(".confState.json")
+			if _, err := got.Lookup(tt.objType, tt.obj); !errors.Is(err, state.ErrNotFound) {
+				t.Errorf("expected %s to be gone from the state file got %v", tt.obj, err)
+			}
+			for _, fn := range tt.deleted {
+				if _, err := os.Stat(fn); err == nil {
+					t.Errorf("expected %s to be deleted", fn)
+				}
+			}
+			for _, fn := range tt.kept {
+				if _, err := os.Stat(fn); err != nil {
+					t.Errorf("expected %s to be kept got %v", fn, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveState_SharedObject(t *testing.T) {
+	writeVerifyState(t)
+	sm, _ := state.ReadState(".confState.json")
+	// a second stack pointing at the same object keeps it
+	s, _ := stack.ReadStack(".state/stack.json")
+	s.Name = "weekly"
+	s.Write(".state/weekly.json")
+	sm.UpdateState("weekly", ".state/weekly.json", state.StackType)
+	sm.SyncState(".confState.json")
+	err := RemoveState(&sm, ".confState.json", state.StackType, "nightly", true, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(".state/instance.json"); err != nil {
+		t.Errorf("expected the object to be kept for weekly got %v", err)
+	}
+	if _, err := os.Stat(".state/stack.json"); err == nil {
+		t.Errorf("expected nightly's stack file to be deleted")
+	}
+}
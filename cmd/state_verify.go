@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stateVerifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Checks every file the state points at is there and intact",
+		Long: "Verify reads every stack and object the state file points at and checks it exists, matches the checksum recorded when it was written and decodes into its type. " +
+			"It prints a report for each object in the state file and exits non-zero if anything failed, run it before a DR drill",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := GetState()
+			err := VerifyState(config.StateFileName, os.Stdout)
+			if err != nil {
+				slog.Error("state failed verification", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+// verifyResult is what verify found for one object in the state file
+type verifyResult struct {
+	files      int      // files is how many files were checked
+	unchecksum int      // unchecksum is how many of them had no checksum so were only decoded
+	problems   []string // problems are why the object failed
+}
+
+func (r *verifyResult) problem(format string, a ...interface{}) {
+	r.problems = append(r.problems, fmt.Sprintf(format, a...))
+}
+
+// verifyFile checks a file against its checksum, it returns the contents if they can be decoded
+func (r *verifyResult) verifyFile(filename string, checksum string, size int64) []byte {
+	r.files++
+	dat, err := state.VerifyFile(filename, checksum, size)
+	if errors.Is(err, state.ErrNoChecksum) {
+		r.unchecksum++
+		return dat
+	}
+	if err != nil {
+		r.problem("%v", err)
+		return nil
+	}
+	return dat
+}
+
+// VerifyState checks every file the state file points at and writes a report for each object, it errors if any failed
+func VerifyState(stateFileName string, out io.Writer) error {
+	dat, err := state.ReadObject(stateFileName)
+	if err != nil {
+		return err
+	}
+	kvs, err := state.DecodeStateFile(dat)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, kv := range kvs {
+		r := verifyObject(kv)
+		status := fmt.Sprintf("ok, %d files", r.files)
+		if r.unchecksum > 0 {
+			status += fmt.Sprintf(" (%d had no checksum and were only decoded)", r.unchecksum)
+		}
+		if len(r.problems) > 0 {
+			failed++
+			status = "FAILED"
+		}
+		fmt.Fprintf(out, "%s %s (%s): %s\n", kv.ObjectType, kv.Object, kv.FileLocation, status)
+		for _, p := range r.problems {
+			fmt.Fprintf(out, "  %s\n", p)
+		}
+	}
+	fmt.Fprintf(out, "verified %d objects, %d failed\n", len(kvs), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects failed verification", failed, len(kvs))
+	}
+	return nil
+}
+
+func verifyObject(kv state.StateKV) verifyResult {
+	var r verifyResult
+	dat := r.verifyFile(kv.FileLocation, kv.Checksum, kv.Size)
+	if dat == nil {
+		return r
+	}
+	if kv.ObjectType != "stack" {
+		if _, err := state.DecodeObject(dat, kv.ObjectType); err != nil {
+			r.problem("%s doesn't decode: %v", kv.FileLocation, err)
+		}
+		return r
+	}
+	s, err := stack.DecodeStack(dat)
+	if err != nil {
+		r.problem("%s doesn't decode: %v", kv.FileLocation, err)
+		return r
+	}
+	if err := s.Validate(); err != nil {
+		r.problem("%v", err)
+	}
+	for _, o := range s.Objects {
+		dat := r.verifyFile(o.FileName, o.Checksum, o.Size)
+		if dat == nil {
+			continue
+		}
+		if _, err := stack.DecodeBytes(o.ObjType, dat); err != nil {
+			r.problem("%s %s doesn't decode: %v", o.ID, o.FileName, err)
+		}
+	}
+	return r
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	latsaws "github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func writeVerifyState(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	obj := stack.NewObject("instance", ".state/instance.json", stack.LoneInstance)
+	err := stack.Write(obj, &rds.RestoreDBInstanceFromDBSnapshotInput{DBInstanceIdentifier: aws.String("db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stack.NewStack("nightly", stack.LoneInstance, []stack.Object{obj}).Write(".state/stack.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.WriteOutput(".state/snap.json", state.EncodeRDSSnapshotOutput(&types.DBSnapshot{DBSnapshotIdentifier: aws.String("snap")}))
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("nightly", ".state/stack.json", "stack")
+	sm.UpdateState("snap", ".state/snap.json", state.SnapshotType)
+	sm.SyncState(".confState.json")
+}
+
+func TestVerifyState(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func()
+		want   string
+		fails  bool
+	}{
+		{"intact", func() {}, "stack nightly (.state/stack.json): ok, 2 files", false},
+		{"missing object", func() { os.Remove(".state/instance.json") }, ".state/instance.json is missing", true},
+		{"tampered object", func() { os.WriteFile(".state/instance.json", []byte(`{"format":"lats"}`), 0644) }, ".state/instance.json is 17 bytes", true},
+		{"tampered snapshot", func() { os.WriteFile(".state/snap.json", []byte("garbage"), 0644) }, "RDSSnapshot snap (.state/snap.json): FAILED", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeVerifyState(t)
+			tt.damage()
+			var out bytes.Buffer
+			err := VerifyState(".confState.json", &out)
+			if (err != nil) != tt.fails {
+				t.Errorf("VerifyState() error = %v, fails %v", err, tt.fails)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("expected %q in the report got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestVerifyState_NoChecksums(t *testing.T) {
+	writeVerifyState(t)
+	// state written by an older lats has no checksums so files are only decoded
+	os.WriteFile(".confState.json", []byte(`{"version":2,"stateLocations":[{"object":"snap","fileLocation":".state/snap.json","objectType":"RDSSnapshot"}]}`), 0644)
+	var out bytes.Buffer
+	err := VerifyState(".confState.json", &out)
+	if err != nil {
+		t.Errorf("VerifyState() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "1 had no checksum") {
+		t.Errorf("expected the report to say there was no checksum got %q", out.String())
+	}
+}
+
+func TestVerifyState_Encrypted(t *testing.T) {
+	kms := mock.NewKmsClient("mrk-1234")
+	state.Encrypter = &state.Encryption{Keys: latsaws.KmsOperations{Client: kms}, KeyID: "mrk-1234"}
+	defer func() { state.Encrypter = nil }()
+	writeVerifyState(t)
+	dat, _ := os.ReadFile(".state/instance.json")
+	if !state.IsEncrypted(dat) {
+		t.Fatalf("expected the stack object to be encrypted")
+	}
+	var out bytes.Buffer
+	err := VerifyState(".confState.json", &out)
+	if err != nil {
+		t.Errorf("VerifyState() error = %v, report %s", err, out.String())
+	}
+
+	// a machine without the key can't decode the object
+	state.Encrypter = nil
+	out.Reset()
+	err = VerifyState(".confState.json", &out)
+	if err == nil || !strings.Contains(out.String(), "encryption isn't configured") {
+		t.Errorf("expected verify to fail without encryption got %v %s", err, out.String())
+	}
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrottersman/lats/aws"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+// lats wait exit codes
+const (
+	ExitAvailable = 0
+	ExitError     = 1 // ExitError is when lats couldn't check, like bad credentials
+	ExitFailed    = 2 // ExitFailed is when it failed or was deleted
+	ExitTimeout   = 3
+	ExitNotFound  = 4
+)
+
+var (
+	// Variables used for flags
+	waitTimeout  time.Duration
+	waitInterval time.Duration
+
+	// snapshotWaitTimeout is how long create and copy wait for their snapshot
+	snapshotWaitTimeout time.Duration
+	// pollInterval is how long create, copy and restore sleep between checks
+	pollInterval = 30 * time.Second
+
+	// StatusCmd reports progress on a snapshot, copy or restore
+	StatusCmd = &cobra.Command{
+		Use:   "status stack|snapshot|db",
+		Short: "Reports the progress of a snapshot, snapshot copy or restored database",
+		Long: "Status looks for a stack in the state, then a snapshot, cluster snapshot, instance or cluster with that name in the main and backup regions. " +
+			"It prints the status, percent done and an ETA extrapolated from how long it's taken so far, databases don't report a percent",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			err := Status(sm, args[0], configRegions(config), time.Now(), outputFormat, os.Stdout)
+			if err != nil {
+				slog.Error("error getting status", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	// WaitCmd blocks until a snapshot, copy or restore is done
+	WaitCmd = &cobra.Command{
+		Use:   "wait stack|snapshot|db",
+		Short: "Waits for a snapshot, snapshot copy or restored database to be available",
+		Long: "Wait finds what to wait on like lats status and checks it until it's available or failed. " +
+			"It exits 0 when it's available, 1 when lats couldn't check, 2 when it failed, 3 when --timeout runs out and 4 when there's nothing with that name",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, sm := GetState()
+			os.Exit(Wait(sm, args[0], configRegions(config), waitInterval, waitTimeout, outputFormat, os.Stdout))
+		},
+	}
+)
+
+func init() {
+	WaitCmd.Flags().DurationVar(&waitTimeout, "timeout", 2*time.Hour, "how long to wait, 0 waits forever")
+	WaitCmd.Flags().DurationVar(&waitInterval, "interval", 30*time.Second, "how long to sleep between checks")
+}
+
+// configRegions are clients for the main and backup regions
+func configRegions(config Config) []RegionClient {
+	return []RegionClient{
+		{Region: config.MainRegion, DB: aws.Init(config.MainRegion)},
+		{Region: config.BackupRegion, DB: aws.Init(config.BackupRegion)},
+	}
+}
+
+// TargetStatus is what lats status and lats wait report
+type TargetStatus struct {
+	Name  string `json:"name"`            // Name is what was asked about
+	Stack string `json:"stack,omitempty"` // Stack is set when Name is a stack, the progress is its snapshot's
+	aws.Progress
+	ETASeconds float64 `json:"etaSeconds,omitempty"`
+}
+
+// statusTarget is the snapshot or database a name resolved to and the region it's in
+type statusTarget struct {
+	Name   string
+	Stack  string
+	Type   string
+	ID     string
+	Region RegionClient
+}
+
+// findTarget works out what name is, a stack's snapshot first then a snapshot, cluster snapshot, instance or cluster in regions.
+// It returns the progress it found so it isn't described twice
+func findTarget(sm state.StateManager, name string, regions []RegionClient) (statusTarget, aws.Progress, error) {
+	kv, err := sm.FindStack(name)
+	if err == nil {
+		return findStackTarget(kv, name, regions)
+	}
+	if !errors.Is(err, state.ErrNotFound) {
+		return statusTarget{}, aws.Progress{}, err
+	}
+	types := []string{aws.SnapshotProgress, aws.ClusterSnapshotProgress, aws.InstanceProgress, aws.ClusterProgress}
+	t, p, err := findProgress(statusTarget{Name: name, ID: name}, types, regions)
+	if errors.Is(err, aws.ErrProgressNotFound) {
+		return t, p, fmt.Errorf("no stack, snapshot or database called %s: %w", name, aws.ErrProgressNotFound)
+	}
+	return t, p, err
+}
+
+// findStackTarget finds a stack's snapshot, stacks from older lats have the snapshot read from their objects
+func findStackTarget(kv state.StateKV, name string, regions []RegionClient) (statusTarget, aws.Progress, error) {
+	md := kv.Stack.Metadata
+	id := md.Snapshot
+	cluster := kv.Stack.RestorationType == stack.Cluster
+	if id == "" {
+		s, err := stack.ReadStack(kv.FileLocation)
+		if err != nil {
+			return statusTarget{}, aws.Progress{}, fmt.Errorf("reading stack %s: %w", name, err)
+		}
+		id, cluster = stackSnapshot(s)
+		if id == "" {
+			return statusTarget{}, aws.Progress{}, fmt.Errorf("stack %s has no snapshot recorded: %w", name, aws.ErrProgressNotFound)
+		}
+	}
+	region := md.Region
+	if region == "" {
+		region = kv.Snapshot.Region
+	}
+	progressType := aws.SnapshotProgress
+	if cluster {
+		progressType = aws.ClusterSnapshotProgress
+	}
+	t, p, err := findProgress(statusTarget{Name: name, Stack: name, ID: id}, []string{progressType}, orderRegions(regions, region))
+	if errors.Is(err, aws.ErrProgressNotFound) {
+		return t, p, fmt.Errorf("stack %s's snapshot %s isn't in any region: %w", name, id, aws.ErrProgressNotFound)
+	}
+	return t, p, err
+}
+
+// findProgress describes t.ID as each type in each region until one is found
+func findProgress(t statusTarget, types []string, regions []RegionClient) (statusTarget, aws.Progress, error) {
+	for _, r := range regions {
+		for _, pt := range types {
+			p, err := r.DB.GetProgress(pt, t.ID)
+			if errors.Is(err, aws.ErrProgressNotFound) {
+				continue
+			}
+			if err != nil {
+				return t, p, fmt.Errorf("describing %s in %s: %w", t.ID, r.Region, err)
+			}
+			t.Type, t.Region = pt, r
+			p.Region = r.Region
+			return t, p, nil
+		}
+	}
+	return t, aws.Progress{}, aws.ErrProgressNotFound
+}
+
+func targetStatus(t statusTarget, p aws.Progress, now time.Time) TargetStatus {
+	return TargetStatus{Name: t.Name, Stack: t.Stack, Progress: p, ETASeconds: p.ETA(now).Seconds()}
+}
+
+// Status writes the progress of the stack, snapshot or database called name
+func Status(sm state.StateManager, name string, regions []RegionClient, now time.Time, format string, out io.Writer) error {
+	t, p, err := findTarget(sm, name, regions)
+	if err != nil {
+		return err
+	}
+	return writeStatus(targetStatus(t, p, now), format, out)
+}
+
+// Wait checks the stack, snapshot or database called name every interval until it's available or failed, it returns the exit code for lats wait
+func Wait(sm state.StateManager, name string, regions []RegionClient, interval time.Duration, timeout time.Duration, format string, out io.Writer) int {
+	t, p, err := findTarget(sm, name, regions)
+	if errors.Is(err, aws.ErrProgressNotFound) {
+		slog.Error("nothing to wait for", "error", err)
+		return ExitNotFound
+	}
+	if err != nil {
+		slog.Error("error finding what to wait for", "error", err)
+		return ExitError
+	}
+	code := ExitAvailable
+	if !p.Done() {
+		logProgress(p)
+		p, err = t.Region.DB.WaitForProgress(t.Type, t.ID, interval, timeout, logProgress)
+		p.Region = t.Region.Region
+		switch {
+		case errors.Is(err, aws.ErrWaitTimeout):
+			slog.Error("gave up waiting", "error", err, "timeout", timeout)
+			code = ExitTimeout
+		case errors.Is(err, aws.ErrProgressNotFound):
+			// it was there when we started so it's been deleted
+			p.Status = "deleted"
+		case err != nil:
+			slog.Error("error waiting", "error", err)
+			return ExitError
+		}
+	}
+	if p.Failed() {
+		slog.Error("it's not going to be available", "type", p.Type, "id", p.ID, "status", p.Status)
+		code = ExitFailed
+	}
+	err = writeStatus(targetStatus(t, p, time.Now()), format, out)
+	if err != nil {
+		slog.Error("error writing the status", "error", err)
+	}
+	return code
+}
+
+func logProgress(p aws.Progress) {
+	if p.Done() {
+		return
+	}
+	slog.Info("in progress", "type", p.Type, "id", p.ID, "status", p.Status, "percent", formatPercent(p.Percent), "eta", formatETA(p.ETA(time.Now())))
+}
+
+func formatPercent(percent *int32) string {
+	if percent == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", *percent)
+}
+
+func formatETA(eta time.Duration) string {
+	if eta == 0 {
+		return "-"
+	}
+	return eta.Round(time.Second).String()
+}
+
+// writeStatus writes a status as a table, JSON or YAML
+func writeStatus(ts TargetStatus, format string, out io.Writer) error {
+	if format == OutputJSON || format == OutputYAML {
+		return writeStructured(ts, format, out)
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tID\tREGION\tSTATUS\tPROGRESS\tETA")
+	eta := time.Duration(ts.ETASeconds * float64(time.Second))
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", ts.Name, ts.Type, ts.ID, orDash(ts.Region), orDash(ts.Status), formatPercent(ts.Percent), formatETA(eta))
+	return w.Flush()
+}
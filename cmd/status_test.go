@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	latsaws "github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestStatus(t *testing.T) {
+	t.Chdir(t.TempDir())
+	now := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	writeSnapshotStack(t, &sm, "nightly", "nightly-snap")
+	writeSnapshotStack(t, &sm, "expired", "rds:db-2023-01-01")
+	main := mock.ProgressRDSClient{Snapshot: "nightly-snap", Instance: "restored", Statuses: []string{"backing-up"}}
+	backup := mock.ProgressRDSClient{Snapshot: "nightly-copy", Statuses: []string{"copying"}, Percent: 25, Started: now.Add(-time.Hour)}
+	regions := []RegionClient{
+		{Region: "us-east-1", DB: latsaws.DbInstances{RdsClient: main}},
+		{Region: "us-west-2", DB: latsaws.DbInstances{RdsClient: backup}},
+	}
+	tests := []struct {
+		name    string
+		target  string
+		want    TargetStatus
+		wantErr bool
+	}{
+		{"stack", "nightly", TargetStatus{Name: "nightly", Stack: "nightly", Progress: latsaws.Progress{Type: latsaws.SnapshotProgress, ID: "nightly-snap", Region: "us-east-1", Status: "backing-up"}}, false},
+		{"copy in backup region", "nightly-copy", TargetStatus{Name: "nightly-copy", Progress: latsaws.Progress{Type: latsaws.SnapshotProgress, ID: "nightly-copy", Region: "us-west-2", Status: "copying"}, ETASeconds: 3 * 60 * 60}, false},
+		{"restored instance", "restored", TargetStatus{Name: "restored", Progress: latsaws.Progress{Type: latsaws.InstanceProgress, ID: "restored", Region: "us-east-1", Status: "backing-up"}}, false},
+		{"stack without snapshot", "expired", TargetStatus{}, true},
+		{"nothing", "nope", TargetStatus{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Status(sm, tt.target, regions, now, OutputJSON, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Status() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got TargetStatus
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want.Name || got.Stack != tt.want.Stack || got.Type != tt.want.Type || got.ID != tt.want.ID ||
+				got.Region != tt.want.Region || got.Status != tt.want.Status || got.ETASeconds != tt.want.ETASeconds {
+				t.Errorf("Status() = %+v want %+v", got, tt.want)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := Status(sm, "nightly-copy", regions, now, OutputText, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PROGRESS", "nightly-copy", "us-west-2", "copying", "25%", "3h0m0s"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("status table is missing %q\n%s", want, out.String())
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	tests := []struct {
+		name     string
+		client   mock.ProgressRDSClient
+		target   string
+		timeout  time.Duration
+		want     int
+		wantStat string
+	}{
+		{"available", mock.ProgressRDSClient{Snapshot: "snap", Statuses: []string{"creating", "creating", "available"}}, "snap", 0, ExitAvailable, "available"},
+		{"already available", mock.ProgressRDSClient{Cluster: "aurora"}, "aurora", 0, ExitAvailable, "available"},
+		{"failed", mock.ProgressRDSClient{Instance: "db", Statuses: []string{"creating", "incompatible-restore"}}, "db", 0, ExitFailed, "incompatible-restore"},
+		{"timeout", mock.ProgressRDSClient{ClusterSnapshot: "csnap", Statuses: []string{"creating"}}, "csnap", 5 * time.Millisecond, ExitTimeout, "creating"},
+		{"not found", mock.ProgressRDSClient{}, "nope", 0, ExitNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			tt.client.Calls = &calls
+			regions := []RegionClient{{Region: "us-east-1", DB: latsaws.DbInstances{RdsClient: tt.client}}}
+			var out bytes.Buffer
+			got := Wait(sm, tt.target, regions, time.Millisecond, tt.timeout, OutputJSON, &out)
+			if got != tt.want {
+				t.Fatalf("Wait() = %d want %d", got, tt.want)
+			}
+			if tt.wantStat == "" {
+				return
+			}
+			var ts TargetStatus
+			if err := json.Unmarshal(out.Bytes(), &ts); err != nil {
+				t.Fatal(err)
+			}
+			if ts.Status != tt.wantStat || ts.Region != "us-east-1" {
+				t.Errorf("Wait() printed %+v want status %s", ts, tt.wantStat)
+			}
+		})
+	}
+}
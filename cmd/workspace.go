@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/jrottersman/lats/state"
+	"github.com/spf13/cobra"
+)
+
+// DefaultWorkspace is the workspace made of the top level settings in the config
+const DefaultWorkspace = "default"
+
+// workspacesDir is where workspaces keep local state
+const workspacesDir = ".latsWorkspaces"
+
+// WorkspaceConfig is a separate estate with its own regions, credentials and state.
+// Regions, profile and encryption aren't taken from the default workspace since they're usually in another account,
+// state goes to the workspace's own directory, bucket prefix or database when Backend and Replica aren't set
+type WorkspaceConfig struct {
+	MainRegion    string            `json:"mainRegion"`
+	BackupRegion  string            `json:"backupRegion"`
+	Profile       string            `json:"profile,omitempty"`
+	StateFileName string            `json:"stateFileName,omitempty"` // StateFileName defaults to the default workspace's
+	Backend       *BackendConfig    `json:"backend,omitempty"`
+	Replica       *ReplicaConfig    `json:"replica,omitempty"`
+	Encryption    *EncryptionConfig `json:"encryption,omitempty"`
+}
+
+var workspaceNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// ForWorkspace returns the settings of workspace name, an empty name is the selected workspace
+func (c Config) ForWorkspace(name string) (Config, error) {
+	if name == "" {
+		name = c.Workspace
+	}
+	if name == "" || name == DefaultWorkspace {
+		c.Workspace = DefaultWorkspace
+		return c, nil
+	}
+	w, ok := c.Workspaces[name]
+	if !ok {
+		return c, fmt.Errorf("workspace %s doesn't exist, lats workspace list shows the workspaces", name)
+	}
+	r := Config{
+		MainRegion:    w.MainRegion,
+		BackupRegion:  w.BackupRegion,
+		StateFileName: w.StateFileName,
+		StateBackups:  c.StateBackups,
+		Backend:       w.Backend,
+		Replica:       w.Replica,
+		Encryption:    w.Encryption,
+		Profile:       w.Profile,
+		Workspace:     name,
+		Workspaces:    c.Workspaces,
+	}
+	if r.StateFileName == "" {
+		r.StateFileName = c.StateFileName
+	}
+	if r.Backend == nil {
+		r.Backend = workspaceBackend(c.Backend, name)
+	}
+	if r.Replica == nil && c.Replica != nil {
+		replica := *c.Replica
+		replica.Prefix = path.Join(replica.Prefix, "workspaces", name)
+		r.Replica = &replica
+	}
+	return r, nil
+}
+
+// workspaceBackend keeps the workspace's state apart from the default workspace's in the same kind of backend
+func workspaceBackend(b *BackendConfig, name string) *BackendConfig {
+	if b == nil {
+		b = &BackendConfig{Type: "local"}
+	}
+	w := *b
+	switch w.Type {
+	case "", "local":
+		w.Path = filepath.Join(w.Path, workspaceDir(name))
+	case "s3":
+		w.Prefix = path.Join(w.Prefix, "workspaces", name)
+	case "sqlite":
+		db := w.Path
+		if db == "" {
+			db = ".lats.db"
+		}
+		w.Path = filepath.Join(filepath.Dir(db), workspaceDir(name), filepath.Base(db))
+	}
+	return &w
+}
+
+// workspaceDir is the directory a workspace keeps local state in, it's the working directory for the default workspace
+func workspaceDir(name string) string {
+	if name == "" || name == DefaultWorkspace {
+		return ""
+	}
+	return filepath.Join(workspacesDir, name)
+}
+
+// loadConfig reads the config and picks the workspace from --workspace or the selected one
+func loadConfig() (Config, error) {
+	c, err := readConfig(".latsConfig.json")
+	if err != nil {
+		return c, err
+	}
+	return c.ForWorkspace(workspaceName)
+}
+
+var (
+	// Variables used for flags
+	selectCreated bool
+	wsProfile     string
+	wsStateFile   string
+
+	// WorkspaceCmd groups the workspace commands
+	WorkspaceCmd = &cobra.Command{
+		Use:   "workspace",
+		Short: "Manage workspaces",
+		Long:  "Workspaces are separate estates like prod and staging, each with its own regions, credentials and state. Commands use the selected workspace unless they're given --workspace",
+	}
+
+	workspaceListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the workspaces, the selected one is marked with *",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			c, err := readConfig(".latsConfig.json")
+			if err != nil {
+				slog.Error("Error reading config", "error", err)
+				os.Exit(1)
+			}
+			ListWorkspaces(c, os.Stdout)
+		},
+	}
+
+	workspaceSelectCmd = &cobra.Command{
+		Use:   "select workspace",
+		Short: "Picks the workspace commands use",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := SelectWorkspace(".latsConfig.json", args[0])
+			if err != nil {
+				slog.Error("error selecting workspace", "error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("selected workspace %s\n", args[0])
+		},
+	}
+
+	workspaceCreateCmd = &cobra.Command{
+		Use:   "create workspace",
+		Short: "Adds a workspace and creates its state",
+		Long:  "Create adds a workspace with its own regions and credentials profile to the config. Its state is kept apart from the other workspaces in the same kind of backend unless the config says otherwise",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			w := WorkspaceConfig{
+				MainRegion:    getMainRegion(),
+				BackupRegion:  getBackupRegion(),
+				Profile:       wsProfile,
+				StateFileName: wsStateFile,
+			}
+			err := CreateWorkspace(".latsConfig.json", args[0], w, selectCreated)
+			if err != nil {
+				slog.Error("error creating workspace", "error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("created workspace %s\n", args[0])
+		},
+	}
+)
+
+func init() {
+	workspaceCreateCmd.Flags().StringVar(&mainRegion, "main-region", "", "AWS Region the application is running in")
+	workspaceCreateCmd.Flags().StringVar(&backupRegion, "backup-region", "", "AWS region we want backup the application to")
+	workspaceCreateCmd.Flags().StringVar(&wsProfile, "profile", "", "AWS shared config profile for the workspace's account")
+	workspaceCreateCmd.Flags().StringVar(&wsStateFile, "state-file", "", "state file name, defaults to the default workspace's")
+	workspaceCreateCmd.Flags().BoolVar(&selectCreated, "select", false, "select the workspace once it's created")
+	WorkspaceCmd.AddCommand(workspaceListCmd)
+	WorkspaceCmd.AddCommand(workspaceSelectCmd)
+	WorkspaceCmd.AddCommand(workspaceCreateCmd)
+}
+
+// ListWorkspaces writes the workspaces in c sorted by name with the selected one marked
+func ListWorkspaces(c Config, out io.Writer) {
+	names := []string{DefaultWorkspace}
+	for name := range c.Workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	selected := c.Workspace
+	if selected == "" {
+		selected = DefaultWorkspace
+	}
+	for _, name := range names {
+		mark := " "
+		if name == selected {
+			mark = "*"
+		}
+		w, _ := c.ForWorkspace(name)
+		fmt.Fprintf(out, "%s %s\t%s -> %s\n", mark, name, w.MainRegion, w.BackupRegion)
+	}
+}
+
+// SelectWorkspace makes name the workspace commands use
+func SelectWorkspace(filename string, name string) error {
+	c, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := c.ForWorkspace(name); err != nil {
+		return err
+	}
+	c.Workspace = name
+	if name == DefaultWorkspace {
+		c.Workspace = ""
+	}
+	return writeConfig(c, filename)
+}
+
+// CreateWorkspace adds the workspace to the config and creates its empty state
+func CreateWorkspace(filename string, name string, w WorkspaceConfig, sel bool) error {
+	if !workspaceNameRe.MatchString(name) {
+		return fmt.Errorf("%q isn't a workspace name, use letters, numbers, - and _", name)
+	}
+	c, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.Workspaces[name]; ok || name == DefaultWorkspace {
+		return fmt.Errorf("workspace %s already exists", name)
+	}
+	if w.MainRegion == "" || w.BackupRegion == "" {
+		return fmt.Errorf("workspace %s needs a main and backup region", name)
+	}
+	if c.Workspaces == nil {
+		c.Workspaces = map[string]WorkspaceConfig{}
+	}
+	c.Workspaces[name] = w
+	ws, err := c.ForWorkspace(name)
+	if err != nil {
+		return err
+	}
+	err = applyConfig(ws)
+	if err != nil {
+		return err
+	}
+	if sel {
+		c.Workspace = name
+	}
+	err = writeConfig(c, filename)
+	if err != nil {
+		return err
+	}
+	return state.InitState(ws.StateFileName)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func TestForWorkspace(t *testing.T) {
+	c := Config{
+		MainRegion:    "us-east-1",
+		BackupRegion:  "us-west-2",
+		StateFileName: ".confState.json",
+		Profile:       "prod",
+		Replica:       &ReplicaConfig{Bucket: "replica", Prefix: "lats"},
+		Encryption:    &EncryptionConfig{KmsKeyID: "mrk-prod"},
+		Workspace:     "staging",
+		Workspaces: map[string]WorkspaceConfig{
+			"staging":   {MainRegion: "eu-west-1", BackupRegion: "eu-central-1", Profile: "staging"},
+			"analytics": {MainRegion: "us-east-2", BackupRegion: "us-west-1", Backend: &BackendConfig{Type: "s3", Bucket: "analytics"}, Encryption: &EncryptionConfig{KmsKeyID: "mrk-analytics"}},
+		},
+	}
+	tests := []struct {
+		name       string
+		workspace  string
+		want       string // want is the main region
+		wantState  string // wantState is where state is kept
+		wantKey    string
+		wantPrefix string // wantPrefix is the replica prefix
+		wantErr    bool
+	}{
+		{"selected", "", "eu-west-1", "local files in .latsWorkspaces/staging", "", "lats/workspaces/staging", false},
+		{"default", DefaultWorkspace, "us-east-1", "local files", "mrk-prod", "lats", false},
+		{"own backend", "analytics", "us-east-2", "s3://analytics", "mrk-analytics", "lats/workspaces/analytics", false},
+		{"missing", "dev", "", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ForWorkspace(tt.workspace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ForWorkspace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.MainRegion != tt.want || got.StateFileName != ".confState.json" {
+				t.Errorf("got %s %s expected %s", got.MainRegion, got.StateFileName, tt.want)
+			}
+			b, err := newBackend(got)
+			if err != nil || b.String() != tt.wantState {
+				t.Errorf("got state in %v %v expected %s", b, err, tt.wantState)
+			}
+			key := ""
+			if got.Encryption != nil {
+				key = got.Encryption.KmsKeyID
+			}
+			if key != tt.wantKey {
+				t.Errorf("got key %q expected %q", key, tt.wantKey)
+			}
+			if got.Replica.Prefix != tt.wantPrefix {
+				t.Errorf("got replica prefix %s expected %s", got.Replica.Prefix, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestWorkspaceBackend_Sqlite(t *testing.T) {
+	got := workspaceBackend(&BackendConfig{Type: "sqlite", Path: "db/lats.db"}, "staging")
+	if got.Path != filepath.Join("db", ".latsWorkspaces", "staging", "lats.db") {
+		t.Errorf("got %s", got.Path)
+	}
+}
+
+func TestCreateWorkspace(t *testing.T) {
+	defer func() { state.Backend = state.LocalBackend{} }()
+	t.Chdir(t.TempDir())
+	writeConfig(newConfig("us-east-1", "us-west-2"), ".latsConfig.json")
+
+	err := CreateWorkspace(".latsConfig.json", "staging", WorkspaceConfig{MainRegion: "eu-west-1", BackupRegion: "eu-central-1"}, false)
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if _, err := os.Stat(".latsWorkspaces/staging/.confState.json"); err != nil {
+		t.Errorf("expected the workspace's state file got %v", err)
+	}
+	for _, name := range []string{"staging", DefaultWorkspace, "../prod"} {
+		if err := CreateWorkspace(".latsConfig.json", name, WorkspaceConfig{MainRegion: "a", BackupRegion: "b"}, false); err == nil {
+			t.Errorf("expected creating %s to fail", name)
+		}
+	}
+
+	err = SelectWorkspace(".latsConfig.json", "staging")
+	if err != nil {
+		t.Fatalf("SelectWorkspace() error = %v", err)
+	}
+	if err := SelectWorkspace(".latsConfig.json", "dev"); err == nil {
+		t.Errorf("expected selecting a missing workspace to fail")
+	}
+	c, _ := readConfig(".latsConfig.json")
+	var out bytes.Buffer
+	ListWorkspaces(c, &out)
+	want := "  default\tus-east-1 -> us-west-2\n* staging\teu-west-1 -> eu-central-1\n"
+	if out.String() != want {
+		t.Errorf("got %q expected %q", out.String(), want)
+	}
+
+	err = SelectWorkspace(".latsConfig.json", DefaultWorkspace)
+	c, _ = readConfig(".latsConfig.json")
+	if err != nil || c.Workspace != "" {
+		t.Errorf("got %q %v expected the default workspace", c.Workspace, err)
+	}
+	if c.Workspaces["staging"].MainRegion != "eu-west-1" {
+		t.Errorf("expected staging to be kept got %v", c.Workspaces)
+	}
+}
@@ -2,14 +2,15 @@ package helpers
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
-// RandomStateFileName generates a gob file name starting with a UUID
+// RandomStateFileName generates a json file name starting with a UUID
 func RandomStateFileName() *string {
 	u := uuid.New()
-	filename := fmt.Sprintf("%s.gob", u)
+	filename := fmt.Sprintf("%s.json", u)
 	return &filename
 }
 
@@ -19,3 +20,9 @@ func InstanceName() *string {
 	instanceName := fmt.Sprintf("instance-%s", u)
 	return &instanceName
 }
+
+// OperationID generates an id for an operation that's short enough to type
+func OperationID() string {
+	u := uuid.New()
+	return fmt.Sprintf("op-%s", strings.ReplaceAll(u.String(), "-", "")[:12])
+}
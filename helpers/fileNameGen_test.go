@@ -7,8 +7,8 @@ import (
 
 func TestRandomStateFileName(t *testing.T) {
 	s := RandomStateFileName()
-	if !strings.Contains(*s, "gob") {
-		t.Errorf("string should contain gob instead looks like: %s", *s)
+	if !strings.Contains(*s, "json") {
+		t.Errorf("string should contain json instead looks like: %s", *s)
 	}
 }
 
@@ -18,3 +18,13 @@ func TestInstanceName(t *testing.T) {
 		t.Errorf("string should contain instance instead looks like: %s", *s)
 	}
 }
+
+func TestOperationID(t *testing.T) {
+	s := OperationID()
+	if !strings.HasPrefix(s, "op-") || len(s) != 15 {
+		t.Errorf("operation id should be op- and 12 characters instead looks like: %s", s)
+	}
+	if s == OperationID() {
+		t.Errorf("operation ids should be different")
+	}
+}
@@ -2,21 +2,64 @@ package helpers
 
 import (
 	"bytes"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 )
 
-// WriteOutput turns bytes into a file
+// WriteOutput turns bytes into a file, the file is replaced atomically so a crash never leaves half of it behind
 func WriteOutput(filename string, b bytes.Buffer) (int64, error) {
-	f, err := os.Create(filename)
+	n := int64(b.Len())
+	err := WriteFileAtomic(filename, b.Bytes(), 0644)
 	if err != nil {
-		slog.Error("Error creating file:", "error", err)
+		slog.Error("error writing to file:", "error", err)
 		return 0, err
 	}
-	defer f.Close()
-	n, err := b.WriteTo(f)
+	return n, nil
+}
+
+// WriteFileAtomic writes data to a temp file next to filename, fsyncs it and renames it over filename.
+// Readers see either the old file or the new one never a truncated file.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filename)
+	tmp, err := os.CreateTemp(dir, fmt.Sprintf(".%s.tmp-*", filepath.Base(filename)))
 	if err != nil {
-		slog.Error("error writing to file:", "error", err)
+		return fmt.Errorf("error creating temp file for %s: %w", filename, err)
+	}
+	tmpName := tmp.Name()
+	// if anything fails we don't want the temp file hanging around
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return fmt.Errorf("error writing %s: %w", filename, err)
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("error setting permissions on %s: %w", filename, err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("error syncing %s: %w", filename, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %w", filename, err)
+	}
+	if err = os.Rename(tmpName, filename); err != nil {
+		return fmt.Errorf("error replacing %s: %w", filename, err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir makes the rename durable, not every platform lets you fsync a directory so errors are ignored
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
 	}
-	return n, err
+	defer d.Close()
+	d.Sync()
 }
@@ -2,6 +2,8 @@ package helpers
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -31,3 +33,28 @@ func TestWriteOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "state.json")
+	for _, content := range []string{"first", "second"} {
+		err := WriteFileAtomic(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("WriteFileAtomic() error = %v", err)
+		}
+		dat, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("error reading file %v", err)
+		}
+		if string(dat) != content {
+			t.Errorf("got %s expected %s", dat, content)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error reading dir %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the file to be left got %d entries", len(entries))
+	}
+}
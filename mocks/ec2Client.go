@@ -11,6 +11,23 @@ import (
 
 // EC2Client is a client for ec2 that's a mock
 type EC2Client struct {
+	Calls     *[]string // Calls records the security group rule changes as "operation group", without it nothing is recorded
+	NewGroups bool      // NewGroups makes DescribeSecurityGroups find nothing so restore creates the groups
+	NoGroupID bool      // NoGroupID makes CreateSecurityGroup succeed without returning the group's id
+
+	Permissions *[]types.IpPermission // Permissions records the permissions ingress and egress rules authorize
+}
+
+func (m EC2Client) record(op string, groupID *string) {
+	if m.Calls != nil {
+		*m.Calls = append(*m.Calls, op+" "+aws.ToString(groupID))
+	}
+}
+
+func (m EC2Client) permissions(perms []types.IpPermission) {
+	if m.Permissions != nil {
+		*m.Permissions = append(*m.Permissions, perms...)
+	}
 }
 
 // CreateSecurityGroup mock security group creaton
@@ -18,6 +35,9 @@ func (m EC2Client) CreateSecurityGroup(ctx context.Context, params *ec2.CreateSe
 	if params.Description == nil {
 		return nil, fmt.Errorf("nil description error this is fake")
 	}
+	if m.NoGroupID {
+		return &ec2.CreateSecurityGroupOutput{}, nil
+	}
 	return &ec2.CreateSecurityGroupOutput{
 		GroupId: aws.String("foobar"),
 	}, nil
@@ -25,12 +45,17 @@ func (m EC2Client) CreateSecurityGroup(ctx context.Context, params *ec2.CreateSe
 
 // AuthorizeSecurityGroupEgress mock authorize security group egress
 func (m EC2Client) AuthorizeSecurityGroupEgress(ctx context.Context, params *ec2.AuthorizeSecurityGroupEgressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupEgressOutput, error) {
+	m.record("AuthorizeSecurityGroupEgress", params.GroupId)
+	m.permissions(params.IpPermissions)
 	boo := true
 	return &ec2.AuthorizeSecurityGroupEgressOutput{Return: &boo}, nil
 }
 
 // DescribeSecurityGroups mock descirbe security groups
 func (m EC2Client) DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	if m.NewGroups {
+		return &ec2.DescribeSecurityGroupsOutput{}, nil
+	}
 	return &ec2.DescribeSecurityGroupsOutput{
 		SecurityGroups: []types.SecurityGroup{{GroupId: aws.String("foobar")}},
 	}, nil
@@ -38,10 +63,18 @@ func (m EC2Client) DescribeSecurityGroups(ctx context.Context, params *ec2.Descr
 
 // AuthorizeSecurityGroupIngress another mock
 func (m EC2Client) AuthorizeSecurityGroupIngress(ctx context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	m.record("AuthorizeSecurityGroupIngress", params.GroupId)
+	m.permissions(params.IpPermissions)
 	boo := true
 	return &ec2.AuthorizeSecurityGroupIngressOutput{Return: &boo}, nil
 }
 
+// RevokeSecurityGroupEgress mock revoke security group egress
+func (m EC2Client) RevokeSecurityGroupEgress(ctx context.Context, params *ec2.RevokeSecurityGroupEgressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupEgressOutput, error) {
+	m.record("RevokeSecurityGroupEgress", params.GroupId)
+	return &ec2.RevokeSecurityGroupEgressOutput{Return: aws.Bool(true)}, nil
+}
+
 func (m EC2Client) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
 	return &ec2.DescribeSubnetsOutput{
 		Subnets: []types.Subnet{{SubnetId: aws.String("subnet-0123456789abcdef0")}},
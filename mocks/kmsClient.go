@@ -0,0 +1,82 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KmsClient is an in memory KMS, data keys are "encrypted" by prefixing them with the key ID so tests can see which key was used
+type KmsClient struct {
+	mu    sync.Mutex
+	Keys  map[string]bool
+	Calls map[string]int // Calls counts the calls to each operation
+}
+
+// NewKmsClient creates a mock KMS with keys
+func NewKmsClient(keys ...string) *KmsClient {
+	m := &KmsClient{Keys: map[string]bool{}, Calls: map[string]int{}}
+	for _, k := range keys {
+		m.Keys[k] = true
+	}
+	return m
+}
+
+// CreateKey mock create a key
+func (m *KmsClient) CreateKey(ctx context.Context, params *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Calls["CreateKey"]++
+	id := fmt.Sprintf("key-%d", len(m.Keys)+1)
+	m.Keys[id] = true
+	return &kms.CreateKeyOutput{KeyMetadata: &types.KeyMetadata{KeyId: aws.String(id)}}, nil
+}
+
+// GenerateDataKey mock generate a data key
+func (m *KmsClient) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Calls["GenerateDataKey"]++
+	id := aws.ToString(params.KeyId)
+	if !m.Keys[id] {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("Key '%s' does not exist", id))}
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          aws.String(id),
+		Plaintext:      key,
+		CiphertextBlob: append([]byte(id+":"), key...),
+	}, nil
+}
+
+// Decrypt mock decrypt a data key
+func (m *KmsClient) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Calls["Decrypt"]++
+	id, key, ok := bytes.Cut(params.CiphertextBlob, []byte(":"))
+	if !ok || !m.Keys[string(id)] || (params.KeyId != nil && aws.ToString(params.KeyId) != string(id)) {
+		return nil, &types.InvalidCiphertextException{Message: aws.String("invalid ciphertext")}
+	}
+	return &kms.DecryptOutput{KeyId: aws.String(string(id)), Plaintext: key}, nil
+}
+
+// DescribeKey mock describe a key, keys whose ID starts with mrk- are Multi-Region like in AWS
+func (m *KmsClient) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Calls["DescribeKey"]++
+	id := aws.ToString(params.KeyId)
+	if !m.Keys[id] {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("Key '%s' does not exist", id))}
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: &types.KeyMetadata{KeyId: aws.String(id), MultiRegion: aws.Bool(strings.HasPrefix(id, "mrk-"))}}, nil
+}
@@ -188,3 +188,13 @@ func (m MockRDSClient) CreateDBClusterSnapshot(ctx context.Context, params *rds.
 	}
 	return &r, nil
 }
+
+// DeleteDBSnapshot mock delete a snapshot
+func (m MockRDSClient) DeleteDBSnapshot(ctx context.Context, params *rds.DeleteDBSnapshotInput, optFns ...func(*rds.Options)) (*rds.DeleteDBSnapshotOutput, error) {
+	return &rds.DeleteDBSnapshotOutput{DBSnapshot: &types.DBSnapshot{DBSnapshotIdentifier: params.DBSnapshotIdentifier, Status: aws.String("deleted")}}, nil
+}
+
+// DeleteDBClusterSnapshot mock delete a cluster snapshot
+func (m MockRDSClient) DeleteDBClusterSnapshot(ctx context.Context, params *rds.DeleteDBClusterSnapshotInput, optFns ...func(*rds.Options)) (*rds.DeleteDBClusterSnapshotOutput, error) {
+	return &rds.DeleteDBClusterSnapshotOutput{DBClusterSnapshot: &types.DBClusterSnapshot{DBClusterSnapshotIdentifier: params.DBClusterSnapshotIdentifier, Status: aws.String("deleted")}}, nil
+}
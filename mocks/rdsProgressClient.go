@@ -0,0 +1,93 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// ProgressRDSClient is a mock RDS client with at most one snapshot, cluster snapshot, instance and cluster named by its fields.
+// Every describe of one of them moves it to the next of Statuses, the last status sticks. Anything else isn't found
+type ProgressRDSClient struct {
+	MockRDSClient
+	Snapshot        string
+	ClusterSnapshot string
+	Instance        string
+	Cluster         string
+	Statuses        []string
+	Percent         int32 // Percent is reported for snapshots until they're available
+	Started         time.Time
+	Calls           *int // Calls counts the describes, without it every describe is the first status
+}
+
+func (m ProgressRDSClient) next() string {
+	if len(m.Statuses) == 0 {
+		return "available"
+	}
+	if m.Calls == nil {
+		return m.Statuses[0]
+	}
+	i := min(*m.Calls, len(m.Statuses)-1)
+	*m.Calls++
+	return m.Statuses[i]
+}
+
+func (m ProgressRDSClient) percent(status string) *int32 {
+	if status == "available" {
+		return aws.Int32(100)
+	}
+	return aws.Int32(m.Percent)
+}
+
+// DescribeDBSnapshots mock a snapshot being created
+func (m ProgressRDSClient) DescribeDBSnapshots(ctx context.Context, params *rds.DescribeDBSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error) {
+	if m.Snapshot == "" || aws.ToString(params.DBSnapshotIdentifier) != m.Snapshot {
+		return nil, &types.DBSnapshotNotFoundFault{}
+	}
+	status := m.next()
+	return &rds.DescribeDBSnapshotsOutput{DBSnapshots: []types.DBSnapshot{{
+		DBSnapshotIdentifier: aws.String(m.Snapshot),
+		Status:               aws.String(status),
+		PercentProgress:      m.percent(status),
+		SnapshotCreateTime:   aws.Time(m.Started),
+	}}}, nil
+}
+
+// DescribeDBClusterSnapshots mock a cluster snapshot being created
+func (m ProgressRDSClient) DescribeDBClusterSnapshots(ctx context.Context, params *rds.DescribeDBClusterSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotsOutput, error) {
+	if m.ClusterSnapshot == "" || aws.ToString(params.DBClusterSnapshotIdentifier) != m.ClusterSnapshot {
+		return nil, &types.DBClusterSnapshotNotFoundFault{}
+	}
+	status := m.next()
+	return &rds.DescribeDBClusterSnapshotsOutput{DBClusterSnapshots: []types.DBClusterSnapshot{{
+		DBClusterSnapshotIdentifier: aws.String(m.ClusterSnapshot),
+		Status:                      aws.String(status),
+		PercentProgress:             m.percent(status),
+		SnapshotCreateTime:          aws.Time(m.Started),
+	}}}, nil
+}
+
+// DescribeDBInstances mock an instance being restored
+func (m ProgressRDSClient) DescribeDBInstances(ctx context.Context, params *rds.DescribeDBInstancesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	if m.Instance == "" || aws.ToString(params.DBInstanceIdentifier) != m.Instance {
+		return nil, &types.DBInstanceNotFoundFault{}
+	}
+	return &rds.DescribeDBInstancesOutput{DBInstances: []types.DBInstance{{
+		DBInstanceIdentifier: aws.String(m.Instance),
+		DBInstanceStatus:     aws.String(m.next()),
+	}}}, nil
+}
+
+// DescribeDBClusters mock a cluster being restored
+func (m ProgressRDSClient) DescribeDBClusters(ctx context.Context, params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	if m.Cluster == "" || aws.ToString(params.DBClusterIdentifier) != m.Cluster {
+		return nil, &types.DBClusterNotFoundFault{}
+	}
+	return &rds.DescribeDBClustersOutput{DBClusters: []types.DBCluster{{
+		DBClusterIdentifier: aws.String(m.Cluster),
+		Status:              aws.String(m.next()),
+	}}}, nil
+}
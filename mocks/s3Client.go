@@ -0,0 +1,118 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// S3Client is an in memory bucket that honours If-Match and If-None-Match like S3 does
+type S3Client struct {
+	mu       sync.Mutex
+	Objects  map[string][]byte
+	Modified map[string]time.Time // Modified is when each object was put, tests can backdate it
+}
+
+// NewS3Client creates an empty mock bucket
+func NewS3Client() *S3Client {
+	return &S3Client{Objects: map[string][]byte{}, Modified: map[string]time.Time{}}
+}
+
+func etag(b []byte) string {
+	return fmt.Sprintf("\"%x\"", md5.Sum(b))
+}
+
+// GetObject mock get an object
+func (m *S3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.Objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader(b)),
+		ETag: aws.String(etag(b)),
+	}, nil
+}
+
+// PutObject mock put an object, conditional puts that don't match fail with PreconditionFailed
+func (m *S3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := aws.ToString(params.Key)
+	current, ok := m.Objects[key]
+	failed := &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	if params.IfNoneMatch != nil && ok {
+		return nil, failed
+	}
+	if params.IfMatch != nil && (!ok || etag(current) != aws.ToString(params.IfMatch)) {
+		return nil, failed
+	}
+	m.Objects[key] = b
+	m.Modified[key] = time.Now()
+	return &s3.PutObjectOutput{ETag: aws.String(etag(b))}, nil
+}
+
+// HeadObject mock head an object
+func (m *S3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.Objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NotFound{Message: aws.String("Not Found")}
+	}
+	return &s3.HeadObjectOutput{
+		ETag:          aws.String(etag(b)),
+		ContentLength: aws.Int64(int64(len(b))),
+		LastModified:  aws.Time(m.Modified[aws.ToString(params.Key)]),
+	}, nil
+}
+
+// DeleteObject mock delete an object
+func (m *S3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.Objects, aws.ToString(params.Key))
+	delete(m.Modified, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// ListObjectsV2 mock list objects, it returns everything in one page
+func (m *S3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := aws.ToString(params.Prefix)
+	delim := aws.ToString(params.Delimiter)
+	out := &s3.ListObjectsV2Output{}
+	keys := []string{}
+	for k := range m.Objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if delim != "" && strings.Contains(strings.TrimPrefix(k, prefix), delim) {
+			continue
+		}
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(k), ETag: aws.String(etag(m.Objects[k]))})
+	}
+	return out, nil
+}
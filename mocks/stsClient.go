@@ -0,0 +1,23 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// StsClient is a mock STS that says lats is running as ARN in Account, an empty Account fails every call
+type StsClient struct {
+	Account string
+	ARN     string
+}
+
+// GetCallerIdentity mock who am I
+func (m StsClient) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if m.Account == "" {
+		return nil, fmt.Errorf("no credentials this is fake")
+	}
+	return &sts.GetCallerIdentityOutput{Account: aws.String(m.Account), Arn: aws.String(m.ARN)}, nil
+}
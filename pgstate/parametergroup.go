@@ -2,10 +2,10 @@ package pgstate
 
 import (
 	"bytes"
-	"encoding/gob"
 	"log/slog"
 
 	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/state"
 )
 
 type ParameterGroup struct {
@@ -15,9 +15,7 @@ type ParameterGroup struct {
 }
 
 func EncodeParameterGroups(pgs []ParameterGroup) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-	err := enc.Encode(&pgs)
+	encoder, err := state.EncodeDocument(state.KindParameterGroups, &pgs)
 	if err != nil {
 		slog.Error("Error encoding parameters", "Error", err)
 	}
@@ -27,10 +25,27 @@ func EncodeParameterGroups(pgs []ParameterGroup) bytes.Buffer {
 //DecodeParameterGroups Decodes the parameter Group
 func DecodeParameterGroups(b bytes.Buffer) []ParameterGroup {
 	var pg []ParameterGroup
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&pg)
+	err := state.DecodeDocument(b.Bytes(), state.KindParameterGroups, &pg)
 	if err != nil {
 		slog.Error("Error decoding parameters", "Error", err)
 	}
 	return pg
 }
+
+// UserParameters returns the parameters that were changed from the engine defaults these are the only ones we need to set on a restored group
+func (pg ParameterGroup) UserParameters() []types.Parameter {
+	params := []types.Parameter{}
+	for _, p := range pg.Params {
+		if p.Source == nil || *p.Source != "user" {
+			continue
+		}
+		if p.IsModifiable != nil && !*p.IsModifiable {
+			continue
+		}
+		if p.ApplyMethod == "" {
+			p.ApplyMethod = types.ApplyMethodPendingReboot
+		}
+		params = append(params, p)
+	}
+	return params
+}
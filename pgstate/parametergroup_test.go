@@ -1,10 +1,11 @@
 package pgstate_test
 
 import (
-	"encoding/gob"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/jrottersman/lats/pgstate"
+	"github.com/jrottersman/lats/state"
 )
 
 func Test_EncodeParameterGroups(t *testing.T) {
@@ -13,8 +14,7 @@ func Test_EncodeParameterGroups(t *testing.T) {
 	pgs = append(pgs, pg)
 	r := pgstate.EncodeParameterGroups(pgs)
 	var result []pgstate.ParameterGroup
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := state.DecodeDocument(r.Bytes(), state.KindParameterGroups, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -33,3 +33,28 @@ func Test_DecodeParameterGroups(t *testing.T) {
 		t.Errorf("got %d expected %d", len(result), len(pgs))
 	}
 }
+
+func Test_UserParameters(t *testing.T) {
+	user := "user"
+	system := "system"
+	modifiable := true
+	fixed := false
+	pg := pgstate.ParameterGroup{
+		Params: []types.Parameter{
+			{ParameterName: &user, Source: &user, IsModifiable: &modifiable},
+			{ParameterName: &system, Source: &system, IsModifiable: &modifiable},
+			{ParameterName: &user, Source: &user, IsModifiable: &fixed},
+			{ParameterName: &user, Source: &user, ApplyMethod: types.ApplyMethodImmediate},
+		},
+	}
+	result := pg.UserParameters()
+	if len(result) != 2 {
+		t.Fatalf("got %d expected 2", len(result))
+	}
+	if result[0].ApplyMethod != types.ApplyMethodPendingReboot {
+		t.Errorf("got %s expected %s", result[0].ApplyMethod, types.ApplyMethodPendingReboot)
+	}
+	if result[1].ApplyMethod != types.ApplyMethodImmediate {
+		t.Errorf("got %s expected %s", result[1].ApplyMethod, types.ApplyMethodImmediate)
+	}
+}
@@ -46,69 +46,57 @@ func GenerateRDSClusterStack(c ClusterStackInput) (*stack.Stack, error) {
 		c.SecurityGroupsRulesFileName = fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
 	}
 
-	objMap := make(map[int][]stack.Object)
-	bp := pgstate.EncodeParameterGroups(c.ParameterGroups)
-	_, err := state.WriteOutput(c.ParameterFileName, bp)
+	parameterObj := stack.NewObject(ParameterGroupID, c.ParameterFileName, stack.DBClusterParameterGroup)
+	err := stack.Write(parameterObj, c.ParameterGroups)
 	if err != nil {
 		return nil, fmt.Errorf("error writing parameters %s", err)
 	}
-	parameterObj := stack.NewObject(c.ParameterFileName, 1, stack.DBClusterParameterGroup)
 	var paramObjects []stack.Object
 	paramObjects = append(paramObjects, parameterObj)
 
 	if c.OptionGroup != nil {
-		b := state.EncodeOptionGroup(c.OptionGroup)
-		_, err := state.WriteOutput(c.OptionGroupFileName, b)
+		optionObj := stack.NewObject(OptionGroupID, c.OptionGroupFileName, stack.OptionGroup)
+		err := stack.Write(optionObj, c.OptionGroup)
 		if err != nil {
 			return nil, fmt.Errorf("error writing option Group %s", err)
 		}
-		optionObj := stack.NewObject(c.OptionGroupFileName, 1, stack.OptionGroup)
 		paramObjects = append(paramObjects, optionObj)
 	}
 
 	if c.SecurityGroups != nil {
-		b := state.EncodeSecurityGroups(*c.SecurityGroups)
-		_, err := state.WriteOutput(c.SecurityGroupFileName, b)
+		sgObj := stack.NewObject(SecurityGroupsID, c.SecurityGroupFileName, stack.SecurityGroup)
+		err := stack.Write(sgObj, c.SecurityGroups)
 		if err != nil {
 			return nil, fmt.Errorf("error saving security groups %s", err)
 		}
-		sgObj := stack.NewObject(c.SecurityGroupFileName, 1, stack.SecurityGroup)
 		paramObjects = append(paramObjects, sgObj)
 
 		sgRules := state.SecurityGroupNeeds(*c.SecurityGroups)
-		b2 := state.EncodeSGRulesStorage(sgRules)
-		_, err = state.WriteOutput(c.SecurityGroupsRulesFileName, b2)
+		sgRulesObj := stack.NewObject(SecurityGroupRulesID, c.SecurityGroupsRulesFileName, stack.SecurityGroupRules, SecurityGroupsID)
+		err = stack.Write(sgRulesObj, sgRules)
 		if err != nil {
 			return nil, fmt.Errorf("error saving security group rules %s", err)
 		}
-		sgRulesObj := stack.NewObject(c.SecurityGroupsRulesFileName, 1, stack.SecurityGroupRules)
 		paramObjects = append(paramObjects, sgRulesObj)
 	}
 
-	objMap[1] = paramObjects
-
 	ClusterInput := state.GenerateRestoreDBClusterFromSnapshotInput(c.R)
 
 	// This is the cluster
-	bc := state.EncodeRestoreDBClusterFromSnapshotInput(ClusterInput)
-	_, err = helpers.WriteOutput(c.Filename, bc)
+	clusterObj := stack.NewObject(ClusterID, c.Filename, stack.Cluster, objectIDs(paramObjects)...)
+	err = stack.Write(clusterObj, ClusterInput)
 	if err != nil {
 		return nil, err
 	}
-	clusterObj := stack.NewObject(c.Filename, 2, stack.Cluster)
-	var clusterObjects []stack.Object
-	clusterObjects = append(clusterObjects, clusterObj)
-	objMap[2] = clusterObjects
 
-	instanceObjects, err := ClusterInstancesToObjects(c.R.Cluster, c.Client, c.Folder, 3)
+	instanceObjects, err := ClusterInstancesToObjects(c.R.Cluster, c.Client, c.Folder, ClusterID)
 	if err != nil {
 		return nil, err
 	}
-	objMap[3] = instanceObjects
 
-	return &stack.Stack{
-		Name:                  c.StackName,
-		RestorationObjectName: stack.Cluster,
-		Objects:               objMap,
-	}, nil
+	objects := append(paramObjects, clusterObj)
+	objects = append(objects, instanceObjects...)
+	s := stack.NewStack(c.StackName, stack.Cluster, objects)
+	s.Metadata = ClusterMetadata(c.R.ClusterSnapshot)
+	return &s, nil
 }
@@ -11,10 +11,10 @@ import (
 	"github.com/jrottersman/lats/state"
 )
 
-// ClusterInstancesToObjects makes a list of instances as objects for our stack
-func ClusterInstancesToObjects(t *types.DBCluster, c aws.DbInstances, folder string, order int) ([]stack.Object, error) {
-	// Cluster is empty
-	if len(t.DBClusterMembers) == 0 {
+// ClusterInstancesToObjects makes a list of instances as objects for our stack that are restored after dependsOn
+func ClusterInstancesToObjects(t *types.DBCluster, c aws.DbInstances, folder string, dependsOn ...string) ([]stack.Object, error) {
+	// Cluster is empty or gone
+	if t == nil || len(t.DBClusterMembers) == 0 {
 		return nil, nil
 	}
 	objects := []stack.Object{}
@@ -25,13 +25,13 @@ func ClusterInstancesToObjects(t *types.DBCluster, c aws.DbInstances, folder str
 			slog.Warn("error getting instance", "error", err, "instance", *v.DBInstanceIdentifier)
 		}
 		input := state.CreateDbInstanceInput(inst, t.DBClusterIdentifier)
-		b := state.EncodeCreateDBInstanceInput(input)
-		fName := fmt.Sprintf("%s/%s.gob", folder, *v.DBInstanceIdentifier)
-		helpers.WriteOutput(fName, b)
-		obj := stack.Object{
-			FileName: fName,
-			Order:    order,
-			ObjType:  state.RdsInstanceType,
+		// every snapshot of the cluster gets its own file so an older stack's instances aren't overwritten
+		fName := fmt.Sprintf("%s/%s", folder, *helpers.RandomStateFileName())
+		id := fmt.Sprintf("%s-%s", InstanceID, *v.DBInstanceIdentifier)
+		obj := stack.NewObject(id, fName, stack.Instance, dependsOn...)
+		err = stack.Write(obj, input)
+		if err != nil {
+			return nil, err
 		}
 		objects = append(objects, obj)
 
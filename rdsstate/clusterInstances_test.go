@@ -2,6 +2,7 @@ package rdsstate_test
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -15,23 +16,22 @@ import (
 
 func TestClusterInstancesToObjects(t *testing.T) {
 	type args struct {
-		t     *types.DBCluster
-		c     aws.DbInstances
-		f     string
-		order int
+		t         *types.DBCluster
+		c         aws.DbInstances
+		f         string
+		dependsOn []string
 	}
 
 	// mock Client
 	m := mock.MockRDSClient{}
 	cl := aws.DbInstances{RdsClient: m}
 	nilArg := args{
-		t:     &types.DBCluster{},
-		c:     cl,
-		f:     "/tmp/foo",
-		order: 2,
+		t:         &types.DBCluster{},
+		c:         cl,
+		f:         "/tmp/foo",
+		dependsOn: []string{rdsstate.ClusterID},
 	}
 	id := "foo"
-	defer os.Remove("/tmp/foo.gob")
 	// Create DB Cluster Member
 	mem := []types.DBClusterMember{}
 	one := types.DBClusterMember{
@@ -42,16 +42,16 @@ func TestClusterInstancesToObjects(t *testing.T) {
 	//Want object
 	objs := []stack.Object{}
 	fo := stack.Object{
-		FileName: "/tmp/foo.gob",
-		Order:    2,
-		ObjType:  state.RdsInstanceType,
+		ID:        "instance-foo",
+		ObjType:   state.RdsInstanceType,
+		DependsOn: []string{rdsstate.ClusterID},
 	}
 	objs = append(objs, fo)
 	arg := args{
-		t:     &types.DBCluster{DBClusterIdentifier: &id, DBClusterMembers: mem},
-		c:     cl,
-		f:     "/tmp",
-		order: 2,
+		t:         &types.DBCluster{DBClusterIdentifier: &id, DBClusterMembers: mem},
+		c:         cl,
+		f:         "/tmp",
+		dependsOn: []string{rdsstate.ClusterID},
 	}
 	tests := []struct {
 		name    string
@@ -64,14 +64,36 @@ func TestClusterInstancesToObjects(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := rdsstate.ClusterInstancesToObjects(tt.args.t, tt.args.c, tt.args.f, tt.args.order)
+			got, err := rdsstate.ClusterInstancesToObjects(tt.args.t, tt.args.c, tt.args.f, tt.args.dependsOn...)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ClusterInstancesToObjects() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			for i := range got {
+				defer os.Remove(got[i].FileName)
+				if filepath.Dir(got[i].FileName) != tt.args.f {
+					t.Errorf("ClusterInstancesToObjects() wrote %s outside %s", got[i].FileName, tt.args.f)
+				}
+				got[i].FileName = ""
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ClusterInstancesToObjects() = %v, want %v", got, tt.want)
 			}
 		})
 	}
+
+	// a second snapshot of the cluster doesn't overwrite the first one's instances
+	first, err := rdsstate.ClusterInstancesToObjects(arg.t, cl, arg.f, arg.dependsOn...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(first[0].FileName)
+	second, err := rdsstate.ClusterInstancesToObjects(arg.t, cl, arg.f, arg.dependsOn...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(second[0].FileName)
+	if first[0].FileName == second[0].FileName {
+		t.Errorf("both snapshots wrote their instance to %s", first[0].FileName)
+	}
 }
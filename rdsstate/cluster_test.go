@@ -42,28 +42,24 @@ func TestGenerateRDSClusterStack(t *testing.T) {
 		i: input,
 	}
 
-	objs := make(map[int][]stack.Object)
-	pObjs := []stack.Object{}
 	pObj := stack.Object{
+		ID:       rdsstate.ParameterGroupID,
 		FileName: pFileName,
-		Order:    1,
 		ObjType:  stack.DBClusterParameterGroup,
 	}
-	pObjs = append(pObjs, pObj)
-	tObjs := []stack.Object{}
 	obj := stack.Object{
-		FileName: "/tmp/bar",
-		Order:    2,
-		ObjType:  stack.Cluster,
+		ID:        rdsstate.ClusterID,
+		FileName:  "/tmp/bar",
+		ObjType:   stack.Cluster,
+		DependsOn: []string{rdsstate.ParameterGroupID},
 	}
-	tObjs = append(tObjs, obj)
-	objs[1] = pObjs
-	objs[2] = tObjs
-	objs[3] = nil
+	objs := []stack.Object{pObj, obj}
 	wanted := stack.Stack{
+		Version:               stack.StackVersion,
 		Name:                  "foo",
 		RestorationObjectName: stack.Cluster,
 		Objects:               objs,
+		Metadata:              state.StackMetadata{Snapshot: "bar"},
 	}
 
 	tests := []struct {
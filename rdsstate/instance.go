@@ -11,6 +11,16 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/rds/types"
 )
 
+// IDs of the objects in the stacks we generate, cluster instances are InstanceID followed by the instance identifier
+const (
+	ParameterGroupID     = "parameter-group"
+	OptionGroupID        = "option-group"
+	SecurityGroupsID     = "security-groups"
+	SecurityGroupRulesID = "security-group-rules"
+	InstanceID           = "instance"
+	ClusterID            = "cluster"
+)
+
 // InstanceStackInputs struct to generate stack for an instance
 type InstanceStackInputs struct {
 	R                           state.RDSRestorationStore
@@ -47,63 +57,57 @@ func GenerateRDSInstanceStack(i InstanceStackInputs) (*stack.Stack, error) {
 		i.SecurityGroupsRulesFileName = fmt.Sprintf(".state/%s", *helpers.RandomStateFileName())
 	}
 
-	b := pgstate.EncodeParameterGroups(i.ParameterGroups)
-	_, err := state.WriteOutput(i.ParameterFileName, b)
+	paramObj := stack.NewObject(ParameterGroupID, i.ParameterFileName, stack.DBParameterGroup)
+	err := stack.Write(paramObj, i.ParameterGroups)
 	if err != nil {
 		return nil, fmt.Errorf("error writing parameter groups %s", err)
 	}
-	paramObj := stack.NewObject(i.ParameterFileName, 1, stack.DBParameterGroup)
 	var paramObjects []stack.Object
 	paramObjects = append(paramObjects, paramObj)
 
 	if i.OptionGroup != nil {
-		b := state.EncodeOptionGroup(i.OptionGroup)
-		_, err := state.WriteOutput(i.OptionGroupFileName, b)
+		optionObj := stack.NewObject(OptionGroupID, i.OptionGroupFileName, stack.OptionGroup)
+		err := stack.Write(optionObj, i.OptionGroup)
 		if err != nil {
 			return nil, fmt.Errorf("error writing option groups %s", err)
 		}
-		optionObj := stack.NewObject(i.OptionGroupFileName, 1, stack.OptionGroup)
 		paramObjects = append(paramObjects, optionObj)
 	}
 
 	if i.SecurityGroups != nil {
-		b := state.EncodeSecurityGroups(*i.SecurityGroups)
-		_, err := state.WriteOutput(i.SecurityGroupsFileName, b)
+		sgObj := stack.NewObject(SecurityGroupsID, i.SecurityGroupsFileName, stack.SecurityGroup)
+		err := stack.Write(sgObj, i.SecurityGroups)
 		if err != nil {
 			return nil, fmt.Errorf("error saving security groups %s", err)
 		}
-		sgObj := stack.NewObject(i.SecurityGroupsFileName, 1, stack.SecurityGroup)
 		paramObjects = append(paramObjects, sgObj)
 
 		sgRules := state.SecurityGroupNeeds(*i.SecurityGroups)
-		b2 := state.EncodeSGRulesStorage(sgRules)
-		_, err = state.WriteOutput(i.SecurityGroupsRulesFileName, b2)
+		sgRulesObj := stack.NewObject(SecurityGroupRulesID, i.SecurityGroupsRulesFileName, stack.SecurityGroupRules, SecurityGroupsID)
+		err = stack.Write(sgRulesObj, sgRules)
 		if err != nil {
 			return nil, fmt.Errorf("error saving security group rules %s", err)
 		}
-		sgRulesObj := stack.NewObject(i.SecurityGroupsRulesFileName, 1, stack.SecurityGroupRules)
 		paramObjects = append(paramObjects, sgRulesObj)
 	}
 
 	DBInput := state.GenerateRestoreDBInstanceFromDBSnapshotInput(i.R)
-	b = state.EncodeRestoreDBInstanceFromDBSnapshotInput(DBInput)
-	_, err = state.WriteOutput(i.InstanceFileName, b)
+	instanceObj := stack.NewObject(InstanceID, i.InstanceFileName, stack.LoneInstance, objectIDs(paramObjects)...)
+	err = stack.Write(instanceObj, DBInput)
 	if err != nil {
 		return nil, err
 	}
 
-	instanceObj := stack.NewObject(i.InstanceFileName, 2, stack.LoneInstance)
-
-	var instanceObjects []stack.Object
-	instanceObjects = append(instanceObjects, instanceObj)
-
-	m := make(map[int][]stack.Object)
-	m[1] = paramObjects
-	m[2] = instanceObjects
+	s := stack.NewStack(i.StackName, stack.LoneInstance, append(paramObjects, instanceObj))
+	s.Metadata = InstanceMetadata(i.R.Snapshot)
+	return &s, nil
+}
 
-	return &stack.Stack{
-		Name:                  i.StackName,
-		RestorationObjectName: stack.LoneInstance,
-		Objects:               m,
-	}, nil
+// objectIDs are the ids of objects so something can depend on all of them
+func objectIDs(objs []stack.Object) []string {
+	ids := []string{}
+	for _, o := range objs {
+		ids = append(ids, o.ID)
+	}
+	return ids
 }
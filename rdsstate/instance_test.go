@@ -35,22 +35,22 @@ func TestGenerateRDSInstanceStack(t *testing.T) {
 	defer os.Remove("/tmp/bar.gob")
 
 	obj := stack.Object{
-		FileName: "/tmp/foo.gob",
-		Order:    2,
-		ObjType:  stack.LoneInstance,
+		ID:        InstanceID,
+		FileName:  "/tmp/foo.gob",
+		ObjType:   stack.LoneInstance,
+		DependsOn: []string{ParameterGroupID},
 	}
 	pobj := stack.Object{
+		ID:       ParameterGroupID,
 		FileName: "/tmp/bar.gob",
-		Order:    1,
 		ObjType:  stack.DBParameterGroup,
 	}
-	oMap := make(map[int][]stack.Object)
-	oMap[2] = []stack.Object{obj}
-	oMap[1] = []stack.Object{pobj}
 	expected := stack.Stack{
+		Version:               stack.StackVersion,
 		Name:                  "bar",
 		RestorationObjectName: stack.LoneInstance,
-		Objects:               oMap,
+		Objects:               []stack.Object{pobj, obj},
+		Metadata:              state.StackMetadata{Snapshot: "boo"},
 	}
 
 	tests := []struct {
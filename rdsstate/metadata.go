@@ -0,0 +1,82 @@
+package rdsstate
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/state"
+)
+
+// InstanceMetadata is what a snapshot of an instance tells us about it, the region and account come from the snapshot's ARN
+func InstanceMetadata(snap *types.DBSnapshot) state.StackMetadata {
+	if snap == nil {
+		return state.StackMetadata{}
+	}
+	md := state.StackMetadata{
+		Database:        deref(snap.DBInstanceIdentifier),
+		Snapshot:        deref(snap.DBSnapshotIdentifier),
+		Engine:          deref(snap.Engine),
+		EngineVersion:   deref(snap.EngineVersion),
+		KmsKeyID:        deref(snap.KmsKeyId),
+		SourceRegion:    deref(snap.SourceRegion),
+		SnapshotCreated: utc(snap.SnapshotCreateTime),
+	}
+	if snap.AllocatedStorage != nil {
+		md.StorageGB = *snap.AllocatedStorage
+	}
+	md.Region, md.AccountID = arnRegionAccount(deref(snap.DBSnapshotArn))
+	if md.SourceRegion == "" {
+		md.SourceRegion = md.Region
+	}
+	return md
+}
+
+// ClusterMetadata is what a snapshot of a cluster tells us about it, the region and account come from the snapshot's ARN
+func ClusterMetadata(snap *types.DBClusterSnapshot) state.StackMetadata {
+	if snap == nil {
+		return state.StackMetadata{}
+	}
+	md := state.StackMetadata{
+		Database:        deref(snap.DBClusterIdentifier),
+		Snapshot:        deref(snap.DBClusterSnapshotIdentifier),
+		Engine:          deref(snap.Engine),
+		EngineVersion:   deref(snap.EngineVersion),
+		KmsKeyID:        deref(snap.KmsKeyId),
+		SnapshotCreated: utc(snap.SnapshotCreateTime),
+	}
+	if snap.AllocatedStorage != nil {
+		md.StorageGB = *snap.AllocatedStorage
+	}
+	md.Region, md.AccountID = arnRegionAccount(deref(snap.DBClusterSnapshotArn))
+	md.SourceRegion = md.Region
+	if snap.SourceDBClusterSnapshotArn != nil {
+		if r, _ := arnRegionAccount(*snap.SourceDBClusterSnapshotArn); r != "" {
+			md.SourceRegion = r
+		}
+	}
+	return md
+}
+
+// arnRegionAccount splits the region and account out of an ARN like arn:aws:rds:us-east-1:123456789012:snapshot:nightly
+func arnRegionAccount(arn string) (string, string) {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 || parts[0] != "arn" {
+		return "", ""
+	}
+	return parts[3], parts[4]
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func utc(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
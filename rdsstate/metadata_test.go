@@ -0,0 +1,59 @@
+package rdsstate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/state"
+)
+
+func TestInstanceMetadata(t *testing.T) {
+	created := time.Date(2024, 6, 1, 5, 10, 0, 0, time.FixedZone("EDT", -4*60*60))
+	tests := []struct {
+		name     string
+		snapshot *types.DBSnapshot
+		want     state.StackMetadata
+	}{
+		{"nil", nil, state.StackMetadata{}},
+		{"manual", &types.DBSnapshot{
+			DBSnapshotIdentifier: aws.String("nightly"),
+			DBSnapshotArn:        aws.String("arn:aws:rds:us-east-1:123456789012:snapshot:nightly"),
+			DBInstanceIdentifier: aws.String("db"),
+			Engine:               aws.String("postgres"),
+			EngineVersion:        aws.String("16.3"),
+			AllocatedStorage:     aws.Int32(20),
+			KmsKeyId:             aws.String("key"),
+			SnapshotCreateTime:   &created,
+		}, state.StackMetadata{AccountID: "123456789012", SourceRegion: "us-east-1", Region: "us-east-1", Database: "db", Snapshot: "nightly", Engine: "postgres", EngineVersion: "16.3", StorageGB: 20, KmsKeyID: "key", SnapshotCreated: created.UTC()}},
+		{"copy", &types.DBSnapshot{
+			DBSnapshotIdentifier: aws.String("nightly-copy"),
+			DBSnapshotArn:        aws.String("arn:aws:rds:us-west-2:123456789012:snapshot:nightly-copy"),
+			SourceRegion:         aws.String("us-east-1"),
+		}, state.StackMetadata{AccountID: "123456789012", SourceRegion: "us-east-1", Region: "us-west-2", Snapshot: "nightly-copy"}},
+		{"no arn", &types.DBSnapshot{DBSnapshotIdentifier: aws.String("foo")}, state.StackMetadata{Snapshot: "foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InstanceMetadata(tt.snapshot); got != tt.want {
+				t.Errorf("InstanceMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterMetadata(t *testing.T) {
+	snap := &types.DBClusterSnapshot{
+		DBClusterSnapshotIdentifier: aws.String("aurora-copy"),
+		DBClusterSnapshotArn:        aws.String("arn:aws:rds:us-west-2:123456789012:cluster-snapshot:aurora-copy"),
+		SourceDBClusterSnapshotArn:  aws.String("arn:aws:rds:us-east-1:123456789012:cluster-snapshot:aurora"),
+		DBClusterIdentifier:         aws.String("aurora"),
+		Engine:                      aws.String("aurora-postgresql"),
+		AllocatedStorage:            aws.Int32(1),
+	}
+	want := state.StackMetadata{AccountID: "123456789012", SourceRegion: "us-east-1", Region: "us-west-2", Database: "aurora", Snapshot: "aurora-copy", Engine: "aurora-postgresql", StorageGB: 1}
+	if got := ClusterMetadata(snap); got != want {
+		t.Errorf("ClusterMetadata() = %+v, want %+v", got, want)
+	}
+}
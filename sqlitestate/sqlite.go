@@ -0,0 +1,492 @@
+package sqlitestate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+	_ "modernc.org/sqlite"
+)
+
+// schemaVersion is stored in PRAGMA user_version, add a migration to schema when the tables change
+const schemaVersion = 3
+
+// MaxHistory is how many changes to each key history keeps, older ones are dropped as new ones are recorded
+var MaxHistory = 100
+
+// schema has the statements to get to each version, a database at version v runs everything after schema[v-1]
+var schema = [][]string{{
+	// objects holds every file lats writes, the state file included
+	`CREATE TABLE objects (
+		key TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		generation INTEGER NOT NULL,
+		kind TEXT NOT NULL DEFAULT '',
+		engine TEXT NOT NULL DEFAULT '',
+		created INTEGER NOT NULL DEFAULT 0,
+		updated INTEGER NOT NULL DEFAULT 0
+	)`,
+	// state_index is the list of state locations in each state file
+	`CREATE TABLE state_index (
+		state_key TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		object TEXT NOT NULL,
+		file_location TEXT NOT NULL,
+		object_type TEXT NOT NULL,
+		PRIMARY KEY (state_key, position)
+	)`,
+	`CREATE INDEX state_index_object ON state_index (object_type, object)`,
+	`CREATE INDEX state_index_file ON state_index (file_location)`,
+	`CREATE TABLE stacks (
+		key TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		restoration_object TEXT NOT NULL,
+		version INTEGER NOT NULL
+	)`,
+	`CREATE INDEX stacks_name ON stacks (name)`,
+	`CREATE TABLE stack_objects (
+		stack_key TEXT NOT NULL,
+		id TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		obj_type TEXT NOT NULL,
+		depends_on TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (stack_key, id)
+	)`,
+	// history has a row for every write and delete, the newest MaxHistory for each key are kept
+	`CREATE TABLE history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT NOT NULL,
+		generation INTEGER NOT NULL,
+		op TEXT NOT NULL,
+		at INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		data BLOB
+	)`,
+	`CREATE INDEX history_key ON history (key, at)`,
+}, {
+	// 2 records the checksum and size of each file
+	`ALTER TABLE state_index ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE state_index ADD COLUMN size INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE stack_objects ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE stack_objects ADD COLUMN size INTEGER NOT NULL DEFAULT 0`,
+}, {
+	// 3 stops keeping a copy of everything written in history, the generation and size are enough to see what changed
+	`ALTER TABLE history DROP COLUMN data`,
+}}
+
+// Backend keeps lats state in a SQLite database, every file lats writes is a row and the state file and stacks are indexed in tables so they can be queried
+type Backend struct {
+	db   *sql.DB
+	path string
+}
+
+var (
+	_ state.StateBackend = (*Backend)(nil)
+	_ state.Querier      = (*Backend)(nil)
+	_ state.StackFinder  = (*Backend)(nil)
+	_ state.Historian    = (*Backend)(nil)
+	_ state.ModTimer     = (*Backend)(nil)
+)
+
+// Open opens or creates the database at path
+func Open(path string) (*Backend, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate", path))
+	if err != nil {
+		return nil, err
+	}
+	b := &Backend{db: db, path: path}
+	err = b.migrate()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error setting up %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Close closes the database
+func (b *Backend) Close() error {
+	return b.db.Close()
+}
+
+func (b *Backend) String() string {
+	return fmt.Sprintf("sqlite %s", b.path)
+}
+
+func (b *Backend) migrate() error {
+	var v int
+	err := b.db.QueryRow("PRAGMA user_version").Scan(&v)
+	if err != nil {
+		return err
+	}
+	if v > schemaVersion {
+		return &state.VersionError{Name: b.path, Version: v, Supported: schemaVersion}
+	}
+	if v == schemaVersion {
+		return nil
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmts := range schema[v:] {
+		for _, stmt := range stmts {
+			_, err = tx.Exec(stmt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func key(k string) string {
+	return filepath.Clean(k)
+}
+
+// Get reads a row, the generation counts the writes to key
+func (b *Backend) Get(ctx context.Context, k string) ([]byte, string, error) {
+	var data []byte
+	var gen int64
+	err := b.db.QueryRowContext(ctx, "SELECT data, generation FROM objects WHERE key = ?", key(k)).Scan(&data, &gen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("%s: %w", k, state.ErrNotFound)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, strconv.FormatInt(gen, 10), nil
+}
+
+// ModTime is when key was last written
+func (b *Backend) ModTime(ctx context.Context, k string) (time.Time, error) {
+	var updated int64
+	err := b.db.QueryRowContext(ctx, "SELECT updated FROM objects WHERE key = ?", key(k)).Scan(&updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("%s: %w", k, state.ErrNotFound)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, updated), nil
+}
+
+// Put writes a row whatever is there
+func (b *Backend) Put(ctx context.Context, k string, data []byte) error {
+	_, err := b.put(ctx, k, data, nil)
+	return err
+}
+
+// PutIf writes a row only if it's still at generation, an empty generation means it must not exist
+func (b *Backend) PutIf(ctx context.Context, k string, data []byte, generation string) (string, error) {
+	return b.put(ctx, k, data, &generation)
+}
+
+func (b *Backend) put(ctx context.Context, k string, data []byte, generation *string) (string, error) {
+	k = key(k)
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	var current, created int64
+	err = tx.QueryRowContext(ctx, "SELECT generation, created FROM objects WHERE key = ?", k).Scan(&current, &created)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if generation != nil {
+		if (*generation == "" && exists) || (*generation != "" && (!exists || *generation != strconv.FormatInt(current, 10))) {
+			return "", fmt.Errorf("%s: %w", k, state.ErrConflict)
+		}
+	}
+	now := time.Now().UTC().UnixNano()
+	md := state.ReadMetadata(data)
+	if !md.Created.IsZero() {
+		created = md.Created.UnixNano()
+	} else if !exists {
+		created = now
+	}
+	next, err := nextGeneration(ctx, tx, k, current)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO objects (key, data, generation, kind, engine, created, updated) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET data = excluded.data, generation = excluded.generation, kind = excluded.kind,
+		engine = excluded.engine, created = excluded.created, updated = excluded.updated`,
+		k, data, next, md.Kind, md.Engine, created, now)
+	if err != nil {
+		return "", err
+	}
+	err = index(ctx, tx, k, data, md)
+	if err != nil {
+		return "", err
+	}
+	err = record(ctx, tx, k, next, "put", now, len(data))
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(next, 10), tx.Commit()
+}
+
+// nextGeneration is one past the highest generation key has had, a key that was deleted and written again carries on counting
+// so a PutIf with a generation from before the delete still conflicts
+func nextGeneration(ctx context.Context, tx *sql.Tx, k string, current int64) (int64, error) {
+	var last int64
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(generation), 0) FROM history WHERE key = ?", k).Scan(&last)
+	if err != nil {
+		return 0, err
+	}
+	return max(current, last) + 1, nil
+}
+
+// record adds a change to history and drops the key's changes past MaxHistory
+func record(ctx context.Context, tx *sql.Tx, k string, generation int64, op string, at int64, size int) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO history (key, generation, op, at, size) VALUES (?, ?, ?, ?, ?)", k, generation, op, at, size)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM history WHERE key = ? AND id NOT IN (SELECT id FROM history WHERE key = ? ORDER BY id DESC LIMIT ?)", k, k, max(MaxHistory, 1))
+	return err
+}
+
+// index refreshes the state_index and stacks tables for a row
+func index(ctx context.Context, tx *sql.Tx, k string, data []byte, md state.Metadata) error {
+	err := unindex(ctx, tx, k)
+	if err != nil {
+		return err
+	}
+	if md.Kind == state.KindStack {
+		s, err := stack.DecodeStack(data)
+		if err != nil {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO stacks (key, name, restoration_object, version) VALUES (?, ?, ?, ?)", k, s.Name, s.RestorationObjectName, s.Version)
+		if err != nil {
+			return err
+		}
+		for _, o := range s.Objects {
+			_, err = tx.ExecContext(ctx, "INSERT OR REPLACE INTO stack_objects (stack_key, id, file_name, obj_type, depends_on, checksum, size) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				k, o.ID, key(o.FileName), o.ObjType, strings.Join(o.DependsOn, ","), o.Checksum, o.Size)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if md.Kind != "" {
+		return nil
+	}
+	// the state file is the only thing we write that isn't a document
+	if _, err := state.StateFileVersion(data); err != nil {
+		return nil
+	}
+	kvs, err := state.DecodeStateFile(data)
+	if err != nil {
+		return nil
+	}
+	for i, kv := range kvs {
+		_, err = tx.ExecContext(ctx, "INSERT INTO state_index (state_key, position, object, file_location, object_type, checksum, size) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			k, i, kv.Object, key(kv.FileLocation), kv.ObjectType, kv.Checksum, kv.Size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unindex(ctx context.Context, tx *sql.Tx, k string) error {
+	for _, stmt := range []string{
+		"DELETE FROM state_index WHERE state_key = ?",
+		"DELETE FROM stacks WHERE key = ?",
+		"DELETE FROM stack_objects WHERE stack_key = ?",
+	} {
+		_, err := tx.ExecContext(ctx, stmt, k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a row
+func (b *Backend) Delete(ctx context.Context, k string) error {
+	k = key(k)
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var current int64
+	err = tx.QueryRowContext(ctx, "SELECT generation FROM objects WHERE key = ?", k).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", k, state.ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM objects WHERE key = ?", k)
+	if err != nil {
+		return err
+	}
+	err = unindex(ctx, tx, k)
+	if err != nil {
+		return err
+	}
+	err = record(ctx, tx, k, current, "delete", time.Now().UTC().UnixNano(), 0)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// List returns the keys directly under dir
+func (b *Backend) List(ctx context.Context, dir string) ([]string, error) {
+	prefix := key(dir) + string(filepath.Separator)
+	if key(dir) == "." {
+		prefix = ""
+	}
+	rows, err := b.db.QueryContext(ctx, "SELECT key FROM objects WHERE substr(key, 1, ?) = ? ORDER BY key", len(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		err = rows.Scan(&k)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ContainsRune(strings.TrimPrefix(k, prefix), filepath.Separator) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// FindStack looks stacks up by name, only stacks a state file points at are returned
+func (b *Backend) FindStack(ctx context.Context, name string) ([]string, error) {
+	rows, err := b.db.QueryContext(ctx, `SELECT DISTINCT s.key FROM stacks s
+		JOIN state_index i ON i.file_location = s.key AND i.object_type = 'stack'
+		WHERE s.name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		err = rows.Scan(&k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Query filters the state index in SQL, a stack's engine comes from the first of its objects that has one
+func (b *Backend) Query(ctx context.Context, stateFile string, f state.Filter) ([]state.Record, error) {
+	q := `SELECT object, file_location, object_type, checksum, size, kind, engine, created FROM (
+		SELECT i.position, i.object, i.file_location, i.object_type, i.checksum, i.size,
+			COALESCE(o.kind, '') AS kind,
+			COALESCE(NULLIF(o.engine, ''), (
+				SELECT so_o.engine FROM stack_objects so JOIN objects so_o ON so_o.key = so.file_name
+				WHERE so.stack_key = i.file_location AND so_o.engine <> '' ORDER BY so.id LIMIT 1
+			), '') AS engine,
+			COALESCE(o.created, 0) AS created
+		FROM state_index i LEFT JOIN objects o ON o.key = i.file_location
+		WHERE i.state_key = ?
+	) WHERE 1 = 1`
+	args := []interface{}{key(stateFile)}
+	if f.Type != "" {
+		q += " AND object_type = ? COLLATE NOCASE"
+		args = append(args, f.Type)
+	}
+	if f.Name != "" {
+		q += " AND object GLOB ?"
+		args = append(args, f.Name)
+	}
+	if f.Engine != "" {
+		q += " AND engine = ? COLLATE NOCASE"
+		args = append(args, f.Engine)
+	}
+	if !f.Since.IsZero() {
+		q += " AND created > 0 AND created >= ?"
+		args = append(args, f.Since.UnixNano())
+	}
+	if !f.Until.IsZero() {
+		q += " AND created > 0 AND created < ?"
+		args = append(args, f.Until.UnixNano())
+	}
+	q += " ORDER BY position"
+	rows, err := b.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []state.Record{}
+	for rows.Next() {
+		var r state.Record
+		var created int64
+		err = rows.Scan(&r.Object, &r.FileLocation, &r.ObjectType, &r.Checksum, &r.Size, &r.Kind, &r.Engine, &created)
+		if err != nil {
+			return nil, err
+		}
+		if created > 0 {
+			r.Created = time.Unix(0, created).UTC()
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// History lists the changes to keys matching the filter's name, oldest first
+func (b *Backend) History(ctx context.Context, f state.Filter) ([]state.Change, error) {
+	q := "SELECT key, generation, op, at, size FROM history WHERE 1 = 1"
+	args := []interface{}{}
+	if f.Name != "" {
+		q += " AND key GLOB ?"
+		args = append(args, f.Name)
+	}
+	if !f.Since.IsZero() {
+		q += " AND at >= ?"
+		args = append(args, f.Since.UnixNano())
+	}
+	if !f.Until.IsZero() {
+		q += " AND at < ?"
+		args = append(args, f.Until.UnixNano())
+	}
+	q += " ORDER BY id"
+	rows, err := b.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	changes := []state.Change{}
+	for rows.Next() {
+		var c state.Change
+		var gen, at int64
+		err = rows.Scan(&c.Key, &gen, &c.Op, &at, &c.Size)
+		if err != nil {
+			return nil, err
+		}
+		c.Generation = strconv.FormatInt(gen, 10)
+		c.At = time.Unix(0, at).UTC()
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
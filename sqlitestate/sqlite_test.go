@@ -0,0 +1,260 @@
+package sqlitestate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func openTest(t *testing.T) *Backend {
+	b, err := Open(filepath.Join(t.TempDir(), "lats.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// useBackend points state at b for the rest of the test
+func useBackend(t *testing.T, b *Backend) {
+	old := state.Backend
+	state.Backend = b
+	t.Cleanup(func() { state.Backend = old })
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+	b := openTest(t)
+	_, _, err := b.Get(ctx, ".confState.json")
+	if !errors.Is(err, state.ErrNotFound) {
+		t.Fatalf("Get() of a missing key error = %v, want ErrNotFound", err)
+	}
+	gen, err := b.PutIf(ctx, ".confState.json", []byte("one"), "")
+	if err != nil {
+		t.Fatalf("PutIf() error = %v", err)
+	}
+	if _, err = b.PutIf(ctx, ".confState.json", []byte("two"), ""); !errors.Is(err, state.ErrConflict) {
+		t.Errorf("PutIf() creating a key that exists error = %v, want ErrConflict", err)
+	}
+	if _, err = b.PutIf(ctx, ".confState.json", []byte("two"), gen); err != nil {
+		t.Fatalf("PutIf() error = %v", err)
+	}
+	if _, err = b.PutIf(ctx, ".confState.json", []byte("three"), gen); !errors.Is(err, state.ErrConflict) {
+		t.Errorf("PutIf() with a stale generation error = %v, want ErrConflict", err)
+	}
+	dat, _, err := b.Get(ctx, ".confState.json")
+	if err != nil || string(dat) != "two" {
+		t.Errorf("Get() = %s, %v want two", dat, err)
+	}
+
+	for _, k := range []string{".state/a.json", "./.state/b.json", ".state/nested/c.json"} {
+		if err := b.Put(ctx, k, []byte(k)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	keys, err := b.List(ctx, ".state")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []string{".state/a.json", ".state/b.json"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+	if err := b.Delete(ctx, ".state/a.json"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, _, err := b.Get(ctx, ".state/a.json"); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+
+	changes, err := b.History(ctx, state.Filter{Name: ".confState.json"})
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(changes) != 2 || changes[1].Generation != "2" {
+		t.Errorf("History() = %v, want 2 writes", changes)
+	}
+	changes, _ = b.History(ctx, state.Filter{Name: ".state/a.json"})
+	if len(changes) != 2 || changes[1].Op != "delete" {
+		t.Errorf("History() = %v, want a put and a delete", changes)
+	}
+}
+
+func TestBackend_Generations(t *testing.T) {
+	ctx := context.Background()
+	b := openTest(t)
+	old := MaxHistory
+	MaxHistory = 3
+	defer func() { MaxHistory = old }()
+
+	stale, err := b.PutIf(ctx, ".state/a.json", []byte("one"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete(ctx, ".state/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	gen, err := b.PutIf(ctx, ".state/a.json", []byte("two"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen == stale {
+		t.Errorf("PutIf() after a delete started the generation again at %s", gen)
+	}
+	if _, err := b.PutIf(ctx, ".state/a.json", []byte("three"), stale); !errors.Is(err, state.ErrConflict) {
+		t.Errorf("PutIf() with a generation from before the delete error = %v, want ErrConflict", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := b.Put(ctx, ".state/a.json", []byte("more")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := b.History(ctx, state.Filter{Name: ".state/a.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 || changes[2].Generation != "7" {
+		t.Errorf("History() = %v, want the last 3 changes", changes)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lats.db")
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	b.Put(context.Background(), "foo", []byte("bar"))
+	b.Close()
+	b, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() an existing database error = %v", err)
+	}
+	defer b.Close()
+	dat, _, err := b.Get(context.Background(), "foo")
+	if err != nil || string(dat) != "bar" {
+		t.Errorf("Get() = %s, %v want bar", dat, err)
+	}
+}
+
+func TestMigrateSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lats.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range append(schema[0], "PRAGMA user_version = 1") {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() a version 1 database error = %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	useBackend(t, b)
+	stateFile := writeTestState(t)
+	records, err := b.Query(context.Background(), stateFile, state.Filter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	for _, r := range records {
+		if r.Checksum == "" || r.Size == 0 {
+			t.Errorf("expected %s to have a checksum and size got %q %d", r.Object, r.Checksum, r.Size)
+		}
+	}
+}
+
+// writeTestState writes a snapshot and a postgres stack through the backend and syncs a state file pointing at them
+func writeTestState(t *testing.T) string {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snap := state.EncodeRDSSnapshotOutput(&types.DBSnapshot{DBSnapshotIdentifier: aws.String("snap"), Engine: aws.String("mysql"), SnapshotCreateTime: &created})
+	if _, err := state.WriteOutput(".state/snap.json", snap); err != nil {
+		t.Fatal(err)
+	}
+	obj := stack.NewObject("instance", ".state/instance.json", stack.LoneInstance)
+	err := stack.Write(obj, &rds.RestoreDBInstanceFromDBSnapshotInput{DBInstanceIdentifier: aws.String("db"), Engine: aws.String("postgres")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stack.NewStack("nightly", stack.LoneInstance, []stack.Object{obj})
+	if err := s.Write(".state/stack.json"); err != nil {
+		t.Fatal(err)
+	}
+	// a stack that isn't in the state file shouldn't be found
+	if err := stack.NewStack("nightly", stack.LoneInstance, nil).Write(".state/orphan.json"); err != nil {
+		t.Fatal(err)
+	}
+	sm := state.StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("snap", ".state/snap.json", state.SnapshotType)
+	sm.UpdateState("nightly", ".state/stack.json", "stack")
+	stateFile := filepath.Join(t.TempDir(), ".confState.json")
+	if err := sm.SyncState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	return stateFile
+}
+
+func TestFindStack(t *testing.T) {
+	b := openTest(t)
+	useBackend(t, b)
+	writeTestState(t)
+	keys, err := b.FindStack(context.Background(), "nightly")
+	if err != nil {
+		t.Fatalf("FindStack() error = %v", err)
+	}
+	if want := []string{".state/stack.json"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("FindStack() = %v, want %v", keys, want)
+	}
+	keys, _ = b.FindStack(context.Background(), "missing")
+	if len(keys) != 0 {
+		t.Errorf("FindStack() = %v, want nothing", keys)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	b := openTest(t)
+	useBackend(t, b)
+	stateFile := writeTestState(t)
+
+	tests := []struct {
+		name string
+		f    state.Filter
+		want []string
+	}{
+		{"all", state.Filter{}, []string{"snap", "nightly"}},
+		{"type", state.Filter{Type: "stack"}, []string{"nightly"}},
+		{"name", state.Filter{Name: "sn*"}, []string{"snap"}},
+		{"engine", state.Filter{Engine: "postgres"}, []string{"nightly"}},
+		{"since", state.Filter{Since: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}, []string{"snap"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := b.Query(context.Background(), stateFile, tt.f)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			got := []string{}
+			for _, r := range records {
+				got = append(got, r.Object)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package stack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/jrottersman/lats/helpers"
+	"github.com/jrottersman/lats/state"
+)
+
+// A bundle is a tar.gz of stacks and every object they point at so they can be moved to another state
+//
+//	manifest.json
+//	stacks/<n>.json
+//	objects/<n>/<i>.json
+//
+// Stacks in a bundle are always JSON, their objects' FileNames are paths in the bundle.
+
+// BundleFormat is the format field of a bundle manifest
+const BundleFormat = "lats-bundle"
+
+// BundleVersion is the version of the bundles we write
+const BundleVersion = 1
+
+// manifestName is the name of the manifest in the bundle
+const manifestName = "manifest.json"
+
+// maxBundleFile is the biggest file we'll read out of a bundle, objects are small and this stops a bad bundle using all our memory
+const maxBundleFile = 64 << 20
+
+// BundleManifest lists what's in a bundle with a checksum for every file
+type BundleManifest struct {
+	Format  string                 `json:"format"`
+	Version int                    `json:"version"`
+	Created time.Time              `json:"created"`
+	Stacks  []BundleStack          `json:"stacks"`
+	Files   map[string]BundleEntry `json:"files"` // Files are every file in the bundle but the manifest
+}
+
+// BundleStack is a stack in a bundle
+type BundleStack struct {
+	Name string `json:"name"`
+	File string `json:"file"` // File is where the stack is in the bundle
+}
+
+// BundleEntry is the checksum and size of a file in a bundle
+type BundleEntry struct {
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+}
+
+// Bundle is a bundle read into memory
+type Bundle struct {
+	Manifest BundleManifest
+	Files    map[string][]byte
+}
+
+// NewBundle creates an empty bundle
+func NewBundle() *Bundle {
+	return &Bundle{
+		Manifest: BundleManifest{Format: BundleFormat, Version: BundleVersion, Created: time.Now().UTC(), Stacks: []BundleStack{}, Files: map[string]BundleEntry{}},
+		Files:    map[string][]byte{},
+	}
+}
+
+// Add puts a stack in the bundle, objects maps each object's ID to the contents of its file
+func (b *Bundle) Add(s Stack, objects map[string][]byte) error {
+	n := len(b.Manifest.Stacks) + 1
+	bundled := s
+	bundled.Objects = make([]Object, len(s.Objects))
+	for i, o := range s.Objects {
+		dat, ok := objects[o.ID]
+		if !ok {
+			return fmt.Errorf("stack %s: no file for object %s", s.Name, o.ID)
+		}
+		o.FileName = path.Join("objects", fmt.Sprint(n), fmt.Sprintf("%d.json", i))
+		o.Checksum = state.Checksum(dat)
+		o.Size = int64(len(dat))
+		b.put(o.FileName, dat)
+		bundled.Objects[i] = o
+	}
+	enc, err := bundled.Encoder()
+	if err != nil {
+		return err
+	}
+	fn := path.Join("stacks", fmt.Sprintf("%d.json", n))
+	b.put(fn, enc.Bytes())
+	b.Manifest.Stacks = append(b.Manifest.Stacks, BundleStack{Name: s.Name, File: fn})
+	return nil
+}
+
+func (b *Bundle) put(name string, dat []byte) {
+	b.Files[name] = dat
+	b.Manifest.Files[name] = BundleEntry{Checksum: state.Checksum(dat), Size: int64(len(dat))}
+}
+
+// Stack decodes a stack in the bundle, its objects' FileNames are paths in the bundle
+func (b *Bundle) Stack(bs BundleStack) (*Stack, error) {
+	dat, ok := b.Files[bs.File]
+	if !ok {
+		return nil, fmt.Errorf("stack %s isn't in the bundle", bs.Name)
+	}
+	s, err := DecodeStack(dat)
+	if err != nil {
+		return nil, fmt.Errorf("stack %s: %w", bs.Name, err)
+	}
+	for _, o := range s.Objects {
+		if _, ok := b.Files[o.FileName]; !ok {
+			return nil, fmt.Errorf("stack %s: object %s isn't in the bundle", bs.Name, o.ID)
+		}
+	}
+	return s, nil
+}
+
+// Write writes the bundle as a tar.gz, the manifest goes first
+func (b *Bundle) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeTarFile(tw, manifestName, manifest, b.Manifest.Created)
+	if err != nil {
+		return err
+	}
+	for _, bs := range b.Manifest.Stacks {
+		s, err := b.Stack(bs)
+		if err != nil {
+			return err
+		}
+		for _, o := range s.Objects {
+			err = writeTarFile(tw, o.FileName, b.Files[o.FileName], b.Manifest.Created)
+			if err != nil {
+				return err
+			}
+		}
+		err = writeTarFile(tw, bs.File, b.Files[bs.File], b.Manifest.Created)
+		if err != nil {
+			return err
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, dat []byte, modified time.Time) error {
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(dat)), ModTime: modified, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(dat)
+	return err
+}
+
+// ReadBundle reads a tar.gz bundle checking every file against the manifest
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading bundle: %w", err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		dat, err := io.ReadAll(io.LimitReader(tr, maxBundleFile+1))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from the bundle: %w", h.Name, err)
+		}
+		if len(dat) > maxBundleFile {
+			return nil, fmt.Errorf("%s in the bundle is too big", h.Name)
+		}
+		files[path.Clean(h.Name)] = dat
+	}
+	manifest, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("not a bundle, there's no %s", manifestName)
+	}
+	delete(files, manifestName)
+	b := &Bundle{Files: files}
+	err = json.Unmarshal(manifest, &b.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the bundle manifest: %w", err)
+	}
+	if b.Manifest.Format != BundleFormat {
+		return nil, fmt.Errorf("not a bundle, format is %q", b.Manifest.Format)
+	}
+	if b.Manifest.Version > BundleVersion {
+		return nil, &state.VersionError{Name: "bundle", Version: b.Manifest.Version, Supported: BundleVersion}
+	}
+	for name, e := range b.Manifest.Files {
+		dat, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is in the manifest but not the bundle", name)
+		}
+		if int64(len(dat)) != e.Size || state.Checksum(dat) != e.Checksum {
+			return nil, fmt.Errorf("%s in the bundle doesn't match the manifest", name)
+		}
+	}
+	for name := range files {
+		if _, ok := b.Manifest.Files[name]; !ok {
+			return nil, fmt.Errorf("%s is in the bundle but not the manifest", name)
+		}
+	}
+	return b, nil
+}
+
+// Unpack writes a stack in the bundle and its objects to new files in dir as name, plaintext objects are encrypted when encryption is on.
+// It returns the stack and the file it was written to
+func (b *Bundle) Unpack(bs BundleStack, name string, dir string) (*Stack, string, error) {
+	s, err := b.Stack(bs)
+	if err != nil {
+		return nil, "", err
+	}
+	s.Name = name
+	for i, o := range s.Objects {
+		dat := b.Files[o.FileName]
+		o.FileName = path.Join(dir, *helpers.RandomStateFileName())
+		if state.IsEncrypted(dat) {
+			// sealed by the state it came from, writeObject would seal it again
+			_, err = state.WriteOutput(o.FileName, *bytes.NewBuffer(dat))
+		} else {
+			if _, err := DecodeBytes(o.ObjType, dat); err != nil {
+				return nil, "", fmt.Errorf("stack %s object %s: %w", bs.Name, o.ID, err)
+			}
+			err = writeObject(o, *bytes.NewBuffer(dat))
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error writing stack %s object %s: %w", bs.Name, o.ID, err)
+		}
+		s.Objects[i] = o
+	}
+	fn := path.Join(dir, *helpers.RandomStateFileName())
+	err = s.Write(fn)
+	if err != nil {
+		return nil, "", err
+	}
+	return s, fn, nil
+}
@@ -0,0 +1,110 @@
+package stack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func testBundle(t *testing.T) []byte {
+	t.Helper()
+	b := NewBundle()
+	s := NewStack("nightly", LoneInstance, []Object{NewObject("instance", ".state/instance.json", LoneInstance)})
+	err := b.Add(s, map[string][]byte{"instance": []byte(`{"format":"lats"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := b.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// rewriteBundle copies a bundle changing files with edit, returning nil drops the file
+func rewriteBundle(t *testing.T, dat []byte, edit func(name string, b []byte) []byte) []byte {
+	t.Helper()
+	gz, _ := gzip.NewReader(bytes.NewReader(dat))
+	tr := tar.NewReader(gz)
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		b, _ := io.ReadAll(tr)
+		b = edit(h.Name, b)
+		if b == nil {
+			continue
+		}
+		writeTarFile(tw, h.Name, b, h.ModTime)
+	}
+	tw.Close()
+	gw.Close()
+	return out.Bytes()
+}
+
+func TestReadBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(name string, b []byte) []byte
+		wantErr bool
+	}{
+		{"intact", func(n string, b []byte) []byte { return b }, false},
+		{"tampered object", func(n string, b []byte) []byte {
+			if n == "objects/1/0.json" {
+				return []byte(`{"format":"LATS"}`)
+			}
+			return b
+		}, true},
+		{"missing object", func(n string, b []byte) []byte {
+			if n == "objects/1/0.json" {
+				return nil
+			}
+			return b
+		}, true},
+		{"tampered stack", func(n string, b []byte) []byte {
+			if n == "stacks/1.json" {
+				return append(b, ' ')
+			}
+			return b
+		}, true},
+		{"no manifest", func(n string, b []byte) []byte {
+			if n == manifestName {
+				return nil
+			}
+			return b
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ReadBundle(bytes.NewReader(rewriteBundle(t, testBundle(t), tt.edit)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadBundle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			s, err := b.Stack(b.Manifest.Stacks[0])
+			if err != nil || s.Name != "nightly" || s.Objects[0].FileName != "objects/1/0.json" {
+				t.Errorf("got %v %v", s, err)
+			}
+			if s.Objects[0].Checksum != state.Checksum([]byte(`{"format":"lats"}`)) {
+				t.Errorf("expected the bundled object's checksum")
+			}
+		})
+	}
+}
+
+func TestReadBundle_NotABundle(t *testing.T) {
+	if _, err := ReadBundle(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Errorf("expected an error reading garbage")
+	}
+}
@@ -0,0 +1,176 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Handler restores a single object, Execute calls it once per object after all of the objects dependencies have finished
+type Handler func(ctx context.Context, o Object) error
+
+// Lookup finds an object in the stack by ID
+func (s Stack) Lookup(id string) (Object, bool) {
+	for _, o := range s.Objects {
+		if o.ID == id {
+			return o, true
+		}
+	}
+	return Object{}, false
+}
+
+// ObjectsOfType returns every object in the stack with the object type
+func (s Stack) ObjectsOfType(objType string) []Object {
+	objs := []Object{}
+	for _, o := range s.Objects {
+		if o.ObjType == objType {
+			objs = append(objs, o)
+		}
+	}
+	return objs
+}
+
+// Validate checks that object IDs are unique, every dependency exists and that there are no cycles
+func (s Stack) Validate() error {
+	_, err := s.Levels()
+	return err
+}
+
+// Levels sorts the stack topologically, every object in a level only depends on objects in earlier levels.
+// Objects inside a level are sorted by ID so the result is stable.
+func (s Stack) Levels() ([][]Object, error) {
+	byID := make(map[string]Object, len(s.Objects))
+	for _, o := range s.Objects {
+		if o.ID == "" {
+			return nil, fmt.Errorf("stack %s has an object without an ID", s.Name)
+		}
+		if _, ok := byID[o.ID]; ok {
+			return nil, fmt.Errorf("stack %s has more than one object with ID %s", s.Name, o.ID)
+		}
+		byID[o.ID] = o
+	}
+
+	remaining := make(map[string]int, len(s.Objects))
+	dependents := make(map[string][]string)
+	for _, o := range s.Objects {
+		for _, d := range o.DependsOn {
+			if _, ok := byID[d]; !ok {
+				return nil, fmt.Errorf("object %s depends on %s which isn't in stack %s", o.ID, d, s.Name)
+			}
+			dependents[d] = append(dependents[d], o.ID)
+		}
+		remaining[o.ID] = len(o.DependsOn)
+	}
+
+	levels := [][]Object{}
+	ready := []string{}
+	for id, n := range remaining {
+		if n == 0 {
+			ready = append(ready, id)
+		}
+	}
+	seen := 0
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		level := []Object{}
+		next := []string{}
+		for _, id := range ready {
+			level = append(level, byID[id])
+			for _, d := range dependents[id] {
+				remaining[d]--
+				if remaining[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		seen += len(level)
+		levels = append(levels, level)
+		ready = next
+	}
+	if seen != len(s.Objects) {
+		return nil, fmt.Errorf("stack %s has a dependency cycle", s.Name)
+	}
+	return levels, nil
+}
+
+// Execute walks the stack in dependency order calling h for each object.
+// Objects whose dependencies are done run in parallel with at most maxConcurrent running at once.
+// After the first error no new objects are started, the objects already running are waited on and every error is returned.
+func Execute(ctx context.Context, s Stack, maxConcurrent int, h Handler) error {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if _, err := s.Levels(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	remaining := make(map[string]int, len(s.Objects))
+	dependents := make(map[string][]Object)
+	for _, o := range s.Objects {
+		remaining[o.ID] = len(o.DependsOn)
+		for _, d := range o.DependsOn {
+			dependents[d] = append(dependents[d], o)
+		}
+	}
+
+	type result struct {
+		o   Object
+		err error
+	}
+	results := make(chan result)
+	sem := make(chan struct{}, maxConcurrent)
+	var wg sync.WaitGroup
+	start := func(o Object) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results <- result{o, ctx.Err()}
+				return
+			}
+			err := h(ctx, o)
+			<-sem
+			results <- result{o, err}
+		}()
+	}
+
+	running := 0
+	for _, o := range s.Objects {
+		if remaining[o.ID] == 0 {
+			start(o)
+			running++
+		}
+	}
+
+	var errs []error
+	for running > 0 {
+		r := <-results
+		running--
+		if r.err != nil {
+			if len(errs) > 0 && errors.Is(r.err, context.Canceled) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%s %s: %w", r.o.ObjType, r.o.ID, r.err))
+			cancel()
+			continue
+		}
+		if len(errs) > 0 {
+			continue
+		}
+		for _, d := range dependents[r.o.ID] {
+			remaining[d.ID]--
+			if remaining[d.ID] == 0 {
+				start(d)
+				running++
+			}
+		}
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
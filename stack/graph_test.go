@@ -0,0 +1,175 @@
+package stack_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jrottersman/lats/stack"
+)
+
+func testStack() stack.Stack {
+	return stack.NewStack("foo", stack.Cluster, []stack.Object{
+		stack.NewObject("cluster", "", stack.Cluster, "pg", "sg"),
+		stack.NewObject("pg", "", stack.DBClusterParameterGroup),
+		stack.NewObject("sg", "", stack.SecurityGroup),
+		stack.NewObject("rules", "", stack.SecurityGroupRules, "sg"),
+		stack.NewObject("instance-a", "", stack.Instance, "cluster"),
+		stack.NewObject("instance-b", "", stack.Instance, "cluster"),
+	})
+}
+
+func levelIDs(levels [][]stack.Object) [][]string {
+	ids := [][]string{}
+	for _, l := range levels {
+		level := []string{}
+		for _, o := range l {
+			level = append(level, o.ID)
+		}
+		ids = append(ids, level)
+	}
+	return ids
+}
+
+func TestStack_Levels(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       stack.Stack
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "cluster",
+			s:    testStack(),
+			want: [][]string{{"pg", "sg"}, {"cluster", "rules"}, {"instance-a", "instance-b"}},
+		},
+		{
+			name:    "missing",
+			s:       stack.NewStack("foo", "", []stack.Object{stack.NewObject("a", "", "", "b")}),
+			wantErr: true,
+		},
+		{
+			name: "cycle",
+			s: stack.NewStack("foo", "", []stack.Object{
+				stack.NewObject("a", "", "", "b"),
+				stack.NewObject("b", "", "", "a"),
+			}),
+			wantErr: true,
+		},
+		{
+			name: "duplicate",
+			s: stack.NewStack("foo", "", []stack.Object{
+				stack.NewObject("a", "", ""),
+				stack.NewObject("a", "", ""),
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "noID",
+			s:       stack.NewStack("foo", "", []stack.Object{stack.NewObject("", "", "")}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.s.Levels()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Stack.Levels() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if ids := levelIDs(got); !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Stack.Levels() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecute_Order(t *testing.T) {
+	var mu sync.Mutex
+	done := map[string]bool{}
+	s := testStack()
+	err := stack.Execute(context.Background(), s, 3, func(ctx context.Context, o stack.Object) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, d := range o.DependsOn {
+			if !done[d] {
+				t.Errorf("%s ran before its dependency %s", o.ID, d)
+			}
+		}
+		done[o.ID] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(done) != len(s.Objects) {
+		t.Errorf("expected %d objects to run got %d", len(s.Objects), len(done))
+	}
+}
+
+func TestExecute_MaxConcurrent(t *testing.T) {
+	objs := []stack.Object{}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		objs = append(objs, stack.NewObject(id, "", ""))
+	}
+	var running, peak int32
+	err := stack.Execute(context.Background(), stack.NewStack("foo", "", objs), 2, func(ctx context.Context, o stack.Object) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 objects running at once got %d", peak)
+	}
+}
+
+func TestExecute_StopsOnError(t *testing.T) {
+	boom := errors.New("boom")
+	var mu sync.Mutex
+	ran := map[string]bool{}
+	err := stack.Execute(context.Background(), testStack(), 1, func(ctx context.Context, o stack.Object) error {
+		mu.Lock()
+		ran[o.ID] = true
+		mu.Unlock()
+		if o.ID == "pg" {
+			return boom
+		}
+		return nil
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("Execute() error = %v, want %v", err, boom)
+	}
+	for _, id := range []string{"cluster", "instance-a", "instance-b"} {
+		if ran[id] {
+			t.Errorf("%s ran after its dependency failed", id)
+		}
+	}
+}
+
+func TestExecute_Invalid(t *testing.T) {
+	s := stack.NewStack("foo", "", []stack.Object{stack.NewObject("a", "", "", "missing")})
+	err := stack.Execute(context.Background(), s, 1, func(ctx context.Context, o stack.Object) error {
+		t.Errorf("handler called for an invalid stack")
+		return nil
+	})
+	if err == nil {
+		t.Errorf("expected an error for an invalid stack")
+	}
+}
@@ -0,0 +1,67 @@
+package stack
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+)
+
+// legacyObject is how objects were stored when stacks were keyed by an order number
+type legacyObject struct {
+	FileName string
+	Order    int
+	ObjType  string
+}
+
+// legacyStack is the order keyed layout every object in a tier was restored after the tier before it
+type legacyStack struct {
+	Name                  string
+	RestorationObjectName string
+	Objects               map[int][]legacyObject
+}
+
+// decodeLegacyStack reads an order keyed stack and turns the tiers into dependency edges
+func decodeLegacyStack(b []byte) (*Stack, error) {
+	var ls legacyStack
+	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&ls)
+	if err != nil {
+		return nil, err
+	}
+	s := ls.toStack()
+	return &s, nil
+}
+
+func (ls legacyStack) toStack() Stack {
+	tiers := []int{}
+	for k := range ls.Objects {
+		tiers = append(tiers, k)
+	}
+	sort.Ints(tiers)
+
+	objects := []Object{}
+	var previous []string
+	for _, tier := range tiers {
+		current := []string{}
+		groups := []string{}
+		for i, o := range ls.Objects[tier] {
+			if o.ObjType == SecurityGroup {
+				groups = append(groups, fmt.Sprintf("%s-%d-%d", o.ObjType, tier, i))
+			}
+		}
+		for i, o := range ls.Objects[tier] {
+			id := fmt.Sprintf("%s-%d-%d", o.ObjType, tier, i)
+			deps := append([]string(nil), previous...)
+			// rules were stored in the same tier as their groups and need the ids the groups are restored with
+			if o.ObjType == SecurityGroupRules {
+				deps = append(deps, groups...)
+			}
+			objects = append(objects, NewObject(id, o.FileName, o.ObjType, deps...))
+			current = append(current, id)
+		}
+		if len(current) > 0 {
+			previous = current
+		}
+	}
+	return NewStack(ls.Name, ls.RestorationObjectName, objects)
+}
@@ -0,0 +1,68 @@
+package stack
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jrottersman/lats/helpers"
+)
+
+func Test_ReadLegacyStack(t *testing.T) {
+	filename := "/tmp/legacy-stack"
+	defer os.Remove(filename)
+	ls := legacyStack{
+		Name:                  "foo",
+		RestorationObjectName: Cluster,
+		Objects: map[int][]legacyObject{
+			1: {{FileName: "pg", Order: 1, ObjType: DBClusterParameterGroup}},
+			2: {{FileName: "cluster", Order: 2, ObjType: Cluster}},
+			3: {},
+		},
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(ls); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	if _, err := helpers.WriteOutput(filename, b); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+
+	got, err := ReadStack(filename)
+	if err != nil {
+		t.Fatalf("ReadStack() error = %s", err)
+	}
+	want := NewStack("foo", Cluster, []Object{
+		NewObject("DBClusterParameterGroup-1-0", "pg", DBClusterParameterGroup),
+		NewObject("RDSCluster-2-0", "cluster", Cluster, "DBClusterParameterGroup-1-0"),
+	})
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("ReadStack() = %v, want %v", *got, want)
+	}
+}
+
+func Test_legacyStack_rulesDependOnGroups(t *testing.T) {
+	ls := legacyStack{
+		Name:                  "foo",
+		RestorationObjectName: LoneInstance,
+		Objects: map[int][]legacyObject{
+			1: {
+				{FileName: "pg", Order: 1, ObjType: DBParameterGroup},
+				{FileName: "sg", Order: 1, ObjType: SecurityGroup},
+				{FileName: "rules", Order: 1, ObjType: SecurityGroupRules},
+			},
+			2: {{FileName: "instance", Order: 2, ObjType: LoneInstance}},
+		},
+	}
+	want := NewStack("foo", LoneInstance, []Object{
+		NewObject("DBParameterGroup-1-0", "pg", DBParameterGroup),
+		NewObject("SecurityGroup-1-1", "sg", SecurityGroup),
+		NewObject("SecurityGroupRules-1-2", "rules", SecurityGroupRules, "SecurityGroup-1-1"),
+		NewObject("SingleRDSInstance-2-0", "instance", LoneInstance, "DBParameterGroup-1-0", "SecurityGroup-1-1", "SecurityGroupRules-1-2"),
+	})
+	if got := ls.toStack(); !reflect.DeepEqual(got, want) {
+		t.Errorf("toStack() = %v, want %v", got, want)
+	}
+}
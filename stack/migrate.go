@@ -0,0 +1,74 @@
+package stack
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jrottersman/lats/state"
+)
+
+// StackVersion is the layout of the stacks this lats writes
+// 1 kept objects in tiers keyed by an order number, 2 is a graph of objects and their dependencies
+const StackVersion = 2
+
+// StackMigrations upgrades stack files
+var StackMigrations = state.Migrations{
+	Name:    "stack",
+	Current: StackVersion,
+	Version: FileVersion,
+	Steps: []state.Migration{
+		{
+			From:        1,
+			Description: "turn the ordered tiers into objects that depend on every object in the tier before them, security group rules also depend on the groups in their tier",
+			Up: func(b []byte) ([]byte, error) {
+				s, err := decodeLegacyStack(b)
+				if err != nil {
+					return nil, err
+				}
+				enc, err := s.Encoder()
+				if err != nil {
+					return nil, err
+				}
+				return enc.Bytes(), nil
+			},
+		},
+	},
+}
+
+// FileVersion detects the version of a stack file, stacks from before stacks had a version are 1 if they are tiered and 2 if they are graphs
+func FileVersion(b []byte) (int, error) {
+	if state.IsDocument(b) {
+		doc, err := state.ReadDocument(b)
+		if err != nil {
+			return 0, err
+		}
+		if doc.Kind != state.KindStack {
+			return 0, fmt.Errorf("document is a %s not a stack", doc.Kind)
+		}
+		var v struct {
+			Version int `json:"version"`
+		}
+		err = json.Unmarshal(doc.Data, &v)
+		if err != nil {
+			return 0, fmt.Errorf("error reading stack version: %w", err)
+		}
+		if v.Version == 0 {
+			return 2, nil
+		}
+		return v.Version, nil
+	}
+	var s Stack
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&s)
+	if err == nil {
+		if s.Version == 0 {
+			return 2, nil
+		}
+		return s.Version, nil
+	}
+	if _, lerr := decodeLegacyStack(b); lerr == nil {
+		return 1, nil
+	}
+	return 0, fmt.Errorf("not a stack file: %w", err)
+}
@@ -0,0 +1,54 @@
+package stack
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+
+	"github.com/jrottersman/lats/state"
+)
+
+func TestFileVersion(t *testing.T) {
+	var legacy bytes.Buffer
+	gob.NewEncoder(&legacy).Encode(legacyStack{Name: "foo", Objects: map[int][]legacyObject{1: {{FileName: "foo", Order: 1, ObjType: Cluster}}}})
+	var graph bytes.Buffer
+	gob.NewEncoder(&graph).Encode(Stack{Name: "foo"})
+	current, _ := NewStack("foo", Cluster, nil).Encoder()
+	unversioned, _ := state.EncodeDocument(state.KindStack, map[string]string{"name": "foo"})
+	future, _ := state.EncodeDocument(state.KindStack, map[string]int{"version": 9})
+	other, _ := state.EncodeDocument(state.KindDBSnapshot, map[string]string{})
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    int
+		wantErr bool
+	}{
+		{name: "legacy", b: legacy.Bytes(), want: 1, wantErr: false},
+		{name: "gobGraph", b: graph.Bytes(), want: 2, wantErr: false},
+		{name: "json", b: current.Bytes(), want: StackVersion, wantErr: false},
+		{name: "unversioned", b: unversioned.Bytes(), want: 2, wantErr: false},
+		{name: "future", b: future.Bytes(), want: 9, wantErr: false},
+		{name: "notAStack", b: other.Bytes(), want: 0, wantErr: true},
+		{name: "garbage", b: []byte("foo"), want: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileVersion(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FileVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FileVersion() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	_, _, err := StackMigrations.Migrate(future.Bytes())
+	var verr *state.VersionError
+	if !errors.As(err, &verr) {
+		t.Errorf("Migrate() error = %v expected a VersionError", err)
+	}
+}
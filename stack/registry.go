@@ -0,0 +1,222 @@
+package stack
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/jrottersman/lats/pgstate"
+	"github.com/jrottersman/lats/state"
+)
+
+// Codec turns an object of type T into bytes and back
+type Codec[T any] struct {
+	Encode func(T) (bytes.Buffer, error)
+	Decode func(bytes.Buffer) (T, error)
+}
+
+// DocumentCodec is the codec every built in object uses, it writes a JSON document of kind and reads that or the gob files older versions of lats wrote
+func DocumentCodec[T any](kind string) Codec[T] {
+	return Codec[T]{
+		Encode: func(v T) (bytes.Buffer, error) {
+			return state.EncodeDocument(kind, v)
+		},
+		Decode: func(b bytes.Buffer) (T, error) {
+			var v T
+			err := state.DecodeDocument(b.Bytes(), kind, &v)
+			return v, err
+		},
+	}
+}
+
+// GobCodec encodes objects the way lats did before the JSON format
+func GobCodec[T any]() Codec[T] {
+	return Codec[T]{
+		Encode: func(v T) (bytes.Buffer, error) {
+			var b bytes.Buffer
+			err := gob.NewEncoder(&b).Encode(v)
+			return b, err
+		},
+		Decode: func(b bytes.Buffer) (T, error) {
+			var v T
+			err := gob.NewDecoder(&b).Decode(&v)
+			return v, err
+		},
+	}
+}
+
+// registration is the type erased version of a codec so we can keep every object type in one map
+type registration struct {
+	goType reflect.Type
+	encode func(interface{}) (bytes.Buffer, error)
+	decode func(bytes.Buffer) (interface{}, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register adds an object type to the registry with the Go type it decodes to.
+// Registering the same object type twice is a programming error so it panics.
+func Register[T any](objType string, c Codec[T]) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[objType]; ok {
+		panic(fmt.Sprintf("stack: object type %s registered twice", objType))
+	}
+	if c.Encode == nil || c.Decode == nil {
+		panic(fmt.Sprintf("stack: object type %s registered without a codec", objType))
+	}
+	registry[objType] = registration{
+		goType: reflect.TypeFor[T](),
+		encode: func(v interface{}) (bytes.Buffer, error) {
+			return c.Encode(v.(T))
+		},
+		decode: func(b bytes.Buffer) (interface{}, error) {
+			return c.Decode(b)
+		},
+	}
+}
+
+// RegisteredType returns the Go type an object type decodes to
+func RegisteredType(objType string) (reflect.Type, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[objType]
+	return r.goType, ok
+}
+
+func lookup[T any](objType string) (registration, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[objType]
+	if !ok {
+		return registration{}, fmt.Errorf("object type %s is not registered", objType)
+	}
+	if want := reflect.TypeFor[T](); r.goType != want {
+		return registration{}, fmt.Errorf("object type %s decodes to %s not %s", objType, r.goType, want)
+	}
+	return r, nil
+}
+
+// Read decodes the object file into T, it errors if T isn't the type registered for the object
+func Read[T any](o Object) (T, error) {
+	var zero T
+	r, err := lookup[T](o.ObjType)
+	if err != nil {
+		return zero, err
+	}
+	dat, err := state.ReadObject(o.FileName)
+	if err != nil {
+		return zero, fmt.Errorf("error reading object file %s: %w", o.FileName, err)
+	}
+	v, err := r.decode(*bytes.NewBuffer(dat))
+	if err != nil {
+		return zero, fmt.Errorf("error decoding %s object %s: %w", o.ObjType, o.FileName, err)
+	}
+	return v.(T), nil
+}
+
+// Write encodes v to the objects file, it errors if T isn't the type registered for the object
+func Write[T any](o Object, v T) error {
+	r, err := lookup[T](o.ObjType)
+	if err != nil {
+		return err
+	}
+	b, err := r.encode(v)
+	if err != nil {
+		return fmt.Errorf("error encoding %s object: %w", o.ObjType, err)
+	}
+	return writeObject(o, b)
+}
+
+// writeObject writes an encoded object encrypting it when encryption is on
+func writeObject(o Object, b bytes.Buffer) error {
+	if state.IsDocument(b.Bytes()) {
+		var err error
+		b, err = state.Seal(b)
+		if err != nil {
+			return fmt.Errorf("error encrypting %s object: %w", o.ObjType, err)
+		}
+	}
+	_, err := state.WriteOutput(o.FileName, b)
+	return err
+}
+
+// Decode reads an object into whatever type is registered for it
+func Decode(o Object) (interface{}, error) {
+	dat, err := state.ReadObject(o.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading object file %s: %w", o.FileName, err)
+	}
+	v, err := DecodeBytes(o.ObjType, dat)
+	if err != nil {
+		slog.Warn("error decoding object", "type", o.ObjType, "file", o.FileName, "error", err)
+		return nil, fmt.Errorf("%s: %w", o.FileName, err)
+	}
+	return v, nil
+}
+
+// DecodeBytes decodes the contents of an object file into whatever type is registered for objType
+func DecodeBytes(objType string, b []byte) (interface{}, error) {
+	registryMu.RLock()
+	r, ok := registry[objType]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("object type %s is not registered", objType)
+	}
+	v, err := r.decode(*bytes.NewBuffer(b))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s object: %w", objType, err)
+	}
+	return v, nil
+}
+
+// Convert rewrites a gob object as JSON encrypting it when encryption is on, it returns false if there was nothing to do
+func Convert(o Object) (bool, error) {
+	registryMu.RLock()
+	r, ok := registry[o.ObjType]
+	registryMu.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("object type %s is not registered", o.ObjType)
+	}
+	dat, err := state.ReadObject(o.FileName)
+	if err != nil {
+		return false, fmt.Errorf("error reading object file %s: %w", o.FileName, err)
+	}
+	if state.IsDocument(dat) {
+		// plaintext objects are encrypted once encryption is turned on
+		if !state.Encrypting() || state.IsEncrypted(dat) {
+			return false, nil
+		}
+		err = writeObject(o, *bytes.NewBuffer(dat))
+		return err == nil, err
+	}
+	v, err := r.decode(*bytes.NewBuffer(dat))
+	if err != nil {
+		return false, fmt.Errorf("error decoding %s object %s: %w", o.ObjType, o.FileName, err)
+	}
+	b, err := r.encode(v)
+	if err != nil {
+		return false, fmt.Errorf("error encoding %s object: %w", o.ObjType, err)
+	}
+	err = writeObject(o, b)
+	return err == nil, err
+}
+
+func init() {
+	Register(LoneInstance, DocumentCodec[*rds.RestoreDBInstanceFromDBSnapshotInput](state.KindRestoreDBInstanceFromDBSnapshotInput))
+	Register(Cluster, DocumentCodec[*rds.RestoreDBClusterFromSnapshotInput](state.KindRestoreDBClusterFromSnapshotInput))
+	Register(Instance, DocumentCodec[*rds.CreateDBInstanceInput](state.KindCreateDBInstanceInput))
+	Register(DBParameterGroup, DocumentCodec[[]pgstate.ParameterGroup](state.KindParameterGroups))
+	Register(DBClusterParameterGroup, DocumentCodec[[]pgstate.ParameterGroup](state.KindParameterGroups))
+	Register(OptionGroup, DocumentCodec[*types.OptionGroup](state.KindOptionGroup))
+	Register(SecurityGroup, DocumentCodec[*state.SecurityGroupOutput](state.KindSecurityGroups))
+	Register(SecurityGroupRules, DocumentCodec[[]state.SGRuleStorage](state.KindSecurityGroupRules))
+}
@@ -0,0 +1,140 @@
+package stack_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	latsaws "github.com/jrottersman/lats/aws"
+	mock "github.com/jrottersman/lats/mocks"
+	"github.com/jrottersman/lats/pgstate"
+	"github.com/jrottersman/lats/stack"
+	"github.com/jrottersman/lats/state"
+)
+
+func Test_WriteRead(t *testing.T) {
+	filename := "/tmp/registry-foo"
+	defer os.Remove(filename)
+	db := &rds.RestoreDBInstanceFromDBSnapshotInput{
+		DBInstanceIdentifier: aws.String("foo"),
+	}
+	obj := stack.NewObject("instance", filename, stack.LoneInstance)
+	err := stack.Write(obj, db)
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	got, err := stack.Read[*rds.RestoreDBInstanceFromDBSnapshotInput](obj)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	if *got.DBInstanceIdentifier != "foo" {
+		t.Errorf("got %s expected foo", *got.DBInstanceIdentifier)
+	}
+}
+
+func Test_WriteReadEncrypted(t *testing.T) {
+	filename := t.TempDir() + "/instance.json"
+	kms := mock.NewKmsClient("alias/lats")
+	state.Encrypter = &state.Encryption{Keys: latsaws.KmsOperations{Client: kms}}
+	defer func() { state.Encrypter = nil }()
+
+	// written before encryption was turned on
+	obj := stack.NewObject("instance", filename, stack.LoneInstance)
+	err := stack.Write(obj, &rds.RestoreDBInstanceFromDBSnapshotInput{DBInstanceIdentifier: aws.String("foo")})
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	state.Encrypter.KeyID = "alias/lats"
+	converted, err := stack.Convert(obj)
+	if err != nil || !converted {
+		t.Fatalf("Convert() = %v, %v expected the plaintext object to be encrypted", converted, err)
+	}
+	dat, _ := os.ReadFile(filename)
+	if !state.IsEncrypted(dat) {
+		t.Errorf("expected the object to be encrypted got %s", dat)
+	}
+	got, err := stack.Read[*rds.RestoreDBInstanceFromDBSnapshotInput](obj)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	if *got.DBInstanceIdentifier != "foo" {
+		t.Errorf("got %s expected foo", *got.DBInstanceIdentifier)
+	}
+	if v := obj.ReadObject(); v == nil {
+		t.Errorf("ReadObject() of an encrypted object = nil")
+	}
+	if kms.Calls["GenerateDataKey"] != 1 || kms.Calls["Decrypt"] != 1 {
+		t.Errorf("got %v calls to KMS expected one data key decrypted once", kms.Calls)
+	}
+}
+
+func Test_ReadWrongType(t *testing.T) {
+	filename := "/tmp/registry-bar"
+	defer os.Remove(filename)
+	obj := stack.NewObject("pg", filename, stack.DBParameterGroup)
+	err := stack.Write(obj, []pgstate.ParameterGroup{})
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	_, err = stack.Read[rds.CreateDBInstanceInput](obj)
+	if err == nil {
+		t.Errorf("expected an error reading a parameter group as an instance")
+	}
+	err = stack.Write(stack.NewObject("instance", filename, stack.Instance), rds.CreateDBInstanceInput{})
+	if err == nil {
+		t.Errorf("expected an error writing an instance by value")
+	}
+	_, err = stack.Read[[]pgstate.ParameterGroup](stack.NewObject("foo", filename, "NotRegistered"))
+	if err == nil {
+		t.Errorf("expected an error for an unregistered type")
+	}
+}
+
+func Test_ReadMatchesLegacyEncoders(t *testing.T) {
+	filename := "/tmp/registry-baz"
+	defer os.Remove(filename)
+	rules := []state.SGRuleStorage{{GroupID: aws.String("sg-1")}}
+	_, err := state.WriteOutput(filename, state.EncodeSGRulesStorage(rules))
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	got, err := stack.Read[[]state.SGRuleStorage](stack.NewObject("rules", filename, stack.SecurityGroupRules))
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	if !reflect.DeepEqual(got, rules) {
+		t.Errorf("got %v expected %v", got, rules)
+	}
+}
+
+func Test_Decode(t *testing.T) {
+	filename := "/tmp/registry-qux"
+	defer os.Remove(filename)
+	obj := stack.NewObject("sg", filename, stack.SecurityGroup)
+	err := stack.Write(obj, &state.SecurityGroupOutput{})
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	v, err := stack.Decode(obj)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if _, ok := v.(*state.SecurityGroupOutput); !ok {
+		t.Errorf("got %T expected *state.SecurityGroupOutput", v)
+	}
+	typ, ok := stack.RegisteredType(stack.SecurityGroup)
+	if !ok || typ != reflect.TypeOf(v) {
+		t.Errorf("got %v expected %T", typ, v)
+	}
+}
+
+func Test_RegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering %s twice to panic", stack.Cluster)
+		}
+	}()
+	stack.Register(stack.Cluster, stack.GobCodec[*rds.RestoreDBClusterFromSnapshotInput]())
+}
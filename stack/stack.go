@@ -2,13 +2,10 @@ package stack
 
 import (
 	"bytes"
-	"encoding/gob"
+	"errors"
+	"fmt"
 	"log/slog"
-	"os"
-	"sort"
 
-	"github.com/jrottersman/lats/helpers"
-	"github.com/jrottersman/lats/pgstate"
 	"github.com/jrottersman/lats/state"
 )
 
@@ -21,58 +18,49 @@ const OptionGroup = "OptionGroup"
 const SecurityGroup = "SecurityGroup"
 const SecurityGroupRules = "SecurityGroupRules"
 
+// Object is a node in a stack, it points at the file holding the object and the objects it depends on
 type Object struct {
-	FileName string
-	Order    int
-	ObjType  string
+	ID        string   `json:"id"`                  // ID identifies the object inside it's stack
+	FileName  string   `json:"fileName"`            // FileName is where the encoded object lives
+	ObjType   string   `json:"objType"`             // ObjType is the registered type of the object
+	DependsOn []string `json:"dependsOn,omitempty"` // DependsOn are the IDs of objects that have to be restored before this one
+	Checksum  string   `json:"checksum,omitempty"`  // Checksum is the sha256 of the file when the stack was written
+	Size      int64    `json:"size,omitempty"`      // Size of the file when the stack was written
 }
 
-// ReadObject Read the file for the object this uses a crazy case statement to figure out what to decode the value to and return it. This might be replaced with a generic decode function
+// ReadObject reads the file for the object and decodes it into the type registered for its ObjType, use Read when you know the type you want
 func (o Object) ReadObject() interface{} {
-	dat, err := os.ReadFile(o.FileName)
 	slog.Info("filename is", "Filename", o.FileName)
+	v, err := Decode(o)
 	if err != nil {
 		slog.Warn("error reading object file", "error", err)
+		return nil
 	}
-	buf := bytes.NewBuffer(dat)
-	switch o.ObjType {
-	case LoneInstance:
-		return state.DecodeRestoreDBInstanceFromDBSnapshotInput(*buf)
-	case Cluster:
-		return state.DecodeRestoreDBClusterFromSnapshotInput(*buf)
-	case Instance:
-		return state.DecodeCreateDBInstanceInput(*buf)
-	case DBParameterGroup:
-		return pgstate.DecodeParameterGroups(*buf)
-	case DBClusterParameterGroup:
-		return pgstate.DecodeParameterGroups(*buf)
-	case SecurityGroup:
-		return state.DecodeSecurityGroups(*buf)
-	case SecurityGroupRules:
-		return state.DecodeSGRulesStorage(*buf)
-	}
-	return nil
+	return v
 }
 
-func NewObject(filename string, order int, objtype string) Object {
+// NewObject creates a stack object that is restored after the objects in dependsOn
+func NewObject(id string, filename string, objtype string, dependsOn ...string) Object {
 	return Object{
-		FileName: filename,
-		Order:    order,
-		ObjType:  objtype,
+		ID:        id,
+		FileName:  filename,
+		ObjType:   objtype,
+		DependsOn: dependsOn,
 	}
 }
 
+// Stack is a graph of the objects we need to restore a database, use Levels or Execute to walk it in dependency order
 type Stack struct {
-	Name                  string //Name is the name of the stack
-	RestorationObjectName string // RestorationObjectName is the name of the object that will be restored
-	Objects               map[int][]Object
+	Version               int                 `json:"version"`               // Version is the layout of the stack see StackVersion
+	Name                  string              `json:"name"`                  //Name is the name of the stack
+	RestorationObjectName string              `json:"restorationObjectName"` // RestorationObjectName is the name of the object that will be restored
+	Objects               []Object            `json:"objects"`               // Objects are the nodes of the graph the edges are Object.DependsOn
+	Metadata              state.StackMetadata `json:"metadata,omitzero"`     // Metadata describes the snapshot and who made the stack, it's empty for stacks from older lats
 }
 
+// Encoder encodes the stack as a JSON document
 func (s Stack) Encoder() (*bytes.Buffer, error) {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(s)
+	encoder, err := state.EncodeDocument(state.KindStack, s)
 	if err != nil {
 		slog.Error("Error encoding our stack", "error", err)
 		return nil, err
@@ -80,13 +68,15 @@ func (s Stack) Encoder() (*bytes.Buffer, error) {
 	return &encoder, nil
 }
 
+// Write writes the stack recording the checksum and size of each object file, objects have to be written before their stack
 func (s Stack) Write(filename string) error {
+	s.Objects = checksumObjects(s.Objects)
 	b, err := s.Encoder()
 	if err != nil {
 		slog.Error("Error creating bytes", "error", err)
 		return err
 	}
-	_, err = helpers.WriteOutput(filename, *b)
+	_, err = state.WriteOutput(filename, *b)
 	if err != nil {
 		slog.Error("error writing output", "error", err)
 		return err
@@ -94,52 +84,101 @@ func (s Stack) Write(filename string) error {
 	return nil
 }
 
-func (s Stack) SortStack() *[]int {
-	keys := []int{}
-	for k := range s.Objects {
-		keys = append(keys, k)
+// checksumObjects returns a copy of objects with the checksum of each file, objects whose file can't be read keep what they had
+func checksumObjects(objects []Object) []Object {
+	out := make([]Object, len(objects))
+	for i, o := range objects {
+		out[i] = o
+		dat, err := state.ReadObject(o.FileName)
+		if err != nil {
+			slog.Warn("can't read object file to record it's checksum", "file", o.FileName, "error", err)
+			continue
+		}
+		out[i].Checksum = state.Checksum(dat)
+		out[i].Size = int64(len(dat))
 	}
-	sort.Ints(keys)
-	return &keys
+	return out
 }
 
+// NewStack creates a stack from objects
 func NewStack(name string, restorationObjectName string, objects []Object) Stack {
-	objs := make(map[int][]Object)
-	for _, v := range objects {
-		order := v.Order
-		_, ok := objs[order]
-		if !ok {
-			objs[order] = []Object{v}
-		} else {
-			objs[order] = append(objs[order], v)
-		}
-	}
-
 	return Stack{
+		Version:               StackVersion,
 		Name:                  name,
 		RestorationObjectName: restorationObjectName,
-		Objects:               objs,
+		Objects:               objects,
 	}
 }
 
+// ReadStack reads a stack written as JSON or as gob by an older lats, older layouts are migrated in memory
 func ReadStack(filename string) (*Stack, error) {
-	f, err := os.ReadFile(filename)
+	f, err := state.ReadObject(filename)
 	if err != nil {
 		slog.Error("Error reading the stack", "error", err)
 		return nil, err
 	}
-	buf := bytes.NewBuffer(f)
+	stack, err := DecodeStack(f)
+	if err != nil {
+		slog.Error("Error Decoding Stack", "file", filename, "error", err)
+		return nil, err
+	}
+	return stack, nil
+}
+
+// DecodeStack decodes the contents of a stack file migrating older layouts
+func DecodeStack(b []byte) (*Stack, error) {
+	m, from, err := StackMigrations.Migrate(b)
+	if err != nil {
+		return nil, err
+	}
+	if from < StackVersion {
+		slog.Info("migrated stack", "from", from, "to", StackVersion)
+	}
 	var stack Stack
-	dec := gob.NewDecoder(buf)
-	err = dec.Decode(&stack)
+	err = state.DecodeDocument(m, state.KindStack, &stack)
 	if err != nil {
-		slog.Error("Error Decoding Stack", "error", err)
 		return nil, err
 	}
+	if stack.Version == 0 {
+		stack.Version = StackVersion
+	}
 	return &stack, nil
 }
 
+// ConvertStack rewrites a stack and all of it's objects as JSON documents, it returns how many files it rewrote
+func ConvertStack(filename string) (int, error) {
+	dat, err := state.ReadObject(filename)
+	if err != nil {
+		return 0, err
+	}
+	s, err := ReadStack(filename)
+	if err != nil {
+		return 0, err
+	}
+	converted := 0
+	var errs []error
+	for _, o := range s.Objects {
+		ok, err := Convert(o)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("object %s: %w", o.ID, err))
+			continue
+		}
+		if ok {
+			converted++
+		}
+	}
+	// the stack is written again when objects changed so it has their new checksums
+	if !state.IsDocument(dat) || converted > 0 {
+		err = s.Write(filename)
+		if err != nil {
+			errs = append(errs, err)
+		} else if !state.IsDocument(dat) {
+			converted++
+		}
+	}
+	return converted, errors.Join(errs...)
+}
+
 func DeleteStack(filename string) error {
-	err := os.Remove(filename)
-	return err
+	return state.DeleteObject(filename)
 }
@@ -1,20 +1,19 @@
 package stack_test
 
 import (
-	"encoding/gob"
 	"os"
 	"reflect"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/jrottersman/lats/stack"
 	"github.com/jrottersman/lats/state"
 )
 
 func Test_ReadObject(t *testing.T) {
 	filename := "/tmp/foo"
-	order := 5
 	objType := stack.LoneInstance
 
 	defer os.Remove(filename)
@@ -27,7 +26,7 @@ func Test_ReadObject(t *testing.T) {
 		t.Errorf("failed to write output, %s", err)
 	}
 
-	resp := stack.NewObject(filename, order, objType)
+	resp := stack.NewObject("instance", filename, objType)
 	i := resp.ReadObject()
 	_, ok := i.(*rds.RestoreDBInstanceFromDBSnapshotInput)
 	if !ok {
@@ -37,12 +36,14 @@ func Test_ReadObject(t *testing.T) {
 
 func Test_NewObject(t *testing.T) {
 	filename := "/tmp/foo"
-	order := 5
 	objType := "rdsInstance"
 
-	resp := stack.NewObject(filename, order, objType)
-	if resp.Order != order {
-		t.Errorf("NewObject order expected %d got %d", resp.Order, order)
+	resp := stack.NewObject("instance", filename, objType, "parameter-group")
+	if resp.ID != "instance" {
+		t.Errorf("NewObject id expected instance got %s", resp.ID)
+	}
+	if !reflect.DeepEqual(resp.DependsOn, []string{"parameter-group"}) {
+		t.Errorf("NewObject depends on expected [parameter-group] got %v", resp.DependsOn)
 	}
 }
 
@@ -50,22 +51,14 @@ func Test_NewStack(t *testing.T) {
 	name := "foo"
 	roname := "bar"
 
-	o1 := stack.Object{
-		"tmp/foo",
-		1,
-		"RDSCluster",
-	}
+	o1 := stack.NewObject("foo", "tmp/foo", "RDSCluster")
 
-	o2 := stack.Object{
-		"tmp/bar",
-		1,
-		"RDSCluster",
-	}
+	o2 := stack.NewObject("bar", "tmp/bar", "RDSCluster", "foo")
 	objects := []stack.Object{o1, o2}
 
 	resp := stack.NewStack(name, roname, objects)
-	if len(resp.Objects[1]) != 2 {
-		t.Errorf("expected 2 got %d", len(resp.Objects[1]))
+	if len(resp.Objects) != 2 {
+		t.Errorf("expected 2 got %d", len(resp.Objects))
 	}
 }
 
@@ -73,17 +66,9 @@ func Test_Encoder(t *testing.T) {
 	name := "foo"
 	roname := "bar"
 
-	o1 := stack.Object{
-		"tmp/foo",
-		1,
-		"RDSCluster",
-	}
+	o1 := stack.NewObject("foo", "tmp/foo", "RDSCluster")
 
-	o2 := stack.Object{
-		"tmp/bar",
-		1,
-		"RDSCluster",
-	}
+	o2 := stack.NewObject("bar", "tmp/bar", "RDSCluster", "foo")
 	objects := []stack.Object{o1, o2}
 
 	mStack := stack.NewStack(name, roname, objects)
@@ -93,8 +78,7 @@ func Test_Encoder(t *testing.T) {
 		t.Errorf("encode error: %s", err)
 	}
 	var result stack.Stack
-	dec := gob.NewDecoder(r)
-	err = dec.Decode(&result)
+	err = state.DecodeDocument(r.Bytes(), state.KindStack, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -107,17 +91,9 @@ func Test_Write(t *testing.T) {
 	name := "foo"
 	roname := "bar"
 
-	o1 := stack.Object{
-		"tmp/foo",
-		1,
-		"RDSCluster",
-	}
+	o1 := stack.NewObject("foo", "tmp/foo", "RDSCluster")
 
-	o2 := stack.Object{
-		"tmp/bar",
-		1,
-		"RDSCluster",
-	}
+	o2 := stack.NewObject("bar", "tmp/bar", "RDSCluster", "foo")
 	objects := []stack.Object{o1, o2}
 
 	mStack := stack.NewStack(name, roname, objects)
@@ -133,17 +109,9 @@ func Test_ReadStack(t *testing.T) {
 	name := "foo"
 	roname := "bar"
 
-	o1 := stack.Object{
-		"tmp/foo",
-		1,
-		"RDSCluster",
-	}
+	o1 := stack.NewObject("foo", "tmp/foo", "RDSCluster")
 
-	o2 := stack.Object{
-		"tmp/bar",
-		1,
-		"RDSCluster",
-	}
+	o2 := stack.NewObject("bar", "tmp/bar", "RDSCluster", "foo")
 	objects := []stack.Object{o1, o2}
 
 	mStack := stack.NewStack(name, roname, objects)
@@ -157,8 +125,8 @@ func Test_ReadStack(t *testing.T) {
 	if err != nil {
 		t.Errorf("error reading stack %s", err)
 	}
-	if sp.Name != mStack.Name {
-		t.Errorf("got %s expected %s", sp.Name, mStack.Name)
+	if !reflect.DeepEqual(*sp, mStack) {
+		t.Errorf("got %v expected %v", *sp, mStack)
 	}
 }
 
@@ -166,17 +134,9 @@ func Test_DeleteStack(t *testing.T) {
 	name := "foo"
 	roname := "bar"
 
-	o1 := stack.Object{
-		"tmp/foo",
-		1,
-		"RDSCluster",
-	}
+	o1 := stack.NewObject("foo", "tmp/foo", "RDSCluster")
 
-	o2 := stack.Object{
-		"tmp/bar",
-		1,
-		"RDSCluster",
-	}
+	o2 := stack.NewObject("bar", "tmp/bar", "RDSCluster", "foo")
 	objects := []stack.Object{o1, o2}
 
 	mStack := stack.NewStack(name, roname, objects)
@@ -191,34 +151,19 @@ func Test_DeleteStack(t *testing.T) {
 	}
 }
 
-func TestStack_SortStack(t *testing.T) {
-	type fields struct {
-		Name                  string
-		RestorationObjectName string
-		Objects               map[int][]stack.Object
-	}
-	objs := make(map[int][]stack.Object)
-	objs[1] = []stack.Object{}
-	objs[2] = []stack.Object{}
-	objs[3] = []stack.Object{}
-	expected := []int{1, 2, 3}
-	tests := []struct {
-		name   string
-		fields fields
-		want   *[]int
-	}{
-		{name: "Test", fields: fields{Objects: objs}, want: &expected},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := stack.Stack{
-				Name:                  tt.fields.Name,
-				RestorationObjectName: tt.fields.RestorationObjectName,
-				Objects:               tt.fields.Objects,
-			}
-			if got := s.SortStack(); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Stack.SortStack() = %v, want %v", got, tt.want)
-			}
-		})
+func Test_ReadObjectDependencies(t *testing.T) {
+	ogFile := "/tmp/foo-og"
+	sgFile := "/tmp/foo-sg"
+	defer os.Remove(ogFile)
+	defer os.Remove(sgFile)
+	og := types.OptionGroup{OptionGroupName: aws.String("foo")}
+	state.WriteOutput(ogFile, state.EncodeOptionGroup(&og))
+	state.WriteOutput(sgFile, state.EncodeSecurityGroups(state.SecurityGroupOutput{}))
+
+	if _, ok := stack.NewObject("og", ogFile, stack.OptionGroup).ReadObject().(*types.OptionGroup); !ok {
+		t.Errorf("failed to coerce to *types.OptionGroup")
+	}
+	if _, ok := stack.NewObject("sg", sgFile, stack.SecurityGroup).ReadObject().(*state.SecurityGroupOutput); !ok {
+		t.Errorf("failed to coerce to *state.SecurityGroupOutput")
 	}
 }
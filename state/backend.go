@@ -0,0 +1,159 @@
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jrottersman/lats/helpers"
+)
+
+// ErrNotFound is returned by a StateBackend for a key that doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned by PutIf when the key changed since it was read
+var ErrConflict = errors.New("changed since it was read")
+
+// StateBackend stores the state file and the objects it points at.
+// Keys are the paths lats used to write in the working directory like .confState.json and .state/<uuid>.json
+type StateBackend interface {
+	// Get returns the contents of key and its generation, the generation changes every time key is written
+	Get(ctx context.Context, key string) ([]byte, string, error)
+	// Put writes key whatever is there
+	Put(ctx context.Context, key string, data []byte) error
+	// PutIf writes key only if it's still at generation, an empty generation means key must not exist yet. It returns the new generation
+	PutIf(ctx context.Context, key string, data []byte, generation string) (string, error)
+	// Delete removes key
+	Delete(ctx context.Context, key string) error
+	// List returns the keys directly under dir
+	List(ctx context.Context, dir string) ([]string, error)
+	// String describes where the backend keeps state for logs
+	String() string
+}
+
+// ModTimer is implemented by backends that know when a key was last written, gc won't delete anything it can't tell the age of
+type ModTimer interface {
+	ModTime(ctx context.Context, key string) (time.Time, error)
+}
+
+// Backend is where lats keeps state, it's the working directory unless the config says otherwise
+var Backend StateBackend = LocalBackend{}
+
+// ReadObject reads key from the backend
+func ReadObject(key string) ([]byte, error) {
+	dat, _, err := Backend.Get(context.Background(), key)
+	return dat, err
+}
+
+// DeleteObject removes key from the backend
+func DeleteObject(key string) error {
+	return Backend.Delete(context.Background(), key)
+}
+
+// LocalBackend keeps state in files relative to the working directory, or to Dir when it's set
+type LocalBackend struct {
+	Dir string
+}
+
+// path is where key is on disk
+func (b LocalBackend) path(key string) string {
+	return filepath.Join(b.Dir, key)
+}
+
+func (b LocalBackend) String() string {
+	if b.Dir != "" {
+		return "local files in " + b.Dir
+	}
+	return "local files"
+}
+
+// Get reads the file, the generation is a hash of its contents
+func (b LocalBackend) Get(ctx context.Context, key string) ([]byte, string, error) {
+	dat, err := os.ReadFile(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", errors.Join(ErrNotFound, err)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return dat, localGeneration(dat), nil
+}
+
+// Put writes the file atomically creating the directory it's in if it has to
+func (b LocalBackend) Put(ctx context.Context, key string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(b.path(key)), 0755)
+	if err != nil {
+		return err
+	}
+	return helpers.WriteFileAtomic(b.path(key), data, 0644)
+}
+
+// PutIf checks the file's hash before writing it, it's only safe against other lats processes holding the state lock
+func (b LocalBackend) PutIf(ctx context.Context, key string, data []byte, generation string) (string, error) {
+	_, gen, err := b.Get(ctx, key)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if generation != "" {
+			return "", ErrConflict
+		}
+	case err != nil:
+		return "", err
+	case generation != gen:
+		return "", ErrConflict
+	}
+	err = b.Put(ctx, key, data)
+	if err != nil {
+		return "", err
+	}
+	return localGeneration(data), nil
+}
+
+// Delete removes the file
+func (b LocalBackend) Delete(ctx context.Context, key string) error {
+	err := os.Remove(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return errors.Join(ErrNotFound, err)
+	}
+	return err
+}
+
+// List returns the files in dir
+func (b LocalBackend) List(ctx context.Context, dir string) ([]string, error) {
+	entries, err := os.ReadDir(b.path(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		keys = append(keys, filepath.Join(dir, e.Name()))
+	}
+	return keys, nil
+}
+
+// ModTime is when the file was last written
+func (b LocalBackend) ModTime(ctx context.Context, key string) (time.Time, error) {
+	fi, err := os.Stat(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, errors.Join(ErrNotFound, err)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func localGeneration(dat []byte) string {
+	sum := sha256.Sum256(dat)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,92 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLocalBackend_PutIf(t *testing.T) {
+	ctx := context.Background()
+	b := LocalBackend{}
+	key := filepath.Join(t.TempDir(), "nested", "state.json")
+	gen, err := b.PutIf(ctx, key, []byte("one"), "")
+	if err != nil {
+		t.Fatalf("PutIf() error = %v", err)
+	}
+	_, err = b.PutIf(ctx, key, []byte("two"), "")
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("PutIf() creating a file that exists error = %v, want ErrConflict", err)
+	}
+	_, err = b.PutIf(ctx, key, []byte("two"), gen)
+	if err != nil {
+		t.Fatalf("PutIf() error = %v", err)
+	}
+	_, err = b.PutIf(ctx, key, []byte("three"), gen)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("PutIf() with a stale generation error = %v, want ErrConflict", err)
+	}
+	_, _, err = b.Get(ctx, filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing file error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalBackend_Dir(t *testing.T) {
+	ctx := context.Background()
+	t.Chdir(t.TempDir())
+	b := LocalBackend{Dir: "workspaces/staging"}
+	err := b.Put(ctx, ".state/a.json", []byte("a"))
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, err := os.Stat("workspaces/staging/.state/a.json"); err != nil {
+		t.Errorf("expected the file under Dir got %v", err)
+	}
+	keys, err := b.List(ctx, ".state")
+	if err != nil || len(keys) != 1 || keys[0] != filepath.Join(".state", "a.json") {
+		t.Errorf("List() got %v %v expected keys without Dir", keys, err)
+	}
+	if _, _, err := (LocalBackend{}).Get(ctx, ".state/a.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the file to only be under Dir got %v", err)
+	}
+}
+
+// racingBackend writes another object to the state file the first time PutIf is called like a lats on another machine would
+type racingBackend struct {
+	LocalBackend
+	once sync.Once
+}
+
+func (r *racingBackend) PutIf(ctx context.Context, key string, data []byte, generation string) (string, error) {
+	r.once.Do(func() {
+		m, _ := json.Marshal(stateFile{Version: StateVersion, StateLocations: []StateKV{{Object: "other", FileLocation: "/tmp/other", ObjectType: SnapshotType}}})
+		r.LocalBackend.Put(ctx, key, m)
+	})
+	return r.LocalBackend.PutIf(ctx, key, data, generation)
+}
+
+func TestSyncState_Conflict(t *testing.T) {
+	old := Backend
+	defer func() { Backend = old }()
+	Backend = &racingBackend{}
+	filename := filepath.Join(t.TempDir(), ".state.json")
+
+	sm := StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("mine", "/tmp/mine", SnapshotType)
+	err := sm.SyncState(filename)
+	if err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	got, err := ReadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.StateLocations) != 2 {
+		t.Errorf("expected the object written during the sync to be merged got %v", got.StateLocations)
+	}
+}
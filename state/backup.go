@@ -0,0 +1,119 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxBackups is how many old copies of the state file SyncState keeps, 0 turns backups off
+var MaxBackups = 5
+
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// Backup is an old copy of the state file
+type Backup struct {
+	Path string
+	Time time.Time
+}
+
+// BackupDir is where the backups of a state file are kept
+func BackupDir(filename string) string {
+	return filepath.Join(filepath.Dir(filename), ".stateBackups")
+}
+
+// backupState copies dat, the state file as it is now, into the backup directory and drops the oldest backups past MaxBackups
+func backupState(filename string, dat []byte) error {
+	if MaxBackups < 1 || len(bytes.TrimSpace(dat)) == 0 {
+		return nil
+	}
+	dir := BackupDir(filename)
+	name := fmt.Sprintf("%s.%s", filepath.Base(filename), time.Now().UTC().Format(backupTimeFormat))
+	err := Backend.Put(context.Background(), filepath.Join(dir, name), dat)
+	if err != nil {
+		return err
+	}
+	return pruneBackups(filename)
+}
+
+func pruneBackups(filename string) error {
+	backups, err := ListBackups(filename)
+	if err != nil {
+		return err
+	}
+	if len(backups) <= MaxBackups {
+		return nil
+	}
+	var errs []error
+	for _, b := range backups[MaxBackups:] {
+		err := Backend.Delete(context.Background(), b.Path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListBackups returns the backups of a state file newest first
+func ListBackups(filename string) ([]Backup, error) {
+	keys, err := Backend.List(context.Background(), BackupDir(filename))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(filename) + "."
+	backups := []Backup{}
+	for _, k := range keys {
+		name := filepath.Base(k)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, strings.TrimPrefix(name, prefix))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: k, Time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// RestoreBackup replaces the state file with a backup, the state file being replaced is backed up first so a restore can be undone
+func RestoreBackup(filename string, backup string) error {
+	dat, err := ReadObject(backup)
+	if err != nil {
+		return err
+	}
+	m, _, err := StateMigrations.Migrate(dat)
+	if err != nil {
+		return fmt.Errorf("backup %s isn't a usable state file: %w", backup, err)
+	}
+	var sf stateFile
+	err = json.Unmarshal(m, &sf)
+	if err != nil {
+		return fmt.Errorf("backup %s isn't a usable state file: %w", backup, err)
+	}
+	return WithLock(filename, func() error {
+		current, gen, err := Backend.Get(context.Background(), filename)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		err = backupState(filename, current)
+		if err != nil {
+			slog.Warn("error backing up the state file before restoring", "error", err)
+		}
+		_, err = Backend.PutIf(context.Background(), filename, dat, gen)
+		if errors.Is(err, ErrConflict) {
+			return fmt.Errorf("state file %s changed while restoring, try again: %w", filename, err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func syncTestState(t *testing.T, filename string, objects ...string) {
+	sm := StateManager{Mu: &sync.Mutex{}}
+	for _, o := range objects {
+		sm.UpdateState(o, "/tmp/"+o, SnapshotType)
+	}
+	err := sm.SyncState(filename)
+	if err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+}
+
+func TestSyncState_Backups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	old := MaxBackups
+	MaxBackups = 2
+	defer func() { MaxBackups = old }()
+
+	syncTestState(t, filename, "a")
+	backups, err := ListBackups(filename)
+	if err != nil {
+		t.Fatalf("ListBackups() error = %v", err)
+	}
+	if len(backups) != 0 {
+		t.Errorf("expected no backup of a new state file got %d", len(backups))
+	}
+
+	syncTestState(t, filename, "a", "b")
+	syncTestState(t, filename, "a", "b", "c")
+	syncTestState(t, filename, "a", "b", "c", "d")
+	backups, err = ListBackups(filename)
+	if err != nil {
+		t.Fatalf("ListBackups() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups got %d", len(backups))
+	}
+	if !backups[0].Time.After(backups[1].Time) {
+		t.Errorf("expected backups newest first")
+	}
+	sm, err := ReadState(backups[0].Path)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if len(sm.StateLocations) != 3 {
+		t.Errorf("expected the newest backup to have 3 objects got %d", len(sm.StateLocations))
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	syncTestState(t, filename, "a")
+	syncTestState(t, filename, "a", "b")
+	backups, err := ListBackups(filename)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected 1 backup got %d, %v", len(backups), err)
+	}
+
+	err = RestoreBackup(filename, backups[0].Path)
+	if err != nil {
+		t.Fatalf("RestoreBackup() error = %v", err)
+	}
+	sm, err := ReadState(filename)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if len(sm.StateLocations) != 1 {
+		t.Errorf("expected the restored state to have 1 object got %d", len(sm.StateLocations))
+	}
+	backups, err = ListBackups(filename)
+	if err != nil || len(backups) != 2 {
+		t.Errorf("expected the replaced state to be backed up got %d backups, %v", len(backups), err)
+	}
+}
+
+func TestRestoreBackup_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, ".state.json")
+	syncTestState(t, filename, "a")
+	bad := filepath.Join(dir, "bad")
+	err := os.WriteFile(bad, []byte("not state"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RestoreBackup(filename, bad)
+	if err == nil {
+		t.Errorf("expected an error restoring a bad backup")
+	}
+	sm, err := ReadState(filename)
+	if err != nil || len(sm.StateLocations) != 1 {
+		t.Errorf("state file changed after a bad restore")
+	}
+}
@@ -2,7 +2,6 @@ package state
 
 import (
 	"bytes"
-	"encoding/gob"
 	"log/slog"
 
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
@@ -15,10 +14,7 @@ type SecurityGroupOutput struct {
 
 // EncodeSecurityGroups encodes a security group to bytes
 func EncodeSecurityGroups(sg SecurityGroupOutput) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(sg)
+	encoder, err := EncodeDocument(KindSecurityGroups, sg)
 	if err != nil {
 		slog.Error("Error encoding our database", "error", err)
 	}
@@ -28,8 +24,7 @@ func EncodeSecurityGroups(sg SecurityGroupOutput) bytes.Buffer {
 // DecodeSecurityGroups takes bytes and gives us a securitygroupoutput for resotration
 func DecodeSecurityGroups(b bytes.Buffer) SecurityGroupOutput {
 	var securityGroups SecurityGroupOutput
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&securityGroups)
+	err := DecodeDocument(b.Bytes(), KindSecurityGroups, &securityGroups)
 	if err != nil {
 		slog.Error("Error decoding state for Security Groups", "error", err)
 	}
@@ -44,35 +39,56 @@ type SGRuleStorage struct {
 	IPProtocol    *string
 	PrefixIdsList []string
 	IPRanges      []types.IpRange
+	IPv6Ranges    []types.Ipv6Range       `json:",omitempty"`
+	GroupPairs    []types.UserIdGroupPair `json:",omitempty"` // GroupPairs are the security groups the rule allows
+	Egress        bool                    `json:",omitempty"` // Egress is an outbound rule, rules from older lats are all inbound
 }
 
 // SecurityGroupNeeds is a function that takes a security group and get's the parts we need out more for thought then anything
 func SecurityGroupNeeds(sg SecurityGroupOutput) []SGRuleStorage {
 	var sgRules []SGRuleStorage
 	for _, v := range sg.SecurityGroups {
-		gid := v.GroupId
-		gname := v.GroupName
 		for _, z := range v.IpPermissions {
-			// What is needed for ipv4 and SG rules
-			fromPort := z.FromPort
-			toPort := z.ToPort
-			IpProtocol := z.IpProtocol
-			prefixes := []string{}
-			for _, prefix := range z.PrefixListIds {
-				prefixes = append(prefixes, *prefix.PrefixListId)
-			}
-			IpRanges := z.IpRanges
-			sgRules = append(sgRules, SGRuleStorage{GroupID: gid, GroupName: gname, FromPort: fromPort, ToPort: toPort, IPProtocol: IpProtocol, IPRanges: IpRanges, PrefixIdsList: prefixes})
+			sgRules = append(sgRules, sgRule(v, z, false))
+		}
+		for _, z := range v.IpPermissionsEgress {
+			sgRules = append(sgRules, sgRule(v, z, true))
 		}
 	}
 	return sgRules
 }
 
-func EncodeSGRulesStorage(sg []SGRuleStorage) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
+// sgRule is what is needed for ipv4 and SG rules
+func sgRule(sg types.SecurityGroup, z types.IpPermission, egress bool) SGRuleStorage {
+	prefixes := []string{}
+	for _, prefix := range z.PrefixListIds {
+		prefixes = append(prefixes, *prefix.PrefixListId)
+	}
+	return SGRuleStorage{GroupID: sg.GroupId, GroupName: sg.GroupName, FromPort: z.FromPort, ToPort: z.ToPort, IPProtocol: z.IpProtocol, IPRanges: z.IpRanges, IPv6Ranges: z.Ipv6Ranges, GroupPairs: z.UserIdGroupPairs, PrefixIdsList: prefixes, Egress: egress}
+}
 
-	err := enc.Encode(sg)
+// RemapGroups points the rule's group pairs at the new ids of groups that were restored, groupIDs maps the original id to the new one.
+// Pairs for groups that weren't restored are left alone
+func (sg SGRuleStorage) RemapGroups(groupIDs map[string]string) SGRuleStorage {
+	if len(sg.GroupPairs) == 0 {
+		return sg
+	}
+	pairs := make([]types.UserIdGroupPair, 0, len(sg.GroupPairs))
+	for _, p := range sg.GroupPairs {
+		if p.GroupId != nil {
+			if id, ok := groupIDs[*p.GroupId]; ok {
+				// the restored group is in our account and vpc so the rest of the pair doesn't apply
+				p = types.UserIdGroupPair{GroupId: &id, Description: p.Description}
+			}
+		}
+		pairs = append(pairs, p)
+	}
+	sg.GroupPairs = pairs
+	return sg
+}
+
+func EncodeSGRulesStorage(sg []SGRuleStorage) bytes.Buffer {
+	encoder, err := EncodeDocument(KindSecurityGroupRules, sg)
 	if err != nil {
 		slog.Error("Error encoding our Security Group rules", "error", err)
 	}
@@ -81,8 +97,7 @@ func EncodeSGRulesStorage(sg []SGRuleStorage) bytes.Buffer {
 
 func DecodeSGRulesStorage(b bytes.Buffer) []SGRuleStorage {
 	var sg []SGRuleStorage
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&sg)
+	err := DecodeDocument(b.Bytes(), KindSecurityGroupRules, &sg)
 	if err != nil {
 		slog.Error("Error decoding state for Security Group rules", "error", err)
 	}
@@ -90,10 +105,7 @@ func DecodeSGRulesStorage(b bytes.Buffer) []SGRuleStorage {
 }
 
 func EncodeVpc(vpc types.Vpc) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(vpc)
+	encoder, err := EncodeDocument(KindVpc, vpc)
 	if err != nil {
 		slog.Error("Error encoding our VPC", "error", err)
 	}
@@ -102,8 +114,7 @@ func EncodeVpc(vpc types.Vpc) bytes.Buffer {
 
 func DecodeVpc(b bytes.Buffer) types.Vpc {
 	var vpc types.Vpc
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&vpc)
+	err := DecodeDocument(b.Bytes(), KindVpc, &vpc)
 	if err != nil {
 		slog.Error("Error decoding state for VPC", "error", err)
 	}
@@ -111,10 +122,7 @@ func DecodeVpc(b bytes.Buffer) types.Vpc {
 }
 
 func EncodeSubnets(subnets []types.Subnet) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(subnets)
+	encoder, err := EncodeDocument(KindSubnets, subnets)
 	if err != nil {
 		slog.Error("Error encoding our Subnets", "error", err)
 	}
@@ -123,8 +131,7 @@ func EncodeSubnets(subnets []types.Subnet) bytes.Buffer {
 
 func DecodeSubnets(b bytes.Buffer) []types.Subnet {
 	var subnets []types.Subnet
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&subnets)
+	err := DecodeDocument(b.Bytes(), KindSubnets, &subnets)
 	if err != nil {
 		slog.Error("Error decoding state for Subnets", "error", err)
 	}
@@ -132,10 +139,7 @@ func DecodeSubnets(b bytes.Buffer) []types.Subnet {
 }
 
 func EncodeInternetGateways(igws []types.InternetGateway) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(igws)
+	encoder, err := EncodeDocument(KindInternetGateways, igws)
 	if err != nil {
 		slog.Error("Error encoding our Internet Gateways", "error", err)
 	}
@@ -144,8 +148,7 @@ func EncodeInternetGateways(igws []types.InternetGateway) bytes.Buffer {
 
 func DecodeInternetGateways(b bytes.Buffer) []types.InternetGateway {
 	var igws []types.InternetGateway
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&igws)
+	err := DecodeDocument(b.Bytes(), KindInternetGateways, &igws)
 	if err != nil {
 		slog.Error("Error decoding state for Internet Gateways", "error", err)
 	}
@@ -153,10 +156,7 @@ func DecodeInternetGateways(b bytes.Buffer) []types.InternetGateway {
 }
 
 func EncodeRouteTables(rts []types.RouteTable) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(rts)
+	encoder, err := EncodeDocument(KindRouteTables, rts)
 	if err != nil {
 		slog.Error("Error encoding our Route Tables", "error", err)
 	}
@@ -165,8 +165,7 @@ func EncodeRouteTables(rts []types.RouteTable) bytes.Buffer {
 
 func DecodeRouteTables(b bytes.Buffer) []types.RouteTable {
 	var rts []types.RouteTable
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&rts)
+	err := DecodeDocument(b.Bytes(), KindRouteTables, &rts)
 	if err != nil {
 		slog.Error("Error decoding state for Route Tables", "error", err)
 	}
@@ -174,10 +173,7 @@ func DecodeRouteTables(b bytes.Buffer) []types.RouteTable {
 }
 
 func EncodeAvailabilityZones(azs []types.AvailabilityZone) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(azs)
+	encoder, err := EncodeDocument(KindAvailabilityZones, azs)
 	if err != nil {
 		slog.Error("Error encoding our Availability Zones", "error", err)
 	}
@@ -186,8 +182,7 @@ func EncodeAvailabilityZones(azs []types.AvailabilityZone) bytes.Buffer {
 
 func DecodeAvailabilityZones(b bytes.Buffer) []types.AvailabilityZone {
 	var azs []types.AvailabilityZone
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&azs)
+	err := DecodeDocument(b.Bytes(), KindAvailabilityZones, &azs)
 	if err != nil {
 		slog.Error("Error decoding state for Availability Zones", "error", err)
 	}
@@ -200,6 +195,8 @@ func SgRuleStorageToIpPermission(sg SGRuleStorage) types.IpPermission {
 	ip.ToPort = sg.ToPort
 	ip.IpProtocol = sg.IPProtocol
 	ip.IpRanges = sg.IPRanges
+	ip.Ipv6Ranges = sg.IPv6Ranges
+	ip.UserIdGroupPairs = sg.GroupPairs
 	ip.PrefixListIds = prefixlistGenerator(sg.PrefixIdsList)
 	return ip
 }
@@ -1,7 +1,6 @@
 package state
 
 import (
-	"encoding/gob"
 	"reflect"
 	"testing"
 
@@ -19,8 +18,7 @@ func TestEncodeSecurityGroups(t *testing.T) {
 	}
 	r := EncodeSecurityGroups(sg2)
 	var result SecurityGroupOutput
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindSecurityGroups, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -54,6 +52,26 @@ func TestSecurityGroupNeeds(t *testing.T) {
 		want []SGRuleStorage
 	}{
 		{name: "test", args: args{sg: SecurityGroupOutput{SecurityGroups: []types.SecurityGroup{{GroupId: aws.String("foobar"), IpPermissions: []types.IpPermission{{IpProtocol: aws.String("tcp")}}}}}}, want: []SGRuleStorage{{GroupID: aws.String("foobar"), GroupName: nil, FromPort: nil, ToPort: nil, IPProtocol: aws.String("tcp"), IPRanges: nil, PrefixIdsList: []string{}}}},
+		{name: "egress", args: args{sg: SecurityGroupOutput{SecurityGroups: []types.SecurityGroup{{
+			GroupId:             aws.String("foobar"),
+			IpPermissions:       []types.IpPermission{{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(5432), ToPort: aws.Int32(5432)}},
+			IpPermissionsEgress: []types.IpPermission{{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(443), ToPort: aws.Int32(443), IpRanges: []types.IpRange{{CidrIp: aws.String("10.0.0.0/8")}}}},
+		}}}}, want: []SGRuleStorage{
+			{GroupID: aws.String("foobar"), FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IPProtocol: aws.String("tcp"), PrefixIdsList: []string{}},
+			{GroupID: aws.String("foobar"), FromPort: aws.Int32(443), ToPort: aws.Int32(443), IPProtocol: aws.String("tcp"), IPRanges: []types.IpRange{{CidrIp: aws.String("10.0.0.0/8")}}, PrefixIdsList: []string{}, Egress: true},
+		}},
+		{name: "group source", args: args{sg: SecurityGroupOutput{SecurityGroups: []types.SecurityGroup{{
+			GroupId: aws.String("sg-db"),
+			IpPermissions: []types.IpPermission{{
+				IpProtocol:       aws.String("tcp"),
+				FromPort:         aws.Int32(5432),
+				ToPort:           aws.Int32(5432),
+				UserIdGroupPairs: []types.UserIdGroupPair{{GroupId: aws.String("sg-app"), UserId: aws.String("123456789012")}},
+				Ipv6Ranges:       []types.Ipv6Range{{CidrIpv6: aws.String("2001:db8::/32")}},
+			}},
+		}}}}, want: []SGRuleStorage{
+			{GroupID: aws.String("sg-db"), FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IPProtocol: aws.String("tcp"), PrefixIdsList: []string{}, IPv6Ranges: []types.Ipv6Range{{CidrIpv6: aws.String("2001:db8::/32")}}, GroupPairs: []types.UserIdGroupPair{{GroupId: aws.String("sg-app"), UserId: aws.String("123456789012")}}},
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -72,8 +90,7 @@ func TestEncodeSGRuleStorage(t *testing.T) {
 	sgs = append(sgs, sgr)
 	r := EncodeSGRulesStorage(sgs)
 	var result []SGRuleStorage
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindSecurityGroupRules, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -101,8 +118,7 @@ func TestEncodeVpc(t *testing.T) {
 	}
 	r := EncodeVpc(vpc)
 	var result types.Vpc
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindVpc, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -129,8 +145,7 @@ func TestEncodeSubnets(t *testing.T) {
 	subnets := []types.Subnet{sn}
 	r := EncodeSubnets(subnets)
 	var result []types.Subnet
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindSubnets, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -158,8 +173,7 @@ func TestEncodeInternetGateways(t *testing.T) {
 	igs := []types.InternetGateway{ig}
 	r := EncodeInternetGateways(igs)
 	var result []types.InternetGateway
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindInternetGateways, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -184,8 +198,7 @@ func TestEncodeAvailabilityZones(t *testing.T) {
 	azs := []types.AvailabilityZone{{ZoneName: aws.String("foo")}}
 	r := EncodeAvailabilityZones(azs)
 	var result []types.AvailabilityZone
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindAvailabilityZones, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -213,6 +226,7 @@ func TestSgRuleStorageToIpPermission(t *testing.T) {
 		want types.IpPermission
 	}{
 		{name: "test", args: args{sg: SGRuleStorage{GroupID: aws.String("foobar"), FromPort: aws.Int32(8000), ToPort: aws.Int32(8000), IPProtocol: aws.String("tcp")}}, want: types.IpPermission{FromPort: aws.Int32(8000), ToPort: aws.Int32(8000), IpProtocol: aws.String("tcp"), IpRanges: nil}},
+		{name: "group source", args: args{sg: SGRuleStorage{GroupID: aws.String("sg-db"), FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IPProtocol: aws.String("tcp"), GroupPairs: []types.UserIdGroupPair{{GroupId: aws.String("sg-app")}}, IPv6Ranges: []types.Ipv6Range{{CidrIpv6: aws.String("2001:db8::/32")}}}}, want: types.IpPermission{FromPort: aws.Int32(5432), ToPort: aws.Int32(5432), IpProtocol: aws.String("tcp"), UserIdGroupPairs: []types.UserIdGroupPair{{GroupId: aws.String("sg-app")}}, Ipv6Ranges: []types.Ipv6Range{{CidrIpv6: aws.String("2001:db8::/32")}}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -242,3 +256,21 @@ func TestSgRuleStoragesToIpPermissions(t *testing.T) {
 		})
 	}
 }
+
+func TestRemapGroups(t *testing.T) {
+	rule := SGRuleStorage{GroupID: aws.String("sg-db"), GroupPairs: []types.UserIdGroupPair{
+		{GroupId: aws.String("sg-app"), UserId: aws.String("123456789012"), Description: aws.String("app")},
+		{GroupId: aws.String("sg-shared"), UserId: aws.String("123456789012")},
+	}}
+	got := rule.RemapGroups(map[string]string{"sg-app": "sg-app-new"})
+	want := []types.UserIdGroupPair{
+		{GroupId: aws.String("sg-app-new"), Description: aws.String("app")},
+		{GroupId: aws.String("sg-shared"), UserId: aws.String("123456789012")},
+	}
+	if !reflect.DeepEqual(got.GroupPairs, want) {
+		t.Errorf("RemapGroups() = %+v, want %+v", got.GroupPairs, want)
+	}
+	if *rule.GroupPairs[0].GroupId != "sg-app" {
+		t.Error("RemapGroups() changed the rule it was called on")
+	}
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// KindEncrypted is a document holding another document encrypted with a data key
+const KindEncrypted = "lats.Encrypted"
+
+// DataKeys makes and unwraps the data keys objects are encrypted with, aws.KmsOperations is one
+type DataKeys interface {
+	// GenerateDataKey returns a new 256 bit key and the key encrypted under keyID
+	GenerateDataKey(keyID string) ([]byte, []byte, error)
+	// Decrypt unwraps an encrypted data key, keyID is the key it was encrypted under
+	Decrypt(keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// Encryption is how stack objects are encrypted at rest.
+// Objects are written encrypted when KeyID is set, encrypted objects can be read as long as Keys is set
+type Encryption struct {
+	Keys  DataKeys
+	KeyID string
+
+	mu   sync.Mutex
+	keys map[string][]byte // keys caches unwrapped data keys so each is only decrypted once
+}
+
+// Encrypter is used to encrypt and decrypt stack objects, nil leaves objects in plaintext
+var Encrypter *Encryption
+
+// ErrNoEncryption is returned reading an encrypted object when there's no Encrypter to decrypt it
+var ErrNoEncryption = errors.New("object is encrypted and encryption isn't configured")
+
+// encrypted is the data of a KindEncrypted document, the document inside is sealed with AES-256-GCM
+type encrypted struct {
+	KeyID        string `json:"keyId"`        // KeyID is the KMS key the data key is encrypted under
+	EncryptedKey []byte `json:"encryptedKey"` // EncryptedKey is the data key encrypted by KMS
+	Kind         string `json:"kind"`         // Kind is the kind of the document inside so it can be checked without decrypting
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// Encrypting tells if new objects are encrypted
+func Encrypting() bool {
+	return Encrypter != nil && Encrypter.KeyID != ""
+}
+
+// IsEncrypted tells if b is an encrypted document
+func IsEncrypted(b []byte) bool {
+	if !IsDocument(b) {
+		return false
+	}
+	doc, err := ReadDocument(b)
+	return err == nil && doc.Kind == KindEncrypted
+}
+
+// Seal encrypts a document with a new data key, b is returned as is when there's no Encrypter or key
+func Seal(b bytes.Buffer) (bytes.Buffer, error) {
+	if !Encrypting() {
+		return b, nil
+	}
+	e := Encrypter
+	doc, err := ReadDocument(b.Bytes())
+	if err != nil {
+		return b, err
+	}
+	key, encKey, err := e.Keys.GenerateDataKey(e.KeyID)
+	if err != nil {
+		return b, fmt.Errorf("error generating a data key: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return b, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return b, err
+	}
+	return EncodeDocument(KindEncrypted, encrypted{
+		KeyID:        e.KeyID,
+		EncryptedKey: encKey,
+		Kind:         doc.Kind,
+		Nonce:        nonce,
+		// the kind is authenticated so an encrypted object can't be passed off as another kind
+		Ciphertext: gcm.Seal(nil, nonce, b.Bytes(), []byte(doc.Kind)),
+	})
+}
+
+// Open decrypts an encrypted document and returns the document inside
+func Open(b []byte) ([]byte, error) {
+	doc, err := ReadDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	var enc encrypted
+	err = json.Unmarshal(doc.Data, &enc)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encrypted document: %w", err)
+	}
+	e := Encrypter
+	if e == nil || e.Keys == nil {
+		return nil, ErrNoEncryption
+	}
+	key, err := e.dataKey(enc.KeyID, enc.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, enc.Nonce, enc.Ciphertext, []byte(enc.Kind))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting %s: %w", enc.Kind, err)
+	}
+	return plain, nil
+}
+
+func (e *Encryption) dataKey(keyID string, encKey []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if key, ok := e.keys[string(encKey)]; ok {
+		return key, nil
+	}
+	key, err := e.Keys.Decrypt(keyID, encKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting the data key with %s: %w", keyID, err)
+	}
+	if e.keys == nil {
+		e.keys = map[string][]byte{}
+	}
+	e.keys[string(encKey)] = key
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bad data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// fakeKeys wraps data keys by prefixing them with the key ID
+type fakeKeys struct {
+	decrypts int
+}
+
+func (f *fakeKeys) GenerateDataKey(keyID string) ([]byte, []byte, error) {
+	key := bytes.Repeat([]byte{7}, 32)
+	return key, append([]byte(keyID+":"), key...), nil
+}
+
+func (f *fakeKeys) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	f.decrypts++
+	id, key, ok := bytes.Cut(ciphertext, []byte(":"))
+	if !ok || string(id) != keyID {
+		return nil, fmt.Errorf("wrong key")
+	}
+	return key, nil
+}
+
+// useEncryption turns encryption on for the rest of the test
+func useEncryption(t *testing.T, e *Encryption) {
+	old := Encrypter
+	Encrypter = e
+	t.Cleanup(func() { Encrypter = old })
+}
+
+func TestSeal(t *testing.T) {
+	keys := &fakeKeys{}
+	useEncryption(t, &Encryption{Keys: keys, KeyID: "alias/lats"})
+	snap := &types.DBSnapshot{DBSnapshotIdentifier: aws.String("secret-snapshot")}
+	plain, err := EncodeDocument(KindDBSnapshot, snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(plain)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if strings.Contains(sealed.String(), "secret-snapshot") {
+		t.Errorf("sealed document has the plaintext in it")
+	}
+	if !IsEncrypted(sealed.Bytes()) || IsEncrypted(plain.Bytes()) {
+		t.Errorf("IsEncrypted() got the wrong answer")
+	}
+
+	for i := 0; i < 2; i++ {
+		var got types.DBSnapshot
+		err = DecodeDocument(sealed.Bytes(), KindDBSnapshot, &got)
+		if err != nil || *got.DBSnapshotIdentifier != "secret-snapshot" {
+			t.Errorf("DecodeDocument() = %v, %v want secret-snapshot", got.DBSnapshotIdentifier, err)
+		}
+	}
+	if keys.decrypts != 1 {
+		t.Errorf("data key was decrypted %d times expected it to be cached", keys.decrypts)
+	}
+
+	var cluster types.DBCluster
+	err = DecodeDocument(sealed.Bytes(), KindDBCluster, &cluster)
+	if err == nil {
+		t.Errorf("expected an error decoding an encrypted snapshot as a cluster")
+	}
+
+	Encrypter = nil
+	var got types.DBSnapshot
+	err = DecodeDocument(sealed.Bytes(), KindDBSnapshot, &got)
+	if !errors.Is(err, ErrNoEncryption) {
+		t.Errorf("DecodeDocument() without encryption error = %v, want ErrNoEncryption", err)
+	}
+	same, _ := Seal(plain)
+	if !bytes.Equal(same.Bytes(), plain.Bytes()) {
+		t.Errorf("Seal() without encryption should leave the document alone")
+	}
+}
+
+func TestOpen_Tampered(t *testing.T) {
+	useEncryption(t, &Encryption{Keys: &fakeKeys{}, KeyID: "alias/lats"})
+	plain, _ := EncodeDocument(KindDBSnapshot, &types.DBSnapshot{DBSnapshotIdentifier: aws.String("snap")})
+	sealed, _ := Seal(plain)
+	// claiming it holds another kind breaks the authentication
+	tampered := strings.Replace(sealed.String(), `"kind": "rds.DBSnapshot"`, `"kind": "rds.DBCluster"`, 1)
+	if tampered == sealed.String() {
+		t.Fatal("test didn't change the kind")
+	}
+	_, err := Open([]byte(tampered))
+	if err == nil {
+		t.Errorf("expected an error opening a tampered document")
+	}
+}
@@ -0,0 +1,241 @@
+package state
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// Everything lats writes to .state is a JSON document wrapped in an envelope that says what it is
+//
+//	{
+//	  "format": "lats",
+//	  "version": 1,
+//	  "kind": "rds.DBSnapshot",
+//	  "data": { ... }
+//	}
+//
+// data is the object as encoding/json writes it so AWS types keep their SDK field names, null fields are left out.
+// Files written before the JSON format are gob, DecodeDocument reads both.
+
+// FormatName is the format field of every document
+const FormatName = "lats"
+
+// FormatVersion is the version of the documents we write
+const FormatVersion = 1
+
+// Kinds of document, they are part of the format so don't rename them
+const (
+	KindDBInstance                           = "rds.DBInstance"
+	KindDBCluster                            = "rds.DBCluster"
+	KindDBSnapshot                           = "rds.DBSnapshot"
+	KindDBClusterSnapshot                    = "rds.DBClusterSnapshot"
+	KindOptionGroup                          = "rds.OptionGroup"
+	KindCreateDBClusterInput                 = "rds.CreateDBClusterInput"
+	KindCreateDBInstanceInput                = "rds.CreateDBInstanceInput"
+	KindCreateDBInstanceInputs               = "rds.CreateDBInstanceInputs"
+	KindRestoreDBInstanceFromDBSnapshotInput = "rds.RestoreDBInstanceFromDBSnapshotInput"
+	KindRestoreDBClusterFromSnapshotInput    = "rds.RestoreDBClusterFromSnapshotInput"
+	KindParameterGroups                      = "lats.ParameterGroups"
+	KindSecurityGroup                        = "ec2.SecurityGroup"
+	KindSecurityGroups                       = "lats.SecurityGroups"
+	KindSecurityGroupRules                   = "lats.SecurityGroupRules"
+	KindVpc                                  = "ec2.Vpc"
+	KindSubnets                              = "ec2.Subnets"
+	KindInternetGateways                     = "ec2.InternetGateways"
+	KindRouteTables                          = "ec2.RouteTables"
+	KindAvailabilityZones                    = "ec2.AvailabilityZones"
+	KindKmsKey                               = "kms.KeyMetadata"
+	KindStack                                = "lats.Stack"
+	KindOperation                            = "lats.Operation"
+)
+
+// Document is the envelope around every object in .state
+type Document struct {
+	Format  string          `json:"format"`
+	Version int             `json:"version"`
+	Kind    string          `json:"kind"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// EncodeDocument wraps v in a document of kind
+func EncodeDocument(kind string, v interface{}) (bytes.Buffer, error) {
+	var b bytes.Buffer
+	data, err := json.Marshal(v)
+	if err != nil {
+		return b, fmt.Errorf("error encoding %s: %w", kind, err)
+	}
+	data, err = dropNulls(data)
+	if err != nil {
+		return b, fmt.Errorf("error encoding %s: %w", kind, err)
+	}
+	doc := Document{
+		Format:  FormatName,
+		Version: FormatVersion,
+		Kind:    kind,
+		Data:    data,
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return b, fmt.Errorf("error encoding %s: %w", kind, err)
+	}
+	b.Write(out)
+	b.WriteByte('\n')
+	return b, nil
+}
+
+// dropNulls removes null fields, AWS types are mostly nil pointers and the nulls make the files hard to read
+func dropNulls(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(pruneNulls(v))
+}
+
+func pruneNulls(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if val == nil {
+				delete(t, k)
+				continue
+			}
+			t[k] = pruneNulls(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = pruneNulls(val)
+		}
+	}
+	return v
+}
+
+// IsDocument tells JSON documents apart from gob files by reading the envelope, a gob file starts with { when its first message is 123 bytes long
+func IsDocument(b []byte) bool {
+	var env struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(b, &env) == nil && env.Format == FormatName
+}
+
+// ReadDocument reads the envelope without decoding the data
+func ReadDocument(b []byte) (Document, error) {
+	var doc Document
+	err := json.Unmarshal(b, &doc)
+	if err != nil {
+		return doc, fmt.Errorf("error reading document: %w", err)
+	}
+	if doc.Format != FormatName {
+		return doc, fmt.Errorf("not a lats document, format is %q", doc.Format)
+	}
+	if doc.Version > FormatVersion {
+		return doc, &VersionError{Name: fmt.Sprintf("%s document", doc.Kind), Version: doc.Version, Supported: FormatVersion}
+	}
+	if doc.Version < 1 {
+		return doc, fmt.Errorf("%s document has no version", doc.Kind)
+	}
+	return doc, nil
+}
+
+// DecodeDocument decodes b into v, b is either a document of kind, an encrypted document of kind or a gob file from before the JSON format
+func DecodeDocument(b []byte, kind string, v interface{}) error {
+	if !IsDocument(b) {
+		return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+	}
+	doc, err := ReadDocument(b)
+	if err != nil {
+		return err
+	}
+	if doc.Kind == KindEncrypted && kind != KindEncrypted {
+		plain, err := Open(b)
+		if err != nil {
+			return err
+		}
+		return DecodeDocument(plain, kind, v)
+	}
+	if doc.Kind != kind {
+		return fmt.Errorf("document is a %s not a %s", doc.Kind, kind)
+	}
+	err = json.Unmarshal(doc.Data, v)
+	if err != nil {
+		return fmt.Errorf("error decoding %s: %w", kind, err)
+	}
+	return nil
+}
+
+// ErrAlreadyConverted is returned by ConvertFile when the file is already a JSON document
+var ErrAlreadyConverted = errors.New("already a JSON document")
+
+// ConvertFile rewrites a gob file as a document of kind, v is a pointer to the type the file holds
+func ConvertFile(filename string, kind string, v interface{}) error {
+	dat, err := ReadObject(filename)
+	if err != nil {
+		return err
+	}
+	if IsDocument(dat) {
+		return ErrAlreadyConverted
+	}
+	err = DecodeDocument(dat, kind, v)
+	if err != nil {
+		return fmt.Errorf("error decoding %s: %w", filename, err)
+	}
+	b, err := EncodeDocument(kind, v)
+	if err != nil {
+		return err
+	}
+	_, err = WriteOutput(filename, b)
+	return err
+}
+
+// objectKind returns the document kind and a pointer to the type for a StateKV ObjectType
+func objectKind(objType string) (string, interface{}, error) {
+	switch objType {
+	case SnapshotType:
+		return KindDBSnapshot, &types.DBSnapshot{}, nil
+	case RdsInstanceType:
+		return KindDBInstance, &types.DBInstance{}, nil
+	case RdsClusterType:
+		return KindDBCluster, &types.DBCluster{}, nil
+	case KMSKeyType:
+		return KindKmsKey, &kmstypes.KeyMetadata{}, nil
+	case ClusterSnapshotType:
+		return KindDBClusterSnapshot, &types.DBClusterSnapshot{}, nil
+	case SecurityGroupType:
+		return KindSecurityGroup, &ec2types.SecurityGroup{}, nil
+	case OperationType:
+		return KindOperation, &Operation{}, nil
+	}
+	return "", nil, fmt.Errorf("unknown object type %s", objType)
+}
+
+// ConvertObject converts a file the state file points at, objType is the StateKV ObjectType
+func ConvertObject(filename string, objType string) error {
+	kind, v, err := objectKind(objType)
+	if err != nil {
+		return fmt.Errorf("don't know how to convert %s objects", objType)
+	}
+	return ConvertFile(filename, kind, v)
+}
+
+// DecodeObject decodes the contents of a file the state file points at into the type for objType
+func DecodeObject(b []byte, objType string) (interface{}, error) {
+	kind, v, err := objectKind(objType)
+	if err != nil {
+		return nil, err
+	}
+	err = DecodeDocument(b, kind, v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+func TestEncodeDocument(t *testing.T) {
+	snap := types.DBSnapshot{
+		DBSnapshotIdentifier: aws.String("foo"),
+		SnapshotCreateTime:   aws.Time(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+	b, err := EncodeDocument(KindDBSnapshot, &snap)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	if !IsDocument(b.Bytes()) {
+		t.Errorf("expected a JSON document got %s", b.String())
+	}
+	doc, err := ReadDocument(b.Bytes())
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	if doc.Format != FormatName || doc.Version != FormatVersion || doc.Kind != KindDBSnapshot {
+		t.Errorf("got %s %d %s", doc.Format, doc.Version, doc.Kind)
+	}
+	if !strings.Contains(string(doc.Data), `"DBSnapshotIdentifier": "foo"`) {
+		t.Errorf("expected readable data got %s", doc.Data)
+	}
+	if strings.Contains(string(doc.Data), "null") {
+		t.Errorf("expected null fields to be left out got %s", doc.Data)
+	}
+	var got types.DBSnapshot
+	err = DecodeDocument(b.Bytes(), KindDBSnapshot, &got)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if !reflect.DeepEqual(got, snap) {
+		t.Errorf("got %v expected %v", got, snap)
+	}
+}
+
+func TestIsDocument(t *testing.T) {
+	// a gob of a string long enough for its first message to be 123 bytes starts with {
+	var braced bytes.Buffer
+	for n := 0; n < 200; n++ {
+		braced.Reset()
+		if err := gob.NewEncoder(&braced).Encode(strings.Repeat("a", n)); err != nil {
+			t.Fatal(err)
+		}
+		if braced.Bytes()[0] == '{' {
+			break
+		}
+	}
+	if braced.Bytes()[0] != '{' {
+		t.Fatal("no gob starting with {")
+	}
+	doc, err := EncodeDocument(KindDBSnapshot, &types.DBSnapshot{DBSnapshotIdentifier: aws.String("foo")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		b    []byte
+		want bool
+	}{
+		{"document", doc.Bytes(), true},
+		{"whitespace", []byte("\n  " + doc.String() + "\n"), true},
+		{"gob starting with {", braced.Bytes(), false},
+		{"state file", []byte(`{"version": 2, "stateLocations": []}`), false},
+		{"other format", []byte(`{"format": "other", "version": 1}`), false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDocument(tt.b); got != tt.want {
+				t.Errorf("IsDocument() = %v want %v", got, tt.want)
+			}
+		})
+	}
+
+	var got string
+	if err := DecodeDocument(braced.Bytes(), KindDBSnapshot, &got); err != nil || !strings.HasPrefix(got, "a") {
+		t.Errorf("DecodeDocument() of a gob starting with { = %q, %v", got, err)
+	}
+}
+
+func TestDecodeDocument(t *testing.T) {
+	input := &rds.RestoreDBInstanceFromDBSnapshotInput{DBInstanceIdentifier: aws.String("foo")}
+	var legacy bytes.Buffer
+	if err := gob.NewEncoder(&legacy).Encode(input); err != nil {
+		t.Fatalf("gob error: %s", err)
+	}
+	current, _ := EncodeDocument(KindRestoreDBInstanceFromDBSnapshotInput, input)
+	future := []byte(`{"format":"lats","version":99,"kind":"rds.RestoreDBInstanceFromDBSnapshotInput","data":{}}`)
+	other := []byte(`{"format":"terraform","version":1,"kind":"rds.RestoreDBInstanceFromDBSnapshotInput","data":{}}`)
+
+	tests := []struct {
+		name    string
+		b       []byte
+		kind    string
+		wantErr bool
+	}{
+		{name: "json", b: current.Bytes(), kind: KindRestoreDBInstanceFromDBSnapshotInput, wantErr: false},
+		{name: "gob", b: legacy.Bytes(), kind: KindRestoreDBInstanceFromDBSnapshotInput, wantErr: false},
+		{name: "wrongKind", b: current.Bytes(), kind: KindDBSnapshot, wantErr: true},
+		{name: "newerVersion", b: future, kind: KindRestoreDBInstanceFromDBSnapshotInput, wantErr: true},
+		{name: "notLats", b: other, kind: KindRestoreDBInstanceFromDBSnapshotInput, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got rds.RestoreDBInstanceFromDBSnapshotInput
+			err := DecodeDocument(tt.b, tt.kind, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *got.DBInstanceIdentifier != "foo" {
+				t.Errorf("got %s expected foo", *got.DBInstanceIdentifier)
+			}
+		})
+	}
+}
+
+func TestConvertObject(t *testing.T) {
+	filename := "/tmp/convert-snapshot"
+	defer os.Remove(filename)
+	snap := types.DBSnapshot{DBSnapshotIdentifier: aws.String("foo")}
+	var legacy bytes.Buffer
+	if err := gob.NewEncoder(&legacy).Encode(&snap); err != nil {
+		t.Fatalf("gob error: %s", err)
+	}
+	WriteOutput(filename, legacy)
+
+	err := ConvertObject(filename, SnapshotType)
+	if err != nil {
+		t.Fatalf("convert error: %s", err)
+	}
+	dat, _ := os.ReadFile(filename)
+	if !IsDocument(dat) {
+		t.Errorf("expected %s to be JSON", filename)
+	}
+	got := DecodeRDSSnapshotOutput(*bytes.NewBuffer(dat))
+	if *got.DBSnapshotIdentifier != "foo" {
+		t.Errorf("got %s expected foo", *got.DBSnapshotIdentifier)
+	}
+	if err := ConvertObject(filename, SnapshotType); err != ErrAlreadyConverted {
+		t.Errorf("got %v expected %v", err, ErrAlreadyConverted)
+	}
+	if err := ConvertObject(filename, "NotAType"); err == nil {
+		t.Errorf("expected an error for an unknown type")
+	}
+}
@@ -0,0 +1,169 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StackType is the ObjectType of stacks in the state file
+const StackType = "stack"
+
+// StackInfo is what the state file keeps about a stack so finding one doesn't mean reading every stack file
+type StackInfo struct {
+	Name            string        `json:"name"`
+	RestorationType string        `json:"restorationType"` // RestorationType is the stack's RestorationObjectName like SingleRDSInstance or RDSCluster
+	Objects         int           `json:"objects"`
+	Metadata        StackMetadata `json:"metadata,omitzero"`
+}
+
+// StackMetadata is what a stack records about its snapshot and who made it when it's created or copied, stacks from older lats have none.
+// Times are UTC so state entries holding it still compare equal after a round trip through the state file
+type StackMetadata struct {
+	AccountID       string    `json:"accountId,omitempty"`
+	SourceRegion    string    `json:"sourceRegion,omitempty"` // SourceRegion is where the database the snapshot was taken from runs
+	Region          string    `json:"region,omitempty"`       // Region is where the stack's snapshot is, it's the backup region for copies
+	Database        string    `json:"database,omitempty"`     // Database is the identifier of the instance or cluster
+	Snapshot        string    `json:"snapshot,omitempty"`
+	CopyOf          string    `json:"copyOf,omitempty"` // CopyOf is the stack this one is a copy of
+	Engine          string    `json:"engine,omitempty"`
+	EngineVersion   string    `json:"engineVersion,omitempty"`
+	StorageGB       int32     `json:"storageGb,omitempty"`
+	KmsKeyID        string    `json:"kmsKeyId,omitempty"`
+	SnapshotCreated time.Time `json:"snapshotCreated,omitzero"`
+	Created         time.Time `json:"created,omitzero"`    // Created is when lats wrote the stack
+	CreatedBy       string    `json:"createdBy,omitempty"` // CreatedBy is the ARN lats was running as
+	LatsVersion     string    `json:"latsVersion,omitempty"`
+}
+
+// SnapshotMissing is the status of a snapshot refresh couldn't find in any region
+const SnapshotMissing = "missing"
+
+// SnapshotInfo is what lats state refresh last saw of a stack's snapshot in AWS
+type SnapshotInfo struct {
+	ID        string    `json:"id"`
+	Region    string    `json:"region,omitempty"`
+	Status    string    `json:"status"`           // Status is the snapshot's status in AWS like available, or SnapshotMissing
+	SizeGB    int32     `json:"sizeGb,omitempty"` // SizeGB is the allocated storage of the snapshot
+	Created   time.Time `json:"created,omitzero"`
+	Refreshed time.Time `json:"refreshed"` // Refreshed is when refresh looked, times are UTC so entries still compare equal after a round trip through the state file
+}
+
+// readStackInfo reads the info of a stack document, gob stacks from older lats have none
+func readStackInfo(b []byte) StackInfo {
+	if !IsDocument(b) {
+		return StackInfo{}
+	}
+	doc, err := ReadDocument(b)
+	if err != nil || doc.Kind != KindStack {
+		return StackInfo{}
+	}
+	var s struct {
+		Name                  string            `json:"name"`
+		RestorationObjectName string            `json:"restorationObjectName"`
+		Objects               []json.RawMessage `json:"objects"`
+		Metadata              StackMetadata     `json:"metadata"`
+	}
+	if json.Unmarshal(doc.Data, &s) != nil {
+		return StackInfo{}
+	}
+	md := s.Metadata
+	md.SnapshotCreated = md.SnapshotCreated.UTC()
+	md.Created = md.Created.UTC()
+	return StackInfo{Name: s.Name, RestorationType: s.RestorationObjectName, Objects: len(s.Objects), Metadata: md}
+}
+
+// NotFoundError is returned when nothing in the state file has the type and name asked for, it matches ErrNotFound
+type NotFoundError struct {
+	ObjectType string
+	Name       string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no %s called %s in the state file", e.ObjectType, e.Name)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+type indexKey struct {
+	objectType string
+	name       string
+}
+
+// indexName is the name an entry is found by, stacks use the name in their info and fall back to the object name for state from older lats
+func indexName(kv StateKV) string {
+	if kv.ObjectType == StackType && kv.Stack.Name != "" {
+		return kv.Stack.Name
+	}
+	return kv.Object
+}
+
+// lookup finds the entries of a type with a name oldest first, the index is built the first time and dropped whenever the locations change.
+// Callers hold Mu
+func (s *StateManager) lookup(ot string, name string) []StateKV {
+	if s.index == nil {
+		s.index = map[indexKey][]int{}
+		for i, kv := range s.StateLocations {
+			k := indexKey{kv.ObjectType, indexName(kv)}
+			s.index[k] = append(s.index[k], i)
+		}
+	}
+	kvs := []StateKV{}
+	for _, i := range s.index[indexKey{ot, name}] {
+		kvs = append(kvs, s.StateLocations[i])
+	}
+	return kvs
+}
+
+// Lookup returns the entries in the state file of type ot called name oldest first, it's a NotFoundError when there aren't any
+func (s *StateManager) Lookup(ot string, name string) ([]StateKV, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	kvs := s.lookup(ot, name)
+	if len(kvs) == 0 {
+		return nil, &NotFoundError{ObjectType: ot, Name: name}
+	}
+	return kvs, nil
+}
+
+// FindStack returns the newest stack called name
+func (s *StateManager) FindStack(name string) (StateKV, error) {
+	kvs, err := s.Lookup(StackType, name)
+	if err != nil {
+		return StateKV{}, err
+	}
+	return kvs[len(kvs)-1], nil
+}
+
+// Remove drops the entries of type ot called name and returns them, their files are left for gc
+func (s *StateManager) Remove(ot string, name string) []StateKV {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	removed := []StateKV{}
+	kept := []StateKV{}
+	for _, kv := range s.StateLocations {
+		if kv.ObjectType == ot && indexName(kv) == name {
+			removed = append(removed, kv)
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	s.StateLocations = kept
+	s.index = nil
+	return removed
+}
+
+// SetSnapshot records what refresh saw of the snapshot of the stack in filename
+func (s *StateManager) SetSnapshot(filename string, info SnapshotInfo) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	info.Created = info.Created.UTC()
+	info.Refreshed = info.Refreshed.UTC()
+	for i, kv := range s.StateLocations {
+		if kv.ObjectType == StackType && kv.FileLocation == filename {
+			s.StateLocations[i].Snapshot = info
+		}
+	}
+}
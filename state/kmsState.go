@@ -2,7 +2,6 @@ package state
 
 import (
 	"bytes"
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -12,10 +11,7 @@ import (
 
 // EncodeKmsOutput encodes the output of KMS into a bytes.Buffer for writing
 func EncodeKmsOutput(kmd *types.KeyMetadata) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(kmd)
+	encoder, err := EncodeDocument(KindKmsKey, kmd)
 	if err != nil {
 		slog.Error("Error encoding our database:", "Error", err)
 	}
@@ -25,8 +21,7 @@ func EncodeKmsOutput(kmd *types.KeyMetadata) bytes.Buffer {
 // DecodeKmsOutput takes bytes and turns them into KeyMetadata
 func DecodeKmsOutput(b bytes.Buffer) types.KeyMetadata {
 	var kmsMetadata types.KeyMetadata
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&kmsMetadata)
+	err := DecodeDocument(b.Bytes(), KindKmsKey, &kmsMetadata)
 	if err != nil {
 		slog.Error("Error decoding state for KMS Key:", "error", err)
 	}
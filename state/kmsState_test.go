@@ -1,7 +1,6 @@
 package state
 
 import (
-	"encoding/gob"
 	"os"
 	"sync"
 	"testing"
@@ -16,8 +15,7 @@ func TestEncodeKmsOutput(t *testing.T) {
 	}
 	b := EncodeKmsOutput(&kmd)
 	var result types.KeyMetadata
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&result)
+	err := DecodeDocument(b.Bytes(), KindKmsKey, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -59,8 +57,8 @@ func TestGetKmsKeyOutput(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 	newKmd, err := GetKmsOutput(&sm, "foo")
 	if err != nil {
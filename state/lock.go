@@ -0,0 +1,167 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LockTimeout is how long we wait for another lats to release the state lock
+var LockTimeout = 10 * time.Second
+
+// LockOperation is recorded in the lock so whoever is waiting knows what holds it
+var LockOperation = "lats"
+
+var lockPollInterval = 100 * time.Millisecond
+
+// LockInfo is written to the lock file by whoever holds the lock
+type LockInfo struct {
+	ID        string    `json:"id"`
+	Who       string    `json:"who"`
+	PID       int       `json:"pid"`
+	Operation string    `json:"operation"`
+	Created   time.Time `json:"created"`
+}
+
+func (i LockInfo) String() string {
+	return fmt.Sprintf("%s (pid %d) running %s since %s, lock id %s", i.Who, i.PID, i.Operation, i.Created.Local().Format(time.RFC3339), i.ID)
+}
+
+// LockError is returned when the lock is still held after the timeout
+type LockError struct {
+	Path string
+	Info LockInfo
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("state is locked by %s, wait for it to finish or if it's stale run lats state force-unlock %s", e.Info, e.Info.ID)
+}
+
+// Lock is an advisory lock on the state directory, it only keeps out other lats processes that take it
+type Lock struct {
+	Path string
+	Info LockInfo
+}
+
+// LockPath is the lock file for the directory the state file is in
+func LockPath(filename string) string {
+	if b, ok := Backend.(LocalBackend); ok {
+		filename = b.path(filename)
+	}
+	return filepath.Join(filepath.Dir(filename), ".lats.lock")
+}
+
+func newLockInfo() LockInfo {
+	who := "unknown"
+	if u, err := user.Current(); err == nil {
+		who = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		who = fmt.Sprintf("%s@%s", who, h)
+	}
+	return LockInfo{
+		ID:        uuid.New().String(),
+		Who:       who,
+		PID:       os.Getpid(),
+		Operation: LockOperation,
+		Created:   time.Now().UTC(),
+	}
+}
+
+// AcquireLock takes the lock for the state file's directory, waiting up to timeout for whoever holds it
+func AcquireLock(filename string, timeout time.Duration) (*Lock, error) {
+	path := LockPath(filename)
+	info := newLockInfo()
+	b, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.Write(b)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("error writing lock %s: %w", path, err)
+			}
+			return &Lock{Path: path, Info: info}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("error creating lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			held, err := ReadLock(filename)
+			if err != nil {
+				return nil, fmt.Errorf("state is locked, error reading lock %s: %w", path, err)
+			}
+			return nil, &LockError{Path: path, Info: *held}
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Unlock releases the lock if we still hold it
+func (l *Lock) Unlock() error {
+	held, err := readLockFile(l.Path)
+	if err != nil {
+		return err
+	}
+	if held.ID != l.Info.ID {
+		return fmt.Errorf("lock %s is held by %s, it was force unlocked", l.Path, held)
+	}
+	return os.Remove(l.Path)
+}
+
+// ReadLock returns who holds the lock for the state file's directory, the error is fs.ErrNotExist when nobody does
+func ReadLock(filename string) (*LockInfo, error) {
+	return readLockFile(LockPath(filename))
+}
+
+func readLockFile(path string) (*LockInfo, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info LockInfo
+	err = json.Unmarshal(dat, &info)
+	if err != nil {
+		return nil, fmt.Errorf("error reading lock %s: %w", path, err)
+	}
+	return &info, nil
+}
+
+// ForceUnlock removes a stale lock, id has to match the lock so we don't remove one that was taken since
+func ForceUnlock(filename string, id string) error {
+	held, err := ReadLock(filename)
+	if err != nil {
+		return err
+	}
+	if held.ID != id {
+		return fmt.Errorf("lock id is %s not %s, the lock is held by %s", held.ID, id, held)
+	}
+	return os.Remove(LockPath(filename))
+}
+
+// WithLock runs fn holding the state lock
+func WithLock(filename string, fn func() error) error {
+	lock, err := AcquireLock(filename, LockTimeout)
+	if err != nil {
+		return err
+	}
+	err = fn()
+	if uerr := lock.Unlock(); uerr != nil {
+		err = errors.Join(err, uerr)
+	}
+	return err
+}
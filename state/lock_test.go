@@ -0,0 +1,228 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	lock, err := AcquireLock(filename, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	_, err = AcquireLock(filename, 50*time.Millisecond)
+	var lerr *LockError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("AcquireLock() error = %v, want a LockError", err)
+	}
+	if lerr.Info.ID != lock.Info.ID {
+		t.Errorf("LockError has lock id %s want %s", lerr.Info.ID, lock.Info.ID)
+	}
+
+	err = lock.Unlock()
+	if err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	lock, err = AcquireLock(filename, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() after unlock error = %v", err)
+	}
+	lock.Unlock()
+}
+
+func TestAcquireLock_Waits(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	lock, err := AcquireLock(filename, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lock.Unlock()
+	}()
+	second, err := AcquireLock(filename, 5*time.Second)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v, expected it to wait for the lock", err)
+	}
+	second.Unlock()
+}
+
+func TestForceUnlock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	lock, err := AcquireLock(filename, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	err = ForceUnlock(filename, "wrong")
+	if err == nil {
+		t.Errorf("expected an error force unlocking with the wrong id")
+	}
+	err = ForceUnlock(filename, lock.Info.ID)
+	if err != nil {
+		t.Fatalf("ForceUnlock() error = %v", err)
+	}
+	if lock.Unlock() == nil {
+		t.Errorf("expected an error unlocking a lock that was force unlocked")
+	}
+}
+
+func TestSyncState_Merges(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	err := InitState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := ReadState(filename)
+	second, _ := ReadState(filename)
+	first.UpdateState("a", "/tmp/a", SnapshotType)
+	second.UpdateState("b", "/tmp/b", SnapshotType)
+	if err := first.SyncState(filename); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	if err := second.SyncState(filename); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	sm, err := ReadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.StateLocations) != 2 {
+		t.Fatalf("expected both objects after merging got %v", sm.StateLocations)
+	}
+
+	// objects removed from a state we read stay removed
+	sm.StateLocations = sm.StateLocations[:1]
+	if err := sm.SyncState(filename); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	sm, _ = ReadState(filename)
+	if len(sm.StateLocations) != 1 {
+		t.Errorf("expected the removed object to stay removed got %v", sm.StateLocations)
+	}
+}
+
+func TestSyncState_Concurrent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	err := InitState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sm, err := ReadState(filename)
+			if err != nil {
+				t.Errorf("ReadState() error = %v", err)
+				return
+			}
+			sm.UpdateState(fmt.Sprintf("obj-%d", i), fmt.Sprintf("/tmp/obj-%d", i), SnapshotType)
+			if err := sm.SyncState(filename); err != nil {
+				t.Errorf("SyncState() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	sm, err := ReadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.StateLocations) != 10 {
+		t.Errorf("expected 10 objects got %d", len(sm.StateLocations))
+	}
+}
+
+func TestMergeState(t *testing.T) {
+	a := StateKV{Object: "a", FileLocation: "/tmp/a", ObjectType: StackType}
+	b := StateKV{Object: "b", FileLocation: "/tmp/b", ObjectType: StackType}
+	refreshed := a
+	refreshed.Snapshot = SnapshotInfo{ID: "a", Status: "available"}
+	rehashed := a
+	rehashed.Checksum = "new"
+	renamed := a
+	renamed.Object = "c"
+	tests := []struct {
+		name  string
+		base  []StateKV
+		disk  []StateKV
+		local []StateKV
+		want  []StateKV
+	}{
+		{"nothing changed", []StateKV{a}, []StateKV{a}, []StateKV{a}, []StateKV{a}},
+		{"added on both sides", []StateKV{a}, []StateKV{a, b}, []StateKV{a, renamed}, []StateKV{renamed, b}},
+		{"changed on disk", []StateKV{a}, []StateKV{refreshed}, []StateKV{a}, []StateKV{refreshed}},
+		{"changed by us", []StateKV{a}, []StateKV{a}, []StateKV{rehashed}, []StateKV{rehashed}},
+		{"changed on both sides", []StateKV{a}, []StateKV{refreshed}, []StateKV{rehashed}, []StateKV{rehashed}},
+		{"renamed on disk", []StateKV{a, b}, []StateKV{renamed, b}, []StateKV{a, b}, []StateKV{renamed, b}},
+		{"removed on disk", []StateKV{a, b}, []StateKV{b}, []StateKV{a, b}, []StateKV{b}},
+		{"removed on disk and changed by us", []StateKV{a}, []StateKV{}, []StateKV{rehashed}, []StateKV{}},
+		{"removed by us", []StateKV{a, b}, []StateKV{refreshed, b}, []StateKV{b}, []StateKV{b}},
+		{"duplicates collapse", nil, []StateKV{a, rehashed}, []StateKV{}, []StateKV{rehashed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeState(tt.base, tt.disk, tt.local)
+			if len(got) != len(tt.want) {
+				t.Fatalf("mergeState() = %+v want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("mergeState()[%d] = %+v want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSyncState_ChangedElsewhere(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".state.json")
+	if err := InitState(filename); err != nil {
+		t.Fatal(err)
+	}
+	sm, _ := ReadState(filename)
+	sm.UpdateState("a", "/tmp/a", StackType)
+	sm.UpdateState("b", "/tmp/b", StackType)
+	if err := sm.SyncState(filename); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := ReadState(filename)
+	second, _ := ReadState(filename)
+
+	// a refresh in one lats while another adds a stack
+	first.SetSnapshot("/tmp/a", SnapshotInfo{ID: "a", Status: "available"})
+	if err := first.SyncState(filename); err != nil {
+		t.Fatal(err)
+	}
+	second.UpdateState("c", "/tmp/c", StackType)
+	if err := second.SyncState(filename); err != nil {
+		t.Fatal(err)
+	}
+	sm, _ = ReadState(filename)
+	a, err := sm.Lookup(StackType, "a")
+	if err != nil || len(a) != 1 || a[0].Snapshot.Status != "available" || len(sm.StateLocations) != 3 {
+		t.Errorf("expected one refreshed a and c got %+v", sm.StateLocations)
+	}
+
+	// a state rm in one lats isn't undone by another that still has it
+	first, _ = ReadState(filename)
+	second, _ = ReadState(filename)
+	first.Remove(StackType, "b")
+	if err := first.SyncState(filename); err != nil {
+		t.Fatal(err)
+	}
+	second.SetSnapshot("/tmp/a", SnapshotInfo{ID: "a", Status: "deleted"})
+	if err := second.SyncState(filename); err != nil {
+		t.Fatal(err)
+	}
+	sm, _ = ReadState(filename)
+	if _, err := sm.Lookup(StackType, "b"); !errors.Is(err, ErrNotFound) || len(sm.StateLocations) != 2 {
+		t.Errorf("expected b to stay removed got %+v", sm.StateLocations)
+	}
+}
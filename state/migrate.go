@@ -0,0 +1,127 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// StateVersion is the layout of the state file this lats writes
+// 1 was a bare list of StateKV, 2 wraps the list in an object with a version
+const StateVersion = 2
+
+// VersionError is returned for files written by a newer lats, we refuse to touch them so we don't corrupt them
+type VersionError struct {
+	Name      string
+	Version   int
+	Supported int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s is version %d but this lats only understands up to version %d, upgrade lats", e.Name, e.Version, e.Supported)
+}
+
+// Migration upgrades a file from version From to From+1
+type Migration struct {
+	From        int
+	Description string
+	Up          func([]byte) ([]byte, error)
+}
+
+// Migrations is the chain of migrations for one kind of file
+type Migrations struct {
+	Name    string
+	Current int
+	Version func([]byte) (int, error) // Version detects what version a file is
+	Steps   []Migration
+}
+
+// Plan returns the steps that take a file at version from to Current in order
+func (m Migrations) Plan(from int) ([]Migration, error) {
+	if from > m.Current {
+		return nil, &VersionError{Name: m.Name, Version: from, Supported: m.Current}
+	}
+	steps := []Migration{}
+	for v := from; v < m.Current; v++ {
+		found := false
+		for _, s := range m.Steps {
+			if s.From == v {
+				steps = append(steps, s)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no migration for %s from version %d", m.Name, v)
+		}
+	}
+	return steps, nil
+}
+
+// Migrate upgrades b to Current one step at a time, it returns the upgraded bytes and the version b was at
+func (m Migrations) Migrate(b []byte) ([]byte, int, error) {
+	from, err := m.Version(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	steps, err := m.Plan(from)
+	if err != nil {
+		return nil, from, err
+	}
+	for _, s := range steps {
+		b, err = s.Up(b)
+		if err != nil {
+			return nil, from, fmt.Errorf("error migrating %s from version %d: %w", m.Name, s.From, err)
+		}
+	}
+	return b, from, nil
+}
+
+// stateFile is the layout of the state file on disk
+type stateFile struct {
+	Version        int       `json:"version"`
+	StateLocations []StateKV `json:"stateLocations"`
+}
+
+// StateMigrations upgrades the state file
+var StateMigrations = Migrations{
+	Name:    "state file",
+	Current: StateVersion,
+	Version: StateFileVersion,
+	Steps: []Migration{
+		{
+			From:        1,
+			Description: "wrap the list of state locations in an object with a version",
+			Up: func(b []byte) ([]byte, error) {
+				var kvs []StateKV
+				err := json.Unmarshal(b, &kvs)
+				if err != nil {
+					return nil, err
+				}
+				return json.Marshal(stateFile{Version: 2, StateLocations: kvs})
+			},
+		},
+	},
+}
+
+// StateFileVersion detects the version of a state file, version 1 files are a bare list
+func StateFileVersion(b []byte) (int, error) {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if len(b) == 0 {
+		return 0, fmt.Errorf("state file is empty")
+	}
+	if b[0] == '[' {
+		return 1, nil
+	}
+	var v struct {
+		Version int `json:"version"`
+	}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return 0, fmt.Errorf("error reading state file version: %w", err)
+	}
+	if v.Version < 1 {
+		return 0, fmt.Errorf("state file has no version")
+	}
+	return v.Version, nil
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStateFileVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       string
+		want    int
+		wantErr bool
+	}{
+		{name: "list", b: `[{"object":"foo"}]`, want: 1, wantErr: false},
+		{name: "versioned", b: `{"version":2,"stateLocations":[]}`, want: 2, wantErr: false},
+		{name: "future", b: `{"version":7}`, want: 7, wantErr: false},
+		{name: "noVersion", b: `{}`, want: 0, wantErr: true},
+		{name: "empty", b: ``, want: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StateFileVersion([]byte(tt.b))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StateFileVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("StateFileVersion() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrations_Plan(t *testing.T) {
+	m := Migrations{
+		Name:    "test",
+		Current: 3,
+		Steps:   []Migration{{From: 2}, {From: 1}},
+	}
+	steps, err := m.Plan(1)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if len(steps) != 2 || steps[0].From != 1 || steps[1].From != 2 {
+		t.Errorf("Plan() = %v expected the steps from 1 then 2", steps)
+	}
+	if steps, _ := m.Plan(3); len(steps) != 0 {
+		t.Errorf("Plan() = %v expected nothing to do", steps)
+	}
+	_, err = m.Plan(4)
+	var verr *VersionError
+	if !errors.As(err, &verr) {
+		t.Errorf("Plan() error = %v expected a VersionError", err)
+	}
+	_, err = Migrations{Name: "gap", Current: 3, Steps: []Migration{{From: 1}}}.Plan(1)
+	if err == nil {
+		t.Errorf("expected an error for a missing migration")
+	}
+}
+
+func TestReadStateMigrates(t *testing.T) {
+	filename := "/tmp/.stateConfV1.json"
+	defer os.Remove(filename)
+	kvs := []StateKV{{Object: "foo", FileLocation: ".state/foo.json", ObjectType: "stack"}}
+	b, _ := json.Marshal(kvs)
+	os.WriteFile(filename, b, 0644)
+
+	sm, err := ReadState(filename)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if !reflect.DeepEqual(sm.StateLocations, kvs) {
+		t.Errorf("got %v expected %v", sm.StateLocations, kvs)
+	}
+	err = sm.SyncState(filename)
+	if err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	dat, _ := os.ReadFile(filename)
+	if v, _ := StateFileVersion(dat); v != StateVersion {
+		t.Errorf("got version %d expected %d", v, StateVersion)
+	}
+}
+
+func TestRefuseNewerState(t *testing.T) {
+	filename := "/tmp/.stateConfFuture.json"
+	defer os.Remove(filename)
+	future := []byte(`{"version":99,"stateLocations":[],"somethingNew":true}`)
+	os.WriteFile(filename, future, 0644)
+
+	_, err := ReadState(filename)
+	var verr *VersionError
+	if !errors.As(err, &verr) {
+		t.Errorf("ReadState() error = %v expected a VersionError", err)
+	}
+	sm := StateManager{Mu: &sync.Mutex{}}
+	err = sm.SyncState(filename)
+	if !errors.As(err, &verr) {
+		t.Errorf("SyncState() error = %v expected a VersionError", err)
+	}
+	dat, _ := os.ReadFile(filename)
+	if string(dat) != string(future) {
+		t.Errorf("state from a newer lats was overwritten with %s", dat)
+	}
+}
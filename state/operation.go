@@ -0,0 +1,119 @@
+package state
+
+import (
+	"fmt"
+	"time"
+)
+
+// OperationType is the ObjectType of operations in the state file
+const OperationType = "operation"
+
+// Kinds of operation
+const (
+	OpCreateSnapshot = "create-snapshot"
+	OpCopySnapshot   = "copy-snapshot"
+	OpRestore        = "restore"
+)
+
+// Operation statuses
+const (
+	OpRunning   = "running"
+	OpSucceeded = "succeeded"
+	OpFailed    = "failed"
+	OpCancelled = "cancelled"
+)
+
+// OperationResource is something an operation started in AWS and is waiting on
+type OperationResource struct {
+	Type   string `json:"type"` // Type is DBSnapshot, DBClusterSnapshot, DBInstance or DBCluster
+	ID     string `json:"id"`
+	ARN    string `json:"arn,omitempty"`
+	Region string `json:"region"`
+	Status string `json:"status,omitempty"` // Status is what AWS said the last time we looked
+}
+
+// Operation is a create, copy or restore lats started in AWS.
+// It's recorded so another lats can wait on it when the one that started it didn't wait or died
+type Operation struct {
+	ID        string              `json:"id"`
+	Kind      string              `json:"kind"`
+	Status    string              `json:"status"`
+	Params    map[string]string   `json:"params,omitempty"` // Params are the flags the command was run with
+	Stack     string              `json:"stack,omitempty"`  // Stack is the stack the operation wrote or restores
+	Resources []OperationResource `json:"resources"`
+	Error     string              `json:"error,omitempty"`
+	Created   time.Time           `json:"created"`
+	Updated   time.Time           `json:"updated"`
+	Finished  time.Time           `json:"finished,omitzero"`
+}
+
+// Done is true when there's nothing left to wait for
+func (o Operation) Done() bool {
+	return o.Status != OpRunning
+}
+
+// OperationInfo is what the state file keeps about an operation so listing them doesn't mean reading every operation file.
+// Times are UTC so entries still compare equal after a round trip through the state file
+type OperationInfo struct {
+	ID      string    `json:"id"`
+	Kind    string    `json:"kind"`
+	Status  string    `json:"status"`
+	Stack   string    `json:"stack,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// readOperationInfo reads the info of an operation document
+func readOperationInfo(b []byte) OperationInfo {
+	var o Operation
+	if err := DecodeDocument(b, KindOperation, &o); err != nil {
+		return OperationInfo{}
+	}
+	return OperationInfo{ID: o.ID, Kind: o.Kind, Status: o.Status, Stack: o.Stack, Created: o.Created.UTC(), Updated: o.Updated.UTC()}
+}
+
+// WriteOperation writes an operation document to filename, call Rehash after rewriting one the state file already points at
+func WriteOperation(filename string, o Operation) error {
+	b, err := EncodeDocument(KindOperation, o)
+	if err != nil {
+		return err
+	}
+	_, err = WriteOutput(filename, b)
+	return err
+}
+
+// ReadOperation reads an operation document
+func ReadOperation(filename string) (Operation, error) {
+	var o Operation
+	dat, err := ReadObject(filename)
+	if err != nil {
+		return o, err
+	}
+	err = DecodeDocument(dat, KindOperation, &o)
+	if err != nil {
+		return o, fmt.Errorf("error decoding operation %s: %w", filename, err)
+	}
+	return o, nil
+}
+
+// FindOperation returns the entry of the operation with id
+func (s *StateManager) FindOperation(id string) (StateKV, error) {
+	kvs, err := s.Lookup(OperationType, id)
+	if err != nil {
+		return StateKV{}, err
+	}
+	return kvs[0], nil
+}
+
+// Operations returns the entry of every operation oldest first
+func (s *StateManager) Operations() []StateKV {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	ops := []StateKV{}
+	for _, kv := range s.StateLocations {
+		if kv.ObjectType == OperationType {
+			ops = append(ops, kv)
+		}
+	}
+	return ops
+}
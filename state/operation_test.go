@@ -0,0 +1,115 @@
+package state
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOperation(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2024, 6, 1, 5, 0, 0, 0, time.UTC)
+	op := Operation{
+		ID:        "op-1",
+		Kind:      OpCopySnapshot,
+		Status:    OpRunning,
+		Params:    map[string]string{"snapshot": "nightly", "new-snapshot": "nightly-copy"},
+		Stack:     "nightly-copy",
+		Resources: []OperationResource{{Type: "DBSnapshot", ID: "nightly-copy", Region: "us-west-2", Status: "copying"}},
+		Created:   created,
+		Updated:   created,
+	}
+	fn := dir + "/op-1.json"
+	if err := WriteOperation(fn, op); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadOperation(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != op.ID || got.Params["new-snapshot"] != "nightly-copy" || len(got.Resources) != 1 || got.Resources[0].Status != "copying" || got.Done() {
+		t.Errorf("ReadOperation() = %+v", got)
+	}
+
+	sm := StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState(op.ID, fn, OperationType)
+	kv, err := sm.FindOperation("op-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OperationInfo{ID: "op-1", Kind: OpCopySnapshot, Status: OpRunning, Stack: "nightly-copy", Created: created, Updated: created}
+	if kv.Operation != want || kv.Checksum == "" {
+		t.Errorf("FindOperation() = %+v want %+v", kv.Operation, want)
+	}
+
+	op.Status, op.Updated = OpSucceeded, created.Add(time.Hour)
+	if err := WriteOperation(fn, op); err != nil {
+		t.Fatal(err)
+	}
+	sm.Rehash(fn)
+	kv, _ = sm.FindOperation("op-1")
+	if kv.Operation.Status != OpSucceeded {
+		t.Errorf("Rehash() left the operation %s", kv.Operation.Status)
+	}
+	if _, err := sm.FindOperation("op-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindOperation() error = %v want %v", err, ErrNotFound)
+	}
+	if dat, _ := ReadObject(fn); dat != nil {
+		if _, err := DecodeObject(dat, OperationType); err != nil {
+			t.Errorf("DecodeObject() error = %v", err)
+		}
+	}
+}
+
+func TestOperations(t *testing.T) {
+	sm := StateManager{Mu: &sync.Mutex{}, StateLocations: []StateKV{
+		{Object: "op-1", FileLocation: "/tmp/op-1", ObjectType: OperationType, Operation: OperationInfo{ID: "op-1", Status: OpSucceeded}},
+		{Object: "nightly", FileLocation: "/tmp/nightly", ObjectType: StackType},
+		{Object: "op-2", FileLocation: "/tmp/op-2", ObjectType: OperationType, Operation: OperationInfo{ID: "op-2", Status: OpRunning}},
+	}}
+	ops := sm.Operations()
+	if len(ops) != 2 || ops[0].Object != "op-1" || ops[1].Object != "op-2" {
+		t.Errorf("Operations() = %+v", ops)
+	}
+}
+
+func TestOperations_ConcurrentUpdates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	created := time.Date(2024, 6, 1, 5, 0, 0, 0, time.UTC)
+	op := Operation{ID: "op-1", Kind: OpCopySnapshot, Status: OpRunning, Created: created, Updated: created}
+	fn := ".state/op-1.json"
+	if err := WriteOperation(fn, op); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitState(".state.json"); err != nil {
+		t.Fatal(err)
+	}
+	sm, _ := ReadState(".state.json")
+	sm.UpdateState(op.ID, fn, OperationType)
+	if err := sm.SyncState(".state.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	// two lats polling the same operation each record what they saw
+	first, _ := ReadState(".state.json")
+	second, _ := ReadState(".state.json")
+	for i, sm := range []*StateManager{&first, &second} {
+		op.Updated = created.Add(time.Duration(i+1) * time.Minute)
+		if i == 1 {
+			op.Status = OpSucceeded
+		}
+		if err := WriteOperation(fn, op); err != nil {
+			t.Fatal(err)
+		}
+		sm.Rehash(fn)
+		if err := sm.SyncState(".state.json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sm, _ = ReadState(".state.json")
+	ops := sm.Operations()
+	if len(ops) != 1 || len(sm.StateLocations) != 1 || ops[0].Operation.Status != OpSucceeded {
+		t.Errorf("expected the operation once and succeeded got %+v", sm.StateLocations)
+	}
+}
@@ -0,0 +1,203 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+)
+
+// Metadata is what we can tell about an object from its document
+type Metadata struct {
+	Kind    string    `json:"kind,omitempty"`
+	Engine  string    `json:"engine,omitempty"`
+	Created time.Time `json:"created,omitempty"`
+}
+
+// createTimeFields are the fields AWS uses for when something was created
+var createTimeFields = []string{"SnapshotCreateTime", "ClusterSnapshotCreateTime", "InstanceCreateTime", "ClusterCreateTime", "CreationDate"}
+
+// ReadMetadata pulls the kind, engine and creation time out of a document, gob files and documents without them leave the fields empty
+func ReadMetadata(b []byte) Metadata {
+	if !IsDocument(b) {
+		return Metadata{}
+	}
+	doc, err := ReadDocument(b)
+	if err != nil {
+		return Metadata{}
+	}
+	md := Metadata{Kind: doc.Kind}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(doc.Data, &fields) != nil {
+		return md
+	}
+	if e, ok := fields["Engine"]; ok {
+		json.Unmarshal(e, &md.Engine)
+	}
+	for _, f := range createTimeFields {
+		if t, ok := fields[f]; ok && json.Unmarshal(t, &md.Created) == nil {
+			break
+		}
+	}
+	return md
+}
+
+// StackObjectFiles returns the files the objects of a stack document are in
+func StackObjectFiles(b []byte) []string {
+	doc, err := ReadDocument(b)
+	if err != nil || doc.Kind != KindStack {
+		return nil
+	}
+	var s struct {
+		Objects []struct {
+			FileName string `json:"fileName"`
+		} `json:"objects"`
+	}
+	if json.Unmarshal(doc.Data, &s) != nil {
+		return nil
+	}
+	files := []string{}
+	for _, o := range s.Objects {
+		files = append(files, o.FileName)
+	}
+	return files
+}
+
+// StackObjectChecksums returns the checksum recorded for each object file of a stack document, objects from older lats don't have one
+func StackObjectChecksums(b []byte) map[string]string {
+	sums := map[string]string{}
+	doc, err := ReadDocument(b)
+	if err != nil || doc.Kind != KindStack {
+		return sums
+	}
+	var s struct {
+		Objects []struct {
+			FileName string `json:"fileName"`
+			Checksum string `json:"checksum"`
+		} `json:"objects"`
+	}
+	if json.Unmarshal(doc.Data, &s) != nil {
+		return sums
+	}
+	for _, o := range s.Objects {
+		if o.Checksum != "" {
+			sums[o.FileName] = o.Checksum
+		}
+	}
+	return sums
+}
+
+// Filter narrows a query, empty fields match everything
+type Filter struct {
+	Type   string    // Type is the ObjectType in the state file like stack or RDSSnapshot
+	Name   string    // Name is a glob matched against the object name
+	Engine string    // Engine like postgres or aurora-mysql
+	Since  time.Time // Since only matches objects created at or after it
+	Until  time.Time // Until only matches objects created before it
+}
+
+// Match checks a record against the filter, records with no creation time don't match a time filter
+func (f Filter) Match(r Record) bool {
+	if f.Type != "" && !strings.EqualFold(r.ObjectType, f.Type) {
+		return false
+	}
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, r.Object); !ok {
+			return false
+		}
+	}
+	if f.Engine != "" && !strings.EqualFold(r.Engine, f.Engine) {
+		return false
+	}
+	if !f.Since.IsZero() && (r.Created.IsZero() || r.Created.Before(f.Since)) {
+		return false
+	}
+	if !f.Until.IsZero() && (r.Created.IsZero() || !r.Created.Before(f.Until)) {
+		return false
+	}
+	return true
+}
+
+// Record is an object in the state file with its metadata
+type Record struct {
+	StateKV
+	Metadata
+}
+
+// Querier is implemented by backends that can answer queries without reading every object
+type Querier interface {
+	Query(ctx context.Context, stateFile string, f Filter) ([]Record, error)
+}
+
+// StackFinder is implemented by backends that index stacks by name
+type StackFinder interface {
+	// FindStack returns the keys of the stacks called name
+	FindStack(ctx context.Context, name string) ([]string, error)
+}
+
+// Change is a write or delete recorded by a backend that keeps history
+type Change struct {
+	Key        string    `json:"key"`
+	Generation string    `json:"generation"`
+	Op         string    `json:"op"`
+	At         time.Time `json:"at"`
+	Size       int       `json:"size"`
+}
+
+// Historian is implemented by backends that keep a history of every change
+type Historian interface {
+	History(ctx context.Context, f Filter) ([]Change, error)
+}
+
+// Query returns the objects in the state file that match f, backends that implement Querier answer it themselves
+// otherwise every matching object is read for its metadata
+func Query(filename string, f Filter) ([]Record, error) {
+	if q, ok := Backend.(Querier); ok {
+		return q.Query(context.Background(), filename, f)
+	}
+	dat, err := ReadObject(filename)
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := DecodeStateFile(dat)
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, kv := range kvs {
+		r := Record{StateKV: kv}
+		// check what we can before reading the object
+		if !(Filter{Type: f.Type, Name: f.Name}).Match(r) {
+			continue
+		}
+		r.Metadata = objectMetadata(kv.FileLocation)
+		if f.Match(r) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// objectMetadata reads the metadata of an object, stacks take the engine of the first of their objects that has one
+func objectMetadata(filename string) Metadata {
+	dat, err := ReadObject(filename)
+	if err != nil {
+		return Metadata{}
+	}
+	md := ReadMetadata(dat)
+	if md.Kind != KindStack {
+		return md
+	}
+	for _, fn := range StackObjectFiles(dat) {
+		o, err := ReadObject(fn)
+		if err != nil {
+			continue
+		}
+		if e := ReadMetadata(o).Engine; e != "" {
+			md.Engine = e
+			break
+		}
+	}
+	return md
+}
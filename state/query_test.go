@@ -0,0 +1,73 @@
+package state
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+func TestReadMetadata(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := EncodeRDSSnapshotOutput(&types.DBSnapshot{Engine: aws.String("postgres"), SnapshotCreateTime: &created})
+	want := Metadata{Kind: KindDBSnapshot, Engine: "postgres", Created: created}
+	if got := ReadMetadata(b.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadMetadata() = %v, want %v", got, want)
+	}
+	if got := ReadMetadata([]byte("gob")); !reflect.DeepEqual(got, Metadata{}) {
+		t.Errorf("ReadMetadata() of a gob file = %v, want nothing", got)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snaps := []*types.DBSnapshot{
+		{DBSnapshotIdentifier: aws.String("pg"), Engine: aws.String("postgres"), SnapshotCreateTime: &created},
+		{DBSnapshotIdentifier: aws.String("my"), Engine: aws.String("mysql"), SnapshotCreateTime: aws.Time(created.AddDate(0, 1, 0))},
+	}
+	sm := StateManager{Mu: &sync.Mutex{}}
+	for _, s := range snaps {
+		fn := filepath.Join(dir, *s.DBSnapshotIdentifier)
+		if _, err := WriteOutput(fn, EncodeRDSSnapshotOutput(s)); err != nil {
+			t.Fatal(err)
+		}
+		sm.UpdateState(*s.DBSnapshotIdentifier, fn, SnapshotType)
+	}
+	stateFile := filepath.Join(dir, ".state.json")
+	if err := sm.SyncState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		f    Filter
+		want []string
+	}{
+		{"all", Filter{}, []string{"pg", "my"}},
+		{"type", Filter{Type: "stack"}, []string{}},
+		{"name", Filter{Name: "p*"}, []string{"pg"}},
+		{"engine", Filter{Engine: "MySQL"}, []string{"my"}},
+		{"since", Filter{Since: created.Add(time.Hour)}, []string{"my"}},
+		{"until", Filter{Until: created.Add(time.Hour)}, []string{"pg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := Query(stateFile, tt.f)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			got := []string{}
+			for _, r := range records {
+				got = append(got, r.Object)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
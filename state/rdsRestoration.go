@@ -61,6 +61,17 @@ func (r RDSRestorationStore) GetClusterParameterGroups() *string {
 	return r.Cluster.DBClusterParameterGroup
 }
 
+//GetOptionGroupName gets the option group an instance is using
+func (r RDSRestorationStore) GetOptionGroupName() *string {
+	if r.Instance == nil {
+		return nil
+	}
+	if len(r.Instance.OptionGroupMemberships) == 0 {
+		return nil
+	}
+	return r.Instance.OptionGroupMemberships[0].OptionGroupName
+}
+
 //GetAutoMinorVersionUpgrade yet another getter
 func (r RDSRestorationStore) GetAutoMinorVersionUpgrade() *bool {
 	if r.Instance == nil {
@@ -633,3 +633,23 @@ func TestRDSRestorationStore_GetClusterParameterGroups(t *testing.T) {
 		})
 	}
 }
+
+func TestRDSRestorationStore_GetOptionGroupName(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance *types.DBInstance
+		want     *string
+	}{
+		{name: "nil", instance: nil, want: nil},
+		{name: "noMemberships", instance: &types.DBInstance{}, want: nil},
+		{name: "Value", instance: &types.DBInstance{OptionGroupMemberships: []types.OptionGroupMembership{{OptionGroupName: aws.String("foo")}}}, want: aws.String("foo")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := RDSRestorationStore{Instance: tt.instance}
+			if got := r.GetOptionGroupName(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RDSRestorationStore.GetOptionGroupName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,11 +2,10 @@ package state
 
 import (
 	"bytes"
-	"encoding/gob"
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
@@ -16,10 +15,7 @@ import (
 
 // EncodeRDSDatabaseOutput converts a dbInstace to an array of bytes in preperation for wrtiing it to disk
 func EncodeRDSDatabaseOutput(db *types.DBInstance) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(db)
+	encoder, err := EncodeDocument(KindDBInstance, db)
 	if err != nil {
 		slog.Error("Error encoding our database", "error", err)
 	}
@@ -27,9 +23,7 @@ func EncodeRDSDatabaseOutput(db *types.DBInstance) bytes.Buffer {
 }
 
 func EncodeCreateDBClusterInput(c *rds.CreateDBClusterInput) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-	err := enc.Encode(&c)
+	encoder, err := EncodeDocument(KindCreateDBClusterInput, &c)
 	if err != nil {
 		slog.Error("Error encoding our database", "error", err)
 	}
@@ -38,8 +32,7 @@ func EncodeCreateDBClusterInput(c *rds.CreateDBClusterInput) bytes.Buffer {
 
 func DecodeCreateDBClusterInput(b bytes.Buffer) *rds.CreateDBClusterInput {
 	var dbCluster rds.CreateDBClusterInput
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&dbCluster)
+	err := DecodeDocument(b.Bytes(), KindCreateDBClusterInput, &dbCluster)
 	if err != nil {
 		slog.Error("Error decoding state for RDS Cluster", "error", err)
 	}
@@ -48,10 +41,7 @@ func DecodeCreateDBClusterInput(b bytes.Buffer) *rds.CreateDBClusterInput {
 
 // EncodeOptionGroup convers an option group struct to bytes
 func EncodeOptionGroup(og *types.OptionGroup) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(og)
+	encoder, err := EncodeDocument(KindOptionGroup, og)
 	if err != nil {
 		slog.Error("Error encoding our option group", "error", err)
 	}
@@ -61,8 +51,7 @@ func EncodeOptionGroup(og *types.OptionGroup) bytes.Buffer {
 // DecodeOptionGroup takes a bytes buffer and returns it to a option group
 func DecodeOptionGroup(b bytes.Buffer) types.OptionGroup {
 	var optionGroup types.OptionGroup
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&optionGroup)
+	err := DecodeDocument(b.Bytes(), KindOptionGroup, &optionGroup)
 	if err != nil {
 		slog.Error("Error decoding state for Option Group", "error", err)
 	}
@@ -71,10 +60,7 @@ func DecodeOptionGroup(b bytes.Buffer) types.OptionGroup {
 
 // EncodeSecurityGroup converts a security group struct to bytes
 func EncodeSecurityGroup(s ec2types.SecurityGroup) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(s)
+	encoder, err := EncodeDocument(KindSecurityGroup, s)
 	if err != nil {
 		slog.Error("Error encoding our option group", "error", err)
 	}
@@ -84,8 +70,7 @@ func EncodeSecurityGroup(s ec2types.SecurityGroup) bytes.Buffer {
 // DecodeSecurityGroup takes a bytes buffer and returns it to a option group
 func DecodeSecurityGroup(b bytes.Buffer) ec2types.SecurityGroup {
 	var securityGroup ec2types.SecurityGroup
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&securityGroup)
+	err := DecodeDocument(b.Bytes(), KindSecurityGroup, &securityGroup)
 	if err != nil {
 		slog.Error("Error decoding state for Option Group", "error", err)
 	}
@@ -95,8 +80,7 @@ func DecodeSecurityGroup(b bytes.Buffer) ec2types.SecurityGroup {
 // DecodeRDSClusterOutput takes a bytes buffer and returns it to a DbCluster type in preperation of restoring the database
 func DecodeRDSClusterOutput(b bytes.Buffer) types.DBCluster {
 	var dbCluster types.DBCluster
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&dbCluster)
+	err := DecodeDocument(b.Bytes(), KindDBCluster, &dbCluster)
 	if err != nil {
 		slog.Error("Error decoding state for RDS Cluster", "error", err)
 	}
@@ -105,10 +89,7 @@ func DecodeRDSClusterOutput(b bytes.Buffer) types.DBCluster {
 
 // EncodeRDSClusterOutput takes a cluster snapshot and creates bytes
 func EncodeRDSClusterOutput(db *types.DBCluster) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(db)
+	encoder, err := EncodeDocument(KindDBCluster, db)
 	if err != nil {
 		slog.Error("Error encoding our database", "error", err)
 	}
@@ -118,8 +99,7 @@ func EncodeRDSClusterOutput(db *types.DBCluster) bytes.Buffer {
 // DecodeRDSDatabaseOutput takes a bytes buffer and returns it to a DbInstance type in preperation of restoring the database
 func DecodeRDSDatabaseOutput(b bytes.Buffer) types.DBInstance {
 	var dbInstance types.DBInstance
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&dbInstance)
+	err := DecodeDocument(b.Bytes(), KindDBInstance, &dbInstance)
 	if err != nil {
 		slog.Error("Error decoding state for RDS Instance", "error", err)
 	}
@@ -128,10 +108,7 @@ func DecodeRDSDatabaseOutput(b bytes.Buffer) types.DBInstance {
 
 // EncodeRDSSnapshotOutput converts a DbSnapshot struct to an array of bytes in preperation for wrtiing it to disk
 func EncodeRDSSnapshotOutput(snapshot *types.DBSnapshot) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(snapshot)
+	encoder, err := EncodeDocument(KindDBSnapshot, snapshot)
 	if err != nil {
 		slog.Error("Error encoding our snapshot", "error", err)
 	}
@@ -151,10 +128,7 @@ func GetRDSSnapshotOutput(s StateManager, snap string) (*types.DBSnapshot, error
 
 // EncodeRDSClusterSnapshotOutput cluster output as bytes
 func EncodeRDSClusterSnapshotOutput(snapshot *types.DBClusterSnapshot) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(snapshot)
+	encoder, err := EncodeDocument(KindDBClusterSnapshot, snapshot)
 	if err != nil {
 		slog.Error("Error encoding our snapshot", "error", err)
 	}
@@ -191,10 +165,8 @@ func GenerateRestoreDBInstanceFromDBClusterSnapshotInput(r RDSRestorationStore)
 
 // EncodeRestoreDBInstanceFromDBSnapshotInput encode snapshot as bytes
 func EncodeRestoreDBInstanceFromDBSnapshotInput(r *rds.RestoreDBInstanceFromDBSnapshotInput) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
 	slog.Info("encoding db instance")
-	err := enc.Encode(r)
+	encoder, err := EncodeDocument(KindRestoreDBInstanceFromDBSnapshotInput, r)
 	if err != nil {
 		slog.Error("Error encoding our snapshot", "error", err)
 	}
@@ -204,8 +176,7 @@ func EncodeRestoreDBInstanceFromDBSnapshotInput(r *rds.RestoreDBInstanceFromDBSn
 // DecodeRestoreDBInstanceFromDBSnapshotInput  decodes snapshot from bytes
 func DecodeRestoreDBInstanceFromDBSnapshotInput(b bytes.Buffer) *rds.RestoreDBInstanceFromDBSnapshotInput {
 	var Restore rds.RestoreDBInstanceFromDBSnapshotInput
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&Restore)
+	err := DecodeDocument(b.Bytes(), KindRestoreDBInstanceFromDBSnapshotInput, &Restore)
 	if err != nil {
 		slog.Error("Error decoding state for RestoreDBInstance struct", "error", err)
 	}
@@ -223,10 +194,7 @@ func GenerateRestoreDBClusterFromSnapshotInput(r RDSRestorationStore) *rds.Resto
 
 // EncodeRestoreDBClusterFromSnapshotInput takes a cluster snapshot and turns it into bytes
 func EncodeRestoreDBClusterFromSnapshotInput(r *rds.RestoreDBClusterFromSnapshotInput) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-
-	err := enc.Encode(r)
+	encoder, err := EncodeDocument(KindRestoreDBClusterFromSnapshotInput, r)
 	if err != nil {
 		slog.Error("Error encoding our snapshot", "error", err)
 	}
@@ -236,8 +204,7 @@ func EncodeRestoreDBClusterFromSnapshotInput(r *rds.RestoreDBClusterFromSnapshot
 // DecodeRestoreDBClusterFromSnapshotInput takes bytes and retruns a db cluster from snapshot input which is needed for restoring a db cluster
 func DecodeRestoreDBClusterFromSnapshotInput(b bytes.Buffer) *rds.RestoreDBClusterFromSnapshotInput {
 	var Restore rds.RestoreDBClusterFromSnapshotInput
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&Restore)
+	err := DecodeDocument(b.Bytes(), KindRestoreDBClusterFromSnapshotInput, &Restore)
 	if err != nil {
 		slog.Error("Error decoding state for RestoreDBCluster struct", "error", err)
 	}
@@ -246,8 +213,7 @@ func DecodeRestoreDBClusterFromSnapshotInput(b bytes.Buffer) *rds.RestoreDBClust
 
 func DecodeRDSClusterSnapshotOutput(b bytes.Buffer) types.DBClusterSnapshot {
 	var dbSnapshot types.DBClusterSnapshot
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&dbSnapshot)
+	err := DecodeDocument(b.Bytes(), KindDBClusterSnapshot, &dbSnapshot)
 	if err != nil {
 		slog.Error("Error decoding state for cluster snapshot", "error", err)
 	}
@@ -287,25 +253,20 @@ func GetRDSDatabaseClusterOutput(s StateManager, dbName string) (*types.DBCluste
 // DecodeRDSSnapshhotOutput takes a bytes buffer and returns it to a DbSnapshot type in preperation of restoring the database
 func DecodeRDSSnapshotOutput(b bytes.Buffer) types.DBSnapshot {
 	var dbSnapshot types.DBSnapshot
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&dbSnapshot)
+	err := DecodeDocument(b.Bytes(), KindDBSnapshot, &dbSnapshot)
 	if err != nil {
 		slog.Error("Error decoding state for snapshot", "error", err)
 	}
 	return dbSnapshot
 }
 
+// WriteOutput writes bytes to filename in the state backend
 func WriteOutput(filename string, b bytes.Buffer) (int64, error) {
-	f, err := os.Create(filename)
-	if err != nil {
-		slog.Error("Error creating file", "error", err)
-	}
-	defer f.Close()
-	n, err := b.WriteTo(f)
+	err := Backend.Put(context.Background(), filename, b.Bytes())
 	if err != nil {
-		slog.Error("error writing to file", "error", err)
+		return 0, err
 	}
-	return n, err
+	return int64(b.Len()), nil
 }
 
 // CreateInstanceInput creates an instance to prep for creating our Cluster
@@ -533,9 +494,7 @@ func CreateDBClusterInput(c *types.DBCluster) *rds.CreateDBClusterInput {
 
 // EncodeCreateDBInstanceInput bytes buffer for create
 func EncodeCreateDBInstanceInput(c *rds.CreateDBInstanceInput) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-	err := enc.Encode(&c)
+	encoder, err := EncodeDocument(KindCreateDBInstanceInput, &c)
 	if err != nil {
 		slog.Error("Error encoding our database", "error", err)
 	}
@@ -545,8 +504,7 @@ func EncodeCreateDBInstanceInput(c *rds.CreateDBInstanceInput) bytes.Buffer {
 // DecodeCreateDBInstanceInput creates the instance from our bytes buffer when we want to replay
 func DecodeCreateDBInstanceInput(b bytes.Buffer) *rds.CreateDBInstanceInput {
 	var dbInstance rds.CreateDBInstanceInput
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&dbInstance)
+	err := DecodeDocument(b.Bytes(), KindCreateDBInstanceInput, &dbInstance)
 	if err != nil {
 		slog.Error("Error decoding state for RDS Instance", "error", err)
 	}
@@ -554,9 +512,7 @@ func DecodeCreateDBInstanceInput(b bytes.Buffer) *rds.CreateDBInstanceInput {
 }
 
 func EncodeClusterCreateDBInstanceInput(c []rds.CreateDBInstanceInput) bytes.Buffer {
-	var encoder bytes.Buffer
-	enc := gob.NewEncoder(&encoder)
-	err := enc.Encode(&c)
+	encoder, err := EncodeDocument(KindCreateDBInstanceInputs, &c)
 	if err != nil {
 		slog.Error("Error encoding our database", "error", err)
 	}
@@ -565,8 +521,7 @@ func EncodeClusterCreateDBInstanceInput(c []rds.CreateDBInstanceInput) bytes.Buf
 
 func DecodeClusterCreateDBInstanceInput(b bytes.Buffer) []rds.CreateDBInstanceInput {
 	var dbInstances []rds.CreateDBInstanceInput
-	dec := gob.NewDecoder(&b)
-	err := dec.Decode(&dbInstances)
+	err := DecodeDocument(b.Bytes(), KindCreateDBInstanceInputs, &dbInstances)
 	if err != nil {
 		slog.Error("Error decoding state for RDS Instance", "error", err)
 	}
@@ -20,8 +20,7 @@ func TestEncodeOptionGroup(t *testing.T) {
 	}
 	r := EncodeOptionGroup(&og)
 	var result types.OptionGroup
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindOptionGroup, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -47,8 +46,7 @@ func TestEncodeCreateDBClusterInput(t *testing.T) {
 	}
 	r := EncodeCreateDBClusterInput(&c)
 	var result rds.CreateDBClusterInput
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindCreateDBClusterInput, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -75,8 +73,7 @@ func TestEncodeSecurityGroup(t *testing.T) {
 	}
 	r := EncodeSecurityGroup(sg)
 	var result ec2types.SecurityGroup
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindSecurityGroup, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -103,8 +100,7 @@ func TestEncodeRestoreDBInstanceFromDBSnapshotInput(t *testing.T) {
 	}
 	r := EncodeRestoreDBInstanceFromDBSnapshotInput(&db)
 	var result rds.RestoreDBInstanceFromDBSnapshotInput
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindRestoreDBInstanceFromDBSnapshotInput, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -131,8 +127,7 @@ func TestEncodeRestoreDBClusterFromSnapshotInput(t *testing.T) {
 	}
 	r := EncodeRestoreDBClusterFromSnapshotInput(&db)
 	var result rds.RestoreDBClusterFromSnapshotInput
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindRestoreDBClusterFromSnapshotInput, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -160,8 +155,7 @@ func TestEncodeRDSDBOutput(t *testing.T) {
 	}
 	r := EncodeRDSDatabaseOutput(&db)
 	var result types.DBInstance
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindDBInstance, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -193,8 +187,7 @@ func TestEncodeRDSClusterOutput(t *testing.T) {
 	}
 	r := EncodeRDSClusterOutput(&db)
 	var result types.DBCluster
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindDBCluster, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -228,8 +221,7 @@ func TestEncodeRDSSnapshotOutput(t *testing.T) {
 	}
 	r := EncodeRDSSnapshotOutput(&snap)
 	var result types.DBSnapshot
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindDBSnapshot, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -260,8 +252,7 @@ func TestEncodeRDSClusterSnapshotOutput(t *testing.T) {
 	}
 	r := EncodeRDSClusterSnapshotOutput(&snap)
 	var result types.DBClusterSnapshot
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindDBClusterSnapshot, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -298,7 +289,8 @@ func TestWriteOutput(t *testing.T) {
 		t.Errorf("Error encoding our test: %s", err)
 	}
 
-	var expected int64 = 36
+	// gob type ids are global so the size depends on what else the test binary encoded
+	expected := int64(encoder.Len())
 	filename := "/tmp/foo.gob"
 	defer os.Remove(filename)
 
@@ -336,8 +328,8 @@ func TestGetRDSSnapshotOutput(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 	newSnap, err := GetRDSSnapshotOutput(sm, "foo")
 	if err != nil {
@@ -373,8 +365,8 @@ func TestGetRDSClusterSnapshotOutput(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 	newSnap, err := GetRDSClusterSnapshotOutput(sm, "foo")
 	if err != nil {
@@ -409,8 +401,8 @@ func TestGetRDSInstanceOutput(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 	newDbi, err := GetRDSDatabaseInstanceOutput(sm, "foo")
 	if err != nil {
@@ -446,8 +438,8 @@ func TestGetRDSClusterOutput(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 	newDbi, err := GetRDSDatabaseClusterOutput(sm, "foo")
 	if err != nil {
@@ -505,8 +497,7 @@ func Test_EncodeCreateDBInstanceInput(t *testing.T) {
 	}
 	r := EncodeCreateDBInstanceInput(&db)
 	var result rds.CreateDBInstanceInput
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindCreateDBInstanceInput, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
@@ -535,8 +526,7 @@ func Test_EncodeClusterCreateDBInstanceInput(t *testing.T) {
 	dbs = append(dbs, db)
 	r := EncodeClusterCreateDBInstanceInput(dbs)
 	var result []rds.CreateDBInstanceInput
-	dec := gob.NewDecoder(&r)
-	err := dec.Decode(&result)
+	err := DecodeDocument(r.Bytes(), KindCreateDBInstanceInputs, &result)
 	if err != nil {
 		t.Errorf("decode error: %s", err)
 	}
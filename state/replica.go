@@ -0,0 +1,215 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ReplicaManifest is written to the replica last, it lists everything that was copied and a hash of each so we only copy what changed
+const ReplicaManifest = ".latsReplica.json"
+
+// Replication copies the state file and everything it points at to another backend after every SyncState
+type Replication struct {
+	Backend StateBackend
+	Files   []string // Files are local files that aren't state but are needed to recover like the config
+}
+
+// Replica is where SyncState copies state to, nil turns replication off
+var Replica *Replication
+
+// Manifest is the contents of ReplicaManifest
+type Manifest struct {
+	StateFile  string              `json:"stateFile"`
+	Replicated time.Time           `json:"replicated"`
+	Objects    map[string]string   `json:"objects"`          // Objects maps each key to the sha256 of what was copied
+	Files      map[string]string   `json:"files"`            // Files are the local files that were copied
+	Stacks     map[string][]string `json:"stacks,omitempty"` // Stacks are the object files of each stack so an unchanged stack isn't read again
+}
+
+// replicate copies the state file and the objects in kvs to the replica, it's called by SyncState with the state it just wrote.
+// Objects whose checksum in the state file or their stack matches the last manifest aren't read again, only what was added or changed since is copied
+func replicate(filename string, data []byte, kvs []StateKV) error {
+	if Replica == nil {
+		return nil
+	}
+	ctx := context.Background()
+	old := readManifest(ctx, Replica.Backend)
+	m := Manifest{StateFile: filename, Objects: map[string]string{}, Files: map[string]string{}, Stacks: map[string][]string{}}
+	var errs []error
+	// copyObject copies key unless sum says it's what we copied last time, it returns what it read
+	copyObject := func(key string, sum string) []byte {
+		if _, ok := m.Objects[key]; ok {
+			return nil
+		}
+		if sum != "" && old.Objects[key] == sum {
+			m.Objects[key] = sum
+			return nil
+		}
+		dat, err := ReadObject(key)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		h := Checksum(dat)
+		if old.Objects[key] != h {
+			err = Replica.Backend.Put(ctx, key, dat)
+			if err != nil {
+				errs = append(errs, err)
+				return dat
+			}
+		}
+		m.Objects[key] = h
+		return dat
+	}
+	for _, kv := range kvs {
+		if kv.ObjectType != StackType {
+			copyObject(kv.FileLocation, kv.Checksum)
+			continue
+		}
+		files, ok := old.Stacks[kv.FileLocation]
+		if ok && kv.Checksum != "" && old.Objects[kv.FileLocation] == kv.Checksum && replicated(old, files) {
+			// the stack hasn't changed so neither have its objects
+			m.Objects[kv.FileLocation] = kv.Checksum
+			m.Stacks[kv.FileLocation] = files
+			for _, fn := range files {
+				m.Objects[fn] = old.Objects[fn]
+			}
+			continue
+		}
+		dat := copyObject(kv.FileLocation, "")
+		if dat == nil {
+			continue
+		}
+		if !IsDocument(dat) {
+			slog.Warn("stack is gob so it's objects can't be replicated, run lats state convert", "stack", kv.Object)
+			continue
+		}
+		sums := StackObjectChecksums(dat)
+		m.Stacks[kv.FileLocation] = StackObjectFiles(dat)
+		for _, fn := range m.Stacks[kv.FileLocation] {
+			copyObject(fn, sums[fn])
+		}
+	}
+	for _, fn := range Replica.Files {
+		dat, err := os.ReadFile(fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = Replica.Backend.Put(ctx, fn, dat)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.Files[fn] = Checksum(dat)
+	}
+	// the state file goes after everything it points at so the replica never points at something that isn't there,
+	// the last manifest is kept when a copy failed so the next replicate copies whatever didn't make it
+	if len(errs) > 0 {
+		return fmt.Errorf("not updating the replica's state file: %w", errors.Join(errs...))
+	}
+	err := Replica.Backend.Put(ctx, filename, data)
+	if err != nil {
+		return err
+	}
+	m.Objects[filename] = Checksum(data)
+	m.Replicated = time.Now().UTC()
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return Replica.Backend.Put(ctx, ReplicaManifest, b)
+}
+
+// replicated tells if every file is in the manifest
+func replicated(m Manifest, files []string) bool {
+	for _, fn := range files {
+		if _, ok := m.Objects[fn]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func readManifest(ctx context.Context, b StateBackend) Manifest {
+	var m Manifest
+	dat, _, err := b.Get(ctx, ReplicaManifest)
+	if err == nil {
+		json.Unmarshal(dat, &m)
+	}
+	return m
+}
+
+// ReadManifest reads the manifest of a replica
+func ReadManifest(b StateBackend) (Manifest, error) {
+	dat, _, err := b.Get(context.Background(), ReplicaManifest)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("no replica manifest, has lats replicated here: %w", err)
+	}
+	var m Manifest
+	err = json.Unmarshal(dat, &m)
+	if err != nil {
+		return m, fmt.Errorf("error reading replica manifest: %w", err)
+	}
+	return m, nil
+}
+
+// ReplicateState copies the state file and everything it points at to the replica now
+func ReplicateState(filename string) error {
+	if Replica == nil {
+		return fmt.Errorf("no replica is configured")
+	}
+	dat, err := ReadObject(filename)
+	if err != nil {
+		return err
+	}
+	kvs, err := DecodeStateFile(dat)
+	if err != nil {
+		return err
+	}
+	return replicate(filename, dat, kvs)
+}
+
+// Recover copies everything in a replica's manifest from the replica to Backend, local files like the config are left to the caller.
+// It returns how many objects it copied
+func Recover(from StateBackend, m Manifest) (int, error) {
+	ctx := context.Background()
+	copied := 0
+	var errs []error
+	for key, h := range m.Objects {
+		if key == m.StateFile {
+			continue
+		}
+		err := recoverObject(ctx, from, key, h)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		copied++
+	}
+	if len(errs) > 0 {
+		return copied, errors.Join(errs...)
+	}
+	// the state file goes last so it never points at something we didn't copy
+	err := recoverObject(ctx, from, m.StateFile, m.Objects[m.StateFile])
+	if err != nil {
+		return copied, err
+	}
+	return copied + 1, nil
+}
+
+func recoverObject(ctx context.Context, from StateBackend, key string, h string) error {
+	dat, _, err := from.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if Checksum(dat) != h {
+		return fmt.Errorf("%s in the replica doesn't match the manifest, it changed after it was replicated", key)
+	}
+	return Backend.Put(ctx, key, dat)
+}
@@ -0,0 +1,265 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// memBackend keeps state in a map and counts writes
+type memBackend struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+	fail    map[string]error // fail makes Put of a key return the error
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{objects: map[string][]byte{}}
+}
+
+func (m *memBackend) String() string { return "memory" }
+
+func (m *memBackend) Get(ctx context.Context, key string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	return b, Checksum(b), nil
+}
+
+func (m *memBackend) Put(ctx context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fail[key]; err != nil {
+		return err
+	}
+	m.objects[key] = data
+	m.puts++
+	return nil
+}
+
+func (m *memBackend) PutIf(ctx context.Context, key string, data []byte, generation string) (string, error) {
+	_, gen, _ := m.Get(ctx, key)
+	if gen != generation {
+		return "", ErrConflict
+	}
+	return Checksum(data), m.Put(ctx, key, data)
+}
+
+func (m *memBackend) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memBackend) List(ctx context.Context, dir string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []string{}
+	for k := range m.objects {
+		if filepath.Dir(k) == filepath.Clean(dir) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// writeReplicaTestState writes a snapshot and a stack document pointing at an object into the working directory
+func writeReplicaTestState(t *testing.T) StateManager {
+	if _, err := WriteOutput(".state/snap.json", EncodeRDSSnapshotOutput(&types.DBSnapshot{DBSnapshotIdentifier: aws.String("snap")})); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".state/object.json", []byte(`{"format":"lats","version":1,"kind":"lats.ParameterGroups","data":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stack := `{"format":"lats","version":1,"kind":"lats.Stack","data":{"version":2,"name":"foo","objects":[{"id":"pg","fileName":".state/object.json","objType":"DBParameterGroup"}]}}`
+	if err := os.WriteFile(".state/stack.json", []byte(stack), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".latsConfig.json", []byte(`{"stateFileName":".confState.json"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sm := StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("snap", ".state/snap.json", SnapshotType)
+	sm.UpdateState("foo", ".state/stack.json", "stack")
+	return sm
+}
+
+func TestSyncState_Replicates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	replica := newMemBackend()
+	Replica = &Replication{Backend: replica, Files: []string{".latsConfig.json"}}
+	defer func() { Replica = nil }()
+
+	sm := writeReplicaTestState(t)
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	for _, k := range []string{".confState.json", ".state/snap.json", ".state/stack.json", ".state/object.json", ".latsConfig.json", ReplicaManifest} {
+		if _, ok := replica.objects[k]; !ok {
+			t.Errorf("%s wasn't replicated", k)
+		}
+	}
+
+	// only the state file, config and manifest change on the next sync
+	puts := replica.puts
+	sm.SetSnapshot(".state/stack.json", SnapshotInfo{ID: "snap", Status: "available"})
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	if got := replica.puts - puts; got != 3 {
+		t.Errorf("expected 3 writes to the replica got %d", got)
+	}
+
+	m, err := ReadManifest(replica)
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+	t.Chdir(t.TempDir())
+	n, err := Recover(replica, m)
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 objects recovered got %d", n)
+	}
+	recovered, err := ReadState(".confState.json")
+	if err != nil || len(recovered.StateLocations) != 2 {
+		t.Errorf("ReadState() of the recovered state = %v, %v", recovered.StateLocations, err)
+	}
+	if _, err := os.Stat(".state/object.json"); err != nil {
+		t.Errorf("the stack's object wasn't recovered %v", err)
+	}
+}
+
+func TestRecover_Tampered(t *testing.T) {
+	t.Chdir(t.TempDir())
+	replica := newMemBackend()
+	Replica = &Replication{Backend: replica}
+	defer func() { Replica = nil }()
+	sm := writeReplicaTestState(t)
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatal(err)
+	}
+	replica.objects[".state/object.json"] = []byte("changed")
+	m, _ := ReadManifest(replica)
+	t.Chdir(t.TempDir())
+	_, err := Recover(replica, m)
+	if err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("Recover() error = %v, want a mismatch", err)
+	}
+	if _, err := os.Stat(".confState.json"); err == nil {
+		t.Errorf("the state file was recovered with an object missing")
+	}
+}
+
+func TestReplicate_OnlyChanged(t *testing.T) {
+	t.Chdir(t.TempDir())
+	replica := newMemBackend()
+	Replica = &Replication{Backend: replica}
+	defer func() { Replica = nil }()
+	sm := writeReplicaTestState(t)
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing that's already replicated is read again, so losing the files locally doesn't matter
+	for _, fn := range []string{".state/snap.json", ".state/object.json"} {
+		if err := os.Remove(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := WriteOutput(".state/new.json", EncodeRDSSnapshotOutput(&types.DBSnapshot{DBSnapshotIdentifier: aws.String("new")})); err != nil {
+		t.Fatal(err)
+	}
+	sm.UpdateState("new", ".state/new.json", SnapshotType)
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplicateState(".confState.json"); err != nil {
+		t.Fatalf("ReplicateState() error = %v", err)
+	}
+	m, err := ReadManifest(replica)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{".state/snap.json", ".state/stack.json", ".state/object.json", ".state/new.json"} {
+		if _, ok := m.Objects[k]; !ok {
+			t.Errorf("%s isn't in the manifest %v", k, m.Objects)
+		}
+	}
+	if _, ok := replica.objects[".state/new.json"]; !ok {
+		t.Error("the new snapshot wasn't replicated")
+	}
+}
+
+func TestReplicate_RetriesFailed(t *testing.T) {
+	t.Chdir(t.TempDir())
+	replica := newMemBackend()
+	replica.fail = map[string]error{".state/object.json": errors.New("replica unavailable")}
+	Replica = &Replication{Backend: replica}
+	defer func() { Replica = nil }()
+	sm := writeReplicaTestState(t)
+	if err := sm.SyncState(".confState.json"); err != nil {
+		t.Fatal(err)
+	}
+	// the replica isn't pointed at a stack whose object it doesn't have
+	for _, k := range []string{".confState.json", ReplicaManifest} {
+		if _, ok := replica.objects[k]; ok {
+			t.Errorf("%s was written with an object missing", k)
+		}
+	}
+	if err := ReplicateState(".confState.json"); err == nil {
+		t.Error("ReplicateState() should error while a copy fails")
+	}
+
+	delete(replica.fail, ".state/object.json")
+	if err := ReplicateState(".confState.json"); err != nil {
+		t.Fatalf("ReplicateState() error = %v", err)
+	}
+	if _, ok := replica.objects[".state/object.json"]; !ok {
+		t.Error("the object that failed wasn't copied again")
+	}
+
+	// manifests from older lats could list a stack without an object that failed, the stack isn't skipped
+	m, err := ReadManifest(replica)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(m.Objects, ".state/object.json")
+	delete(replica.objects, ".state/object.json")
+	b, _ := json.Marshal(m)
+	replica.objects[ReplicaManifest] = b
+	if err := ReplicateState(".confState.json"); err != nil {
+		t.Fatalf("ReplicateState() error = %v", err)
+	}
+	if _, ok := replica.objects[".state/object.json"]; !ok {
+		t.Error("an unchanged stack's missing object wasn't copied")
+	}
+
+	m, err = ReadManifest(replica)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if _, err := Recover(replica, m); err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if _, err := os.Stat(".state/object.json"); err != nil {
+		t.Errorf("the stack's object wasn't recovered %v", err)
+	}
+}
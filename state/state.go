@@ -2,9 +2,12 @@ package state
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
-	"os"
+	"slices"
 	"sync"
 )
 
@@ -19,14 +22,21 @@ const SecurityGroupType = "SecurityGroup"
 
 // StateKV manages our state file and object location
 type StateKV struct {
-	Object       string `json:"object"`
-	FileLocation string `json:"fileLocation"`
-	ObjectType   string `json:"objectType"`
+	Object       string        `json:"object"`
+	FileLocation string        `json:"fileLocation"`
+	ObjectType   string        `json:"objectType"`
+	Checksum     string        `json:"checksum,omitempty"` // Checksum is the sha256 of the file when it was added, state written by older lats doesn't have it
+	Size         int64         `json:"size,omitempty"`
+	Stack        StackInfo     `json:"stack,omitzero"`     // Stack is only set for stacks
+	Snapshot     SnapshotInfo  `json:"snapshot,omitzero"`  // Snapshot is set on stacks by lats state refresh
+	Operation    OperationInfo `json:"operation,omitzero"` // Operation is only set for operations
 }
 
 type StateManager struct {
 	Mu             *sync.Mutex
 	StateLocations []StateKV `json:"stateLocations"`
+	base           []StateKV // base is what was in the state file when we read it, SyncState uses it to merge
+	index          map[indexKey][]int
 }
 
 func (s *StateManager) UpdateState(name string, filename string, ot string) {
@@ -37,32 +47,166 @@ func (s *StateManager) UpdateState(name string, filename string, ot string) {
 		FileLocation: filename,
 		ObjectType:   ot,
 	}
+	describeFile(&kv)
 	s.StateLocations = append(s.StateLocations, kv)
+	s.index = nil
 }
 
+// Rehash records the checksum and stack info of files again after they were rewritten in place like by convert or migrate
+func (s *StateManager) Rehash(filenames ...string) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for i, kv := range s.StateLocations {
+		if slices.Contains(filenames, kv.FileLocation) {
+			describeFile(&s.StateLocations[i])
+		}
+	}
+	s.index = nil
+}
+
+// maxSyncAttempts is how many times SyncState merges again when the state file changes while it's writing
+const maxSyncAttempts = 5
+
+// SyncState writes the state file keeping a backup of the old one, it refuses to overwrite a state file from a newer lats.
+// The state file is read again under the state lock and merged so objects other lats processes added since we read it aren't lost,
+// the write only succeeds if the state file is still what we merged with so lats on other machines sharing a remote backend are caught too.
+// When a Replica is set the state is copied there afterwards
 func (s *StateManager) SyncState(filename string) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	m, err := json.Marshal(s.StateLocations)
+	var written []byte
+	err := WithLock(filename, func() error {
+		for attempt := 1; ; attempt++ {
+			current, gen, disk, err := readStateLocations(filename)
+			if err != nil {
+				slog.Error("Refusing to overwrite state", "error", err)
+				return err
+			}
+			merged := mergeState(s.base, disk, s.StateLocations)
+			m, err := json.Marshal(stateFile{Version: StateVersion, StateLocations: merged})
+			if err != nil {
+				slog.Error("Error creating json", "error", err)
+				return err
+			}
+			err = backupState(filename, current)
+			if err != nil {
+				slog.Warn("Error backing up the state file", "error", err)
+			}
+			_, err = Backend.PutIf(context.Background(), filename, m, gen)
+			if errors.Is(err, ErrConflict) && attempt < maxSyncAttempts {
+				slog.Info("state file changed while we were writing it, merging again", "file", filename)
+				continue
+			}
+			if err != nil {
+				slog.Error("Error writing file", "error", err)
+				return err
+			}
+			s.StateLocations = merged
+			s.index = nil
+			s.base = append([]StateKV{}, merged...)
+			written = m
+			return nil
+		}
+	})
 	if err != nil {
-		slog.Error("Error creating json", "error", err)
 		return err
 	}
-	err = os.WriteFile(filename, m, 0644)
+	// a replica that's behind is better than failing a sync that worked so this only warns
+	err = replicate(filename, written, s.StateLocations)
 	if err != nil {
-		slog.Error("Error writing file", "error", err)
-		return err
+		slog.Warn("error replicating state, run lats state replicate to try again", "error", err)
 	}
 	return nil
 }
 
+// readStateLocations reads the state file as it is in the backend with its generation, a missing or empty file has no locations
+func readStateLocations(filename string) ([]byte, string, []StateKV, error) {
+	existing, gen, err := Backend.Get(context.Background(), filename)
+	if errors.Is(err, ErrNotFound) {
+		return nil, "", nil, nil
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if len(bytes.TrimSpace(existing)) == 0 {
+		return existing, gen, nil, nil
+	}
+	kvs, err := DecodeStateFile(existing)
+	var verr *VersionError
+	if errors.As(err, &verr) {
+		return nil, "", nil, &VersionError{Name: filename, Version: verr.Version, Supported: StateVersion}
+	}
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("state file %s is unreadable, fix it or run lats state restore-backup: %w", filename, err)
+	}
+	return existing, gen, kvs, nil
+}
+
+// DecodeStateFile decodes the contents of a state file migrating older layouts
+func DecodeStateFile(b []byte) ([]StateKV, error) {
+	m, _, err := StateMigrations.Migrate(b)
+	if err != nil {
+		return nil, err
+	}
+	var sf stateFile
+	err = json.Unmarshal(m, &sf)
+	if err != nil {
+		return nil, err
+	}
+	return sf.StateLocations, nil
+}
+
+// mergeState combines our locations with what's on disk now, entries are matched by the file they point at.
+// An entry only one side changed since we read it keeps that side's change, when both changed ours wins.
+// Entries we read that either side no longer has were removed and are dropped, entries we didn't read were added and are kept
+func mergeState(base, disk, local []StateKV) []StateKV {
+	baseKV, _ := byFile(base)
+	diskKV, diskOrder := byFile(disk)
+	localKV, localOrder := byFile(local)
+	merged := []StateKV{}
+	done := map[string]bool{}
+	for _, fn := range append(localOrder, diskOrder...) {
+		if done[fn] {
+			continue
+		}
+		done[fn] = true
+		l, inLocal := localKV[fn]
+		d, inDisk := diskKV[fn]
+		b, inBase := baseKV[fn]
+		switch {
+		case inBase && (!inLocal || !inDisk):
+			continue
+		case inLocal && inDisk && l == b && d != b:
+			merged = append(merged, d)
+		case inLocal:
+			merged = append(merged, l)
+		default:
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
+
+// byFile maps entries by the file they point at with the files in the order they first appear, the last entry for a file wins
+func byFile(kvs []StateKV) (map[string]StateKV, []string) {
+	m := make(map[string]StateKV, len(kvs))
+	order := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		if _, ok := m[kv.FileLocation]; !ok {
+			order = append(order, kv.FileLocation)
+		}
+		m[kv.FileLocation] = kv
+	}
+	return m, order
+}
+
 func (s *StateManager) GetStateObject(object string) interface{} {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 
 	for i := range s.StateLocations {
 		if s.StateLocations[i].Object == object {
-			dat, err := os.ReadFile(s.StateLocations[i].FileLocation)
+			dat, err := ReadObject(s.StateLocations[i].FileLocation)
 			if err != nil {
 				slog.Error("error reading the file", "error", err)
 			}
@@ -89,14 +233,18 @@ func (s *StateManager) GetStateObject(object string) interface{} {
 	return nil
 }
 
+// InitState creates an empty state file, a state file that's already there is left alone
 func InitState(filename string) error {
-	initStr := []string{}
-	m, err := json.Marshal(initStr)
+	m, err := json.Marshal(stateFile{Version: StateVersion, StateLocations: []StateKV{}})
 	if err != nil {
 		slog.Error("Error initing empty string to json", "error", err)
 		return err
 	}
-	err = os.WriteFile(filename, m, 0644)
+	_, err = Backend.PutIf(context.Background(), filename, m, "")
+	if errors.Is(err, ErrConflict) {
+		slog.Info("state file already exists", "file", filename, "backend", Backend)
+		return nil
+	}
 	if err != nil {
 		slog.Error("Error writing file", "error", err)
 		return err
@@ -104,20 +252,28 @@ func InitState(filename string) error {
 	return nil
 }
 
+// ReadState reads the state file, older layouts are migrated in memory and written in the new layout on the next SyncState
 func ReadState(filename string) (StateManager, error) {
-	f, err := os.ReadFile(filename)
+	var mu sync.Mutex
+	f, err := ReadObject(filename)
 	if err != nil {
 		slog.Error("Error reading the file", "error", err)
 	}
-	var s []StateKV
-	err = json.Unmarshal(f, &s)
+	var sf stateFile
+	m, from, err := StateMigrations.Migrate(f)
+	if err == nil {
+		if from < StateVersion {
+			slog.Info("migrated state file", "file", filename, "from", from, "to", StateVersion)
+		}
+		err = json.Unmarshal(m, &sf)
+	}
 	if err != nil {
 		slog.Error("Error reading the file", "error", err)
 	}
-	var mu sync.Mutex
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: sf.StateLocations,
+		base:           append([]StateKV{}, sf.StateLocations...),
 	}
 	return sm, err
 }
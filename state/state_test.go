@@ -2,6 +2,7 @@ package state
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
@@ -44,8 +45,8 @@ func TestUpdateState(t *testing.T) {
 	var mu sync.Mutex
 	var s []StateKV
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 	filename := "/tmp/foo"
 	obj := "boo"
@@ -56,12 +57,28 @@ func TestUpdateState(t *testing.T) {
 	}
 }
 
+func TestUpdateState_Checksum(t *testing.T) {
+	filename := t.TempDir() + "/obj.json"
+	os.WriteFile(filename, []byte("one"), 0644)
+	sm := StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("foo", filename, SnapshotType)
+	if kv := sm.StateLocations[0]; kv.Checksum != Checksum([]byte("one")) || kv.Size != 3 {
+		t.Errorf("got %s %d expected the checksum of one", kv.Checksum, kv.Size)
+	}
+
+	os.WriteFile(filename, []byte("three"), 0644)
+	sm.Rehash(filename)
+	if kv := sm.StateLocations[0]; kv.Checksum != Checksum([]byte("three")) || kv.Size != 5 {
+		t.Errorf("got %s %d after Rehash() expected the checksum of three", kv.Checksum, kv.Size)
+	}
+}
+
 func TestSyncState(t *testing.T) {
 	var mu sync.Mutex
 	var s []StateKV
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 
 	filename := "/tmp/foo"
@@ -74,13 +91,16 @@ func TestSyncState(t *testing.T) {
 	if err != nil {
 		t.Errorf("couldn't read file got %s", err)
 	}
-	var sf []StateKV
+	var sf stateFile
 	err = json.Unmarshal(f, &sf)
 	if err != nil {
 		fmt.Printf("Couldn't unmarshall the json %s", err)
 	}
-	if sf[0].Object != obj {
-		t.Errorf("got %s expected %s", sf[0].Object, obj)
+	if sf.Version != StateVersion {
+		t.Errorf("got version %d expected %d", sf.Version, StateVersion)
+	}
+	if sf.StateLocations[0].Object != obj {
+		t.Errorf("got %s expected %s", sf.StateLocations[0].Object, obj)
 	}
 
 }
@@ -113,8 +133,8 @@ func TestGetStateObject(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 
 	result := sm.GetStateObject("foo")
@@ -154,8 +174,8 @@ func TestGetStateObjectClusterSnapshot(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 
 	result := sm.GetStateObject("foo")
@@ -194,8 +214,8 @@ func TestGetStateObjectInstance(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 
 	result := sm.GetStateObject("foo")
@@ -233,8 +253,8 @@ func TestGetStateObjectKMS(t *testing.T) {
 	}
 	s = append(s, kv)
 	sm := StateManager{
-		&mu,
-		s,
+		Mu:             &mu,
+		StateLocations: s,
 	}
 
 	result := sm.GetStateObject("foo")
@@ -249,3 +269,55 @@ func TestGetStateObjectKMS(t *testing.T) {
 		t.Errorf("got %s expected foo", *res.KeyId)
 	}
 }
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	stack := func(name string) string {
+		fn := fmt.Sprintf("%s/%s.json", dir, name)
+		b, _ := EncodeDocument(KindStack, map[string]interface{}{"name": name, "restorationObjectName": "RDSCluster", "objects": []interface{}{map[string]string{"id": "cluster"}}})
+		os.WriteFile(fn, b.Bytes(), 0644)
+		return fn
+	}
+	sm := StateManager{Mu: &sync.Mutex{}}
+	sm.UpdateState("nightly", stack("nightly"), StackType)
+	sm.UpdateState("nightly", "/tmp/snap", SnapshotType)
+	// older lats only has the object name for the stack
+	sm.StateLocations = append(sm.StateLocations, StateKV{Object: "weekly", FileLocation: "/tmp/weekly", ObjectType: StackType})
+	newer := stack("nightly-2")
+
+	tests := []struct {
+		name    string
+		ot      string
+		lookup  string
+		want    []string
+		missing bool
+	}{
+		{"stack", StackType, "nightly", []string{dir + "/nightly.json"}, false},
+		{"type", SnapshotType, "nightly", []string{"/tmp/snap"}, false},
+		{"legacy", StackType, "weekly", []string{"/tmp/weekly"}, false},
+		{"missing", StackType, "monthly", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs, err := sm.Lookup(tt.ot, tt.lookup)
+			var nf *NotFoundError
+			if tt.missing != errors.As(err, &nf) {
+				t.Fatalf("Lookup() error = %v, missing %v", err, tt.missing)
+			}
+			got := []string(nil)
+			for _, kv := range kvs {
+				got = append(got, kv.FileLocation)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Lookup() = %v want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the index is rebuilt when a stack is added
+	sm.UpdateState("nightly", newer, StackType)
+	kv, err := sm.FindStack("nightly-2")
+	if err != nil || kv.FileLocation != newer || kv.Stack.RestorationType != "RDSCluster" || kv.Stack.Objects != 1 {
+		t.Errorf("FindStack() = %+v, %v want %s", kv, err, newer)
+	}
+}
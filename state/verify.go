@@ -0,0 +1,55 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Checksum is the sha256 of a file, it's what the state index and stacks record for each file
+func Checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// describeFile reads the file of kv for its checksum, size and stack info, a file that can't be read has none of them
+func describeFile(kv *StateKV) {
+	kv.Checksum, kv.Size, kv.Stack, kv.Operation = "", 0, StackInfo{}, OperationInfo{}
+	dat, err := ReadObject(kv.FileLocation)
+	if err != nil {
+		return
+	}
+	kv.Checksum, kv.Size = Checksum(dat), int64(len(dat))
+	switch kv.ObjectType {
+	case StackType:
+		kv.Stack = readStackInfo(dat)
+	case OperationType:
+		kv.Operation = readOperationInfo(dat)
+	}
+}
+
+// ErrNoChecksum is returned by VerifyFile when there's no checksum to check against, the file was still read
+var ErrNoChecksum = errors.New("no checksum recorded")
+
+// VerifyFile reads a file and checks it against the checksum and size recorded for it.
+// It returns the contents so callers can check it decodes, with ErrNoChecksum when there was nothing to check
+func VerifyFile(filename string, checksum string, size int64) ([]byte, error) {
+	dat, err := ReadObject(filename)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%s is missing", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if checksum == "" {
+		return dat, ErrNoChecksum
+	}
+	if int64(len(dat)) != size {
+		return nil, fmt.Errorf("%s is %d bytes, it was %d", filename, len(dat), size)
+	}
+	if got := Checksum(dat); got != checksum {
+		return nil, fmt.Errorf("%s has checksum %s, it was %s", filename, got, checksum)
+	}
+	return dat, nil
+}